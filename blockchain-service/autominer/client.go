@@ -0,0 +1,66 @@
+package autominer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"blockchain/blockchain-service/blockchain"
+)
+
+// Client talks to the /blocktemplate and /submitblock endpoints of a node.
+type Client struct {
+	gateway string
+	client  *http.Client
+}
+
+func NewClient(gateway string) *Client {
+	return &Client{
+		gateway: strings.TrimSuffix(gateway, "/"),
+		client:  &http.Client{},
+	}
+}
+
+func (c *Client) BlockTemplate() (*blockchain.BlockTemplate, error) {
+	resp, err := c.client.Get(c.gateway + "/blocktemplate")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError(resp)
+	}
+
+	var template blockchain.BlockTemplate
+	if err := json.NewDecoder(resp.Body).Decode(&template); err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+func (c *Client) SubmitBlock(b *blockchain.Block) error {
+	body, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.client.Post(c.gateway+"/submitblock", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+	return nil
+}
+
+func responseError(resp *http.Response) error {
+	b, _ := io.ReadAll(resp.Body)
+	return fmt.Errorf("request failed - status: %s, body: %s", resp.Status, strings.TrimSpace(string(b)))
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"time"
+
+	"blockchain/blockchain-service/autominer"
+)
+
+func init() {
+	log.SetPrefix("Miner: ")
+}
+
+func main() {
+	gateway := flag.String("gateway", "http://127.0.0.1:5000", "Blockchain server to mine for")
+	interval := flag.Duration("interval", time.Second*10, "How often to ask for a new block template")
+	workers := flag.Int("workers", 0, "Number of proof of work goroutines, defaults to the number of CPUs")
+	flag.Parse()
+
+	am := autominer.New(*interval, *workers, autominer.NewClient(*gateway))
+	am.Start(context.Background())
+}
@@ -4,55 +4,62 @@ import (
 	"context"
 	"log"
 	"time"
+
+	"blockchain/blockchain-service/blockchain"
 )
 
+// blockchainer is the block template API. It is served by the node itself and
+// by Client for miners running in their own process.
 type blockchainer interface {
-	Mine() (int64, bool, error)
+	BlockTemplate() (*blockchain.BlockTemplate, error)
+	SubmitBlock(b *blockchain.Block) error
 }
 
 type miner struct {
 	tickerTime time.Duration
+	engine     *blockchain.MiningEngine
 	blockchainer
 }
 
-func New(d time.Duration, b blockchainer) miner {
+func New(d time.Duration, workers int, b blockchainer) miner {
 	return miner{
 		tickerTime:   d,
+		engine:       blockchain.NewMiningEngine(workers),
 		blockchainer: b,
 	}
 }
 
 func (c *miner) Start(ctx context.Context) {
 	t := time.NewTicker(c.tickerTime)
-	run := true
-	go func(c context.Context) {
-		for {
-			select {
-			case <-c.Done():
-				run = false
-				return
-			}
-		}
-	}(ctx)
+	defer t.Stop()
 	for {
 		select {
 		case <-t.C:
-			if run {
-				c.do()
-			}
+			c.do(ctx)
 		case <-ctx.Done():
 			return
 		}
 	}
 }
 
-func (c *miner) do() {
-	timestamp, mined, err := c.Mine()
+func (c *miner) do(ctx context.Context) {
+	template, err := c.BlockTemplate()
+	if err != nil {
+		log.Printf("failed to get block template with err: %s", err)
+		return
+	}
+	if template.Empty() {
+		return
+	}
+
+	b, result, err := template.Solve(ctx, c.engine)
 	if err != nil {
 		log.Printf("failed to autoMine with err: %s", err)
 		return
 	}
-	if mined {
-		log.Printf("automine sucess block timestamp: %d", timestamp)
+	if err := c.SubmitBlock(b); err != nil {
+		log.Printf("failed to submit block with err: %s", err)
+		return
 	}
+	log.Printf("automine sucess block height: %d, nonce: %d, %.0f H/s", template.Height, result.Nonce, result.HashRate())
 }
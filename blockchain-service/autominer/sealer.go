@@ -0,0 +1,48 @@
+package autominer
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"blockchain/blockchain-service/blockchain"
+)
+
+// sealingNode seals the pending transactions into a block with its own
+// consensus engine.
+type sealingNode interface {
+	Mine() (int64, bool, error)
+}
+
+// sealer makes the node seal a block on a timer. It is used instead of the
+// miner under proof of authority and proof of stake, where blocks are signed
+// by the node rather than solved from a template.
+type sealer struct {
+	tickerTime time.Duration
+	sealingNode
+}
+
+func NewSealer(d time.Duration, n sealingNode) sealer {
+	return sealer{
+		tickerTime:  d,
+		sealingNode: n,
+	}
+}
+
+func (s *sealer) Start(ctx context.Context) {
+	t := time.NewTicker(s.tickerTime)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			// Under proof of stake most blocks are drawn for other
+			// validators.
+			if _, _, err := s.Mine(); err != nil && !errors.Is(err, blockchain.ErrNotSelected) {
+				log.Printf("failed to seal block with err: %s", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
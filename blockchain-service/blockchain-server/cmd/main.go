@@ -11,7 +11,11 @@ import (
 
 	"blockchain/blockchain-service/autominer"
 	"blockchain/blockchain-service/blockchain-server"
+	"blockchain/blockchain-service/finalizer"
+	"blockchain/blockchain-service/mempool"
 	syncer "blockchain/blockchain-service/neighbor-nodes-syncer"
+	"blockchain/blockchain-service/network-params"
+	"blockchain/blockchain-service/pool"
 	"blockchain/foundation/cryptography"
 )
 
@@ -20,22 +24,198 @@ func init() {
 }
 
 func main() {
-	p := flag.Uint("port", 5000, "TCP Port Number for Blockchain server")
+	p := flag.Uint("port", 0, "TCP Port Number for Blockchain server, defaults to the network port")
 	//ami := flag.Int("automineInterval", 10, "Automine interval in minutes")
 	//nsi := flag.Int("neighborNodeSyncInterval", 10, "Neighbor node sync interval in seconds")
-	bcAddress := flag.String("bcAddress", "0xAF909ba846284732E2a4Ec7bE12574CA937AAdd4", "Blockchain address")
+	bcAddress := flag.String("bcAddress", "", "Blockchain address the node mines to, required unless a signer or pool key gives it")
+	networkName := flag.String("network", "mainnet", "Network to use: mainnet, testnet or regtest")
+	ledger := flag.String("ledger", "", "Ledger model: account or utxo, defaults to the one of the network")
+	genesis := flag.String("genesis", "", "Genesis spec file of the chain to run, on top of the network ports and address versions")
+	consensus := flag.String("consensus", "", "Consensus engine: pow, poa or pos, defaults to the one of the network or genesis spec")
+	assumeValid := flag.String("assumeValid", "", "Hash of a block whose ancestors are synced without checking their signatures")
+	maxReorgDepth := flag.Int("maxReorgDepth", -1, "Most blocks a reorg may disconnect, 0 for no limit, defaults to the one of the network")
+	miningWorkers := flag.Int("miningWorkers", 0, "Number of proof of work goroutines, defaults to the number of CPUs")
+	mempoolMaxSize := flag.Int("mempoolMaxSize", mempool.DefaultConfig().MaxSize, "Maximum size in bytes of the pending transactions")
+	mempoolExpiry := flag.Duration("mempoolExpiry", mempool.DefaultConfig().Expiry, "How long a transaction stays pending before it is dropped")
+	poolPort := flag.Uint("poolPort", 0, "TCP Port Number for the mining pool, the pool is disabled when 0")
+	poolPrivateKey := flag.String("poolPrivateKey", "", "Private key the pool pays rewards with, the node mines to its address")
+	poolPublicKey := flag.String("poolPublicKey", "", "Public key matching poolPrivateKey")
+	poolShareDifficulty := flag.Int("poolShareDifficulty", 1, "Leading zeros required for a pool share")
+	poolScheme := flag.String("poolScheme", "pplns", "Pool payout scheme: pplns or proportional")
+	poolWindow := flag.Int("poolWindow", 1000, "Number of shares paid by PPLNS")
+	poolFee := flag.Float64("poolFee", 0, "Fraction of each block reward kept by the pool")
+	signerPrivateKey := flag.String("signerPrivateKey", "", "Private key the node seals blocks with on a proof of authority or proof of stake chain, the node is paid to its address")
+	signerPublicKey := flag.String("signerPublicKey", "", "Public key matching signerPrivateKey")
+	finalityPrivateKey := flag.String("finalityPrivateKey", "", "Private key the node votes with as one of the finality validators of the genesis spec")
+	finalityPublicKey := flag.String("finalityPublicKey", "", "Public key matching finalityPrivateKey")
+	roundTimeout := flag.Duration("roundTimeout", blockchain.DefaultRoundTimeout, "How long a finality round waits for a commit")
 	flag.Parse()
 
-	bc, err := blockchain.NewBlockchain(*bcAddress)
+	params, err := network_params.ByName(*networkName)
+	if err != nil {
+		log.Fatalf("Failed to select network with err: %s", err)
+	}
+	if *ledger != "" {
+		l, err := network_params.LedgerFromString(*ledger)
+		if err != nil {
+			log.Fatalf("Failed to select ledger with err: %s", err)
+		}
+		custom := *params
+		custom.Ledger = l
+		params = &custom
+	}
+	if *genesis != "" {
+		spec, err := network_params.LoadGenesisSpec(*genesis)
+		if err != nil {
+			log.Fatalf("Failed to load genesis spec with err: %s", err)
+		}
+		if params, err = spec.Apply(params); err != nil {
+			log.Fatalf("Failed to apply genesis spec with err: %s", err)
+		}
+	}
+	if *consensus != "" {
+		c, err := network_params.ConsensusEngineFromString(*consensus)
+		if err != nil {
+			log.Fatalf("Failed to select consensus engine with err: %s", err)
+		}
+		custom := *params
+		custom.Consensus = c
+		params = &custom
+	}
+	if *assumeValid != "" || *maxReorgDepth >= 0 {
+		custom := *params
+		if *assumeValid != "" {
+			if custom.AssumeValid, err = network_params.ParseHash(*assumeValid); err != nil {
+				log.Fatalf("Failed to parse assumeValid with err: %s", err)
+			}
+		}
+		if *maxReorgDepth >= 0 {
+			custom.MaxReorgDepth = *maxReorgDepth
+		}
+		params = &custom
+	}
+	if *p == 0 {
+		*p = uint(params.DefaultBlockchainPort)
+	}
+
+	var poolKey cryptography.PrivateKey
+	if *poolPort != 0 {
+		if params.Consensus != network_params.ProofOfWork {
+			log.Fatalf("The mining pool solves proof of work and can not run on a %s chain", params.Consensus)
+		}
+		if params.UTXO() {
+			log.Fatalf("The mining pool pays out of an account and needs the account ledger")
+		}
+		publicKey, err := cryptography.PublicKeyFromString(*poolPublicKey)
+		if err != nil {
+			log.Fatalf("Failed to parse pool public key with err: %s", err)
+		}
+		poolKey, err = cryptography.PrivateKeyFromString(*poolPrivateKey, publicKey)
+		if err != nil {
+			log.Fatalf("Failed to parse pool private key with err: %s", err)
+		}
+		*bcAddress = params.GenerateBlockchainAddress(publicKey)
+	}
+
+	sealed := params.Consensus == network_params.ProofOfAuthority || params.Consensus == network_params.ProofOfStake
+	var signerKey cryptography.PrivateKey
+	if sealed && *signerPrivateKey != "" {
+		publicKey, err := cryptography.PublicKeyFromString(*signerPublicKey)
+		if err != nil {
+			log.Fatalf("Failed to parse signer public key with err: %s", err)
+		}
+		signerKey, err = cryptography.PrivateKeyFromString(*signerPrivateKey, publicKey)
+		if err != nil {
+			log.Fatalf("Failed to parse signer private key with err: %s", err)
+		}
+		*bcAddress = params.GenerateBlockchainAddress(publicKey)
+	}
+
+	if *bcAddress == "" {
+		log.Fatalf("A blockchain address to mine to is required: set bcAddress, or the signer or pool keys")
+	}
+	if err := cryptography.ValidateBlockchainAddress(*bcAddress, params); err != nil {
+		log.Fatalf("Failed to validate bcAddress %s with err: %s", *bcAddress, err)
+	}
+
+	bc, err := blockchain.NewBlockchain(*bcAddress, params)
 	if err != nil {
 		log.Fatalf("Failed to instantiate Blockchain with err: %s", err)
 	}
-	managingSrv := blockchain_server.New(uint16(*p), bc, cryptography.GenerateBlockchainAddress)
+	if signerKey != nil {
+		switch engine := bc.Consensus().(type) {
+		case *blockchain.ProofOfAuthority:
+			engine.SetSigner(signerKey)
+		case *blockchain.ProofOfStake:
+			engine.SetValidator(signerKey)
+		}
+	}
+	if len(params.FinalityValidators) > 0 {
+		bc.SetRoundTimeout(*roundTimeout)
+		if *finalityPrivateKey != "" {
+			publicKey, err := cryptography.PublicKeyFromString(*finalityPublicKey)
+			if err != nil {
+				log.Fatalf("Failed to parse finality public key with err: %s", err)
+			}
+			finalityKey, err := cryptography.PrivateKeyFromString(*finalityPrivateKey, publicKey)
+			if err != nil {
+				log.Fatalf("Failed to parse finality private key with err: %s", err)
+			}
+			if err := bc.SetFinalityKey(finalityKey); err != nil {
+				log.Fatalf("Failed to set finality key with err: %s", err)
+			}
+		}
+	}
+	bc.SetMiningWorkers(*miningWorkers)
+	mempoolConfig := mempool.DefaultConfig()
+	mempoolConfig.MaxSize = *mempoolMaxSize
+	mempoolConfig.Expiry = *mempoolExpiry
+	bc.SetMempoolConfig(mempoolConfig)
+	bc.OnReorg(func(e *blockchain.ReorgEvent) {
+		log.Printf("Reorg at height %d: %d blocks disconnected, %d connected, %d transactions back in the pool",
+			e.Fork, len(e.Disconnected), len(e.Connected), len(e.Orphaned))
+	})
+	managingSrv := blockchain_server.New(uint16(*p), params, bc, params.GenerateBlockchainAddress)
 
 	//am := autominer.New(time.Minute*time.Duration(*i), bc)
-	am := autominer.New(time.Second*10, managingSrv)
 	amCtx := context.Background()
-	go am.Start(amCtx)
+	if sealed {
+		if signerKey != nil {
+			sealer := autominer.NewSealer(time.Second*10, managingSrv)
+			go sealer.Start(amCtx)
+		}
+	} else {
+		am := autominer.New(time.Second*10, *miningWorkers, managingSrv)
+		go am.Start(amCtx)
+	}
+
+	if *poolPort != 0 {
+		scheme, err := pool.SchemeFromString(*poolScheme)
+		if err != nil {
+			log.Fatalf("Failed to select pool scheme with err: %s", err)
+		}
+		mp, err := pool.New(managingSrv, pool.NewKeyPayer(poolKey, *bcAddress, bc), params, pool.Config{
+			ShareDifficulty: *poolShareDifficulty,
+			Scheme:          scheme,
+			Window:          *poolWindow,
+			Fee:             float32(*poolFee),
+		})
+		if err != nil {
+			log.Fatalf("Failed to instantiate mining pool with err: %s", err)
+		}
+		poolCtx := context.Background()
+		go mp.Start(poolCtx)
+		go func() {
+			if err := mp.ListenAndServe(poolCtx, "0.0.0.0:"+strconv.Itoa(int(*poolPort))); err != nil {
+				log.Fatalf("Failed to serve mining pool with err: %s", err)
+			}
+		}()
+	}
+
+	if len(params.FinalityValidators) > 0 {
+		fz := finalizer.New(time.Second*2, managingSrv)
+		go fz.Start(context.Background())
+	}
 
 	ns := syncer.New(time.Second*10, managingSrv)
 	nsCtx := context.Background()
@@ -45,9 +225,32 @@ func main() {
 
 	http.HandleFunc("/chain", transport.HandleGetChain)
 	http.HandleFunc("/transactions", transport.HandleTransactions)
+	http.HandleFunc("/transactions/", transport.HandleTransactionProof)
+	http.HandleFunc("/headers", transport.HandleHeaders)
 	http.HandleFunc("/mining", transport.HandleMining)
 	http.HandleFunc("/balance", transport.HandleBalance)
+	http.HandleFunc("/balance/proof", transport.HandleBalanceProof)
+	http.HandleFunc("/utxos", transport.HandleUTXOs)
 	http.HandleFunc("/consensus", transport.HandleConsensus)
+	http.HandleFunc("/fees/estimate", transport.HandleFeeEstimate)
+	http.HandleFunc("/supply", transport.HandleSupply)
+	http.HandleFunc("/blocktemplate", transport.HandleBlockTemplate)
+	http.HandleFunc("/submitblock", transport.HandleSubmitBlock)
+	http.HandleFunc("/blocks", transport.HandleBlocks)
+	http.HandleFunc("/blocks/", transport.HandleBlocks)
+	http.HandleFunc("/genesis", transport.HandleGenesis)
+	http.HandleFunc("/signers", transport.HandleSigners)
+	http.HandleFunc("/validators", transport.HandleValidators)
+	http.HandleFunc("/contracts", transport.HandleContracts)
+	http.HandleFunc("/contracts/", transport.HandleContracts)
+	http.HandleFunc("/receipts/", transport.HandleReceipt)
+	http.HandleFunc("/assets", transport.HandleAssets)
+	http.HandleFunc("/assets/", transport.HandleAssets)
+	http.HandleFunc("/nfts", transport.HandleNFTs)
+	http.HandleFunc("/nfts/", transport.HandleNFTs)
+	http.HandleFunc("/addresses/", transport.HandleAddresses)
+	http.HandleFunc("/finality", transport.HandleFinality)
+	http.HandleFunc("/finality/votes", transport.HandleFinalityVotes)
 
 	if err := http.ListenAndServe("0.0.0.0:"+strconv.Itoa(int(*p)), nil); err != nil {
 		log.Fatalf("Failed ListenAndServe with err: %s", err)
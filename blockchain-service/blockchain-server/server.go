@@ -2,8 +2,9 @@ package blockchain_server
 
 import (
 	"bytes"
-	"crypto/ecdsa"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -11,44 +12,82 @@ import (
 	"sync"
 
 	"blockchain/blockchain-service/blockchain"
+	"blockchain/blockchain-service/network-params"
 	"blockchain/foundation/cryptography"
 	"blockchain/foundation/network"
 )
 
 const (
-	BLOCKCHAIN_PORT_RANGE_START = 5000
-	BLOCKCHAIN_PORT_RANGE_END   = 5003
-	NEIGHBOR_IP_RANGE_START     = 0
-	NEIGHBOR_IP_RANGE_END       = 1
+	NEIGHBOR_IP_RANGE_START = 0
+	NEIGHBOR_IP_RANGE_END   = 1
 )
 
 type blockchainer interface {
-	SetChain(c []*blockchain.Block)
+	SetChain(c []*blockchain.Block) error
 	Chain() []*blockchain.Block
 	TransactionPool() []*blockchain.Transaction
-	TruncateTransactionPool() int
-	CreateTransaction(sender, recipient string, value float32, pKey *ecdsa.PublicKey, s *cryptography.Signature) error
-	AddTransaction(sender, recipient string, value float32, pKey *ecdsa.PublicKey, s *cryptography.Signature) error
+	PruneTransactionPool() int
+	CreateTransaction(sender, recipient string, value, fee float32, nonce uint64, pKey cryptography.PublicKey, s *cryptography.Signature) error
+	AddTransaction(sender, recipient string, value, fee float32, nonce uint64, pKey cryptography.PublicKey, s *cryptography.Signature) error
+	CreateMultisigTransaction(sender, recipient string, value, fee float32, nonce uint64, threshold int, pKeys []cryptography.PublicKey, sigs []*cryptography.Signature) error
+	AddMultisigTransaction(sender, recipient string, value, fee float32, nonce uint64, threshold int, pKeys []cryptography.PublicKey, sigs []*cryptography.Signature) error
+	CreateUTXOTransaction(sender string, inputs []blockchain.OutPoint, outputs []blockchain.TxOutput, fee float32, threshold int, pKeys []cryptography.PublicKey, sigs []*cryptography.Signature) error
+	AddUTXOTransaction(sender string, inputs []blockchain.OutPoint, outputs []blockchain.TxOutput, fee float32, threshold int, pKeys []cryptography.PublicKey, sigs []*cryptography.Signature) error
 	Mine() (int64, bool, error)
+	BlockTemplate() (*blockchain.BlockTemplate, error)
+	SubmitBlock(b *blockchain.Block) error
+	ProcessBlock(b *blockchain.Block) error
+	BlockStatus(hash [32]byte) (*blockchain.BlockStatus, bool)
+	FinalityStatus() (*blockchain.FinalityStatus, error)
+	AddFinalityVote(v *blockchain.FinalityVote) error
+	FinalityStep() ([]*blockchain.FinalityVote, error)
+	ApplyCommit(c *blockchain.Commit) error
+	Genesis() *blockchain.Block
+	Signers() ([]string, error)
+	ProposeSigner(address string, authorize bool) error
+	Validators() ([]blockchain.Validator, string, error)
+	AddStakeTransaction(kind blockchain.TxKind, sender string, value, fee float32, nonce uint64, pKey cryptography.PublicKey, s *cryptography.Signature) error
+	AddEvidenceTransaction(sender string, evidence *blockchain.DoubleSignEvidence, fee float32, nonce uint64, pKey cryptography.PublicKey, s *cryptography.Signature) error
+	AddContractTransaction(kind blockchain.TxKind, sender, contract string, data []byte, gas uint64, fee float32, nonce uint64, pKey cryptography.PublicKey, s *cryptography.Signature) error
+	Contract(address string) (*blockchain.ContractInfo, error)
+	CallContract(address, caller string, input []byte) (*blockchain.Receipt, error)
+	Receipt(id string) (*blockchain.Receipt, error)
+	AddIssueTransaction(sender, symbol string, decimals uint8, supply uint64, mintAuthority string, fee float32, nonce uint64, pKey cryptography.PublicKey, s *cryptography.Signature) (string, error)
+	AddAssetTransaction(kind blockchain.TxKind, sender, recipient, asset string, amount uint64, fee float32, nonce uint64, pKey cryptography.PublicKey, s *cryptography.Signature) error
+	Asset(id string) (*blockchain.Asset, error)
+	AssetBalances(address string) []blockchain.AssetBalance
+	AddNFTTransaction(kind blockchain.TxKind, sender, recipient, collection, token, metadata string, fee float32, nonce uint64, pKey cryptography.PublicKey, s *cryptography.Signature) error
+	NFT(collection, token string) (*blockchain.NFT, error)
+	NFTs(address string) []*blockchain.NFT
+	HashRate() float64
+	EstimateFee(blocks int) *blockchain.FeeEstimate
+	Supply() *blockchain.Supply
 	CalculateBalance(address string) float32
+	NextNonce(address string) uint64
+	UTXOs(address string) []*blockchain.UTXO
+	BalanceProof(address string, height int) (*blockchain.BalanceProof, error)
+	TransactionProof(id string) (*blockchain.MerkleProof, error)
+	Headers(from int) []*blockchain.BlockHeader
 	ValidChain(chain []*blockchain.Block) (bool, error)
 	Print()
 	MarshalJSON() ([]byte, error)
 }
 
 type Server struct {
-	port uint16
-	mux  sync.Mutex
-	bc   blockchainer
+	port   uint16
+	params *network_params.Params
+	mux    sync.Mutex
+	bc     blockchainer
 
 	neighbors       []string
 	muxNeighbors    sync.Mutex
-	generateAddress func(pKey *ecdsa.PublicKey) string
+	generateAddress func(pKey cryptography.PublicKey) string
 }
 
-func New(port uint16, bc blockchainer, generateAddressFunc func(pKey *ecdsa.PublicKey) string) *Server {
+func New(port uint16, params *network_params.Params, bc blockchainer, generateAddressFunc func(pKey cryptography.PublicKey) string) *Server {
 	s := Server{
 		port:            port,
+		params:          params,
 		bc:              bc,
 		muxNeighbors:    sync.Mutex{},
 		generateAddress: generateAddressFunc,
@@ -79,40 +118,448 @@ func (s *Server) Mine() (int64, bool, error) {
 	}
 
 	if mined {
-		updatedCount, err := s.DeleteNeighborsPools()
-		if err != nil {
-			log.Printf("failed to DeleteNeighborsPools with err: %s", err)
+		s.announceBlock()
+	}
+
+	return t, mined, nil
+}
+
+func (s *Server) BlockTemplate() (*blockchain.BlockTemplate, error) {
+	return s.bc.BlockTemplate()
+}
+
+func (s *Server) SubmitBlock(b *blockchain.Block) error {
+	if err := s.bc.SubmitBlock(b); err != nil {
+		return err
+	}
+	s.announceBlock()
+	return nil
+}
+
+// ReceiveBlock processes a block announced by a peer. The parents of an orphan
+// block are fetched from the neighbors until it connects to a known block.
+func (s *Server) ReceiveBlock(b *blockchain.Block) error {
+	err := s.bc.ProcessBlock(b)
+	for i := 0; i < blockchain.DefaultMaxOrphans; i++ {
+		var orphan *blockchain.OrphanBlockError
+		if !errors.As(err, &orphan) {
+			break
+		}
+		parent, ferr := s.fetchBlock(orphan.Parent)
+		if ferr != nil {
+			return fmt.Errorf("%w, failed to fetch it with err: %s", err, ferr)
+		}
+		err = s.bc.ProcessBlock(parent)
+	}
+	if errors.Is(err, blockchain.ErrKnownBlock) {
+		return nil
+	}
+	return err
+}
+
+// Block returns the block with the given hash with whether it is final.
+func (s *Server) Block(hash string) (*blockchain.BlockStatus, error) {
+	h, err := hex.DecodeString(hash)
+	if err != nil || len(h) != 32 {
+		return nil, fmt.Errorf("%w: invalid hash %q", blockchain.ErrBlockNotFound, hash)
+	}
+	var key [32]byte
+	copy(key[:], h)
+	b, ok := s.bc.BlockStatus(key)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", blockchain.ErrBlockNotFound, hash)
+	}
+	return b, nil
+}
+
+// Finality returns the last final block and the round the finality
+// validators vote in.
+func (s *Server) Finality() (*blockchain.FinalityStatus, error) {
+	return s.bc.FinalityStatus()
+}
+
+// ReceiveFinalityVote takes a vote from a peer. A vote new to the node is
+// passed on to the neighbors with the votes of the node it led to.
+func (s *Server) ReceiveFinalityVote(v *blockchain.FinalityVote) error {
+	if err := s.bc.AddFinalityVote(v); err != nil {
+		if errors.Is(err, blockchain.ErrKnownVote) {
+			return nil
 		}
-		log.Printf("updated %d nneighbors", updatedCount)
+		return err
+	}
+	votes, err := s.bc.FinalityStep()
+	if err != nil {
+		return err
+	}
+	go s.broadcastVotes(append([]*blockchain.FinalityVote{v}, votes...))
+	return nil
+}
+
+// Finalize casts the votes of the node that are due and sends them to the
+// neighbors. It returns the height of the last final block.
+func (s *Server) Finalize() (int, error) {
+	votes, err := s.bc.FinalityStep()
+	if err != nil {
+		return 0, err
+	}
+	s.broadcastVotes(votes)
+	status, err := s.bc.FinalityStatus()
+	if err != nil {
+		return 0, err
+	}
+	return status.Height, nil
+}
 
-		var errsStr []string
+func (s *Server) broadcastVotes(votes []*blockchain.FinalityVote) {
+	for _, v := range votes {
+		b, err := json.Marshal(v)
+		if err != nil {
+			log.Printf("failed to marshal finality vote with err: %s", err)
+			return
+		}
 		for _, n := range s.neighbors {
-			endpoint := fmt.Sprintf("http://%s/consensus", n)
-			client := &http.Client{}
-			req, err := http.NewRequest(http.MethodPut, endpoint, nil)
+			endpoint := fmt.Sprintf("http://%s/finality/votes", n)
+			resp, err := http.Post(endpoint, "application/json", bytes.NewBuffer(b))
 			if err != nil {
-				errsStr = append(errsStr, err.Error())
+				log.Printf("failed to send finality vote to %s with err: %s", n, err)
 				continue
 			}
-			resp, err := client.Do(req)
-			if err != nil {
-				errsStr = append(errsStr, err.Error())
-				continue
+			resp.Body.Close()
+			if resp.StatusCode >= 400 {
+				log.Printf("failed to send finality vote to %s - status: %s", n, resp.Status)
 			}
-			if resp.StatusCode > 400 {
-				errsStr = append(errsStr, fmt.Sprintf("Request failed - status: %s, body: %v", resp.Status, resp.Body))
-				continue
+		}
+	}
+}
+
+// syncFinality applies the last commit of the neighbors, fetching its block
+// when the node does not have it.
+func (s *Server) syncFinality() error {
+	if _, err := s.bc.FinalityStatus(); errors.Is(err, blockchain.ErrNoFinality) {
+		return nil
+	}
+	var errsStr []string
+	for _, n := range s.neighbors {
+		endpoint := fmt.Sprintf("http://%s/finality", n)
+		resp, err := http.Get(endpoint)
+		if err != nil {
+			errsStr = append(errsStr, err.Error())
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			errsStr = append(errsStr, fmt.Sprintf("failed to Get url - %v, status: %s", endpoint, resp.Status))
+			continue
+		}
+		var status blockchain.FinalityStatus
+		err = json.NewDecoder(resp.Body).Decode(&status)
+		resp.Body.Close()
+		if err != nil {
+			errsStr = append(errsStr, err.Error())
+			continue
+		}
+		if status.Commit == nil {
+			continue
+		}
+		err = s.bc.ApplyCommit(status.Commit)
+		if errors.Is(err, blockchain.ErrBlockNotFound) {
+			if err = s.receiveBlockByHash(status.Commit.BlockHash); err == nil {
+				err = s.bc.ApplyCommit(status.Commit)
 			}
 		}
+		if err != nil {
+			errsStr = append(errsStr, fmt.Sprintf("commit from %s: %s", n, err))
+		}
+	}
+	if errsStr != nil {
+		return fmt.Errorf(strings.Join(errsStr, "\n"))
+	}
+	return nil
+}
+
+// receiveBlockByHash fetches the block with the given hash from the
+// neighbors and processes it with its missing parents.
+func (s *Server) receiveBlockByHash(hash [32]byte) error {
+	b, err := s.fetchBlock(hash)
+	if err != nil {
+		return err
+	}
+	return s.ReceiveBlock(b)
+}
+
+// Genesis identifies the chain of the node for its peers.
+func (s *Server) Genesis() (*GenesisInfo, error) {
+	hash, err := s.bc.Genesis().Hash()
+	if err != nil {
+		return nil, err
+	}
+	return &GenesisInfo{
+		ChainID: s.params.ChainID,
+		Hash:    fmt.Sprintf("%x", hash),
+	}, nil
+}
+
+// Signers are the authorities of a proof of authority chain.
+func (s *Server) Signers() ([]string, error) {
+	return s.bc.Signers()
+}
+
+// ProposeSigner makes the node vote for adding or removing a signer in the
+// blocks it seals.
+func (s *Server) ProposeSigner(address string, authorize bool) error {
+	return s.bc.ProposeSigner(address, authorize)
+}
+
+// Validators are the stakers of a proof of stake chain with the one drawn for
+// the next block.
+func (s *Server) Validators() ([]blockchain.Validator, string, error) {
+	return s.bc.Validators()
+}
+
+// AddStakingTransaction stakes or unstakes value of the sender, or reports the
+// double sign in evidence when kind is evidence.
+func (s *Server) AddStakingTransaction(kind, senderPublicKey, senderBlockchainAddress, signature string, value, fee float32, nonce uint64, evidence *blockchain.DoubleSignEvidence) error {
+	k, err := blockchain.TxKindFromString(kind)
+	if err != nil {
+		return fmt.Errorf("%w: %s", blockchain.ErrLedger, err)
+	}
+	publicKey, err := cryptography.PublicKeyFromString(senderPublicKey)
+	if err != nil {
+		return err
+	}
+	sign, err := cryptography.ParseSignature(signature, publicKey.KeyType())
+	if err != nil {
+		return err
+	}
+
+	if k == blockchain.EvidenceTx {
+		return s.bc.AddEvidenceTransaction(senderBlockchainAddress, evidence, fee, nonce, publicKey, sign)
+	}
+	return s.bc.AddStakeTransaction(k, senderBlockchainAddress, value, fee, nonce, publicKey, sign)
+}
+
+// AddContractTransaction deploys the code in data, or calls contract with
+// data as input when kind is call. data is in hex. A deploy without a
+// contract goes to the address derived from the sender and nonce. The address
+// of the contract is returned.
+func (s *Server) AddContractTransaction(kind, senderPublicKey, senderBlockchainAddress, contract, signature, data string, gas uint64, fee float32, nonce uint64) (string, error) {
+	k, err := blockchain.TxKindFromString(kind)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", blockchain.ErrLedger, err)
+	}
+	input, err := hex.DecodeString(data)
+	if err != nil {
+		return "", fmt.Errorf("%w: data: %s", blockchain.ErrLedger, err)
+	}
+	publicKey, err := cryptography.PublicKeyFromString(senderPublicKey)
+	if err != nil {
+		return "", err
+	}
+	sign, err := cryptography.ParseSignature(signature, publicKey.KeyType())
+	if err != nil {
+		return "", err
+	}
+	if k == blockchain.DeployTx && contract == "" {
+		if contract, err = cryptography.GenerateContractAddress(senderBlockchainAddress, nonce, s.params); err != nil {
+			return "", &blockchain.InvalidAddressError{Address: senderBlockchainAddress, Err: err}
+		}
 	}
 
-	return t, mined, nil
+	if err := s.bc.AddContractTransaction(k, senderBlockchainAddress, contract, input, gas, fee, nonce, publicKey, sign); err != nil {
+		return "", err
+	}
+	return contract, nil
+}
+
+// Contract returns the contract at address with its code and storage.
+func (s *Server) Contract(address string) (*blockchain.ContractInfo, error) {
+	return s.bc.Contract(address)
+}
+
+// CallContract runs the contract at address with the hex input without
+// changing it.
+func (s *Server) CallContract(address, caller, input string) (*blockchain.Receipt, error) {
+	b, err := hex.DecodeString(input)
+	if err != nil {
+		return nil, fmt.Errorf("%w: input: %s", blockchain.ErrLedger, err)
+	}
+	return s.bc.CallContract(address, caller, b)
+}
+
+// Receipt returns the receipt of the contract transaction id.
+func (s *Server) Receipt(id string) (*blockchain.Receipt, error) {
+	return s.bc.Receipt(id)
+}
+
+// IssueAsset issues the asset symbol with supply base units and returns its
+// ID.
+func (s *Server) IssueAsset(senderPublicKey, senderBlockchainAddress, signature, symbol string, decimals uint8, supply uint64, mintAuthority string, fee float32, nonce uint64) (string, error) {
+	publicKey, err := cryptography.PublicKeyFromString(senderPublicKey)
+	if err != nil {
+		return "", err
+	}
+	sign, err := cryptography.ParseSignature(signature, publicKey.KeyType())
+	if err != nil {
+		return "", err
+	}
+	return s.bc.AddIssueTransaction(senderBlockchainAddress, symbol, decimals, supply, mintAuthority, fee, nonce, publicKey, sign)
+}
+
+// AddAssetTransaction transfers amount of asset to the recipient, or mints it
+// there when kind is mint.
+func (s *Server) AddAssetTransaction(kind, senderPublicKey, senderBlockchainAddress, recipientBlockchainAddress, asset, signature string, amount uint64, fee float32, nonce uint64) error {
+	k, err := blockchain.TxKindFromString(kind)
+	if err != nil {
+		return fmt.Errorf("%w: %s", blockchain.ErrInvalidAsset, err)
+	}
+	publicKey, err := cryptography.PublicKeyFromString(senderPublicKey)
+	if err != nil {
+		return err
+	}
+	sign, err := cryptography.ParseSignature(signature, publicKey.KeyType())
+	if err != nil {
+		return err
+	}
+	return s.bc.AddAssetTransaction(k, senderBlockchainAddress, recipientBlockchainAddress, asset, amount, fee, nonce, publicKey, sign)
+}
+
+// Asset returns the asset id with its supply.
+func (s *Server) Asset(id string) (*blockchain.Asset, error) {
+	return s.bc.Asset(id)
+}
+
+// AddNFTTransaction mints, transfers or burns the token of collection, as kind
+// says.
+func (s *Server) AddNFTTransaction(kind, senderPublicKey, senderBlockchainAddress, recipientBlockchainAddress, collection, token, metadata, signature string, fee float32, nonce uint64) error {
+	k, err := blockchain.TxKindFromString(kind)
+	if err != nil {
+		return fmt.Errorf("%w: %s", blockchain.ErrInvalidNFT, err)
+	}
+	publicKey, err := cryptography.PublicKeyFromString(senderPublicKey)
+	if err != nil {
+		return err
+	}
+	sign, err := cryptography.ParseSignature(signature, publicKey.KeyType())
+	if err != nil {
+		return err
+	}
+	return s.bc.AddNFTTransaction(k, senderBlockchainAddress, recipientBlockchainAddress, collection, token, metadata, fee, nonce, publicKey, sign)
+}
+
+// NFT returns the token of collection with its owner.
+func (s *Server) NFT(collection, token string) (*blockchain.NFT, error) {
+	return s.bc.NFT(collection, token)
+}
+
+// NFTs returns the tokens address owns.
+func (s *Server) NFTs(address string) ([]*blockchain.NFT, error) {
+	return s.bc.NFTs(address), nil
+}
+
+type GenesisInfo struct {
+	ChainID string `json:"chain_id"`
+	Hash    string `json:"hash"`
+}
+
+// sameChain makes sure the neighbor n runs a chain with our genesis block.
+func (s *Server) sameChain(n string) error {
+	endpoint := fmt.Sprintf("http://%s/genesis", n)
+	resp, err := http.Get(endpoint)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to Get url - %v, status: %s", endpoint, resp.Status)
+	}
+
+	var theirs GenesisInfo
+	if err := json.NewDecoder(resp.Body).Decode(&theirs); err != nil {
+		return err
+	}
+	ours, err := s.Genesis()
+	if err != nil {
+		return err
+	}
+	if theirs != *ours {
+		return fmt.Errorf("%s runs chain %s with genesis %s, expected chain %s with genesis %s", n, theirs.ChainID, theirs.Hash, ours.ChainID, ours.Hash)
+	}
+	return nil
+}
+
+// fetchBlock asks the neighbors for the block with the given hash.
+func (s *Server) fetchBlock(hash [32]byte) (*blockchain.Block, error) {
+	var errsStr []string
+	for _, n := range s.neighbors {
+		endpoint := fmt.Sprintf("http://%s/blocks/%x", n, hash)
+		resp, err := http.Get(endpoint)
+		if err != nil {
+			errsStr = append(errsStr, err.Error())
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			errsStr = append(errsStr, fmt.Sprintf("failed to Get url - %v, status: %s", endpoint, resp.Status))
+			continue
+		}
+		var b blockchain.Block
+		err = json.NewDecoder(resp.Body).Decode(&b)
+		resp.Body.Close()
+		if err != nil {
+			errsStr = append(errsStr, err.Error())
+			continue
+		}
+		if got, _ := b.Hash(); got != hash {
+			errsStr = append(errsStr, fmt.Sprintf("%s returned block %x for %x", n, got, hash))
+			continue
+		}
+		return &b, nil
+	}
+	return nil, fmt.Errorf("block %x not found on %d neighbors: %s", hash, len(s.neighbors), strings.Join(errsStr, "\n"))
+}
+
+func (s *Server) HashRate() float64 {
+	return s.bc.HashRate()
+}
+
+func (s *Server) EstimateFee(blocks int) *blockchain.FeeEstimate {
+	return s.bc.EstimateFee(blocks)
+}
+
+func (s *Server) Supply() *blockchain.Supply {
+	return s.bc.Supply()
 }
 
 func (s *Server) CalculateBalance(address string) (float32, error) {
 	return s.bc.CalculateBalance(address), nil
 }
 
+// NextNonce returns the nonce the next transaction of address has to take.
+func (s *Server) NextNonce(address string) (uint64, error) {
+	return s.bc.NextNonce(address), nil
+}
+
+// AssetBalances returns the assets address holds.
+func (s *Server) AssetBalances(address string) ([]blockchain.AssetBalance, error) {
+	return s.bc.AssetBalances(address), nil
+}
+
+func (s *Server) BalanceProof(address string, height int) (*blockchain.BalanceProof, error) {
+	return s.bc.BalanceProof(address, height)
+}
+
+func (s *Server) UTXOs(address string) ([]*blockchain.UTXO, error) {
+	return s.bc.UTXOs(address), nil
+}
+
+func (s *Server) TransactionProof(id string) (*blockchain.MerkleProof, error) {
+	return s.bc.TransactionProof(id)
+}
+
+func (s *Server) Headers(from int) ([]*blockchain.BlockHeader, error) {
+	return s.bc.Headers(from), nil
+}
+
 func (s *Server) GetTransactions() ([]byte, error) {
 	t := s.bc.TransactionPool()
 	b, err := json.Marshal(struct {
@@ -128,36 +575,78 @@ func (s *Server) GetTransactions() ([]byte, error) {
 	return b, nil
 }
 
-func (s *Server) CreateTransaction(senderPublicKey, senderBlockchainAddress, recipientBlockchainAddress, signature string, amount float32) error {
+func (s *Server) CreateTransaction(senderPublicKey, senderBlockchainAddress, recipientBlockchainAddress, signature string, amount, fee float32, nonce uint64) error {
 	publicKey, err := cryptography.PublicKeyFromString(senderPublicKey)
 	if err != nil {
 		return err
 	}
 
-	sign, err := cryptography.SignatureFromString(signature)
+	sign, err := cryptography.ParseSignature(signature, publicKey.KeyType())
+	if err != nil {
+		return err
+	}
 
-	if err = s.bc.CreateTransaction(senderBlockchainAddress, recipientBlockchainAddress, amount, publicKey, sign); err != nil {
+	if err = s.bc.CreateTransaction(senderBlockchainAddress, recipientBlockchainAddress, amount, fee, nonce, publicKey, sign); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (s *Server) AddTransaction(senderPublicKey, senderBlockchainAddress, recipientBlockchainAddress, signature string, amount float32) error {
+func (s *Server) AddTransaction(senderPublicKey, senderBlockchainAddress, recipientBlockchainAddress, signature string, amount, fee float32, nonce uint64) error {
 	publicKey, err := cryptography.PublicKeyFromString(senderPublicKey)
 	if err != nil {
 		return err
 	}
 
-	sign, err := cryptography.SignatureFromString(signature)
+	sign, err := cryptography.ParseSignature(signature, publicKey.KeyType())
+	if err != nil {
+		return err
+	}
 
-	if err = s.bc.AddTransaction(senderBlockchainAddress, recipientBlockchainAddress, amount, publicKey, sign); err != nil {
+	if err = s.bc.AddTransaction(senderBlockchainAddress, recipientBlockchainAddress, amount, fee, nonce, publicKey, sign); err != nil {
 		return err
 	}
 
 	return nil
 }
 
+func (s *Server) CreateMultisigTransaction(senderPublicKeys, signatures []string, senderBlockchainAddress, recipientBlockchainAddress string, threshold int, amount, fee float32, nonce uint64) error {
+	publicKeys, signs, err := parseMultisig(senderPublicKeys, signatures)
+	if err != nil {
+		return err
+	}
+
+	return s.bc.CreateMultisigTransaction(senderBlockchainAddress, recipientBlockchainAddress, amount, fee, nonce, threshold, publicKeys, signs)
+}
+
+func (s *Server) AddMultisigTransaction(senderPublicKeys, signatures []string, senderBlockchainAddress, recipientBlockchainAddress string, threshold int, amount, fee float32, nonce uint64) error {
+	publicKeys, signs, err := parseMultisig(senderPublicKeys, signatures)
+	if err != nil {
+		return err
+	}
+
+	return s.bc.AddMultisigTransaction(senderBlockchainAddress, recipientBlockchainAddress, amount, fee, nonce, threshold, publicKeys, signs)
+}
+
+func (s *Server) CreateUTXOTransaction(senderPublicKeys, signatures []string, senderBlockchainAddress string, threshold int, inputs []blockchain.OutPoint, outputs []blockchain.TxOutput, fee float32) error {
+	publicKeys, signs, err := parseMultisig(senderPublicKeys, signatures)
+	if err != nil {
+		return err
+	}
+
+	return s.bc.CreateUTXOTransaction(senderBlockchainAddress, inputs, outputs, fee, threshold, publicKeys, signs)
+}
+
+func (s *Server) AddUTXOTransaction(senderPublicKeys, signatures []string, senderBlockchainAddress string, threshold int, inputs []blockchain.OutPoint, outputs []blockchain.TxOutput, fee float32) error {
+	publicKeys, signs, err := parseMultisig(senderPublicKeys, signatures)
+	if err != nil {
+		return err
+	}
+
+	return s.bc.AddUTXOTransaction(senderBlockchainAddress, inputs, outputs, fee, threshold, publicKeys, signs)
+}
+
 func (s *Server) UpdateNeighbors(senderPublicKey, senderBlockchainAddress, recipientBlockchainAddress, signature *string, amount *float32) (int, error) {
 	btr := blockchain.TransactionRequest{
 		SenderBlockchainAddress:    senderBlockchainAddress,
@@ -221,8 +710,37 @@ func (s *Server) DeleteNeighborsPools() (int, error) {
 	return neightborsUpdated, fmt.Errorf(strings.Join(errsStr, "\n"))
 }
 
+// announceBlock clears the neighbors pools and sends them the new tip, which
+// they connect or keep as a side branch.
+func (s *Server) announceBlock() {
+	updatedCount, err := s.DeleteNeighborsPools()
+	if err != nil {
+		log.Printf("failed to DeleteNeighborsPools with err: %s", err)
+	}
+	log.Printf("updated %d nneighbors", updatedCount)
+
+	chain := s.bc.Chain()
+	b, err := json.Marshal(chain[len(chain)-1])
+	if err != nil {
+		log.Printf("failed to marshal block with err: %s", err)
+		return
+	}
+	for _, n := range s.neighbors {
+		endpoint := fmt.Sprintf("http://%s/blocks", n)
+		resp, err := http.Post(endpoint, "application/json", bytes.NewBuffer(b))
+		if err != nil {
+			log.Printf("failed to announce block to %s with err: %s", n, err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode > 400 {
+			log.Printf("failed to announce block to %s - status: %s", n, resp.Status)
+		}
+	}
+}
+
 func (s *Server) CleaTransactionPool() int {
-	return s.bc.TruncateTransactionPool()
+	return s.bc.PruneTransactionPool()
 }
 
 func (s *Server) SetNeighbors() (int, error) {
@@ -231,14 +749,23 @@ func (s *Server) SetNeighbors() (int, error) {
 		s.port,
 		NEIGHBOR_IP_RANGE_START,
 		NEIGHBOR_IP_RANGE_END,
-		BLOCKCHAIN_PORT_RANGE_START,
-		BLOCKCHAIN_PORT_RANGE_END,
+		s.params.BlockchainPortRangeStart,
+		s.params.BlockchainPortRangeEnd,
 	)
 	if err != nil {
 		return 0, err
 	}
-	s.neighbors = n
-	return len(n), nil
+
+	neighbors := make([]string, 0, len(n))
+	for _, neighbor := range n {
+		if err := s.sameChain(neighbor); err != nil {
+			log.Printf("ignoring neighbor %s with err: %s", neighbor, err)
+			continue
+		}
+		neighbors = append(neighbors, neighbor)
+	}
+	s.neighbors = neighbors
+	return len(neighbors), nil
 }
 
 func (s *Server) SyncNeighbors() (int, error) {
@@ -247,9 +774,19 @@ func (s *Server) SyncNeighbors() (int, error) {
 	return s.SetNeighbors()
 }
 
+// ResolveConflicts feeds the chains of the neighbors into the block tree,
+// which switches to the branch with the most work.
 func (s *Server) ResolveConflicts() (bool, error) {
-	var longestChain []*blockchain.Block
-	maxLenght := len(s.bc.Chain())
+	chain := s.bc.Chain()
+	genesis, err := chain[0].Hash()
+	if err != nil {
+		return false, err
+	}
+	tip, err := chain[len(chain)-1].Hash()
+	if err != nil {
+		return false, err
+	}
+
 	var errsStr []string
 	for _, n := range s.neighbors {
 		endpoint := fmt.Sprintf("http://%s/chain", n)
@@ -259,45 +796,70 @@ func (s *Server) ResolveConflicts() (bool, error) {
 			continue
 		}
 
-		if err != nil {
-			errsStr = append(errsStr, err.Error())
-			continue
-		}
-
 		if resp.StatusCode > 400 {
-			errsStr = append(errsStr, fmt.Sprintf("failed to Get url - %v, err: %v", endpoint, err))
+			errsStr = append(errsStr, fmt.Sprintf("failed to Get url - %v, status: %s", endpoint, resp.Status))
 			continue
 		}
 
 		decoder := json.NewDecoder(resp.Body)
 		var otherBlockchain blockchain.Blockchain
 		err = decoder.Decode(&otherBlockchain)
+		resp.Body.Close()
 		if err != nil {
 			errsStr = append(errsStr, err.Error())
 			continue
 		}
-		chain := otherBlockchain.Chain()
-		if len(chain) > maxLenght {
-			valid, err := s.bc.ValidChain(chain)
-			if err != nil {
-				errsStr = append(errsStr, err.Error())
-				continue
-			}
-
-			if valid {
-				maxLenght = len(chain)
-				longestChain = chain
+		other := otherBlockchain.Chain()
+		if len(other) == 0 {
+			continue
+		}
+		if hash, err := other[0].Hash(); err != nil || hash != genesis {
+			errsStr = append(errsStr, fmt.Sprintf("%s: %s", n, blockchain.ErrGenesisMismatch))
+			continue
+		}
+		for i, b := range other {
+			if err := s.bc.ProcessBlock(b); err != nil && !errors.Is(err, blockchain.ErrKnownBlock) {
+				errsStr = append(errsStr, fmt.Sprintf("block %d from %s: %s", i, n, err))
+				break
 			}
 		}
 	}
 
+	if err := s.syncFinality(); err != nil {
+		errsStr = append(errsStr, err.Error())
+	}
+
+	chain = s.bc.Chain()
+	newTip, err := chain[len(chain)-1].Hash()
+	if err != nil {
+		return false, err
+	}
 	if errsStr != nil {
-		return false, fmt.Errorf(strings.Join(errsStr, "\n"))
+		return newTip != tip, fmt.Errorf(strings.Join(errsStr, "\n"))
 	}
+	return newTip != tip, nil
+}
 
-	if longestChain != nil {
-		s.bc.SetChain(longestChain)
-		return true, nil
+func parseMultisig(senderPublicKeys, signatures []string) ([]cryptography.PublicKey, []*cryptography.Signature, error) {
+	publicKeys := make([]cryptography.PublicKey, len(senderPublicKeys))
+	for i, k := range senderPublicKeys {
+		publicKey, err := cryptography.PublicKeyFromString(k)
+		if err != nil {
+			return nil, nil, err
+		}
+		publicKeys[i] = publicKey
+	}
+
+	signs := make([]*cryptography.Signature, len(signatures))
+	for i, sig := range signatures {
+		if len(publicKeys) == 0 {
+			return nil, nil, fmt.Errorf("signature without a public key")
+		}
+		sign, err := cryptography.ParseSignature(sig, publicKeys[0].KeyType())
+		if err != nil {
+			return nil, nil, err
+		}
+		signs[i] = sign
 	}
-	return false, nil
+	return publicKeys, signs, nil
 }
@@ -2,22 +2,60 @@ package blockchain_server
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 
 	http2 "blockchain/foundation/http"
 
 	"blockchain/blockchain-service/blockchain"
+	"blockchain/blockchain-service/mempool"
 )
 
 type Serverer interface {
 	GetTransactions() ([]byte, error)
 	CalculateBalance(address string) (float32, error)
-	CreateTransaction(senderPublicKey, senderBlockchainAddress, recipientBlockchainAddress, signature string, amount float32) error
-	AddTransaction(senderPublicKey, senderBlockchainAddress, recipientBlockchainAddress, signature string, amount float32) error
+	NextNonce(address string) (uint64, error)
+	AssetBalances(address string) ([]blockchain.AssetBalance, error)
+	UTXOs(address string) ([]*blockchain.UTXO, error)
+	BalanceProof(address string, height int) (*blockchain.BalanceProof, error)
+	TransactionProof(id string) (*blockchain.MerkleProof, error)
+	Headers(from int) ([]*blockchain.BlockHeader, error)
+	CreateTransaction(senderPublicKey, senderBlockchainAddress, recipientBlockchainAddress, signature string, amount, fee float32, nonce uint64) error
+	AddTransaction(senderPublicKey, senderBlockchainAddress, recipientBlockchainAddress, signature string, amount, fee float32, nonce uint64) error
+	CreateMultisigTransaction(senderPublicKeys, signatures []string, senderBlockchainAddress, recipientBlockchainAddress string, threshold int, amount, fee float32, nonce uint64) error
+	AddMultisigTransaction(senderPublicKeys, signatures []string, senderBlockchainAddress, recipientBlockchainAddress string, threshold int, amount, fee float32, nonce uint64) error
+	CreateUTXOTransaction(senderPublicKeys, signatures []string, senderBlockchainAddress string, threshold int, inputs []blockchain.OutPoint, outputs []blockchain.TxOutput, fee float32) error
+	AddUTXOTransaction(senderPublicKeys, signatures []string, senderBlockchainAddress string, threshold int, inputs []blockchain.OutPoint, outputs []blockchain.TxOutput, fee float32) error
 	CleaTransactionPool() int
 	Mine() (int64, bool, error)
+	BlockTemplate() (*blockchain.BlockTemplate, error)
+	SubmitBlock(b *blockchain.Block) error
+	ReceiveBlock(b *blockchain.Block) error
+	Block(hash string) (*blockchain.BlockStatus, error)
+	Finality() (*blockchain.FinalityStatus, error)
+	ReceiveFinalityVote(v *blockchain.FinalityVote) error
+	Genesis() (*GenesisInfo, error)
+	Signers() ([]string, error)
+	ProposeSigner(address string, authorize bool) error
+	Validators() ([]blockchain.Validator, string, error)
+	AddStakingTransaction(kind, senderPublicKey, senderBlockchainAddress, signature string, value, fee float32, nonce uint64, evidence *blockchain.DoubleSignEvidence) error
+	AddContractTransaction(kind, senderPublicKey, senderBlockchainAddress, contract, signature, data string, gas uint64, fee float32, nonce uint64) (string, error)
+	Contract(address string) (*blockchain.ContractInfo, error)
+	CallContract(address, caller, input string) (*blockchain.Receipt, error)
+	Receipt(id string) (*blockchain.Receipt, error)
+	IssueAsset(senderPublicKey, senderBlockchainAddress, signature, symbol string, decimals uint8, supply uint64, mintAuthority string, fee float32, nonce uint64) (string, error)
+	AddAssetTransaction(kind, senderPublicKey, senderBlockchainAddress, recipientBlockchainAddress, asset, signature string, amount uint64, fee float32, nonce uint64) error
+	Asset(id string) (*blockchain.Asset, error)
+	AddNFTTransaction(kind, senderPublicKey, senderBlockchainAddress, recipientBlockchainAddress, collection, token, metadata, signature string, fee float32, nonce uint64) error
+	NFT(collection, token string) (*blockchain.NFT, error)
+	NFTs(address string) ([]*blockchain.NFT, error)
+	HashRate() float64
+	EstimateFee(blocks int) *blockchain.FeeEstimate
+	Supply() *blockchain.Supply
 	ResolveConflicts() (bool, error)
 	GetBlockchainBytes() ([]byte, error)
 }
@@ -75,6 +113,81 @@ func (t *Transporter) HandleTransactions(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+// HandleTransactionProof serves GET /transactions/{id}/proof, the merkle proof
+// that a transaction is in a block of the chain.
+func (t *Transporter) HandleTransactionProof(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		id := strings.TrimPrefix(r.URL.Path, "/transactions/")
+		if !strings.HasSuffix(id, "/proof") {
+			http.Error(w, "page not found", http.StatusNotFound)
+			return
+		}
+		id = strings.TrimSuffix(id, "/proof")
+		if id == "" || strings.Contains(id, "/") {
+			http.Error(w, "page not found", http.StatusNotFound)
+			return
+		}
+
+		proof, err := t.server.TransactionProof(id)
+		if errors.Is(err, blockchain.ErrTxNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		b, err := json.Marshal(proof)
+		if err != nil {
+			http.Error(w, "failed to marshal transaction proof", http.StatusInternalServerError)
+			return
+		}
+		io.WriteString(w, string(b[:]))
+	default:
+		http.Error(w, "page not found", http.StatusBadRequest)
+	}
+}
+
+// HandleHeaders returns the block headers from ?from= on, for light clients.
+func (t *Transporter) HandleHeaders(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		from := 0
+		if v := r.URL.Query().Get("from"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				http.Error(w, "from must be a block height", http.StatusBadRequest)
+				return
+			}
+			from = n
+		}
+		headers, err := t.server.Headers(from)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		b, err := json.Marshal(struct {
+			From    int                       `json:"from"`
+			Headers []*blockchain.BlockHeader `json:"headers"`
+		}{
+			From:    from,
+			Headers: headers,
+		})
+		if err != nil {
+			http.Error(w, "failed to marshal headers", http.StatusInternalServerError)
+			return
+		}
+		io.WriteString(w, string(b[:]))
+	default:
+		http.Error(w, "page not found", http.StatusBadRequest)
+	}
+}
+
 func (t *Transporter) HandleBalance(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
@@ -88,13 +201,100 @@ func (t *Transporter) HandleBalance(w http.ResponseWriter, r *http.Request) {
 			io.WriteString(w, string(http2.JsonStatus("fail")))
 			http.Error(w, "something went wrong", http.StatusInternalServerError)
 		}
+		assets, err := t.server.AssetBalances(bcAddress)
+		if err != nil {
+			io.WriteString(w, string(http2.JsonStatus("fail")))
+			http.Error(w, "something went wrong", http.StatusInternalServerError)
+		}
+		nonce, err := t.server.NextNonce(bcAddress)
+		if err != nil {
+			io.WriteString(w, string(http2.JsonStatus("fail")))
+			http.Error(w, "something went wrong", http.StatusInternalServerError)
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		b, err := json.Marshal(struct {
+			Balance   float32                   `json:"balance"`
+			Assets    []blockchain.AssetBalance `json:"assets,omitempty"`
+			NextNonce uint64                    `json:"next_nonce"`
+		}{
+			Balance:   balance,
+			Assets:    assets,
+			NextNonce: nonce,
+		})
+		io.WriteString(w, string(b[:]))
+	default:
+		http.Error(w, "page not found", http.StatusBadRequest)
+	}
+}
+
+// HandleBalanceProof returns the account of an address with a proof against
+// the state root of the block at ?height=, the last block by default.
+func (t *Transporter) HandleBalanceProof(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		bcAddress := r.URL.Query().Get("bc_address")
+		if bcAddress == "" {
+			http.Error(w, "missing blockchain address", http.StatusBadRequest)
+			return
+		}
+		height := -1
+		if v := r.URL.Query().Get("height"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				http.Error(w, "height must be a block height", http.StatusBadRequest)
+				return
+			}
+			height = n
+		}
+
+		proof, err := t.server.BalanceProof(bcAddress, height)
+		if errors.Is(err, blockchain.ErrBlockNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		b, err := json.Marshal(proof)
+		if err != nil {
+			http.Error(w, "failed to marshal balance proof", http.StatusInternalServerError)
+			return
+		}
+		io.WriteString(w, string(b[:]))
+	default:
+		http.Error(w, "page not found", http.StatusBadRequest)
+	}
+}
+
+// HandleUTXOs lists the unspent outputs of an address on a UTXO ledger.
+func (t *Transporter) HandleUTXOs(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		bcAddress := r.URL.Query().Get("bc_address")
+		if bcAddress == "" {
+			http.Error(w, "missing blockchain address", http.StatusBadRequest)
+			return
+		}
+		utxos, err := t.server.UTXOs(bcAddress)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 
 		w.Header().Add("Content-Type", "application/json")
 		b, err := json.Marshal(struct {
-			Balance float32 `json:"balance"`
+			UTXOs []*blockchain.UTXO `json:"utxos"`
 		}{
-			Balance: balance,
+			UTXOs: utxos,
 		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 		io.WriteString(w, string(b[:]))
 	default:
 		http.Error(w, "page not found", http.StatusBadRequest)
@@ -112,12 +312,592 @@ func (t *Transporter) HandleMining(w http.ResponseWriter, r *http.Request) {
 
 		w.Header().Add("Content-Type", "application/json")
 		b, err := json.Marshal(struct {
-			Timestamp int64 `json:"timestamp"`
-			Mined     bool  `json:"mined"`
+			Timestamp int64   `json:"timestamp"`
+			Mined     bool    `json:"mined"`
+			HashRate  float64 `json:"hash_rate"`
 		}{
 			Timestamp: timestamp,
 			Mined:     mined,
+			HashRate:  t.server.HashRate(),
+		})
+		io.WriteString(w, string(b[:]))
+	default:
+		http.Error(w, "page not found", http.StatusBadRequest)
+	}
+}
+
+func (t *Transporter) HandleFeeEstimate(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		blocks := 0
+		if v := r.URL.Query().Get("blocks"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				http.Error(w, "blocks must be a positive number", http.StatusBadRequest)
+				return
+			}
+			blocks = n
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		b, err := json.Marshal(t.server.EstimateFee(blocks))
+		if err != nil {
+			http.Error(w, "failed to marshal fee estimate", http.StatusInternalServerError)
+			return
+		}
+		io.WriteString(w, string(b[:]))
+	default:
+		http.Error(w, "page not found", http.StatusBadRequest)
+	}
+}
+
+func (t *Transporter) HandleSupply(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Add("Content-Type", "application/json")
+		b, err := json.Marshal(t.server.Supply())
+		if err != nil {
+			http.Error(w, "failed to marshal supply", http.StatusInternalServerError)
+			return
+		}
+		io.WriteString(w, string(b[:]))
+	default:
+		http.Error(w, "page not found", http.StatusBadRequest)
+	}
+}
+
+func (t *Transporter) HandleBlockTemplate(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		template, err := t.server.BlockTemplate()
+		if err != nil {
+			http.Error(w, "failed to build block template", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		b, err := json.Marshal(template)
+		if err != nil {
+			http.Error(w, "failed to marshal block template", http.StatusInternalServerError)
+			return
+		}
+		io.WriteString(w, string(b[:]))
+	default:
+		http.Error(w, "page not found", http.StatusBadRequest)
+	}
+}
+
+func (t *Transporter) HandleSubmitBlock(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		var b blockchain.Block
+		if err := json.NewDecoder(r.Body).Decode(&b); err != nil {
+			http.Error(w, "blockchain-server error - failed to parse request body", http.StatusBadRequest)
+			return
+		}
+
+		if err := t.server.SubmitBlock(&b); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		res, _ := json.Marshal(struct {
+			Accepted bool `json:"accepted"`
+		}{
+			Accepted: true,
+		})
+		io.WriteString(w, string(res[:]))
+	default:
+		http.Error(w, "page not found", http.StatusBadRequest)
+	}
+}
+
+// HandleBlocks serves GET /blocks/{hash}, a block of the chain or of a side
+// branch with its height and whether it is final, and takes blocks announced
+// by peers on POST /blocks.
+func (t *Transporter) HandleBlocks(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		hash := strings.TrimPrefix(r.URL.Path, "/blocks/")
+		b, err := t.server.Block(hash)
+		if errors.Is(err, blockchain.ErrBlockNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		res, err := json.Marshal(b)
+		if err != nil {
+			http.Error(w, "failed to marshal block", http.StatusInternalServerError)
+			return
+		}
+		io.WriteString(w, string(res[:]))
+	case http.MethodPost:
+		var b blockchain.Block
+		if err := json.NewDecoder(r.Body).Decode(&b); err != nil {
+			http.Error(w, "blockchain-server error - failed to parse request body", http.StatusBadRequest)
+			return
+		}
+
+		if err := t.server.ReceiveBlock(&b); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		res, _ := json.Marshal(struct {
+			Accepted bool `json:"accepted"`
+		}{
+			Accepted: true,
 		})
+		io.WriteString(w, string(res[:]))
+	default:
+		http.Error(w, "page not found", http.StatusBadRequest)
+	}
+}
+
+// HandleFinality returns the last final block, its commit and the round the
+// finality validators vote in.
+func (t *Transporter) HandleFinality(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		status, err := t.server.Finality()
+		if errors.Is(err, blockchain.ErrNoFinality) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		b, err := json.Marshal(status)
+		if err != nil {
+			http.Error(w, "failed to marshal finality", http.StatusInternalServerError)
+			return
+		}
+		io.WriteString(w, string(b[:]))
+	default:
+		http.Error(w, "page not found", http.StatusBadRequest)
+	}
+}
+
+// HandleFinalityVotes takes the prevotes and precommits of the finality
+// validators sent by peers on POST /finality/votes.
+func (t *Transporter) HandleFinalityVotes(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		var v blockchain.FinalityVote
+		if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+			http.Error(w, "blockchain-server error - failed to parse request body", http.StatusBadRequest)
+			return
+		}
+
+		err := t.server.ReceiveFinalityVote(&v)
+		switch {
+		case errors.Is(err, blockchain.ErrNoFinality):
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case errors.Is(err, blockchain.ErrInvalidVote) || errors.Is(err, blockchain.ErrNotFinalityValidator) ||
+			errors.Is(err, blockchain.ErrConflictingVote):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		io.WriteString(w, string(http2.JsonStatus("success")))
+	default:
+		http.Error(w, "page not found", http.StatusBadRequest)
+	}
+}
+
+// HandleGenesis returns the chain ID and genesis hash peers compare before
+// syncing.
+func (t *Transporter) HandleGenesis(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		genesis, err := t.server.Genesis()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		b, err := json.Marshal(genesis)
+		if err != nil {
+			http.Error(w, "failed to marshal genesis", http.StatusInternalServerError)
+			return
+		}
+		io.WriteString(w, string(b[:]))
+	default:
+		http.Error(w, "page not found", http.StatusBadRequest)
+	}
+}
+
+// HandleSigners lists the signers of a proof of authority chain on GET and
+// takes a vote to add or remove one on POST.
+func (t *Transporter) HandleSigners(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		signers, err := t.server.Signers()
+		if errors.Is(err, blockchain.ErrNotAuthority) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		b, err := json.Marshal(struct {
+			Signers []string `json:"signers"`
+		}{
+			Signers: signers,
+		})
+		if err != nil {
+			http.Error(w, "failed to marshal signers", http.StatusInternalServerError)
+			return
+		}
+		io.WriteString(w, string(b[:]))
+	case http.MethodPost:
+		var vote blockchain.Vote
+		if err := json.NewDecoder(r.Body).Decode(&vote); err != nil {
+			http.Error(w, "blockchain-server error - failed to parse request body", http.StatusBadRequest)
+			return
+		}
+
+		err := t.server.ProposeSigner(vote.Address, vote.Authorize)
+		var invalidAddress *blockchain.InvalidAddressError
+		switch {
+		case errors.Is(err, blockchain.ErrNotAuthority):
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case errors.As(err, &invalidAddress):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		io.WriteString(w, string(http2.JsonStatus("success")))
+	default:
+		http.Error(w, "page not found", http.StatusBadRequest)
+	}
+}
+
+// HandleValidators lists the validators of a proof of stake chain on GET and
+// takes a stake, unstake or evidence transaction on POST.
+func (t *Transporter) HandleValidators(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		validators, next, err := t.server.Validators()
+		if errors.Is(err, blockchain.ErrNotStaking) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		b, err := json.Marshal(struct {
+			Validators []blockchain.Validator `json:"validators"`
+			Next       string                 `json:"next,omitempty"`
+		}{
+			Validators: validators,
+			Next:       next,
+		})
+		if err != nil {
+			http.Error(w, "failed to marshal validators", http.StatusInternalServerError)
+			return
+		}
+		io.WriteString(w, string(b[:]))
+	case http.MethodPost:
+		var req blockchain.StakingRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "blockchain-server error - failed to parse request body", http.StatusBadRequest)
+			return
+		}
+		if !req.Validate() {
+			http.Error(w, "bad request body", http.StatusBadRequest)
+			return
+		}
+
+		err := t.server.AddStakingTransaction(*req.Kind, *req.SenderPublicKey, *req.SenderBlockchainAddress, *req.Signature, req.GetValue(), req.GetFee(), req.GetNonce(), req.Evidence)
+		switch {
+		case errors.Is(err, blockchain.ErrNotStaking):
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), transactionErrorStatus(err))
+			return
+		}
+		io.WriteString(w, string(http2.JsonStatus("success")))
+	default:
+		http.Error(w, "page not found", http.StatusBadRequest)
+	}
+}
+
+// HandleContracts deploys a contract on POST /contracts. On /contracts/{addr}
+// GET returns the contract, or the receipt of a read only call with
+// ?input= and ?caller=, and POST calls it.
+func (t *Transporter) HandleContracts(w http.ResponseWriter, r *http.Request) {
+	address := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/contracts"), "/")
+	if strings.Contains(address, "/") {
+		http.Error(w, "page not found", http.StatusNotFound)
+		return
+	}
+	switch {
+	case r.Method == http.MethodGet && address != "":
+		var res interface{}
+		var err error
+		if input, ok := r.URL.Query()["input"]; ok {
+			res, err = t.server.CallContract(address, r.URL.Query().Get("caller"), input[0])
+		} else {
+			res, err = t.server.Contract(address)
+		}
+		switch {
+		case errors.Is(err, blockchain.ErrContractNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case errors.Is(err, blockchain.ErrLedger):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		b, err := json.Marshal(res)
+		if err != nil {
+			http.Error(w, "failed to marshal contract", http.StatusInternalServerError)
+			return
+		}
+		io.WriteString(w, string(b[:]))
+	case r.Method == http.MethodPost:
+		var req blockchain.ContractRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "blockchain-server error - failed to parse request body", http.StatusBadRequest)
+			return
+		}
+		if !req.Validate() {
+			http.Error(w, "bad request body", http.StatusBadRequest)
+			return
+		}
+
+		kind := blockchain.CallTx
+		if address == "" {
+			kind = blockchain.DeployTx
+			if req.Contract != nil {
+				address = *req.Contract
+			}
+		}
+		contract, err := t.server.AddContractTransaction(string(kind), *req.SenderPublicKey, *req.SenderBlockchainAddress, address, *req.Signature, *req.Data, *req.Gas, req.GetFee(), req.GetNonce())
+		switch {
+		case errors.Is(err, blockchain.ErrContractNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), transactionErrorStatus(err))
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		b, _ := json.Marshal(struct {
+			Contract string `json:"contract"`
+		}{
+			Contract: contract,
+		})
+		io.WriteString(w, string(b[:]))
+	default:
+		http.Error(w, "page not found", http.StatusBadRequest)
+	}
+}
+
+// HandleAssets issues an asset on POST /assets. On /assets/{id} GET returns
+// the asset and POST mints it.
+func (t *Transporter) HandleAssets(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/assets"), "/")
+	if strings.Contains(id, "/") {
+		http.Error(w, "page not found", http.StatusNotFound)
+		return
+	}
+	switch {
+	case r.Method == http.MethodGet && id != "":
+		asset, err := t.server.Asset(id)
+		if errors.Is(err, blockchain.ErrAssetNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		b, err := json.Marshal(asset)
+		if err != nil {
+			http.Error(w, "failed to marshal asset", http.StatusInternalServerError)
+			return
+		}
+		io.WriteString(w, string(b[:]))
+	case r.Method == http.MethodPost:
+		var req blockchain.AssetRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "blockchain-server error - failed to parse request body", http.StatusBadRequest)
+			return
+		}
+		if !req.Validate(id != "") {
+			http.Error(w, "bad request body", http.StatusBadRequest)
+			return
+		}
+
+		var err error
+		if id == "" {
+			id, err = t.server.IssueAsset(*req.SenderPublicKey, *req.SenderBlockchainAddress, *req.Signature, *req.Symbol, req.GetDecimals(), req.GetSupply(), req.GetMintAuthority(), req.GetFee(), req.GetNonce())
+		} else {
+			err = t.server.AddAssetTransaction(string(blockchain.MintTx), *req.SenderPublicKey, *req.SenderBlockchainAddress, *req.Recipient, id, *req.Signature, *req.Amount, req.GetFee(), req.GetNonce())
+		}
+		if err != nil {
+			http.Error(w, err.Error(), transactionErrorStatus(err))
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		b, _ := json.Marshal(struct {
+			Asset string `json:"asset"`
+		}{
+			Asset: id,
+		})
+		io.WriteString(w, string(b[:]))
+	default:
+		http.Error(w, "page not found", http.StatusBadRequest)
+	}
+}
+
+// HandleNFTs mints, transfers or burns a token on POST /nfts, the kind of the
+// request says which. GET /nfts/{collection}/{id} returns the token.
+func (t *Transporter) HandleNFTs(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/nfts"), "/")
+	switch {
+	case r.Method == http.MethodGet && path != "":
+		parts := strings.Split(path, "/")
+		if len(parts) != 2 {
+			http.Error(w, "page not found", http.StatusNotFound)
+			return
+		}
+		nft, err := t.server.NFT(parts[0], parts[1])
+		if errors.Is(err, blockchain.ErrNFTNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		b, err := json.Marshal(nft)
+		if err != nil {
+			http.Error(w, "failed to marshal nft", http.StatusInternalServerError)
+			return
+		}
+		io.WriteString(w, string(b[:]))
+	case r.Method == http.MethodPost && path == "":
+		var req blockchain.NFTRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "blockchain-server error - failed to parse request body", http.StatusBadRequest)
+			return
+		}
+		if !req.Validate() {
+			http.Error(w, "bad request body", http.StatusBadRequest)
+			return
+		}
+
+		err := t.server.AddNFTTransaction(*req.Kind, *req.SenderPublicKey, *req.SenderBlockchainAddress, req.GetRecipient(), *req.Collection, *req.TokenID, req.GetMetadata(), *req.Signature, req.GetFee(), req.GetNonce())
+		if err != nil {
+			http.Error(w, err.Error(), transactionErrorStatus(err))
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, "success")
+	default:
+		http.Error(w, "page not found", http.StatusBadRequest)
+	}
+}
+
+// HandleAddresses returns the tokens an address owns at
+// /addresses/{addr}/nfts.
+func (t *Transporter) HandleAddresses(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/addresses/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] != "nfts" {
+		http.Error(w, "page not found", http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		nfts, err := t.server.NFTs(parts[0])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		b, err := json.Marshal(struct {
+			Address string            `json:"address"`
+			NFTs    []*blockchain.NFT `json:"nfts"`
+		}{
+			Address: parts[0],
+			NFTs:    nfts,
+		})
+		if err != nil {
+			http.Error(w, "failed to marshal nfts", http.StatusInternalServerError)
+			return
+		}
+		io.WriteString(w, string(b[:]))
+	default:
+		http.Error(w, "page not found", http.StatusBadRequest)
+	}
+}
+
+// HandleReceipt returns the receipt of the contract transaction at
+// /receipts/{id}.
+func (t *Transporter) HandleReceipt(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		id := strings.TrimPrefix(r.URL.Path, "/receipts/")
+		if id == "" || strings.Contains(id, "/") {
+			http.Error(w, "page not found", http.StatusNotFound)
+			return
+		}
+
+		receipt, err := t.server.Receipt(id)
+		if errors.Is(err, blockchain.ErrTxNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		b, err := json.Marshal(receipt)
+		if err != nil {
+			http.Error(w, "failed to marshal receipt", http.StatusInternalServerError)
+			return
+		}
 		io.WriteString(w, string(b[:]))
 	default:
 		http.Error(w, "page not found", http.StatusBadRequest)
@@ -169,10 +949,20 @@ func (t *Transporter) createTransaction(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err := t.server.CreateTransaction(*trReq.SenderPublicKey, *trReq.SenderBlockchainAddress, *trReq.RecipientBlockchainAddress, *trReq.Signature, *trReq.Value)
+	var err error
+	if trReq.IsUTXO() {
+		pKeys, sigs, threshold := trReq.Signers()
+		err = t.server.CreateUTXOTransaction(pKeys, sigs, *trReq.SenderBlockchainAddress, threshold, *trReq.Inputs, *trReq.Outputs, trReq.GetFee())
+	} else if trReq.IsAsset() {
+		err = t.server.AddAssetTransaction(string(blockchain.TransferTx), *trReq.SenderPublicKey, *trReq.SenderBlockchainAddress, *trReq.RecipientBlockchainAddress, *trReq.Asset, *trReq.Signature, *trReq.Amount, trReq.GetFee(), trReq.GetNonce())
+	} else if trReq.IsMultisig() {
+		err = t.server.CreateMultisigTransaction(*trReq.SenderPublicKeys, *trReq.Signatures, *trReq.SenderBlockchainAddress, *trReq.RecipientBlockchainAddress, *trReq.Threshold, *trReq.Value, trReq.GetFee(), trReq.GetNonce())
+	} else {
+		err = t.server.CreateTransaction(*trReq.SenderPublicKey, *trReq.SenderBlockchainAddress, *trReq.RecipientBlockchainAddress, *trReq.Signature, *trReq.Value, trReq.GetFee(), trReq.GetNonce())
+	}
 	if err != nil {
 		io.WriteString(w, string(http2.JsonStatus("fail")))
-		http.Error(w, "blockchain-server error - failed to create short url", http.StatusInternalServerError)
+		http.Error(w, err.Error(), transactionErrorStatus(err))
 		return
 	}
 
@@ -193,12 +983,44 @@ func (t *Transporter) addTransaction(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := t.server.AddTransaction(*trReq.SenderPublicKey, *trReq.SenderBlockchainAddress, *trReq.RecipientBlockchainAddress, *trReq.Signature, *trReq.Value)
+	var err error
+	if trReq.IsUTXO() {
+		pKeys, sigs, threshold := trReq.Signers()
+		err = t.server.AddUTXOTransaction(pKeys, sigs, *trReq.SenderBlockchainAddress, threshold, *trReq.Inputs, *trReq.Outputs, trReq.GetFee())
+	} else if trReq.IsAsset() {
+		err = t.server.AddAssetTransaction(string(blockchain.TransferTx), *trReq.SenderPublicKey, *trReq.SenderBlockchainAddress, *trReq.RecipientBlockchainAddress, *trReq.Asset, *trReq.Signature, *trReq.Amount, trReq.GetFee(), trReq.GetNonce())
+	} else if trReq.IsMultisig() {
+		err = t.server.AddMultisigTransaction(*trReq.SenderPublicKeys, *trReq.Signatures, *trReq.SenderBlockchainAddress, *trReq.RecipientBlockchainAddress, *trReq.Threshold, *trReq.Value, trReq.GetFee(), trReq.GetNonce())
+	} else {
+		err = t.server.AddTransaction(*trReq.SenderPublicKey, *trReq.SenderBlockchainAddress, *trReq.RecipientBlockchainAddress, *trReq.Signature, *trReq.Value, trReq.GetFee(), trReq.GetNonce())
+	}
 	if err != nil {
 		io.WriteString(w, string(http2.JsonStatus("fail")))
-		http.Error(w, "blockchain-server error - failed to create short url", http.StatusInternalServerError)
+		http.Error(w, err.Error(), transactionErrorStatus(err))
 		return
 	}
 
 	io.WriteString(w, "success")
 }
+
+func transactionErrorStatus(err error) int {
+	var invalidAddress *blockchain.InvalidAddressError
+	var addressMismatch *blockchain.AddressMismatchError
+	if errors.As(err, &invalidAddress) || errors.As(err, &addressMismatch) || errors.Is(err, blockchain.ErrInvalidSignature) || errors.Is(err, blockchain.ErrNegativeFee) ||
+		errors.Is(err, blockchain.ErrInsufficientFunds) || errors.Is(err, blockchain.ErrCoinbase) ||
+		errors.Is(err, blockchain.ErrDoubleSpend) || errors.Is(err, blockchain.ErrLedger) ||
+		errors.Is(err, blockchain.ErrInsufficientStake) || errors.Is(err, blockchain.ErrInvalidEvidence) ||
+		errors.Is(err, blockchain.ErrKnownEvidence) || errors.Is(err, blockchain.ErrNoStake) ||
+		errors.Is(err, blockchain.ErrContractExists) || errors.Is(err, blockchain.ErrContractAddress) ||
+		errors.Is(err, blockchain.ErrGasLimit) || errors.Is(err, blockchain.ErrInvalidAsset) ||
+		errors.Is(err, blockchain.ErrAssetNotFound) || errors.Is(err, blockchain.ErrAssetExists) ||
+		errors.Is(err, blockchain.ErrMintAuthority) || errors.Is(err, blockchain.ErrSupplyOverflow) ||
+		errors.Is(err, blockchain.ErrInvalidNFT) || errors.Is(err, blockchain.ErrNFTNotFound) ||
+		errors.Is(err, blockchain.ErrNFTExists) || errors.Is(err, blockchain.ErrNFTOwner) ||
+		errors.Is(err, blockchain.ErrCollectionCreator) ||
+		errors.Is(err, mempool.ErrDuplicate) || errors.Is(err, mempool.ErrReplacementUnderpriced) ||
+		errors.Is(err, mempool.ErrMempoolFull) || errors.Is(err, mempool.ErrTransactionTooLarge) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
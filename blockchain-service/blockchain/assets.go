@@ -0,0 +1,261 @@
+package blockchain
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"blockchain/foundation/cryptography"
+)
+
+// MaxAssetDecimals is the most decimals an asset may have.
+const MaxAssetDecimals = 18
+
+var (
+	ErrAssetNotFound  = errors.New("asset not found")
+	ErrAssetExists    = errors.New("asset already exists")
+	ErrInvalidAsset   = errors.New("invalid asset transaction")
+	ErrMintAuthority  = errors.New("sender is not the mint authority of the asset")
+	ErrSupplyOverflow = errors.New("mint exceeds the largest supply of an asset")
+)
+
+// Asset is a token issued on the chain. Amounts of it are in base units, one
+// token is 10^Decimals of them. An asset without a MintAuthority has a fixed
+// supply.
+type Asset struct {
+	ID            string `json:"id"`
+	Issuer        string `json:"issuer"`
+	Symbol        string `json:"symbol"`
+	Decimals      uint8  `json:"decimals"`
+	Supply        uint64 `json:"supply"`
+	MintAuthority string `json:"mint_authority,omitempty"`
+}
+
+// AssetBalance is what an address holds of an asset.
+type AssetBalance struct {
+	Asset    string `json:"asset"`
+	Symbol   string `json:"symbol"`
+	Decimals uint8  `json:"decimals"`
+	Balance  uint64 `json:"balance"`
+}
+
+// AssetID is the ID of the asset issued by issuer with nonce: the hex encoded
+// sha256 of the issuer followed by the nonce.
+func AssetID(issuer string, nonce uint64) string {
+	h := sha256.New()
+	h.Write([]byte(issuer))
+	var n [8]byte
+	binary.BigEndian.PutUint64(n[:], nonce)
+	h.Write(n[:])
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// AddIssueTransaction issues the asset symbol and returns its ID.
+func (bc *Blockchain) AddIssueTransaction(sender, symbol string, decimals uint8, supply uint64, mintAuthority string, fee float32, nonce uint64, pKey cryptography.PublicKey, s *cryptography.Signature) (string, error) {
+	t := NewIssueTransaction(sender, symbol, decimals, supply, mintAuthority, fee, nonce, 0, []cryptography.PublicKey{pKey}, []*cryptography.Signature{s})
+	if err := bc.addTransaction(t); err != nil {
+		return "", err
+	}
+	return t.Asset(), nil
+}
+
+// AddAssetTransaction transfers amount of asset from sender to recipient, or
+// mints it to recipient when kind is MintTx.
+func (bc *Blockchain) AddAssetTransaction(kind TxKind, sender, recipient, asset string, amount uint64, fee float32, nonce uint64, pKey cryptography.PublicKey, s *cryptography.Signature) error {
+	if kind != TransferTx && kind != MintTx {
+		return fmt.Errorf("%w: %q does not move an asset", ErrInvalidAsset, kind)
+	}
+	return bc.addTransaction(NewAssetTransaction(kind, sender, recipient, asset, amount, fee, nonce, 0, []cryptography.PublicKey{pKey}, []*cryptography.Signature{s}))
+}
+
+// Asset returns the asset id as of the last block.
+func (bc *Blockchain) Asset(id string) (*Asset, error) {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+
+	asset := bc.state.Account(id).Asset
+	if asset == nil {
+		return nil, fmt.Errorf("%w: %s", ErrAssetNotFound, id)
+	}
+	c := *asset
+	return &c, nil
+}
+
+// AssetBalances returns the assets address holds as of the last block.
+func (bc *Blockchain) AssetBalances(address string) []AssetBalance {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+
+	return bc.state.AssetBalances(address)
+}
+
+// AssetBalances returns the assets address holds, by symbol.
+func (s *StateTree) AssetBalances(address string) []AssetBalance {
+	var balances []AssetBalance
+	for id, balance := range s.Account(address).Assets {
+		b := AssetBalance{Asset: id, Balance: balance}
+		if asset := s.Account(id).Asset; asset != nil {
+			b.Symbol, b.Decimals = asset.Symbol, asset.Decimals
+		}
+		balances = append(balances, b)
+	}
+	sort.Slice(balances, func(i, j int) bool {
+		if balances[i].Symbol != balances[j].Symbol {
+			return balances[i].Symbol < balances[j].Symbol
+		}
+		return balances[i].Asset < balances[j].Asset
+	})
+	return balances
+}
+
+// verifyAsset checks the shape of an issue, a mint or an asset transfer, and
+// that no other transaction carries asset fields.
+func (bc *Blockchain) verifyAsset(t *Transaction) error {
+	issue := t.symbol != "" || t.decimals != 0 || t.mintAuthority != ""
+	switch {
+	case t.kind == IssueTx:
+		if t.recipient != t.sender || t.value != 0 || t.asset != "" {
+			return fmt.Errorf("%w: an issue pays its supply to its sender", ErrInvalidAsset)
+		}
+		if !validSymbol(t.symbol) {
+			return fmt.Errorf("%w: symbol %q must be 1 to 12 capital letters or digits", ErrInvalidAsset, t.symbol)
+		}
+		if t.decimals > MaxAssetDecimals {
+			return fmt.Errorf("%w: %d decimals, at most %d", ErrInvalidAsset, t.decimals, MaxAssetDecimals)
+		}
+		if t.amount == 0 && t.mintAuthority == "" {
+			return fmt.Errorf("%w: an asset without supply needs a mint authority", ErrInvalidAsset)
+		}
+		if t.mintAuthority != "" {
+			if err := cryptography.ValidateBlockchainAddress(t.mintAuthority, bc.params); err != nil {
+				return &InvalidAddressError{Address: t.mintAuthority, Err: err}
+			}
+		}
+	case t.kind == MintTx || t.kind == TransferTx && t.asset != "":
+		if t.asset == "" || t.amount == 0 || t.value != 0 || issue {
+			return fmt.Errorf("%w: a %s moves a positive amount of an asset only", ErrInvalidAsset, t.kind)
+		}
+	case t.asset != "" || t.amount != 0 || issue:
+		return fmt.Errorf("%w: a %s transaction carries no asset", ErrInvalidAsset, t.kind)
+	}
+	return nil
+}
+
+func validSymbol(symbol string) bool {
+	if len(symbol) == 0 || len(symbol) > 12 {
+		return false
+	}
+	for _, c := range symbol {
+		if !(c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// assetUse is what the transactions before the one checked, in a block or
+// in the pool, already take from the asset balances and supplies.
+type assetUse struct {
+	// spent is by address and asset.
+	spent  map[string]uint64
+	minted map[string]uint64
+	issued map[string]bool
+}
+
+func newAssetUse() *assetUse {
+	return &assetUse{
+		spent:  make(map[string]uint64),
+		minted: make(map[string]uint64),
+		issued: make(map[string]bool),
+	}
+}
+
+// checkAsset makes sure an issue creates a new asset, a mint is sent by the
+// mint authority without overflowing the supply and a transfer spends no more
+// than the sender holds in state. t is added to used when it passes.
+func (bc *Blockchain) checkAsset(t *Transaction, state *StateTree, used *assetUse) error {
+	switch {
+	case t.kind == IssueTx:
+		id := t.Asset()
+		if used.issued[id] || state.Account(id).Asset != nil {
+			return fmt.Errorf("%w: %s", ErrAssetExists, id)
+		}
+		used.issued[id] = true
+	case t.kind == MintTx:
+		asset := state.Account(t.asset).Asset
+		if asset == nil {
+			return fmt.Errorf("%w: %s", ErrAssetNotFound, t.asset)
+		}
+		if asset.MintAuthority == "" || asset.MintAuthority != t.sender {
+			return fmt.Errorf("%w: %s mints %s", ErrMintAuthority, t.sender, asset.Symbol)
+		}
+		if math.MaxUint64-asset.Supply-used.minted[t.asset] < t.amount {
+			return fmt.Errorf("%w: %s", ErrSupplyOverflow, asset.Symbol)
+		}
+		used.minted[t.asset] += t.amount
+	case t.asset != "":
+		key := t.sender + "/" + t.asset
+		if available := state.Account(t.sender).Assets[t.asset] - used.spent[key]; t.amount > available {
+			return fmt.Errorf("%w: %s spends %d of %d %s", ErrInsufficientFunds, t.sender, t.amount, available, t.asset)
+		}
+		used.spent[key] += t.amount
+	}
+	return nil
+}
+
+// applyAsset issues, mints or transfers the asset of t.
+func (s *StateTree) applyAsset(t *Transaction) error {
+	id := t.Asset()
+	switch t.kind {
+	case IssueTx:
+		s.set(id, Account{Asset: &Asset{
+			ID:            id,
+			Issuer:        t.sender,
+			Symbol:        t.symbol,
+			Decimals:      t.decimals,
+			Supply:        t.amount,
+			MintAuthority: t.mintAuthority,
+		}})
+	case MintTx:
+		record := s.Account(id)
+		if record.Asset == nil {
+			return fmt.Errorf("%w: %s", ErrAssetNotFound, id)
+		}
+		asset := *record.Asset
+		asset.Supply += t.amount
+		record.Asset = &asset
+		s.set(id, record)
+	default:
+		sender := s.Account(t.sender)
+		if sender.Assets[id] < t.amount {
+			return fmt.Errorf("%w: %s holds %d of %s", ErrInsufficientFunds, t.sender, sender.Assets[id], id)
+		}
+		sender.Assets = withAsset(sender.Assets, id, sender.Assets[id]-t.amount)
+		s.set(t.sender, sender)
+	}
+	recipient := s.Account(t.recipient)
+	recipient.Assets = withAsset(recipient.Assets, id, recipient.Assets[id]+t.amount)
+	s.set(t.recipient, recipient)
+	return nil
+}
+
+// withAsset returns a copy of balances with the balance of id set, the
+// account kept to undo a block still holds the old map.
+func withAsset(balances map[string]uint64, id string, balance uint64) map[string]uint64 {
+	c := make(map[string]uint64, len(balances)+1)
+	for k, v := range balances {
+		c[k] = v
+	}
+	if balance == 0 {
+		delete(c, id)
+	} else {
+		c[id] = balance
+	}
+	if len(c) == 0 {
+		return nil
+	}
+	return c
+}
@@ -1,7 +1,6 @@
 package blockchain
 
 import (
-	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -12,7 +11,13 @@ type Block struct {
 	timestamp    int64
 	nonce        int
 	previousHash [32]byte
+	// stateRoot commits to the account state after the block.
+	stateRoot    [32]byte
 	transactions []*Transaction
+
+	// extra and seal are filled in by the consensus engine.
+	extra []byte
+	seal  []byte
 }
 
 func NewBlock(nonce int, previousHash [32]byte, ts []*Transaction) *Block {
@@ -36,16 +41,39 @@ func (b *Block) GetNonce() int {
 	return b.nonce
 }
 
+func (b *Block) GetStateRoot() [32]byte {
+	return b.stateRoot
+}
+
+func (b *Block) GetExtra() []byte {
+	return b.extra
+}
+
+func (b *Block) GetSeal() []byte {
+	return b.seal
+}
+
 func (b *Block) GetTransactions() []*Transaction {
 	return b.transactions
 }
 
-func (b *Block) Hash() ([32]byte, error) {
-	bts, err := json.Marshal(b)
-	if err != nil {
-		return [32]byte{}, err
+// Header returns the header of the block, committing to its transactions by
+// their merkle root.
+func (b *Block) Header() *BlockHeader {
+	return &BlockHeader{
+		Timestamp:    b.timestamp,
+		Nonce:        b.nonce,
+		PreviousHash: b.previousHash,
+		StateRoot:    b.stateRoot,
+		MerkleRoot:   MerkleRoot(b.transactions),
+		Extra:        b.extra,
+		Seal:         b.seal,
 	}
-	return sha256.Sum256(bts), nil
+}
+
+// Hash is the hash of the block header.
+func (b *Block) Hash() ([32]byte, error) {
+	return b.Header().Hash(), nil
 }
 
 func (b *Block) MarshalJSON() ([]byte, error) {
@@ -58,51 +86,85 @@ func (b *Block) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct {
 		Nonce        int                  `json:"nonce"`
 		PreviousHash string               `json:"previous_hash"`
+		StateRoot    string               `json:"state_root"`
 		Timestamp    int64                `json:"timestamp"`
+		Extra        string               `json:"extra,omitempty"`
+		Seal         string               `json:"seal,omitempty"`
 		Transactions map[int]*Transaction `json:"transactions"`
 	}{
 		Nonce:        b.nonce,
 		PreviousHash: fmt.Sprintf("%x", b.previousHash),
+		StateRoot:    fmt.Sprintf("%x", b.stateRoot),
 		Timestamp:    b.timestamp,
+		Extra:        hex.EncodeToString(b.extra),
+		Seal:         hex.EncodeToString(b.seal),
 		Transactions: tMap,
 	})
 }
 
 func (b *Block) UnmarshalJSON(bts []byte) error {
-	var previousHash string
+	var previousHash, stateRoot, extra, seal string
 	var tMap map[int]*Transaction
 	s := struct {
 		Nonce        *int                  `json:"nonce"`
 		PreviousHash *string               `json:"previous_hash"`
+		StateRoot    *string               `json:"state_root"`
 		Timestamp    *int64                `json:"timestamp"`
+		Extra        *string               `json:"extra"`
+		Seal         *string               `json:"seal"`
 		Transactions *map[int]*Transaction `json:"transactions"`
 	}{
 		Nonce:        &b.nonce,
 		PreviousHash: &previousHash,
+		StateRoot:    &stateRoot,
 		Timestamp:    &b.timestamp,
+		Extra:        &extra,
+		Seal:         &seal,
 		Transactions: &tMap,
 	}
 	if err := json.Unmarshal(bts, &s); err != nil {
 		return err
 	}
 
+	// The indices are distinct keys within 0..n-1, so they fill every slot.
 	ts := make([]*Transaction, len(tMap))
 	for i, t := range tMap {
+		if i < 0 || i >= len(ts) {
+			return fmt.Errorf("transaction index %d out of range", i)
+		}
+		if t == nil {
+			return fmt.Errorf("transaction %d is null", i)
+		}
 		ts[i] = t
 	}
+	b.transactions = ts
 
 	ph, err := hex.DecodeString(*s.PreviousHash)
 	if err != nil {
 		return err
 	}
+	if len(ph) != 32 {
+		return fmt.Errorf("invalid previous hash length %d", len(ph))
+	}
 	copy(b.previousHash[:], ph[:32])
-	return nil
+
+	sr, err := decodeHash(stateRoot)
+	if err != nil {
+		return err
+	}
+	b.stateRoot = sr
+	if b.extra, err = decodeBytes(extra); err != nil {
+		return err
+	}
+	b.seal, err = decodeBytes(seal)
+	return err
 }
 
 func (b *Block) Print() {
 	fmt.Printf("timestamp       %d\n", b.timestamp)
 	fmt.Printf("nonce           %d\n", b.nonce)
 	fmt.Printf("previous_hash   %x\n", b.previousHash)
+	fmt.Printf("state_root      %x\n", b.stateRoot)
 	//fmt.Printf("transactions    %v\n", b.Transactions)
 	for _, t := range b.transactions {
 		t.Print()
@@ -1,133 +1,425 @@
 package blockchain
 
 import (
-	"crypto/ecdsa"
+	"context"
 	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"log"
 	"strings"
 	"sync"
+	"time"
 
+	"blockchain/blockchain-service/mempool"
+	"blockchain/blockchain-service/network-params"
 	"blockchain/foundation/cryptography"
 )
 
 const (
-	MIN_DIFFICULTY     = 2
 	BENEFACTOR_ADDRESS = "THE BLOCKCHAIN"
-	MINING_REWARD      = 0.0001
 )
 
 type Blockchain struct {
-	transactionPool   []*Transaction
-	chain             []*Block
+	mempool *mempool.Mempool
+	chain   []*Block
+	// utxos is only kept on networks with a UTXO ledger.
+	utxos *UTXOSet
+	// state is the account state after the last block.
+	state *StateTree
+	// undo holds, by block hash, the accounts before the block changed them.
+	undo map[[32]byte]map[string]Account
+	// tree holds every block known to be on a branch from the genesis block,
+	// the chain and its side branches.
+	tree    map[[32]byte]*blockNode
+	orphans *orphanPool
+	// maxSideBlocks is how many blocks off the chain tree may hold.
+	maxSideBlocks int
+	// genesis is the hash of the block every chain must start with.
+	genesis           [32]byte
 	blockchainAddress string
-	mux               sync.Mutex
+	params            *network_params.Params
+	mux               sync.RWMutex
+
+	// clock is the time blocks from the future are judged by.
+	clock func() time.Time
+
+	consensus    Consensus
+	cancelMining context.CancelFunc
+	// finality is nil unless the network has finality validators.
+	finality *finality
+
+	reorgListeners []func(e *ReorgEvent)
 }
 
-func NewBlockchain(blockchainAddress string) (*Blockchain, error) {
-	b := &Block{}
+func NewBlockchain(blockchainAddress string, params *network_params.Params) (*Blockchain, error) {
+	consensus, err := NewConsensus(params)
+	if err != nil {
+		return nil, err
+	}
 	bc := &Blockchain{
+		mempool:           mempool.New(mempool.DefaultConfig()),
 		blockchainAddress: blockchainAddress,
+		params:            params,
+		consensus:         consensus,
+		clock:             time.Now,
+		state:             NewStateTree(),
+		undo:              make(map[[32]byte]map[string]Account),
+		tree:              make(map[[32]byte]*blockNode),
+		orphans:           newOrphanPool(DefaultMaxOrphans),
+		maxSideBlocks:     DefaultMaxSideBlocks,
+	}
+	if params.UTXO() {
+		bc.utxos = NewUTXOSet()
 	}
 
-	hash, err := b.Hash()
+	genesis, err := genesisBlock(params)
 	if err != nil {
 		return nil, err
 	}
-	bc.createBlock(0, hash)
+	bc.genesis = genesis.Header().Hash()
+	bc.chain = append(bc.chain, genesis)
+	bc.addNode(genesis, bc.genesis)
+	if err := bc.state.apply(genesis.GetTransactions(), nil); err != nil {
+		return nil, err
+	}
+	if err := bc.connectUTXOs(genesis, 0); err != nil {
+		return nil, err
+	}
+	if len(params.FinalityValidators) > 0 {
+		if bc.finality, err = newFinality(params, genesis.Header().Hash()); err != nil {
+			return nil, err
+		}
+	}
 	return bc, nil
 }
 
 // Public
 
-func (bc *Blockchain) SetChain(c []*Block) {
-	bc.chain = c
+func (bc *Blockchain) Params() *network_params.Params {
+	return bc.params
+}
+
+// SetClock replaces the clock the timestamp of new blocks is checked against.
+func (bc *Blockchain) SetClock(clock func() time.Time) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	bc.clock = clock
+}
+
+// Consensus returns the consensus engine of the chain.
+func (bc *Blockchain) Consensus() Consensus {
+	return bc.consensus
+}
+
+// SetMiningWorkers sets the proof of work goroutines, it does nothing under
+// another consensus.
+func (bc *Blockchain) SetMiningWorkers(workers int) {
+	if pow, ok := bc.consensus.(*ProofOfWork); ok {
+		pow.SetWorkers(workers)
+	}
+}
+
+// SetMempoolConfig replaces the mempool limits, keeping the transactions that
+// fit the new ones.
+func (bc *Blockchain) SetMempoolConfig(config mempool.Config) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+
+	m := mempool.New(config)
+	m.Reinsert(bc.mempool.Sorted())
+	bc.mempool = m
+}
+
+func (bc *Blockchain) HashRate() float64 {
+	if pow, ok := bc.consensus.(*ProofOfWork); ok {
+		return pow.HashRate()
+	}
+	return 0
 }
 
 func (bc *Blockchain) Chain() []*Block {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
 	return bc.chain
 }
 
+// TransactionPool returns the pending transactions by fee rate, highest first.
 func (bc *Blockchain) TransactionPool() []*Transaction {
-	return bc.transactionPool
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	return bc.pendingTransactions()
 }
 
-func (bc *Blockchain) TruncateTransactionPool() int {
-	l := len(bc.transactionPool)
-	bc.transactionPool = []*Transaction{}
-	return l
+// PruneTransactionPool drops expired transactions and the ones already in the
+// chain.
+func (bc *Blockchain) PruneTransactionPool() int {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+
+	n := bc.mempool.Expire()
+	for _, b := range bc.chain {
+		n += bc.mempool.RemoveMined(poolTxs(b.GetTransactions()))
+	}
+	if bc.utxos != nil {
+		// Transactions spending outputs that are gone can never be mined.
+		var stale []*Transaction
+		for _, t := range bc.pendingTransactions() {
+			for _, op := range t.inputs {
+				if _, ok := bc.utxos.Get(op); !ok {
+					stale = append(stale, t)
+					break
+				}
+			}
+		}
+		n += bc.mempool.RemoveMined(poolTxs(stale))
+	}
+	return n
 }
 
-func (bc *Blockchain) CreateTransaction(sender, recipient string, value float32, pKey *ecdsa.PublicKey, s *cryptography.Signature) error {
-	return bc.AddTransaction(sender, recipient, value, pKey, s)
+func (bc *Blockchain) CreateTransaction(sender, recipient string, value, fee float32, nonce uint64, pKey cryptography.PublicKey, s *cryptography.Signature) error {
+	return bc.AddTransaction(sender, recipient, value, fee, nonce, pKey, s)
 }
 
-func (bc *Blockchain) AddTransaction(sender, recipient string, value float32, pKey *ecdsa.PublicKey, s *cryptography.Signature) error {
-	t := NewTransaction(sender, recipient, value)
+func (bc *Blockchain) AddTransaction(sender, recipient string, value, fee float32, nonce uint64, pKey cryptography.PublicKey, s *cryptography.Signature) error {
+	t := NewSignedTransaction(sender, recipient, value, fee, nonce, 0, []cryptography.PublicKey{pKey}, []*cryptography.Signature{s})
+	if err := bc.verifyTransaction(t); err != nil {
+		return err
+	}
 
-	if sender != BENEFACTOR_ADDRESS {
-		valid, err := bc.verifyTransactionSignature(pKey, s, t)
-		if err != nil {
-			return err
-		}
-		if !valid {
-			return fmt.Errorf("invalid transaction signature")
-		}
-		//if bc.CalculateBalance(sender) < value {
-		//	return fmt.Errorf("not enouth funds")
-		//}
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	if err := bc.checkFunds(t); err != nil {
+		return err
 	}
+	return bc.mempool.Add(t)
+}
 
-	bc.transactionPool = append(bc.transactionPool, t)
-	return nil
+func (bc *Blockchain) CreateMultisigTransaction(sender, recipient string, value, fee float32, nonce uint64, threshold int, pKeys []cryptography.PublicKey, sigs []*cryptography.Signature) error {
+	return bc.AddMultisigTransaction(sender, recipient, value, fee, nonce, threshold, pKeys, sigs)
+}
+
+func (bc *Blockchain) AddMultisigTransaction(sender, recipient string, value, fee float32, nonce uint64, threshold int, pKeys []cryptography.PublicKey, sigs []*cryptography.Signature) error {
+	t := NewSignedTransaction(sender, recipient, value, fee, nonce, threshold, pKeys, sigs)
+	if err := bc.verifyTransaction(t); err != nil {
+		return err
+	}
+
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	if err := bc.checkFunds(t); err != nil {
+		return err
+	}
+	return bc.mempool.Add(t)
+}
+
+func (bc *Blockchain) CreateUTXOTransaction(sender string, inputs []OutPoint, outputs []TxOutput, fee float32, threshold int, pKeys []cryptography.PublicKey, sigs []*cryptography.Signature) error {
+	return bc.AddUTXOTransaction(sender, inputs, outputs, fee, threshold, pKeys, sigs)
+}
+
+// AddUTXOTransaction adds a transaction spending the given outputs of sender.
+// A threshold above zero makes sender a multisig address.
+func (bc *Blockchain) AddUTXOTransaction(sender string, inputs []OutPoint, outputs []TxOutput, fee float32, threshold int, pKeys []cryptography.PublicKey, sigs []*cryptography.Signature) error {
+	t := NewUTXOTransaction(sender, inputs, outputs, fee, threshold, pKeys, sigs)
+	if err := bc.verifyTransaction(t); err != nil {
+		return err
+	}
+
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	if err := bc.checkFunds(t); err != nil {
+		return err
+	}
+	return bc.mempool.Add(t)
 }
 
 func (bc *Blockchain) Mine() (int64, bool, error) {
-	bc.mux.Lock()
-	defer bc.mux.Unlock()
+	return bc.MineContext(context.Background())
+}
 
-	if len(bc.TransactionPool()) == 0 {
+// MineContext seals a block for the current pool with the consensus engine
+// without holding the chain lock, so reads go on while it runs. Mining is
+// aborted when ctx is done or when the chain tip changes underneath it.
+func (bc *Blockchain) MineContext(ctx context.Context) (int64, bool, error) {
+	bc.mux.Lock()
+	if bc.mempool.Len() == 0 || bc.cancelMining != nil {
+		bc.mux.Unlock()
 		return 0, false, nil
 	}
 
-	err := bc.AddTransaction(BENEFACTOR_ADDRESS, bc.blockchainAddress, MINING_REWARD, nil, nil)
+	template, err := bc.blockTemplate(bc.blockchainAddress)
 	if err != nil {
+		bc.mux.Unlock()
 		return 0, false, err
 	}
+	chain := chainState{blockHeaders(bc.chain), bc.state.Copy()}
+	b := template.Block(0)
+	if err := bc.consensus.Prepare(chain, b); err != nil {
+		bc.mux.Unlock()
+		return 0, false, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	bc.cancelMining = cancel
+	bc.mux.Unlock()
+
+	err = bc.consensus.Seal(ctx, chain, b)
 
-	nonce, err := bc.proofOfWork()
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	cancel()
+	bc.cancelMining = nil
 	if err != nil {
 		return 0, false, err
 	}
 
-	prevHash, err := bc.lastBlock().Hash()
-	if err != nil {
+	if err := bc.acceptBlock(b); err != nil {
 		return 0, false, err
 	}
-	b := bc.createBlock(nonce, prevHash)
 	return b.timestamp, true, nil
 }
 
 func (bc *Blockchain) CalculateBalance(address string) float32 {
-	var balance float32 = 0
-	for _, b := range bc.chain {
-		for _, t := range b.GetTransactions() {
-			if t.recipient == address {
-				balance += t.value
-			}
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+
+	if bc.utxos != nil {
+		return bc.utxos.Balance(address)
+	}
+	return bc.state.Account(address).Balance
+}
+
+// NextNonce returns the nonce of the next transaction of address, after the
+// ones in the last block and in the mempool.
+func (bc *Blockchain) NextNonce(address string) uint64 {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	return bc.nextNonce(address)
+}
 
-			if t.sender == address {
-				balance -= t.value
+func (bc *Blockchain) nextNonce(address string) uint64 {
+	nonce := bc.state.Account(address).Nonce
+	for _, tx := range bc.mempool.BySender(address) {
+		if tx.Nonce() > nonce {
+			nonce = tx.Nonce()
+		}
+	}
+	return nonce + 1
+}
+
+// UTXOs returns the unspent outputs locked to address, or nil on a network
+// with an account ledger.
+func (bc *Blockchain) UTXOs(address string) []*UTXO {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+
+	if bc.utxos == nil {
+		return nil
+	}
+	return bc.utxos.ByAddress(address)
+}
+
+// BalanceProof proves the account of address against the state root of the
+// block at height, or of the last block when height is negative.
+func (bc *Blockchain) BalanceProof(address string, height int) (*BalanceProof, error) {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+
+	if height < 0 {
+		height = len(bc.chain) - 1
+	}
+	if height >= len(bc.chain) {
+		return nil, fmt.Errorf("%w: height %d", ErrBlockNotFound, height)
+	}
+	state := bc.state
+	if height != len(bc.chain)-1 {
+		var err error
+		if state, err = bc.stateAt(bc.chain[:height+1]); err != nil {
+			return nil, err
+		}
+	}
+
+	p := state.Prove(address)
+	p.Height = height
+	if p.StateRoot != bc.chain[height].GetStateRoot() {
+		return nil, fmt.Errorf("state root of block %d does not match the account state", height)
+	}
+	return p, nil
+}
+
+// TransactionProof proves that the transaction id is in a block of the chain.
+func (bc *Blockchain) TransactionProof(id string) (*MerkleProof, error) {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+
+	for height, b := range bc.chain {
+		trs := b.GetTransactions()
+		for i, t := range trs {
+			if t.ID() != id {
+				continue
+			}
+			hash, err := b.Hash()
+			if err != nil {
+				return nil, err
 			}
+			return &MerkleProof{
+				TxID:         id,
+				BlockHash:    hash,
+				Height:       height,
+				Index:        i,
+				Transactions: len(trs),
+				Siblings:     proveInclusion(trs, i),
+			}, nil
 		}
 	}
-	return balance
+	return nil, fmt.Errorf("%w: %s", ErrTxNotFound, id)
+}
+
+// Headers returns the headers of the blocks from height on.
+func (bc *Blockchain) Headers(from int) []*BlockHeader {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+
+	if from < 0 {
+		from = 0
+	}
+	var headers []*BlockHeader
+	for i := from; i < len(bc.chain); i++ {
+		headers = append(headers, bc.chain[i].Header())
+	}
+	return headers
 }
 
 func (bc *Blockchain) ValidChain(chain []*Block) (bool, error) {
+	if len(chain) == 0 {
+		return false, nil
+	}
 	preBlock := chain[0]
 	currentIndex := 1
+	if preBlock.Header().Hash() != bc.genesis {
+		return false, nil
+	}
+	// The checkpoints are cheap to compare, a chain off them is refused
+	// before any block is validated.
+	for height, hash := range bc.params.Checkpoints {
+		if height < len(chain) && chain[height].Header().Hash() != hash {
+			log.Printf("invalid block %d: %s", height, ErrCheckpoint)
+			return false, nil
+		}
+	}
+	assumed := bc.assumeValidHeight(chain)
+
+	// On a UTXO ledger the blocks are checked against the outputs left
+	// unspent by the blocks before them.
+	var view *UTXOSet
+	if bc.params.UTXO() {
+		view = NewUTXOSet()
+		if err := view.Connect(preBlock, 0); err != nil {
+			return false, err
+		}
+	}
+	state := NewStateTree()
+	if err := state.apply(preBlock.GetTransactions(), nil); err != nil {
+		return false, err
+	}
 
 	for currentIndex < len(chain) {
 		b := chain[currentIndex]
@@ -136,20 +428,21 @@ func (bc *Blockchain) ValidChain(chain []*Block) (bool, error) {
 			return false, err
 		}
 		prevHash := b.GetPreviousHash()
-		log.Printf("hash: %s", fmt.Sprintf("%x", hash))
-		log.Printf("prevHash: %s", fmt.Sprintf("%x", prevHash))
 		if prevHash != hash {
 			return false, nil
 		}
 
-		valid, err := bc.validProof(b.GetNonce(), b.GetPreviousHash(), b.GetTransactions(), MIN_DIFFICULTY)
+		next, err := bc.validateBlock(b, chain[:currentIndex], view, state, currentIndex <= assumed)
 		if err != nil {
-			return false, err
-		}
-
-		if !valid {
+			log.Printf("invalid block %d: %s", currentIndex, err)
 			return false, nil
 		}
+		state = next
+		if view != nil {
+			if err := view.Connect(b, currentIndex); err != nil {
+				return false, err
+			}
+		}
 
 		preBlock = b
 		currentIndex++
@@ -159,6 +452,9 @@ func (bc *Blockchain) ValidChain(chain []*Block) (bool, error) {
 }
 
 func (bc *Blockchain) Print() {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+
 	for i, block := range bc.chain {
 		fmt.Printf("%s chain %d %s\n", strings.Repeat("=", 25), i,
 			strings.Repeat("=", 25))
@@ -168,6 +464,9 @@ func (bc *Blockchain) Print() {
 }
 
 func (bc *Blockchain) MarshalJSON() ([]byte, error) {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+
 	return json.Marshal(struct {
 		Blocks []*Block `json:"chain"`
 	}{
@@ -186,72 +485,243 @@ func (bc *Blockchain) UnmarshalJSON(b []byte) error {
 
 // Private
 
-func (bc *Blockchain) createBlock(nonce int, previousHash [32]byte) *Block {
-	b := NewBlock(nonce, previousHash, bc.TransactionPool())
-	bc.chain = append(bc.chain, b)
-	bc.transactionPool = []*Transaction{}
-	return b
+// genesisBlock is the same on every node of a chain. It pays the allocations
+// and locks the stakes of the chain with coinbase transactions and its
+// previous hash commits to the chain ID and its consensus parameters.
+func genesisBlock(params *network_params.Params) (*Block, error) {
+	var trs []*Transaction
+	for _, a := range params.Allocations {
+		trs = append(trs, NewCoinbaseTransaction(0, a.Address, a.Value))
+	}
+	for _, a := range params.Stakes {
+		t := NewCoinbaseTransaction(0, a.Address, a.Value)
+		t.kind = StakeTx
+		trs = append(trs, t)
+	}
+	b := NewBlock(0, params.GenesisCommitment(), trs)
+	b.timestamp = params.GenesisTimestamp
+
+	state := NewStateTree()
+	if err := state.apply(trs, nil); err != nil {
+		return nil, fmt.Errorf("invalid genesis: %w", err)
+	}
+	b.stateRoot = state.Root()
+	return b, nil
+}
+
+// Genesis returns the first block of the chain.
+func (bc *Blockchain) Genesis() *Block {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	return bc.chain[0]
+}
+
+// GenesisHeader returns the header a chain of the network must start with.
+func GenesisHeader(params *network_params.Params) (*BlockHeader, error) {
+	b, err := genesisBlock(params)
+	if err != nil {
+		return nil, err
+	}
+	return b.Header(), nil
+}
+
+// connectUTXOs keeps the UTXO set, if any, in step with a block appended at
+// height.
+func (bc *Blockchain) connectUTXOs(b *Block, height int) error {
+	if bc.utxos == nil {
+		return nil
+	}
+	return bc.utxos.Connect(b, height)
+}
+
+// stateAt replays chain into the account state after its last block.
+func (bc *Blockchain) stateAt(chain []*Block) (*StateTree, error) {
+	state := NewStateTree()
+	var view *UTXOSet
+	if bc.params.UTXO() {
+		view = NewUTXOSet()
+	}
+	for i, b := range chain {
+		if err := state.apply(b.GetTransactions(), view); err != nil {
+			return nil, err
+		}
+		if view != nil {
+			if err := view.Connect(b, i); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return state, nil
+}
+
+// removeFromPool drops the given transactions and keeps everything that
+// arrived while the block was being mined.
+func (bc *Blockchain) removeFromPool(trs []*Transaction) {
+	bc.mempool.RemoveMined(poolTxs(trs))
+}
+
+func (bc *Blockchain) pendingTransactions() []*Transaction {
+	txs := bc.mempool.Sorted()
+	trs := make([]*Transaction, len(txs))
+	for i, tx := range txs {
+		trs[i] = tx.(*Transaction)
+	}
+	return trs
+}
+
+// poolTxs leaves out the coinbase, which never goes through the mempool.
+func poolTxs(trs []*Transaction) []mempool.Tx {
+	txs := make([]mempool.Tx, 0, len(trs))
+	for _, t := range trs {
+		if t.coinbase {
+			continue
+		}
+		txs = append(txs, t)
+	}
+	return txs
+}
+
+func (bc *Blockchain) abortMining() {
+	if bc.cancelMining != nil {
+		bc.cancelMining()
+	}
 }
 
 func (bc *Blockchain) lastBlock() *Block {
 	return bc.chain[len(bc.chain)-1]
 }
 
-func (bc *Blockchain) copyTransactionPool() []*Transaction {
-	transactions := make([]*Transaction, len(bc.TransactionPool()))
-	for i, t := range bc.TransactionPool() {
-		transactions[i] = NewTransaction(t.sender, t.recipient, t.value)
-	}
-	return transactions
+// verifyTransaction checks that both addresses are well formed, that a stake
+// transaction or evidence is sound, that the sender is the address of the
+// signing key (or multisig key set) and that the signatures are valid.
+func (bc *Blockchain) verifyTransaction(t *Transaction) error {
+	return bc.checkTransaction(t, true)
 }
 
-func (bc *Blockchain) verifyTransactionSignature(sender *ecdsa.PublicKey, sign *cryptography.Signature, t *Transaction) (bool, error) {
-	b, err := json.Marshal(t)
+// checkTransaction is verifyTransaction, leaving out the signatures unless
+// signatures is set.
+func (bc *Blockchain) checkTransaction(t *Transaction, signatures bool) error {
+	if t.coinbase {
+		return ErrCoinbase
+	}
+	if t.fee < 0 {
+		return ErrNegativeFee
+	}
+	if t.IsUTXO() != bc.params.UTXO() {
+		return ErrLedger
+	}
+	if err := bc.verifyKind(t); err != nil {
+		return err
+	}
+	if err := cryptography.ValidateBlockchainAddress(t.sender, bc.params); err != nil {
+		return &InvalidAddressError{Address: t.sender, Err: err}
+	}
+	if t.IsUTXO() {
+		if err := bc.verifyOutputs(t); err != nil {
+			return err
+		}
+	} else if err := cryptography.ValidateBlockchainAddress(t.recipient, bc.params); err != nil {
+		return &InvalidAddressError{Address: t.recipient, Err: err}
+	}
+
+	if t.IsMultisig() {
+		derived, err := cryptography.GenerateMultisigAddress(t.threshold, t.publicKeys, bc.params)
+		if err != nil {
+			return err
+		}
+		if derived != t.sender {
+			return &AddressMismatchError{Sender: t.sender, Derived: derived}
+		}
+		if !signatures {
+			return nil
+		}
+
+		valid, err := bc.verifyMultisigTransaction(t)
+		if err != nil {
+			return err
+		}
+		if !valid {
+			return fmt.Errorf("%w: need %d of %d signatures", ErrInvalidSignature, t.threshold, len(t.publicKeys))
+		}
+		return nil
+	}
+
+	if len(t.publicKeys) != 1 || len(t.signatures) != 1 || t.publicKeys[0] == nil || t.signatures[0] == nil {
+		return ErrInvalidSignature
+	}
+	derived := cryptography.GenerateBlockchainAddress(t.publicKeys[0], bc.params)
+	if derived != t.sender {
+		return &AddressMismatchError{Sender: t.sender, Derived: derived}
+	}
+	if !signatures {
+		return nil
+	}
+
+	valid, err := bc.verifyTransactionSignature(t.publicKeys[0], t.signatures[0], t)
 	if err != nil {
-		return false, err
+		return err
 	}
-	h := sha256.Sum256(b)
-	return ecdsa.Verify(sender, h[:], sign.R, sign.S), nil
+	if !valid {
+		return ErrInvalidSignature
+	}
+	return nil
 }
 
-func (bc *Blockchain) validProof(nonce int, prevHash [32]byte, trs []*Transaction, difficulty int) (bool, error) {
-	log.Printf("nonce: %d", nonce)
-	log.Printf("prevHash: %s", fmt.Sprintf("%x", prevHash))
-	log.Printf("trs: %v", trs)
-	log.Printf("difficulty: %d", difficulty)
-
-	zeros := strings.Repeat("0", difficulty)
-	guessBlock := Block{
-		nonce:        nonce,
-		previousHash: prevHash,
-		timestamp:    0,
-		transactions: trs,
+// verifyOutputs checks the shape of a UTXO transaction: distinct inputs and
+// positive outputs to valid addresses, with no account style recipient.
+func (bc *Blockchain) verifyOutputs(t *Transaction) error {
+	if t.recipient != "" || t.value != 0 || len(t.outputs) == 0 {
+		return fmt.Errorf("%w: a UTXO transaction pays its outputs only", ErrLedger)
+	}
+	seen := make(map[OutPoint]bool)
+	for _, op := range t.inputs {
+		if seen[op] {
+			return fmt.Errorf("%w: %s:%d is spent twice", ErrDoubleSpend, op.TxID, op.Index)
+		}
+		seen[op] = true
 	}
-	hash, err := guessBlock.Hash()
+	for _, out := range t.outputs {
+		if out.Value <= 0 {
+			return fmt.Errorf("output of %f to %s must be positive", out.Value, out.Address)
+		}
+		if err := cryptography.ValidateBlockchainAddress(out.Address, bc.params); err != nil {
+			return &InvalidAddressError{Address: out.Address, Err: err}
+		}
+	}
+	return nil
+}
+
+func (bc *Blockchain) verifyTransactionSignature(sender cryptography.PublicKey, sign *cryptography.Signature, t *Transaction) (bool, error) {
+	b, err := t.SignedPayload()
 	if err != nil {
-		return false, nil
+		return false, err
 	}
-	gHashString := fmt.Sprintf("%x", hash)
-	log.Printf("gHashString: %s", gHashString)
-	return gHashString[:difficulty] == zeros, nil
+	h := sha256.Sum256(b)
+	return sender.Verify(h[:], sign), nil
 }
 
-func (bc *Blockchain) proofOfWork() (int, error) {
-	trs := bc.copyTransactionPool()
-	prevHash, err := bc.lastBlock().Hash()
+// verifyMultisigTransaction requires threshold signatures, each made by a
+// different key of the set. A signature can only be counted once.
+func (bc *Blockchain) verifyMultisigTransaction(t *Transaction) (bool, error) {
+	b, err := t.SignedPayload()
 	if err != nil {
-		return 0, err
+		return false, err
 	}
+	h := sha256.Sum256(b)
 
-	nonce := 0
-	invalid := true
-	for invalid {
-		valid, err := bc.validProof(nonce, prevHash, trs, MIN_DIFFICULTY)
-		if err != nil {
-			return 0, err
+	usedSignatures := make(map[int]bool)
+	valid := 0
+	for _, pKey := range t.publicKeys {
+		for i, sign := range t.signatures {
+			if usedSignatures[i] {
+				continue
+			}
+			if pKey.Verify(h[:], sign) {
+				usedSignatures[i] = true
+				valid++
+				break
+			}
 		}
-		invalid = !valid
-		nonce += 1
 	}
-	return nonce, nil
+	return valid >= t.threshold, nil
 }
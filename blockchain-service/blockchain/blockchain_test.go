@@ -1,6 +1,19 @@
 package blockchain
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"blockchain/blockchain-service/mempool"
+	"blockchain/blockchain-service/network-params"
+	"blockchain/blockchain-service/vm"
 	"blockchain/blockchain-service/wallet"
 	"blockchain/foundation/cryptography"
 	"fmt"
@@ -8,33 +21,35 @@ import (
 )
 
 func Test_Blockchain(t *testing.T) {
-	miner, err := wallet.NewWallet(cryptography.GenerateBlockchainAddress)
+	params := testNetwork()
+	miner, err := wallet.NewWallet(cryptography.P256, params.GenerateBlockchainAddress)
 	if err != nil {
 		t.Errorf("Failed to instatiate a wallet with err: %s", err)
 	}
 
-	niko, err := wallet.NewWallet(cryptography.GenerateBlockchainAddress)
+	niko, err := wallet.NewWallet(cryptography.P256, params.GenerateBlockchainAddress)
 	if err != nil {
 		t.Errorf("Failed to instatiate a wallet with err: %s", err)
 	}
 
-	itay, err := wallet.NewWallet(cryptography.GenerateBlockchainAddress)
+	itay, err := wallet.NewWallet(cryptography.P256, params.GenerateBlockchainAddress)
 	if err != nil {
 		t.Errorf("Failed to instatiate a wallet with err: %s", err)
 	}
 
-	bc, err := NewBlockchain(miner.BlockchainAddress())
+	bc, err := NewBlockchain(miner.BlockchainAddress(), params)
 	if err != nil {
 		t.Errorf("Failed to instatiate a blockchain with err: %s", err)
 	}
-	tr := wallet.NewTransaction(itay.PrivateKey(), itay.PublicKey(), itay.BlockchainAddress(), niko.BlockchainAddress(), 1.0)
+	fund(t, bc, itay.BlockchainAddress())
+	tr := wallet.NewTransactionWithNonce(itay.PrivateKey(), itay.PublicKey(), itay.BlockchainAddress(), niko.BlockchainAddress(), 1.0, 0, 1)
 
 	s, err := tr.GenerateSignature()
 	if err != nil {
 		t.Errorf("Failed to GenerateSignature with err: %s", err)
 	}
 
-	err = bc.AddTransaction(itay.BlockchainAddress(), niko.BlockchainAddress(), 1.0, itay.PublicKey(), s)
+	err = bc.AddTransaction(itay.BlockchainAddress(), niko.BlockchainAddress(), 1.0, 0, 1, itay.PublicKey(), s)
 	if err != nil {
 		t.Errorf("Failed to CreateTransaction with err: %s", err)
 	}
@@ -82,3 +97,2371 @@ func Test_Blockchain(t *testing.T) {
 	//}
 	bc.Print()
 }
+
+func Test_MultisigTransaction(t *testing.T) {
+	params := testNetwork()
+	miner, err := wallet.NewWallet(cryptography.P256, params.GenerateBlockchainAddress)
+	if err != nil {
+		t.Errorf("Failed to instatiate a wallet with err: %s", err)
+	}
+
+	var signers []*wallet.Wallet
+	var pKeys []cryptography.PublicKey
+	for i := 0; i < 3; i++ {
+		w, err := wallet.NewWallet(cryptography.P256, params.GenerateBlockchainAddress)
+		if err != nil {
+			t.Errorf("Failed to instatiate a wallet with err: %s", err)
+		}
+		signers = append(signers, w)
+		pKeys = append(pKeys, w.PublicKey())
+	}
+
+	treasury, err := cryptography.GenerateMultisigAddress(2, pKeys, params)
+	if err != nil {
+		t.Errorf("Failed to GenerateMultisigAddress with err: %s", err)
+	}
+
+	bc, err := NewBlockchain(miner.BlockchainAddress(), params)
+	if err != nil {
+		t.Errorf("Failed to instatiate a blockchain with err: %s", err)
+	}
+	fund(t, bc, treasury)
+
+	sign := func(w *wallet.Wallet) *cryptography.Signature {
+		s, err := wallet.NewTransactionWithNonce(w.PrivateKey(), w.PublicKey(), treasury, miner.BlockchainAddress(), 1.0, 0, 1).GenerateSignature()
+		if err != nil {
+			t.Errorf("Failed to GenerateSignature with err: %s", err)
+		}
+		return s
+	}
+
+	s0 := sign(signers[0])
+	if err := bc.AddMultisigTransaction(treasury, miner.BlockchainAddress(), 1.0, 0, 1, 2, pKeys, []*cryptography.Signature{s0}); err == nil {
+		t.Errorf("Expected 1 of 2 signatures to be rejected")
+	}
+	if err := bc.AddMultisigTransaction(treasury, miner.BlockchainAddress(), 1.0, 0, 1, 2, pKeys, []*cryptography.Signature{s0, s0}); err == nil {
+		t.Errorf("Expected a repeated signature to be counted once")
+	}
+	if err := bc.AddMultisigTransaction(miner.BlockchainAddress(), miner.BlockchainAddress(), 1.0, 0, 1, 2, pKeys, []*cryptography.Signature{s0, sign(signers[2])}); err == nil {
+		t.Errorf("Expected a sender that is not the multisig address to be rejected")
+	}
+	if err := bc.AddMultisigTransaction(treasury, miner.BlockchainAddress(), 1.0, 0, 1, 2, pKeys, []*cryptography.Signature{sign(signers[2]), s0}); err != nil {
+		t.Errorf("Failed to AddMultisigTransaction with err: %s", err)
+	}
+
+	if _, mined, err := bc.Mine(); err != nil || !mined {
+		t.Errorf("Failed to Mine with err: %v", err)
+	}
+	if valid, err := bc.ValidChain(bc.Chain()); err != nil || !valid {
+		t.Errorf("Chain with multisig transaction is not valid, err: %v", err)
+	}
+}
+
+func Test_AddressBinding(t *testing.T) {
+	niko, err := wallet.NewWallet(cryptography.P256, network_params.MainNet.GenerateBlockchainAddress)
+	if err != nil {
+		t.Errorf("Failed to instatiate a wallet with err: %s", err)
+	}
+	itay, err := wallet.NewWallet(cryptography.P256, network_params.MainNet.GenerateBlockchainAddress)
+	if err != nil {
+		t.Errorf("Failed to instatiate a wallet with err: %s", err)
+	}
+
+	bc, err := NewBlockchain(niko.BlockchainAddress(), network_params.MainNet)
+	if err != nil {
+		t.Errorf("Failed to instatiate a blockchain with err: %s", err)
+	}
+
+	// Itay signs a transaction that claims to spend from Niko's address.
+	s, err := wallet.NewTransactionWithNonce(itay.PrivateKey(), itay.PublicKey(), niko.BlockchainAddress(), itay.BlockchainAddress(), 1.0, 0, 1).GenerateSignature()
+	if err != nil {
+		t.Errorf("Failed to GenerateSignature with err: %s", err)
+	}
+	err = bc.AddTransaction(niko.BlockchainAddress(), itay.BlockchainAddress(), 1.0, 0, 1, itay.PublicKey(), s)
+	var mismatch *AddressMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Errorf("Expected AddressMismatchError, got: %v", err)
+	}
+
+	s, err = wallet.NewTransactionWithNonce(itay.PrivateKey(), itay.PublicKey(), itay.BlockchainAddress(), "Niko", 1.0, 0, 1).GenerateSignature()
+	if err != nil {
+		t.Errorf("Failed to GenerateSignature with err: %s", err)
+	}
+	err = bc.AddTransaction(itay.BlockchainAddress(), "Niko", 1.0, 0, 1, itay.PublicKey(), s)
+	var invalid *InvalidAddressError
+	if !errors.As(err, &invalid) || !errors.Is(err, cryptography.ErrAddressLength) {
+		t.Errorf("Expected InvalidAddressError, got: %v", err)
+	}
+
+	// The same key on another network yields an address mainnet rejects.
+	testnetAddress := network_params.TestNet.GenerateBlockchainAddress(itay.PublicKey())
+	s, err = wallet.NewTransactionWithNonce(itay.PrivateKey(), itay.PublicKey(), testnetAddress, niko.BlockchainAddress(), 1.0, 0, 1).GenerateSignature()
+	if err != nil {
+		t.Errorf("Failed to GenerateSignature with err: %s", err)
+	}
+	err = bc.AddTransaction(testnetAddress, niko.BlockchainAddress(), 1.0, 0, 1, itay.PublicKey(), s)
+	if !errors.Is(err, cryptography.ErrAddressVersion) {
+		t.Errorf("Expected a testnet address to be rejected, got: %v", err)
+	}
+}
+
+func Test_MiningEngine(t *testing.T) {
+	trs := []*Transaction{NewTransaction(BENEFACTOR_ADDRESS, "Niko", 1.0)}
+	engine := NewMiningEngine(4)
+
+	header := BlockHeader{Timestamp: time.Now().UnixNano(), MerkleRoot: MerkleRoot(trs)}
+	result, err := engine.Solve(context.Background(), header, 2)
+	if err != nil {
+		t.Fatalf("Failed to Solve with err: %s", err)
+	}
+	header.Nonce = result.Nonce
+	if !header.Meets(2) {
+		t.Errorf("Solved nonce %d is not a valid proof", result.Nonce)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := engine.Solve(ctx, header, 64); !errors.Is(err, ErrMiningAborted) {
+		t.Errorf("Expected ErrMiningAborted, got: %v", err)
+	}
+}
+
+func Test_BlockTemplate(t *testing.T) {
+	params := testNetwork()
+	niko, err := wallet.NewWallet(cryptography.P256, params.GenerateBlockchainAddress)
+	if err != nil {
+		t.Errorf("Failed to instatiate a wallet with err: %s", err)
+	}
+	itay, err := wallet.NewWallet(cryptography.P256, params.GenerateBlockchainAddress)
+	if err != nil {
+		t.Errorf("Failed to instatiate a wallet with err: %s", err)
+	}
+
+	bc, err := NewBlockchain(niko.BlockchainAddress(), params)
+	if err != nil {
+		t.Errorf("Failed to instatiate a blockchain with err: %s", err)
+	}
+	fund(t, bc, itay.BlockchainAddress())
+	s, err := wallet.NewTransactionWithNonce(itay.PrivateKey(), itay.PublicKey(), itay.BlockchainAddress(), niko.BlockchainAddress(), 1.0, 0, 1).GenerateSignature()
+	if err != nil {
+		t.Errorf("Failed to GenerateSignature with err: %s", err)
+	}
+	if err := bc.AddTransaction(itay.BlockchainAddress(), niko.BlockchainAddress(), 1.0, 0, 1, itay.PublicKey(), s); err != nil {
+		t.Errorf("Failed to AddTransaction with err: %s", err)
+	}
+
+	template, err := bc.BlockTemplate()
+	if err != nil {
+		t.Errorf("Failed to get BlockTemplate with err: %s", err)
+	}
+	if template.Empty() || template.Height != 2 {
+		t.Errorf("Unexpected template height %d with %d transactions", template.Height, len(template.Transactions))
+	}
+
+	// The template and the solved block travel as JSON between the node and
+	// an external miner.
+	b, err := json.Marshal(template)
+	if err != nil {
+		t.Errorf("Failed to marshal template with err: %s", err)
+	}
+	var received BlockTemplate
+	if err := json.Unmarshal(b, &received); err != nil {
+		t.Errorf("Failed to unmarshal template with err: %s", err)
+	}
+	block, _, err := received.Solve(context.Background(), NewMiningEngine(2))
+	if err != nil {
+		t.Errorf("Failed to Solve with err: %s", err)
+	}
+	b, err = json.Marshal(block)
+	if err != nil {
+		t.Errorf("Failed to marshal block with err: %s", err)
+	}
+	var submitted Block
+	if err := json.Unmarshal(b, &submitted); err != nil {
+		t.Errorf("Failed to unmarshal block with err: %s", err)
+	}
+
+	if err := bc.SubmitBlock(&submitted); err != nil {
+		t.Errorf("Failed to SubmitBlock with err: %s", err)
+	}
+	if len(bc.TransactionPool()) != 0 {
+		t.Errorf("Expected the pool to be emptied, has %d", len(bc.TransactionPool()))
+	}
+	if balance := bc.CalculateBalance(niko.BlockchainAddress()); balance != 1+params.Subsidy(2) {
+		t.Errorf("Wrong calculation %f", balance)
+	}
+	if err := bc.SubmitBlock(&submitted); !errors.Is(err, ErrStaleBlock) {
+		t.Errorf("Expected ErrStaleBlock, got: %v", err)
+	}
+}
+
+func Test_BlockUnmarshal(t *testing.T) {
+	b, err := json.Marshal(NewBlock(0, [32]byte{}, []*Transaction{NewCoinbaseTransaction(1, BENEFACTOR_ADDRESS, 1)}))
+	if err != nil {
+		t.Fatalf("Failed to marshal block with err: %s", err)
+	}
+	var block Block
+	if err := json.Unmarshal(b, &block); err != nil || len(block.GetTransactions()) != 1 {
+		t.Fatalf("Failed to unmarshal block with err: %v", err)
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		t.Fatalf("Failed to unmarshal block fields with err: %s", err)
+	}
+	tx := string(fields["transactions"])[len(`{"0":`) : len(fields["transactions"])-1]
+	for _, transactions := range []string{`{"0":null}`, `{"1":` + tx + `}`, `{"-1":` + tx + `}`, `{"0":` + tx + `,"2":` + tx + `}`} {
+		fields["transactions"] = json.RawMessage(transactions)
+		malformed, err := json.Marshal(fields)
+		if err != nil {
+			t.Fatalf("Failed to marshal block fields with err: %s", err)
+		}
+		if err := json.Unmarshal(malformed, &Block{}); err == nil {
+			t.Errorf("Expected transactions %s to be rejected", transactions)
+		}
+	}
+}
+
+func Test_Fees(t *testing.T) {
+	params := *testNetwork()
+	params.MaxBlockTransactions = 1
+	miner, err := wallet.NewWallet(cryptography.P256, params.GenerateBlockchainAddress)
+	if err != nil {
+		t.Errorf("Failed to instatiate a wallet with err: %s", err)
+	}
+	niko, err := wallet.NewWallet(cryptography.P256, params.GenerateBlockchainAddress)
+	if err != nil {
+		t.Errorf("Failed to instatiate a wallet with err: %s", err)
+	}
+
+	bc, err := NewBlockchain(miner.BlockchainAddress(), &params)
+	if err != nil {
+		t.Errorf("Failed to instatiate a blockchain with err: %s", err)
+	}
+	fund(t, bc, niko.BlockchainAddress())
+
+	for i, fee := range []float32{0.1, 0.5, 0} {
+		nonce := uint64(i + 1)
+		s, err := wallet.NewTransactionWithNonce(niko.PrivateKey(), niko.PublicKey(), niko.BlockchainAddress(), miner.BlockchainAddress(), 1.0, fee, nonce).GenerateSignature()
+		if err != nil {
+			t.Errorf("Failed to GenerateSignature with err: %s", err)
+		}
+		if err := bc.AddTransaction(niko.BlockchainAddress(), miner.BlockchainAddress(), 1.0, fee, nonce, niko.PublicKey(), s); err != nil {
+			t.Errorf("Failed to AddTransaction with err: %s", err)
+		}
+	}
+
+	// The fee is covered by the signature.
+	s, err := wallet.NewTransactionWithNonce(niko.PrivateKey(), niko.PublicKey(), niko.BlockchainAddress(), miner.BlockchainAddress(), 1.0, 0, 4).GenerateSignature()
+	if err != nil {
+		t.Errorf("Failed to GenerateSignature with err: %s", err)
+	}
+	if err := bc.AddTransaction(niko.BlockchainAddress(), miner.BlockchainAddress(), 1.0, 0.2, 4, niko.PublicKey(), s); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Expected ErrInvalidSignature, got: %v", err)
+	}
+
+	pool := bc.TransactionPool()
+	if len(pool) != 3 || pool[0].Fee() != 0.5 || pool[1].Fee() != 0.1 || pool[2].Fee() != 0 {
+		t.Errorf("Expected the pool to be ordered by fee rate")
+	}
+
+	// The best paying transaction waits for the one before it in nonce order.
+	template, err := bc.BlockTemplate()
+	if err != nil {
+		t.Errorf("Failed to get BlockTemplate with err: %s", err)
+	}
+	if len(template.Transactions) != 2 || template.CoinbaseValue != params.Subsidy(template.Height)+0.1 {
+		t.Errorf("Unexpected template with %d transactions paying %f", len(template.Transactions), template.CoinbaseValue)
+	}
+
+	if _, mined, err := bc.Mine(); err != nil || !mined {
+		t.Errorf("Failed to Mine with err: %v", err)
+	}
+	if len(bc.TransactionPool()) != 2 {
+		t.Errorf("Expected 2 transactions left in the pool, has %d", len(bc.TransactionPool()))
+	}
+	if balance := bc.CalculateBalance(niko.BlockchainAddress()); balance != params.Subsidy(1)-1.1 {
+		t.Errorf("Wrong calculation %f", balance)
+	}
+
+	estimate := bc.EstimateFee(0)
+	if estimate.Transactions != 1 || estimate.Median <= 0 {
+		t.Errorf("Unexpected fee estimate %+v", estimate)
+	}
+}
+
+func Test_ReorgReinsertsTransactions(t *testing.T) {
+	params := testNetwork()
+	niko, err := wallet.NewWallet(cryptography.P256, params.GenerateBlockchainAddress)
+	if err != nil {
+		t.Errorf("Failed to instatiate a wallet with err: %s", err)
+	}
+
+	bc, err := NewBlockchain(niko.BlockchainAddress(), params)
+	if err != nil {
+		t.Errorf("Failed to instatiate a blockchain with err: %s", err)
+	}
+	fund(t, bc, niko.BlockchainAddress())
+	s, err := wallet.NewTransactionWithNonce(niko.PrivateKey(), niko.PublicKey(), niko.BlockchainAddress(), niko.BlockchainAddress(), 1.0, 0, 1).GenerateSignature()
+	if err != nil {
+		t.Errorf("Failed to GenerateSignature with err: %s", err)
+	}
+	if err := bc.AddTransaction(niko.BlockchainAddress(), niko.BlockchainAddress(), 1.0, 0, 1, niko.PublicKey(), s); err != nil {
+		t.Errorf("Failed to AddTransaction with err: %s", err)
+	}
+	if err := bc.AddTransaction(niko.BlockchainAddress(), niko.BlockchainAddress(), 1.0, 0, 1, niko.PublicKey(), s); !errors.Is(err, mempool.ErrDuplicate) {
+		t.Errorf("Expected mempool.ErrDuplicate, got: %v", err)
+	}
+
+	if _, mined, err := bc.Mine(); err != nil || !mined {
+		t.Errorf("Failed to Mine with err: %v", err)
+	}
+	chain := bc.Chain()
+	if len(bc.TransactionPool()) != 0 {
+		t.Errorf("Expected an empty pool after mining")
+	}
+
+	// Disconnecting the block puts its transaction back, connecting it again
+	// takes it out.
+	bc.SetChain(chain[:2])
+	if len(bc.TransactionPool()) != 1 {
+		t.Errorf("Expected the disconnected transaction back in the pool")
+	}
+	bc.SetChain(chain)
+	if len(bc.TransactionPool()) != 0 {
+		t.Errorf("Expected the reconnected transaction to leave the pool")
+	}
+}
+
+func Test_Nonces(t *testing.T) {
+	params := testNetwork()
+	niko, err := wallet.NewWallet(cryptography.P256, params.GenerateBlockchainAddress)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a wallet with err: %s", err)
+	}
+	itay, err := wallet.NewWallet(cryptography.P256, params.GenerateBlockchainAddress)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a wallet with err: %s", err)
+	}
+	bc, err := NewBlockchain(niko.BlockchainAddress(), params)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a blockchain with err: %s", err)
+	}
+	fund(t, bc, niko.BlockchainAddress())
+	send := func(nonce uint64) (*cryptography.Signature, error) {
+		s, err := wallet.NewTransactionWithNonce(niko.PrivateKey(), niko.PublicKey(), niko.BlockchainAddress(), itay.BlockchainAddress(), 1.0, 0, nonce).GenerateSignature()
+		if err != nil {
+			t.Fatalf("Failed to GenerateSignature with err: %s", err)
+		}
+		return s, bc.AddTransaction(niko.BlockchainAddress(), itay.BlockchainAddress(), 1.0, 0, nonce, niko.PublicKey(), s)
+	}
+
+	for _, nonce := range []uint64{0, 2} {
+		if _, err := send(nonce); !errors.Is(err, ErrInvalidNonce) {
+			t.Errorf("Expected ErrInvalidNonce for nonce %d, got: %v", nonce, err)
+		}
+	}
+	s, err := send(1)
+	if err != nil {
+		t.Fatalf("Failed to AddTransaction with err: %s", err)
+	}
+	if next := bc.NextNonce(niko.BlockchainAddress()); next != 2 {
+		t.Errorf("Expected the next nonce to be 2, got %d", next)
+	}
+	if _, mined, err := bc.Mine(); err != nil || !mined {
+		t.Fatalf("Failed to Mine with err: %v", err)
+	}
+
+	// The signed transfer can not be sent again once it is mined, neither
+	// to the pool nor in a block.
+	if err := bc.AddTransaction(niko.BlockchainAddress(), itay.BlockchainAddress(), 1.0, 0, 1, niko.PublicKey(), s); !errors.Is(err, ErrInvalidNonce) {
+		t.Errorf("Expected ErrInvalidNonce replaying a mined transfer, got: %v", err)
+	}
+	replay := NewSignedTransaction(niko.BlockchainAddress(), itay.BlockchainAddress(), 1.0, 0, 1, 0, []cryptography.PublicKey{niko.PublicKey()}, []*cryptography.Signature{s})
+	trs := []*Transaction{NewCoinbaseTransaction(3, niko.BlockchainAddress(), params.Subsidy(3)), replay}
+	state := bc.state.Copy()
+	if err := state.apply(trs, nil); err != nil {
+		t.Fatalf("Failed to apply the block with err: %s", err)
+	}
+	prevHash, _ := bc.lastBlock().Hash()
+	b := NewBlock(0, prevHash, trs)
+	b.stateRoot = state.Root()
+	result, err := NewMiningEngine(0).Solve(context.Background(), *b.Header(), params.MinDifficulty)
+	if err != nil {
+		t.Fatalf("Failed to Solve with err: %s", err)
+	}
+	b.nonce = result.Nonce
+	if err := bc.SubmitBlock(b); !errors.Is(err, ErrInvalidNonce) {
+		t.Errorf("Expected ErrInvalidNonce for a block replaying a transfer, got: %v", err)
+	}
+	if balance := bc.CalculateBalance(itay.BlockchainAddress()); balance != 1 {
+		t.Errorf("Expected the transfer to be paid once, got a balance of %f", balance)
+	}
+}
+
+func Test_Coinbase(t *testing.T) {
+	params := *testNetwork()
+	params.MiningReward = 4
+	params.HalvingInterval = 2
+	params.MaxSupply = 10
+	params.CoinbaseMaturity = 2
+
+	// Heights 1, 2-3 and 4-5 pay 4, 2 and 1, after that the supply is capped.
+	for height, subsidy := range []float32{0, 4, 2, 2, 1, 1, 0} {
+		if params.Subsidy(height) != subsidy {
+			t.Errorf("Expected a subsidy of %f at height %d, got %f", subsidy, height, params.Subsidy(height))
+		}
+	}
+	if params.Supply(100) != params.MaxSupply {
+		t.Errorf("Expected the supply to be capped at %f, got %f", params.MaxSupply, params.Supply(100))
+	}
+
+	niko, err := wallet.NewWallet(cryptography.P256, params.GenerateBlockchainAddress)
+	if err != nil {
+		t.Errorf("Failed to instatiate a wallet with err: %s", err)
+	}
+	bc, err := NewBlockchain(niko.BlockchainAddress(), &params)
+	if err != nil {
+		t.Errorf("Failed to instatiate a blockchain with err: %s", err)
+	}
+
+	fund(t, bc, niko.BlockchainAddress())
+	if supply := bc.Supply(); supply.Immature != 4 || supply.Circulating != 0 || supply.NextSubsidy != 2 {
+		t.Errorf("Unexpected supply %+v", supply)
+	}
+	s, err := wallet.NewTransactionWithNonce(niko.PrivateKey(), niko.PublicKey(), niko.BlockchainAddress(), niko.BlockchainAddress(), 1.0, 0, 1).GenerateSignature()
+	if err != nil {
+		t.Errorf("Failed to GenerateSignature with err: %s", err)
+	}
+	if err := bc.AddTransaction(niko.BlockchainAddress(), niko.BlockchainAddress(), 1.0, 0, 1, niko.PublicKey(), s); !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("Expected an immature coinbase to be unspendable, got: %v", err)
+	}
+
+	fund(t, bc, niko.BlockchainAddress())
+	if supply := bc.Supply(); supply.Circulating != 4 || supply.Immature != 2 {
+		t.Errorf("Unexpected supply %+v", supply)
+	}
+	if err := bc.AddTransaction(niko.BlockchainAddress(), niko.BlockchainAddress(), 1.0, 0, 1, niko.PublicKey(), s); err != nil {
+		t.Errorf("Failed to spend a mature coinbase with err: %s", err)
+	}
+	if err := bc.AddTransaction(BENEFACTOR_ADDRESS, niko.BlockchainAddress(), 1.0, 0, 1, niko.PublicKey(), s); err == nil {
+		t.Errorf("Expected a transaction from the benefactor address to be rejected")
+	}
+
+	// A chain whose block does not start with the coinbase is invalid.
+	template, err := bc.BlockTemplate()
+	if err != nil {
+		t.Errorf("Failed to get BlockTemplate with err: %s", err)
+	}
+	template.Transactions[0], template.Transactions[1] = template.Transactions[1], template.Transactions[0]
+	b, _, err := template.Solve(context.Background(), NewMiningEngine(0))
+	if err != nil {
+		t.Errorf("Failed to Solve with err: %s", err)
+	}
+	if valid, _ := bc.ValidChain(append(bc.Chain(), b)); valid {
+		t.Errorf("Expected a block without a leading coinbase to be rejected")
+	}
+	if err := bc.SubmitBlock(b); err == nil {
+		t.Errorf("Expected SubmitBlock to reject a block without a leading coinbase")
+	}
+}
+
+func Test_CoinbaseFields(t *testing.T) {
+	params := testNetwork()
+	niko, err := wallet.NewWallet(cryptography.P256, params.GenerateBlockchainAddress)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a wallet with err: %s", err)
+	}
+	bc, err := NewBlockchain(niko.BlockchainAddress(), params)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a blockchain with err: %s", err)
+	}
+	fund(t, bc, niko.BlockchainAddress())
+	funded := bc.lastBlock().GetTransactions()[0].ID()
+
+	// submit mines a block with coinbase as its only transaction.
+	submit := func(coinbase *Transaction) error {
+		state := bc.state.Copy()
+		prevHash, _ := bc.lastBlock().Hash()
+		b := NewBlock(0, prevHash, []*Transaction{coinbase})
+		if err := state.apply(b.GetTransactions(), nil); err == nil {
+			b.stateRoot = state.Root()
+		}
+		result, err := NewMiningEngine(0).Solve(context.Background(), *b.Header(), params.MinDifficulty)
+		if err != nil {
+			t.Fatalf("Failed to Solve with err: %s", err)
+		}
+		b.nonce = result.Nonce
+		return bc.SubmitBlock(b)
+	}
+
+	for name, change := range map[string]func(c *Transaction){
+		"negative value": func(c *Transaction) { c.value = -1 },
+		"inputs":         func(c *Transaction) { c.inputs = []OutPoint{{TxID: funded}} },
+		"outputs":        func(c *Transaction) { c.outputs = []TxOutput{{Address: niko.BlockchainAddress(), Value: 1e9}} },
+		"asset":          func(c *Transaction) { c.asset, c.amount = AssetID(niko.BlockchainAddress(), 1), 1e9 },
+		"issue":          func(c *Transaction) { c.symbol, c.amount = "GOLD", 1e9 },
+		"nft":            func(c *Transaction) { c.collection, c.token, c.metadata = "art", "1", "ipfs://art" },
+		"contract":       func(c *Transaction) { c.data, c.gas = []byte{0x00}, 1000 },
+		"evidence":       func(c *Transaction) { c.evidence = &DoubleSignEvidence{} },
+	} {
+		coinbase := NewCoinbaseTransaction(len(bc.Chain()), niko.BlockchainAddress(), 0)
+		change(coinbase)
+		if err := submit(coinbase); !errors.Is(err, ErrInvalidCoinbase) {
+			t.Errorf("Expected ErrInvalidCoinbase for a coinbase with %s, got: %v", name, err)
+		}
+	}
+	if err := submit(NewCoinbaseTransaction(len(bc.Chain()), niko.BlockchainAddress(), 0)); err != nil {
+		t.Errorf("Failed to SubmitBlock with err: %s", err)
+	}
+}
+
+func Test_UTXOLedger(t *testing.T) {
+	params := testNetwork()
+	params.Ledger = network_params.UTXOLedger
+	niko, err := wallet.NewWallet(cryptography.P256, params.GenerateBlockchainAddress)
+	if err != nil {
+		t.Errorf("Failed to instatiate a wallet with err: %s", err)
+	}
+	itay, err := wallet.NewWallet(cryptography.P256, params.GenerateBlockchainAddress)
+	if err != nil {
+		t.Errorf("Failed to instatiate a wallet with err: %s", err)
+	}
+
+	bc, err := NewBlockchain(niko.BlockchainAddress(), params)
+	if err != nil {
+		t.Errorf("Failed to instatiate a blockchain with err: %s", err)
+	}
+	fund(t, bc, niko.BlockchainAddress())
+
+	var coins []wallet.Coin
+	for _, u := range bc.UTXOs(niko.BlockchainAddress()) {
+		coins = append(coins, wallet.Coin{OutPoint: wallet.OutPoint{TxID: u.TxID, Index: u.Index}, Value: u.Value})
+	}
+	if len(coins) != 1 || coins[0].Value != params.Subsidy(1) {
+		t.Fatalf("Expected the coinbase output, got %+v", coins)
+	}
+
+	add := func(tr *wallet.Transaction) error {
+		s, err := tr.GenerateSignature()
+		if err != nil {
+			t.Errorf("Failed to GenerateSignature with err: %s", err)
+		}
+		var inputs []OutPoint
+		for _, in := range tr.Inputs() {
+			inputs = append(inputs, OutPoint{TxID: in.TxID, Index: in.Index})
+		}
+		var outputs []TxOutput
+		for _, out := range tr.Outputs() {
+			outputs = append(outputs, TxOutput{Address: out.Address, Value: out.Value})
+		}
+		return bc.AddUTXOTransaction(niko.BlockchainAddress(), inputs, outputs, tr.Fee(), 0, []cryptography.PublicKey{niko.PublicKey()}, []*cryptography.Signature{s})
+	}
+
+	payment, err := wallet.NewPayment(niko.PrivateKey(), niko.PublicKey(), niko.BlockchainAddress(), coins, itay.BlockchainAddress(), 10, 0.5)
+	if err != nil {
+		t.Fatalf("Failed to create a payment with err: %s", err)
+	}
+	if err := add(payment); err != nil {
+		t.Errorf("Failed to AddUTXOTransaction with err: %s", err)
+	}
+	double, err := wallet.NewPayment(niko.PrivateKey(), niko.PublicKey(), niko.BlockchainAddress(), coins, itay.BlockchainAddress(), 20, 0.5)
+	if err != nil {
+		t.Fatalf("Failed to create a payment with err: %s", err)
+	}
+	if err := add(double); !errors.Is(err, ErrDoubleSpend) {
+		t.Errorf("Expected ErrDoubleSpend, got: %v", err)
+	}
+	s, err := wallet.NewTransactionWithNonce(niko.PrivateKey(), niko.PublicKey(), niko.BlockchainAddress(), itay.BlockchainAddress(), 1.0, 0, 1).GenerateSignature()
+	if err != nil {
+		t.Errorf("Failed to GenerateSignature with err: %s", err)
+	}
+	if err := bc.AddTransaction(niko.BlockchainAddress(), itay.BlockchainAddress(), 1.0, 0, 1, niko.PublicKey(), s); !errors.Is(err, ErrLedger) {
+		t.Errorf("Expected an account transaction to be rejected, got: %v", err)
+	}
+
+	if _, mined, err := bc.Mine(); err != nil || !mined {
+		t.Errorf("Failed to Mine with err: %v", err)
+	}
+	if balance := bc.CalculateBalance(itay.BlockchainAddress()); balance != 10 {
+		t.Errorf("Wrong calculation %f", balance)
+	}
+	if balance := bc.CalculateBalance(niko.BlockchainAddress()); balance != params.Subsidy(1)-10.5+params.Subsidy(2)+0.5 {
+		t.Errorf("Wrong calculation %f", balance)
+	}
+	if valid, err := bc.ValidChain(bc.Chain()); err != nil || !valid {
+		t.Errorf("Chain with UTXO transactions is not valid, err: %v", err)
+	}
+
+	// The UTXO set follows the chain across a reorg.
+	chain := bc.Chain()
+	bc.SetChain(chain[:2])
+	if bc.CalculateBalance(itay.BlockchainAddress()) != 0 || bc.CalculateBalance(niko.BlockchainAddress()) != params.Subsidy(1) {
+		t.Errorf("Expected the disconnected outputs to be gone")
+	}
+	if len(bc.TransactionPool()) != 1 {
+		t.Errorf("Expected the disconnected transaction back in the pool")
+	}
+	bc.SetChain(chain)
+	if bc.CalculateBalance(itay.BlockchainAddress()) != 10 || len(bc.UTXOs(niko.BlockchainAddress())) != 2 {
+		t.Errorf("Expected the reconnected outputs back")
+	}
+}
+
+func Test_StateRoot(t *testing.T) {
+	params := testNetwork()
+	niko, err := wallet.NewWallet(cryptography.P256, params.GenerateBlockchainAddress)
+	if err != nil {
+		t.Errorf("Failed to instatiate a wallet with err: %s", err)
+	}
+	itay, err := wallet.NewWallet(cryptography.P256, params.GenerateBlockchainAddress)
+	if err != nil {
+		t.Errorf("Failed to instatiate a wallet with err: %s", err)
+	}
+
+	bc, err := NewBlockchain(niko.BlockchainAddress(), params)
+	if err != nil {
+		t.Errorf("Failed to instatiate a blockchain with err: %s", err)
+	}
+	fund(t, bc, itay.BlockchainAddress())
+	s, err := wallet.NewTransactionWithNonce(itay.PrivateKey(), itay.PublicKey(), itay.BlockchainAddress(), niko.BlockchainAddress(), 1.0, 0, 1).GenerateSignature()
+	if err != nil {
+		t.Errorf("Failed to GenerateSignature with err: %s", err)
+	}
+	if err := bc.AddTransaction(itay.BlockchainAddress(), niko.BlockchainAddress(), 1.0, 0, 1, itay.PublicKey(), s); err != nil {
+		t.Errorf("Failed to AddTransaction with err: %s", err)
+	}
+	if _, mined, err := bc.Mine(); err != nil || !mined {
+		t.Errorf("Failed to Mine with err: %v", err)
+	}
+
+	chain := bc.Chain()
+	proof, err := bc.BalanceProof(itay.BlockchainAddress(), -1)
+	if err != nil {
+		t.Fatalf("Failed to get BalanceProof with err: %s", err)
+	}
+	if proof.Balance != params.Subsidy(1)-1 || proof.Nonce != 1 || !proof.Verify(chain[2].GetStateRoot()) {
+		t.Errorf("Unexpected balance proof %+v", proof)
+	}
+
+	// A proof survives the trip to a client, against an older block too.
+	proof, err = bc.BalanceProof(itay.BlockchainAddress(), 1)
+	if err != nil {
+		t.Fatalf("Failed to get BalanceProof with err: %s", err)
+	}
+	b, err := json.Marshal(proof)
+	if err != nil {
+		t.Errorf("Failed to marshal proof with err: %s", err)
+	}
+	var received BalanceProof
+	if err := json.Unmarshal(b, &received); err != nil {
+		t.Errorf("Failed to unmarshal proof with err: %s", err)
+	}
+	if received.Balance != params.Subsidy(1) || !received.Verify(chain[1].GetStateRoot()) {
+		t.Errorf("Unexpected balance proof %+v", received)
+	}
+	received.Balance++
+	if received.Verify(chain[1].GetStateRoot()) {
+		t.Errorf("Expected a forged balance not to verify")
+	}
+
+	absent, err := bc.BalanceProof("nobody", -1)
+	if err != nil || absent.Balance != 0 || !absent.Verify(chain[2].GetStateRoot()) {
+		t.Errorf("Expected a proof of absence, err: %v", err)
+	}
+	if _, err := bc.BalanceProof(itay.BlockchainAddress(), 3); !errors.Is(err, ErrBlockNotFound) {
+		t.Errorf("Expected ErrBlockNotFound, got: %v", err)
+	}
+
+	// A block committing to another state is rejected.
+	template, err := bc.BlockTemplate()
+	if err != nil {
+		t.Errorf("Failed to get BlockTemplate with err: %s", err)
+	}
+	template.StateRoot = chain[1].GetStateRoot()
+	block, _, err := template.Solve(context.Background(), NewMiningEngine(0))
+	if err != nil {
+		t.Errorf("Failed to Solve with err: %s", err)
+	}
+	if err := bc.SubmitBlock(block); err == nil {
+		t.Errorf("Expected a block with a wrong state root to be rejected")
+	}
+	if valid, _ := bc.ValidChain(append(chain, block)); valid {
+		t.Errorf("Expected a chain with a wrong state root to be invalid")
+	}
+}
+
+func Test_MerkleProof(t *testing.T) {
+	for n := 1; n <= 7; n++ {
+		var trs []*Transaction
+		for i := 0; i < n; i++ {
+			trs = append(trs, NewTransaction("niko", "itay", float32(i+1)))
+		}
+		root := MerkleRoot(trs)
+		for i, tr := range trs {
+			p := &MerkleProof{TxID: tr.ID(), Index: i, Transactions: n, Siblings: proveInclusion(trs, i)}
+			if !p.Verify(root) {
+				t.Errorf("Expected transaction %d of %d to verify", i, n)
+			}
+			p.Index = (i + 1) % n
+			if n > 1 && p.Verify(root) {
+				t.Errorf("Expected transaction %d of %d not to verify at another index", i, n)
+			}
+		}
+	}
+	if MerkleRoot(nil) != [32]byte{} {
+		t.Errorf("Expected the merkle root of no transactions to be zero")
+	}
+
+	params := testNetwork()
+	niko, err := wallet.NewWallet(cryptography.P256, params.GenerateBlockchainAddress)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a wallet with err: %s", err)
+	}
+	itay, err := wallet.NewWallet(cryptography.P256, params.GenerateBlockchainAddress)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a wallet with err: %s", err)
+	}
+	bc, err := NewBlockchain(niko.BlockchainAddress(), params)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a blockchain with err: %s", err)
+	}
+	fund(t, bc, niko.BlockchainAddress())
+	s, err := wallet.NewTransactionWithNonce(niko.PrivateKey(), niko.PublicKey(), niko.BlockchainAddress(), itay.BlockchainAddress(), 1.0, 0, 1).GenerateSignature()
+	if err != nil {
+		t.Fatalf("Failed to GenerateSignature with err: %s", err)
+	}
+	if err := bc.AddTransaction(niko.BlockchainAddress(), itay.BlockchainAddress(), 1.0, 0, 1, niko.PublicKey(), s); err != nil {
+		t.Fatalf("Failed to AddTransaction with err: %s", err)
+	}
+	fund(t, bc, niko.BlockchainAddress())
+
+	chain := bc.Chain()
+	id := chain[2].GetTransactions()[1].ID()
+	proof, err := bc.TransactionProof(id)
+	if err != nil {
+		t.Fatalf("Failed to get TransactionProof with err: %s", err)
+	}
+	b, err := json.Marshal(proof)
+	if err != nil {
+		t.Errorf("Failed to marshal proof with err: %s", err)
+	}
+	var received MerkleProof
+	if err := json.Unmarshal(b, &received); err != nil {
+		t.Errorf("Failed to unmarshal proof with err: %s", err)
+	}
+	header := bc.Headers(received.Height)[0]
+	if received.Height != 2 || received.BlockHash != header.Hash() || !received.Verify(header.MerkleRoot) {
+		t.Errorf("Unexpected transaction proof %+v", received)
+	}
+	if received.Verify(chain[1].Header().MerkleRoot) {
+		t.Errorf("Expected the proof not to verify against another block")
+	}
+	if _, err := bc.TransactionProof("missing"); !errors.Is(err, ErrTxNotFound) {
+		t.Errorf("Expected ErrTxNotFound, got: %v", err)
+	}
+}
+
+func Test_Reorg(t *testing.T) {
+	params := testNetwork()
+	niko, err := wallet.NewWallet(cryptography.P256, params.GenerateBlockchainAddress)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a wallet with err: %s", err)
+	}
+	itay, err := wallet.NewWallet(cryptography.P256, params.GenerateBlockchainAddress)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a wallet with err: %s", err)
+	}
+	bc, err := NewBlockchain(niko.BlockchainAddress(), params)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a blockchain with err: %s", err)
+	}
+	fund(t, bc, niko.BlockchainAddress())
+	s, err := wallet.NewTransactionWithNonce(niko.PrivateKey(), niko.PublicKey(), niko.BlockchainAddress(), itay.BlockchainAddress(), 1.0, 0, 1).GenerateSignature()
+	if err != nil {
+		t.Fatalf("Failed to GenerateSignature with err: %s", err)
+	}
+	if err := bc.AddTransaction(niko.BlockchainAddress(), itay.BlockchainAddress(), 1.0, 0, 1, niko.PublicKey(), s); err != nil {
+		t.Fatalf("Failed to AddTransaction with err: %s", err)
+	}
+	fund(t, bc, niko.BlockchainAddress())
+	chain := bc.Chain()
+
+	// A longer branch from block 1 that leaves out the transfer.
+	other, err := NewBlockchain(itay.BlockchainAddress(), params)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a blockchain with err: %s", err)
+	}
+	if err := other.SetChain(chain[:2]); err != nil {
+		t.Fatalf("Failed to SetChain with err: %s", err)
+	}
+	fund(t, other, itay.BlockchainAddress())
+	fund(t, other, itay.BlockchainAddress())
+	branch := other.Chain()
+
+	var events []*ReorgEvent
+	bc.OnReorg(func(e *ReorgEvent) { events = append(events, e) })
+
+	// An invalid block in the branch rolls everything back.
+	bad := *branch[3]
+	bad.stateRoot = [32]byte{1}
+	if _, err := bc.Reorg([]*Block{branch[0], branch[1], branch[2], &bad}); err == nil {
+		t.Errorf("Expected a branch with an invalid block to be rejected")
+	}
+	if len(bc.Chain()) != 3 || bc.Chain()[2] != chain[2] || bc.CalculateBalance(itay.BlockchainAddress()) != 1 {
+		t.Errorf("Expected the chain to be rolled back")
+	}
+	if p, err := bc.BalanceProof(itay.BlockchainAddress(), -1); err != nil || !p.Verify(chain[2].GetStateRoot()) {
+		t.Errorf("Expected the state to be rolled back, err: %v", err)
+	}
+	if len(events) != 0 {
+		t.Errorf("Expected no event for a failed reorg")
+	}
+
+	e, err := bc.Reorg(branch)
+	if err != nil {
+		t.Fatalf("Failed to Reorg with err: %s", err)
+	}
+	if e.Fork != 1 || len(e.Disconnected) != 1 || len(e.Connected) != 2 || len(e.Orphaned) != 1 {
+		t.Errorf("Unexpected reorg event %+v", e)
+	}
+	if len(events) != 1 || events[0] != e {
+		t.Errorf("Expected the reorg to be emitted once")
+	}
+	if len(bc.TransactionPool()) != 1 || bc.TransactionPool()[0].ID() != e.Orphaned[0].ID() {
+		t.Errorf("Expected the orphaned transaction back in the pool")
+	}
+	if balance := bc.CalculateBalance(itay.BlockchainAddress()); balance != params.Subsidy(2)+params.Subsidy(3) {
+		t.Errorf("Wrong calculation %f", balance)
+	}
+	if p, err := bc.BalanceProof(niko.BlockchainAddress(), -1); err != nil || !p.Verify(branch[3].GetStateRoot()) {
+		t.Errorf("Expected the state of the new branch, err: %v", err)
+	}
+	if chain[2] == branch[2] {
+		t.Errorf("Expected the old chain slice to be left alone")
+	}
+
+	if _, err := bc.Reorg([]*Block{chain[1]}); !errors.Is(err, ErrGenesisMismatch) {
+		t.Errorf("Expected ErrGenesisMismatch, got: %v", err)
+	}
+}
+
+func Test_BlockTree(t *testing.T) {
+	params := testNetwork()
+	niko, err := wallet.NewWallet(cryptography.P256, params.GenerateBlockchainAddress)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a wallet with err: %s", err)
+	}
+	bc, err := NewBlockchain(niko.BlockchainAddress(), params)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a blockchain with err: %s", err)
+	}
+	fund(t, bc, niko.BlockchainAddress())
+	fund(t, bc, niko.BlockchainAddress())
+	chain := bc.Chain()
+
+	itay, err := wallet.NewWallet(cryptography.P256, params.GenerateBlockchainAddress)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a wallet with err: %s", err)
+	}
+	other, err := NewBlockchain(itay.BlockchainAddress(), params)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a blockchain with err: %s", err)
+	}
+	if err := other.SetChain(chain[:2]); err != nil {
+		t.Fatalf("Failed to SetChain with err: %s", err)
+	}
+	fund(t, other, itay.BlockchainAddress())
+	fund(t, other, itay.BlockchainAddress())
+	branch := other.Chain()
+
+	var events []*ReorgEvent
+	bc.OnReorg(func(e *ReorgEvent) { events = append(events, e) })
+
+	// The child arrives first and waits for its parent.
+	err = bc.ProcessBlock(branch[3])
+	var orphan *OrphanBlockError
+	if !errors.As(err, &orphan) || orphan.Parent != branch[3].GetPreviousHash() || bc.OrphanCount() != 1 {
+		t.Fatalf("Expected an orphan block, got: %v", err)
+	}
+	if err := bc.ProcessBlock(branch[3]); !errors.Is(err, ErrKnownBlock) {
+		t.Errorf("Expected ErrKnownBlock, got: %v", err)
+	}
+	if err := bc.ProcessBlock(branch[2]); err != nil {
+		t.Fatalf("Failed to ProcessBlock with err: %s", err)
+	}
+	if bc.OrphanCount() != 0 || len(bc.Chain()) != 4 || bc.Chain()[3] != branch[3] {
+		t.Fatalf("Expected the chain to switch to the branch with more work")
+	}
+	if len(events) != 1 || events[0].Fork != 1 {
+		t.Errorf("Expected a reorg event from height 1, got %d events", len(events))
+	}
+	hash, _ := chain[2].Hash()
+	if b, ok := bc.Block(hash); !ok || b != chain[2] {
+		t.Errorf("Expected the old block to stay on a side branch")
+	}
+
+	// A heavier branch through an invalid block is dropped.
+	solve := func(prev *Block, height int, stateRoot [32]byte) *Block {
+		prevHash, _ := prev.Hash()
+		trs := []*Transaction{NewCoinbaseTransaction(height, niko.BlockchainAddress(), params.Subsidy(height))}
+		b := NewBlock(0, prevHash, trs)
+		b.stateRoot = stateRoot
+		result, err := NewMiningEngine(0).Solve(context.Background(), *b.Header(), params.MinDifficulty)
+		if err != nil {
+			t.Fatalf("Failed to Solve with err: %s", err)
+		}
+		b.nonce = result.Nonce
+		return b
+	}
+	bad := solve(chain[2], 3, [32]byte{1})
+	if err := bc.ProcessBlock(bad); err != nil {
+		t.Errorf("Expected a side branch without more work to be kept, got: %v", err)
+	}
+	var invalid *InvalidBlockError
+	if err := bc.ProcessBlock(solve(bad, 4, [32]byte{2})); !errors.As(err, &invalid) || invalid.Height != 3 {
+		t.Errorf("Expected the branch to fail at block 3, got: %v", err)
+	}
+	badHash, _ := bad.Hash()
+	if _, ok := bc.Block(badHash); ok {
+		t.Errorf("Expected the invalid block to be dropped")
+	}
+	if len(bc.Chain()) != 4 || bc.Chain()[3] != branch[3] {
+		t.Errorf("Expected the chain to stay on the valid branch")
+	}
+
+	// A branch no reorg may switch to is refused as it arrives, and side
+	// blocks that fall out of reach make room for new ones.
+	params.MaxReorgDepth = 1
+	deep := solve(branch[0], 1, [32]byte{})
+	deepHash, _ := deep.Hash()
+	if err := bc.ProcessBlock(deep); !errors.Is(err, ErrReorgTooDeep) {
+		t.Errorf("Expected ErrReorgTooDeep for a fork from the genesis block, got: %v", err)
+	}
+	if _, ok := bc.Block(deepHash); ok {
+		t.Errorf("Expected the deep fork not to be kept")
+	}
+	if err := bc.ProcessBlock(solve(branch[2], 3, [32]byte{3})); err != nil {
+		t.Errorf("Expected a side block within the reorg depth to be kept, got: %v", err)
+	}
+	bc.maxSideBlocks = 2
+	if err := bc.ProcessBlock(solve(branch[2], 3, [32]byte{4})); err != nil {
+		t.Errorf("Expected a side block to take the room of an unreachable one, got: %v", err)
+	}
+	if _, ok := bc.Block(hash); ok {
+		t.Errorf("Expected the side block forking 2 blocks deep to be dropped")
+	}
+	if err := bc.ProcessBlock(solve(branch[2], 3, [32]byte{5})); !errors.Is(err, ErrTooManySideBlocks) {
+		t.Errorf("Expected ErrTooManySideBlocks, got: %v", err)
+	}
+
+	pool := newOrphanPool(2)
+	for i := 0; i < 3; i++ {
+		b := NewBlock(i, [32]byte{byte(i)}, nil)
+		hash, _ := b.Hash()
+		pool.add(hash, b)
+	}
+	if pool.len() != 2 || len(pool.takeChildren([32]byte{0})) != 0 || len(pool.takeChildren([32]byte{2})) != 1 {
+		t.Errorf("Expected the oldest orphan to be dropped")
+	}
+}
+
+func Test_Genesis(t *testing.T) {
+	niko, err := wallet.NewWallet(cryptography.P256, network_params.RegTest.GenerateBlockchainAddress)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a wallet with err: %s", err)
+	}
+	itay, err := wallet.NewWallet(cryptography.P256, network_params.RegTest.GenerateBlockchainAddress)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a wallet with err: %s", err)
+	}
+	path := filepath.Join(t.TempDir(), "genesis.json")
+	spec := fmt.Sprintf(`{
+		"chain_id": "test-1",
+		"timestamp": "2022-12-03T00:00:00Z",
+		"difficulty": 1,
+		"reward": {"initial": 10, "halving_interval": 100, "max_supply": 2000, "coinbase_maturity": 100},
+		"alloc": {%q: 25, %q: 5}
+	}`, niko.BlockchainAddress(), itay.BlockchainAddress())
+	if err := os.WriteFile(path, []byte(spec), 0o600); err != nil {
+		t.Fatalf("Failed to write spec with err: %s", err)
+	}
+
+	g, err := network_params.LoadGenesisSpec(path)
+	if err != nil {
+		t.Fatalf("Failed to LoadGenesisSpec with err: %s", err)
+	}
+	params, err := g.Apply(network_params.RegTest)
+	if err != nil {
+		t.Fatalf("Failed to Apply with err: %s", err)
+	}
+	if params.ChainID != "test-1" || params.MiningReward != 10 || params.Subsidy(100) != 5 || len(params.Allocations) != 2 {
+		t.Errorf("Unexpected params %+v", params)
+	}
+
+	bc, err := NewBlockchain(niko.BlockchainAddress(), params)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a blockchain with err: %s", err)
+	}
+	again, err := NewBlockchain(itay.BlockchainAddress(), params)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a blockchain with err: %s", err)
+	}
+	if bc.Genesis().Header().Hash() != again.Genesis().Header().Hash() {
+		t.Errorf("Expected every node of the chain to build the same genesis block")
+	}
+	if balance := bc.CalculateBalance(niko.BlockchainAddress()); balance != 25 {
+		t.Errorf("Wrong calculation %f", balance)
+	}
+	if p, err := bc.BalanceProof(itay.BlockchainAddress(), 0); err != nil || p.Balance != 5 || !p.Verify(bc.Genesis().GetStateRoot()) {
+		t.Errorf("Expected a proof of the allocation, err: %v", err)
+	}
+
+	// Allocations are spendable right away.
+	s, err := wallet.NewTransactionWithNonce(niko.PrivateKey(), niko.PublicKey(), niko.BlockchainAddress(), itay.BlockchainAddress(), 20, 0, 1).GenerateSignature()
+	if err != nil {
+		t.Fatalf("Failed to GenerateSignature with err: %s", err)
+	}
+	if err := bc.AddTransaction(niko.BlockchainAddress(), itay.BlockchainAddress(), 20, 0, 1, niko.PublicKey(), s); err != nil {
+		t.Errorf("Failed to AddTransaction with err: %s", err)
+	}
+	if _, mined, err := bc.Mine(); err != nil || !mined {
+		t.Errorf("Failed to Mine with err: %v", err)
+	}
+	if valid, err := bc.ValidChain(bc.Chain()); err != nil || !valid {
+		t.Errorf("Chain with genesis allocations is not valid, err: %v", err)
+	}
+	if supply := bc.Supply(); supply.Circulating != 30 || supply.Immature != 10 {
+		t.Errorf("Unexpected supply %+v", supply)
+	}
+
+	// Peers of another chain are not followed.
+	other, err := NewBlockchain(niko.BlockchainAddress(), network_params.RegTest)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a blockchain with err: %s", err)
+	}
+	if valid, _ := other.ValidChain(bc.Chain()); valid {
+		t.Errorf("Expected a chain with another genesis to be invalid")
+	}
+	if err := other.SetChain(bc.Chain()); !errors.Is(err, ErrGenesisMismatch) {
+		t.Errorf("Expected ErrGenesisMismatch, got: %v", err)
+	}
+
+	// Nor are peers of the same chain ID that run other consensus rules.
+	for name, change := range map[string]func(g network_params.GenesisSpec) network_params.GenesisSpec{
+		"difficulty":        func(g network_params.GenesisSpec) network_params.GenesisSpec { g.Difficulty++; return g },
+		"subsidy":           func(g network_params.GenesisSpec) network_params.GenesisSpec { g.Reward.Initial++; return g },
+		"halving interval":  func(g network_params.GenesisSpec) network_params.GenesisSpec { g.Reward.HalvingInterval++; return g },
+		"coinbase maturity": func(g network_params.GenesisSpec) network_params.GenesisSpec { g.Reward.CoinbaseMaturity++; return g },
+		"max supply":        func(g network_params.GenesisSpec) network_params.GenesisSpec { g.Reward.MaxSupply++; return g },
+		"consensus": func(g network_params.GenesisSpec) network_params.GenesisSpec {
+			g.Consensus = network_params.ProofOfAuthority
+			g.Signers = []string{niko.BlockchainAddress()}
+			return g
+		},
+	} {
+		spec := change(*g)
+		params, err := spec.Apply(network_params.RegTest)
+		if err != nil {
+			t.Fatalf("%s: failed to Apply with err: %s", name, err)
+		}
+		header, err := GenesisHeader(params)
+		if err != nil {
+			t.Fatalf("%s: failed to get GenesisHeader with err: %s", name, err)
+		}
+		if header.Hash() == bc.Genesis().Header().Hash() {
+			t.Errorf("%s: expected another genesis block", name)
+		}
+	}
+
+	g.ChainID = ""
+	if err := g.Validate(); err == nil {
+		t.Errorf("Expected a spec without a chain ID to be invalid")
+	}
+	if _, err := network_params.LoadGenesisSpec("../network-params/genesis/example.json"); err != nil {
+		t.Errorf("Failed to load the example spec with err: %s", err)
+	}
+}
+
+func Test_Timestamps(t *testing.T) {
+	params := testNetwork()
+	niko, err := wallet.NewWallet(cryptography.P256, params.GenerateBlockchainAddress)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a wallet with err: %s", err)
+	}
+	bc, err := NewBlockchain(niko.BlockchainAddress(), params)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a blockchain with err: %s", err)
+	}
+	now := time.Unix(0, params.GenesisTimestamp).Add(24 * time.Hour)
+	bc.SetClock(func() time.Time { return now })
+
+	next := func(timestamp int64) *Block {
+		template, err := bc.BlockTemplate()
+		if err != nil {
+			t.Fatalf("Failed to get BlockTemplate with err: %s", err)
+		}
+		b := template.Block(0)
+		b.timestamp = timestamp
+		result, err := NewMiningEngine(0).Solve(context.Background(), *b.Header(), template.Difficulty)
+		if err != nil {
+			t.Fatalf("Failed to Solve with err: %s", err)
+		}
+		b.nonce = result.Nonce
+		return b
+	}
+
+	if err := bc.SubmitBlock(next(params.GenesisTimestamp)); !errors.Is(err, ErrTimeTooOld) {
+		t.Errorf("Expected ErrTimeTooOld for the median time past, got: %v", err)
+	}
+	limit := now.Add(params.MaxTimeDrift).UnixNano()
+	if err := bc.SubmitBlock(next(limit + 1)); !errors.Is(err, ErrTimeTooNew) {
+		t.Errorf("Expected ErrTimeTooNew past the drift, got: %v", err)
+	}
+	if err := bc.SubmitBlock(next(limit)); err != nil {
+		t.Fatalf("Failed to SubmitBlock at the drift limit with err: %s", err)
+	}
+
+	// A block at the clock is before the block at the limit, the median of
+	// the two blocks.
+	old := next(now.UnixNano())
+	if valid, _ := bc.ValidChain(append(bc.Chain(), old)); valid {
+		t.Errorf("Expected a block before the median time past to make the chain invalid")
+	}
+	template, err := bc.BlockTemplate()
+	if err != nil {
+		t.Fatalf("Failed to get BlockTemplate with err: %s", err)
+	}
+	if template.MinTimestamp != limit+1 {
+		t.Errorf("Expected the template minimum timestamp %d, got %d", limit+1, template.MinTimestamp)
+	}
+
+	// The timestamp is part of the proof of work, a mined block given
+	// another one no longer meets the difficulty.
+	b, _, err := template.Solve(context.Background(), NewMiningEngine(0))
+	if err != nil {
+		t.Fatalf("Failed to Solve with err: %s", err)
+	}
+	for b.timestamp++; b.Header().Meets(template.Difficulty); {
+		b.timestamp++
+	}
+	if err := bc.ProcessBlock(b); err == nil || len(bc.Chain()) != 2 {
+		t.Errorf("Expected a block with a changed timestamp to be rejected, got: %v", err)
+	}
+}
+
+func Test_Checkpoints(t *testing.T) {
+	params := testNetwork()
+	niko, err := wallet.NewWallet(cryptography.P256, params.GenerateBlockchainAddress)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a wallet with err: %s", err)
+	}
+	itay, err := wallet.NewWallet(cryptography.P256, params.GenerateBlockchainAddress)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a wallet with err: %s", err)
+	}
+	bc, err := NewBlockchain(niko.BlockchainAddress(), params)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a blockchain with err: %s", err)
+	}
+	fund(t, bc, niko.BlockchainAddress())
+	fund(t, bc, niko.BlockchainAddress())
+	chain := bc.Chain()
+
+	other, err := NewBlockchain(itay.BlockchainAddress(), params)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a blockchain with err: %s", err)
+	}
+	for i := 0; i < 3; i++ {
+		fund(t, other, itay.BlockchainAddress())
+	}
+	branch := other.Chain()
+
+	checkpointed := *params
+	checkpointed.Checkpoints = map[int][32]byte{1: chain[1].Header().Hash()}
+	node, err := NewBlockchain(niko.BlockchainAddress(), &checkpointed)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a blockchain with err: %s", err)
+	}
+	if valid, _ := node.ValidChain(branch); valid {
+		t.Errorf("Expected a chain off the checkpoint to be invalid")
+	}
+	if err := node.SetChain(chain); err != nil {
+		t.Fatalf("Failed to SetChain with err: %s", err)
+	}
+	if err := node.ProcessBlock(branch[1]); !errors.Is(err, ErrCheckpoint) {
+		t.Errorf("Expected ErrCheckpoint for a side block at the checkpoint, got: %v", err)
+	}
+	if err := node.SetChain(branch); !errors.Is(err, ErrCheckpoint) {
+		t.Errorf("Expected ErrCheckpoint, got: %v", err)
+	}
+
+	shallow := *params
+	shallow.MaxReorgDepth = 1
+	node, err = NewBlockchain(niko.BlockchainAddress(), &shallow)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a blockchain with err: %s", err)
+	}
+	if err := node.SetChain(chain); err != nil {
+		t.Fatalf("Failed to SetChain with err: %s", err)
+	}
+	if err := node.SetChain(branch); !errors.Is(err, ErrReorgTooDeep) {
+		t.Errorf("Expected ErrReorgTooDeep, got: %v", err)
+	}
+	if len(node.Chain()) != len(chain) {
+		t.Errorf("Expected the chain to stay at %d blocks, got %d", len(chain), len(node.Chain()))
+	}
+
+	// A block whose transfer is signed for another value is only accepted
+	// below the assumed valid block.
+	s, err := wallet.NewTransactionWithNonce(niko.PrivateKey(), niko.PublicKey(), niko.BlockchainAddress(), itay.BlockchainAddress(), 1.0, 0, 1).GenerateSignature()
+	if err != nil {
+		t.Fatalf("Failed to GenerateSignature with err: %s", err)
+	}
+	forged := NewSignedTransaction(niko.BlockchainAddress(), itay.BlockchainAddress(), 2.0, 0, 1, 0, []cryptography.PublicKey{niko.PublicKey()}, []*cryptography.Signature{s})
+	trs := []*Transaction{NewCoinbaseTransaction(3, niko.BlockchainAddress(), params.Subsidy(3)), forged}
+	state := bc.state.Copy()
+	if err := state.apply(trs, nil); err != nil {
+		t.Fatalf("Failed to apply the block with err: %s", err)
+	}
+	prevHash, _ := chain[2].Hash()
+	b := NewBlock(0, prevHash, trs)
+	b.stateRoot = state.Root()
+	result, err := NewMiningEngine(0).Solve(context.Background(), *b.Header(), params.MinDifficulty)
+	if err != nil {
+		t.Fatalf("Failed to Solve with err: %s", err)
+	}
+	b.nonce = result.Nonce
+	forgedChain := append(chain, b)
+	if valid, _ := bc.ValidChain(forgedChain); valid {
+		t.Errorf("Expected the forged signature to make the chain invalid")
+	}
+
+	assumed := *params
+	assumed.AssumeValid = b.Header().Hash()
+	node, err = NewBlockchain(niko.BlockchainAddress(), &assumed)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a blockchain with err: %s", err)
+	}
+	if valid, err := node.ValidChain(forgedChain); !valid || err != nil {
+		t.Errorf("Expected the signatures below the assumed valid block to be skipped, got: %v", err)
+	}
+	if err := node.SetChain(forgedChain); err != nil {
+		t.Errorf("Failed to SetChain with err: %s", err)
+	}
+}
+
+func Test_ProofOfAuthority(t *testing.T) {
+	params := testNetwork()
+	var wallets []*wallet.Wallet
+	for i := 0; i < 3; i++ {
+		w, err := wallet.NewWallet(cryptography.P256, params.GenerateBlockchainAddress)
+		if err != nil {
+			t.Fatalf("Failed to instatiate a wallet with err: %s", err)
+		}
+		wallets = append(wallets, w)
+	}
+	niko, itay, gil := wallets[0], wallets[1], wallets[2]
+	params.Consensus = network_params.ProofOfAuthority
+	params.Signers = []string{niko.BlockchainAddress(), itay.BlockchainAddress()}
+
+	bc, err := NewBlockchain(niko.BlockchainAddress(), params)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a blockchain with err: %s", err)
+	}
+	signer := func(w *wallet.Wallet, poa *ProofOfAuthority) *ProofOfAuthority {
+		poa.SetSigner(w.PrivateKey())
+		poa.SetOutOfTurnDelay(0)
+		return poa
+	}
+	engine := func(w *wallet.Wallet) *ProofOfAuthority {
+		poa, err := NewProofOfAuthority(params)
+		if err != nil {
+			t.Fatalf("Failed to instatiate proof of authority with err: %s", err)
+		}
+		return signer(w, poa)
+	}
+	signer(niko, bc.Consensus().(*ProofOfAuthority))
+	seal := func(poa *ProofOfAuthority) (*Block, error) {
+		template, err := bc.BlockTemplate()
+		if err != nil {
+			t.Fatalf("Failed to get BlockTemplate with err: %s", err)
+		}
+		b := template.Block(0)
+		chain := blockHeaders(bc.Chain())
+		if err := poa.Prepare(chain, b); err != nil {
+			return nil, err
+		}
+		if err := poa.Seal(context.Background(), chain, b); err != nil {
+			return nil, err
+		}
+		return b, nil
+	}
+	nikoSeals, itaySeals, gilSeals := engine(niko), engine(itay), engine(gil)
+
+	b, err := seal(nikoSeals)
+	if err != nil {
+		t.Fatalf("Failed to seal with err: %s", err)
+	}
+	if err := bc.SubmitBlock(b); err != nil {
+		t.Fatalf("Failed to SubmitBlock with err: %s", err)
+	}
+	if _, err := seal(nikoSeals); !errors.Is(err, ErrRecentlySigned) {
+		t.Errorf("Expected ErrRecentlySigned for two blocks in a row, got: %v", err)
+	}
+	if _, err := seal(gilSeals); !errors.Is(err, ErrUnauthorizedSigner) {
+		t.Errorf("Expected ErrUnauthorizedSigner, got: %v", err)
+	}
+
+	// Itay votes for Gil in the next block, a block changed after sealing is
+	// refused.
+	if err := itaySeals.Propose(gil.BlockchainAddress(), true); err != nil {
+		t.Fatalf("Failed to Propose with err: %s", err)
+	}
+	b, err = seal(itaySeals)
+	if err != nil {
+		t.Fatalf("Failed to seal with err: %s", err)
+	}
+	b.timestamp++
+	if err := bc.SubmitBlock(b); !errors.Is(err, ErrInvalidSeal) {
+		t.Errorf("Expected ErrInvalidSeal for a changed block, got: %v", err)
+	}
+	b.timestamp--
+	if err := bc.SubmitBlock(b); err != nil {
+		t.Fatalf("Failed to SubmitBlock with err: %s", err)
+	}
+	if signers, _ := bc.Signers(); len(signers) != 2 {
+		t.Errorf("Expected one vote of two to change nothing, got signers %v", signers)
+	}
+
+	// The node seals the second vote itself.
+	if err := bc.ProposeSigner(gil.BlockchainAddress(), true); err != nil {
+		t.Fatalf("Failed to ProposeSigner with err: %s", err)
+	}
+	s, err := wallet.NewTransactionWithNonce(niko.PrivateKey(), niko.PublicKey(), niko.BlockchainAddress(), itay.BlockchainAddress(), 1.0, 0, 1).GenerateSignature()
+	if err != nil {
+		t.Fatalf("Failed to GenerateSignature with err: %s", err)
+	}
+	if err := bc.AddTransaction(niko.BlockchainAddress(), itay.BlockchainAddress(), 1.0, 0, 1, niko.PublicKey(), s); err != nil {
+		t.Fatalf("Failed to AddTransaction with err: %s", err)
+	}
+	if _, mined, err := bc.Mine(); err != nil || !mined {
+		t.Fatalf("Failed to Mine with err: %v", err)
+	}
+	signers, err := bc.Signers()
+	if err != nil || len(signers) != 3 {
+		t.Fatalf("Expected Gil to be voted in, got signers %v with err: %v", signers, err)
+	}
+	if b, err = seal(gilSeals); err != nil {
+		t.Fatalf("Failed to seal with err: %s", err)
+	}
+	if err := bc.SubmitBlock(b); err != nil {
+		t.Fatalf("Failed to SubmitBlock with err: %s", err)
+	}
+
+	// The block in turn weighs more in the fork choice.
+	for height, b := range bc.Chain()[1:] {
+		extra, err := parseExtra(b.GetExtra())
+		if err != nil {
+			t.Fatalf("Failed to parse extra data with err: %s", err)
+		}
+		want := int64(1)
+		if extra.InTurn {
+			want = 2
+		}
+		if work := bc.Consensus().Work(b.Header()); work.Int64() != want {
+			t.Errorf("Expected block %d to add work %d, got %s", height+1, want, work)
+		}
+	}
+
+	// With room for two snapshots the rest are rebuilt from the genesis
+	// signers.
+	other, err := NewBlockchain(itay.BlockchainAddress(), params)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a blockchain with err: %s", err)
+	}
+	otherPoA := other.Consensus().(*ProofOfAuthority)
+	otherPoA.snapshotLimit = 2
+	if valid, err := other.ValidChain(bc.Chain()); !valid || err != nil {
+		t.Errorf("Expected the sealed chain to be valid, got: %v", err)
+	}
+	if len(otherPoA.snapshots) > 2 || len(otherPoA.order) != len(otherPoA.snapshots) {
+		t.Errorf("Expected at most 2 snapshots, got %d", len(otherPoA.snapshots))
+	}
+	if _, err := other.Signers(); err != nil {
+		t.Errorf("Failed to get Signers with err: %s", err)
+	}
+	pow, err := NewBlockchain(niko.BlockchainAddress(), testNetwork())
+	if err != nil {
+		t.Fatalf("Failed to instatiate a blockchain with err: %s", err)
+	}
+	if _, err := pow.Signers(); !errors.Is(err, ErrNotAuthority) {
+		t.Errorf("Expected ErrNotAuthority on a proof of work chain, got: %v", err)
+	}
+}
+
+func Test_ProofOfStake(t *testing.T) {
+	params := testNetwork()
+	wallets := make(map[string]*wallet.Wallet)
+	var niko, itay, gil *wallet.Wallet
+	for _, w := range []**wallet.Wallet{&niko, &itay, &gil} {
+		var err error
+		if *w, err = wallet.NewWallet(cryptography.P256, params.GenerateBlockchainAddress); err != nil {
+			t.Fatalf("Failed to instatiate a wallet with err: %s", err)
+		}
+		wallets[(*w).BlockchainAddress()] = *w
+	}
+	params.Consensus = network_params.ProofOfStake
+	params.Stakes = []network_params.Allocation{
+		{Address: niko.BlockchainAddress(), Value: 10},
+		{Address: itay.BlockchainAddress(), Value: 30},
+	}
+	params.Allocations = []network_params.Allocation{{Address: gil.BlockchainAddress(), Value: 100}}
+
+	// The draw follows the stakes.
+	validators := []Validator{{Address: "a", Stake: 10}, {Address: "b", Stake: 30}}
+	if v, _ := draw([32]byte{}, validators); v != "a" {
+		t.Errorf("Expected the lowest seed to draw the first validator, got %s", v)
+	}
+	drawn := 0
+	for i := 0; i < 1000; i++ {
+		if v, _ := draw(sha256.Sum256([]byte{byte(i), byte(i >> 8)}), validators); v == "b" {
+			drawn++
+		}
+	}
+	if drawn < 650 || drawn > 850 {
+		t.Errorf("Expected a validator with 3/4 of the stake to be drawn about 750 times of 1000, got %d", drawn)
+	}
+
+	bc, err := NewBlockchain(niko.BlockchainAddress(), params)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a blockchain with err: %s", err)
+	}
+	pos := bc.Consensus().(*ProofOfStake)
+	next := func() *wallet.Wallet {
+		_, address, err := bc.Validators()
+		if err != nil {
+			t.Fatalf("Failed to get Validators with err: %s", err)
+		}
+		return wallets[address]
+	}
+	mine := func() {
+		pos.SetValidator(next().PrivateKey())
+		if _, mined, err := bc.Mine(); err != nil || !mined {
+			t.Fatalf("Failed to Mine with err: %v", err)
+		}
+	}
+	// prepare builds the next block as w would, unsealed.
+	prepare := func(w *wallet.Wallet, delay int64) (*Block, ChainState) {
+		template, err := bc.BlockTemplate()
+		if err != nil {
+			t.Fatalf("Failed to get BlockTemplate with err: %s", err)
+		}
+		b := template.Block(0)
+		b.timestamp += delay
+		engine, err := NewProofOfStake(params)
+		if err != nil {
+			t.Fatalf("Failed to instatiate proof of stake with err: %s", err)
+		}
+		engine.SetValidator(w.PrivateKey())
+		chain := chainState{blockHeaders(bc.Chain()), bc.state.Copy()}
+		if err := engine.Prepare(chain, b); err != nil {
+			t.Fatalf("Failed to Prepare with err: %s", err)
+		}
+		return b, chain
+	}
+
+	// Gil stakes 20 of his 100.
+	s, err := wallet.NewStakeTransaction(gil.PrivateKey(), gil.PublicKey(), gil.BlockchainAddress(), "stake", 20, 0, 1).GenerateSignature()
+	if err != nil {
+		t.Fatalf("Failed to GenerateSignature with err: %s", err)
+	}
+	if err := bc.AddStakeTransaction(StakeTx, gil.BlockchainAddress(), 20, 0, 1, gil.PublicKey(), s); err != nil {
+		t.Fatalf("Failed to AddStakeTransaction with err: %s", err)
+	}
+
+	// Only the validator drawn may seal the block.
+	wrong := niko
+	if next() == niko {
+		wrong = itay
+	}
+	b, chain := prepare(wrong, 0)
+	pos.SetValidator(wrong.PrivateKey())
+	if err := pos.Seal(context.Background(), chain, b); !errors.Is(err, ErrNotSelected) {
+		t.Errorf("Expected ErrNotSelected sealing out of turn, got: %v", err)
+	}
+	if err := signSeal(wrong.PrivateKey(), b); err != nil {
+		t.Fatalf("Failed to sign seal with err: %s", err)
+	}
+	if err := bc.SubmitBlock(b); !errors.Is(err, ErrNotSelected) {
+		t.Errorf("Expected ErrNotSelected for a block of another validator, got: %v", err)
+	}
+
+	// Nor may the validator drawn slash another one, or stake from nothing,
+	// with its coinbase.
+	for _, kind := range []TxKind{EvidenceTx, StakeTx} {
+		b, _ := prepare(next(), 0)
+		b.transactions[0].kind = kind
+		b.transactions[0].recipient = wrong.BlockchainAddress()
+		state := bc.state.Copy()
+		if err := state.apply(b.GetTransactions(), nil); err != nil {
+			t.Fatalf("Failed to apply the block with err: %s", err)
+		}
+		b.stateRoot = state.Root()
+		if err := signSeal(next().PrivateKey(), b); err != nil {
+			t.Fatalf("Failed to sign seal with err: %s", err)
+		}
+		if err := bc.SubmitBlock(b); !errors.Is(err, ErrInvalidCoinbase) {
+			t.Errorf("Expected ErrInvalidCoinbase for a %s coinbase, got: %v", kind, err)
+		}
+	}
+	if stake := bc.state.Account(wrong.BlockchainAddress()).Stake; stake == 0 {
+		t.Errorf("Expected the stake of %s to be kept", wrong.BlockchainAddress())
+	}
+
+	mine()
+	if balance := bc.CalculateBalance(gil.BlockchainAddress()); balance != 80 {
+		t.Errorf("Expected 20 of 100 to be locked, got a balance of %f", balance)
+	}
+	validators, _, err = bc.Validators()
+	if err != nil || len(validators) != 3 {
+		t.Fatalf("Expected Gil to become a validator, got %v with err: %v", validators, err)
+	}
+	proof, err := bc.BalanceProof(gil.BlockchainAddress(), -1)
+	if err != nil || proof.Stake != 20 || !proof.Verify(bc.Chain()[proof.Height].GetStateRoot()) {
+		t.Errorf("Expected a valid proof of the stake of 20, got %+v with err: %v", proof, err)
+	}
+
+	s, err = wallet.NewStakeTransaction(gil.PrivateKey(), gil.PublicKey(), gil.BlockchainAddress(), "unstake", 25, 0, 2).GenerateSignature()
+	if err != nil {
+		t.Fatalf("Failed to GenerateSignature with err: %s", err)
+	}
+	if err := bc.AddStakeTransaction(UnstakeTx, gil.BlockchainAddress(), 25, 0, 2, gil.PublicKey(), s); !errors.Is(err, ErrInsufficientStake) {
+		t.Errorf("Expected ErrInsufficientStake unstaking more than the stake, got: %v", err)
+	}
+	s, err = wallet.NewStakeTransaction(gil.PrivateKey(), gil.PublicKey(), gil.BlockchainAddress(), "unstake", 5, 0, 2).GenerateSignature()
+	if err != nil {
+		t.Fatalf("Failed to GenerateSignature with err: %s", err)
+	}
+	if err := bc.AddStakeTransaction(UnstakeTx, gil.BlockchainAddress(), 5, 0, 2, gil.PublicKey(), s); err != nil {
+		t.Fatalf("Failed to AddStakeTransaction with err: %s", err)
+	}
+	mine()
+	if balance, stake := bc.CalculateBalance(gil.BlockchainAddress()), bc.state.Account(gil.BlockchainAddress()).Stake; balance != 85 || stake != 15 {
+		t.Errorf("Expected a balance of 85 and a stake of 15, got %f and %f", balance, stake)
+	}
+
+	// The validator drawn seals two blocks at the same height, Gil reports
+	// it and its stake is burnt.
+	offender := next()
+	first, chain := prepare(offender, 0)
+	second, _ := prepare(offender, 1)
+	for _, b := range []*Block{first, second} {
+		if err := signSeal(offender.PrivateKey(), b); err != nil {
+			t.Fatalf("Failed to sign seal with err: %s", err)
+		}
+		if err := pos.VerifySeal(chain, b.Header()); err != nil {
+			t.Fatalf("Failed to VerifySeal with err: %s", err)
+		}
+	}
+	if err := pos.VerifySeal(blockHeaders(bc.Chain()), first.Header()); !errors.Is(err, ErrNotSelected) {
+		t.Errorf("Expected ErrNotSelected verifying without the state, got: %v", err)
+	}
+
+	// The reveal is the one proof of the validator for the seed, written
+	// one way.
+	forge := func(reveal string) *Block {
+		b, _ := prepare(offender, 2)
+		extra, err := parseStakeExtra(b.extra)
+		if err != nil {
+			t.Fatalf("Failed to parse extra with err: %s", err)
+		}
+		extra.Reveal = reveal
+		if b.extra, err = json.Marshal(extra); err != nil {
+			t.Fatalf("Failed to marshal extra with err: %s", err)
+		}
+		if err := signSeal(offender.PrivateKey(), b); err != nil {
+			t.Fatalf("Failed to sign seal with err: %s", err)
+		}
+		return b
+	}
+	otherSeed, err := cryptography.VRFProve(offender.PrivateKey(), []byte("another seed"))
+	if err != nil {
+		t.Fatalf("Failed to VRFProve with err: %s", err)
+	}
+	firstExtra, _ := parseStakeExtra(first.extra)
+	for _, reveal := range []string{hex.EncodeToString(otherSeed), strings.ToUpper(firstExtra.Reveal)} {
+		if err := pos.VerifySeal(chain, forge(reveal).Header()); !errors.Is(err, ErrInvalidSeal) {
+			t.Errorf("Expected ErrInvalidSeal for reveal %s, got: %v", reveal, err)
+		}
+	}
+
+	if err := bc.SubmitBlock(first); err != nil {
+		t.Fatalf("Failed to SubmitBlock with err: %s", err)
+	}
+	evidence := &DoubleSignEvidence{First: first.Header(), Second: second.Header()}
+	report := func(e *DoubleSignEvidence, nonce uint64) error {
+		s, err := wallet.NewEvidenceTransaction(gil.PrivateKey(), gil.PublicKey(), gil.BlockchainAddress(), offender.BlockchainAddress(), e.ID(), 0, nonce).GenerateSignature()
+		if err != nil {
+			t.Fatalf("Failed to GenerateSignature with err: %s", err)
+		}
+		return bc.AddEvidenceTransaction(gil.BlockchainAddress(), e, 0, nonce, gil.PublicKey(), s)
+	}
+	if err := report(&DoubleSignEvidence{First: first.Header(), Second: first.Header()}, 3); !errors.Is(err, ErrInvalidEvidence) {
+		t.Errorf("Expected ErrInvalidEvidence for the same block twice, got: %v", err)
+	}
+	if err := report(evidence, 3); err != nil {
+		t.Fatalf("Failed to AddEvidenceTransaction with err: %s", err)
+	}
+	mine()
+	if stake := bc.state.Account(offender.BlockchainAddress()).Stake; stake != 0 {
+		t.Errorf("Expected the stake of the offender to be burnt, got %f", stake)
+	}
+	validators, _, _ = bc.Validators()
+	for _, v := range validators {
+		if v.Address == offender.BlockchainAddress() {
+			t.Errorf("Expected the offender to be no validator anymore")
+		}
+	}
+	if err := report(evidence, 4); !errors.Is(err, ErrKnownEvidence) {
+		t.Errorf("Expected ErrKnownEvidence reporting twice, got: %v", err)
+	}
+
+	// A side branch is checked against the draw on the branch, from the
+	// state replayed up to it.
+	fork := bc.Chain()[:len(bc.Chain())-1]
+	forkState, err := bc.stateAt(fork)
+	if err != nil {
+		t.Fatalf("Failed to replay the chain with err: %s", err)
+	}
+	forkChain := chainState{blockHeaders(fork), forkState}
+	selected, err := pos.Selected(forkChain)
+	if err != nil {
+		t.Fatalf("Failed to get Selected with err: %s", err)
+	}
+	side := func(w *wallet.Wallet) *Block {
+		parent, _ := fork[len(fork)-1].Hash()
+		b := NewBlock(0, parent, []*Transaction{NewCoinbaseTransaction(len(fork), w.BlockchainAddress(), params.Subsidy(len(fork)))})
+		engine, err := NewProofOfStake(params)
+		if err != nil {
+			t.Fatalf("Failed to instatiate proof of stake with err: %s", err)
+		}
+		engine.SetValidator(w.PrivateKey())
+		if err := engine.Prepare(forkChain, b); err != nil {
+			t.Fatalf("Failed to Prepare with err: %s", err)
+		}
+		if err := signSeal(w.PrivateKey(), b); err != nil {
+			t.Fatalf("Failed to sign seal with err: %s", err)
+		}
+		return b
+	}
+	wrong = niko
+	if niko.BlockchainAddress() == selected {
+		wrong = itay
+	}
+	if err := bc.ProcessBlock(side(wrong)); !errors.Is(err, ErrNotSelected) {
+		t.Errorf("Expected ErrNotSelected for a side branch block out of turn, got: %v", err)
+	}
+	if err := bc.ProcessBlock(side(wallets[selected])); err != nil {
+		t.Errorf("Expected the side branch block of the validator drawn to be kept, got: %v", err)
+	}
+
+	// Validators prove the draw with a VRF over P-256 keys.
+	secp, err := wallet.NewWallet(cryptography.Secp256k1, params.GenerateBlockchainAddress)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a wallet with err: %s", err)
+	}
+	s, err = wallet.NewStakeTransaction(secp.PrivateKey(), secp.PublicKey(), secp.BlockchainAddress(), "stake", 1, 0, 1).GenerateSignature()
+	if err != nil {
+		t.Fatalf("Failed to GenerateSignature with err: %s", err)
+	}
+	var invalidAddress *InvalidAddressError
+	if err := bc.AddStakeTransaction(StakeTx, secp.BlockchainAddress(), 1, 0, 1, secp.PublicKey(), s); !errors.As(err, &invalidAddress) {
+		t.Errorf("Expected an InvalidAddressError staking with a secp256k1 key, got: %v", err)
+	}
+
+	other, err := NewBlockchain(itay.BlockchainAddress(), params)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a blockchain with err: %s", err)
+	}
+	if valid, err := other.ValidChain(bc.Chain()); !valid || err != nil {
+		t.Errorf("Expected the staked chain to be valid, got: %v", err)
+	}
+	pow, err := NewBlockchain(niko.BlockchainAddress(), testNetwork())
+	if err != nil {
+		t.Fatalf("Failed to instatiate a blockchain with err: %s", err)
+	}
+	if err := pow.AddStakeTransaction(StakeTx, gil.BlockchainAddress(), 20, 0, 1, gil.PublicKey(), s); !errors.Is(err, ErrNotStaking) {
+		t.Errorf("Expected ErrNotStaking on a proof of work chain, got: %v", err)
+	}
+}
+
+func Test_Contracts(t *testing.T) {
+	params := testNetwork()
+	niko, err := wallet.NewWallet(cryptography.P256, params.GenerateBlockchainAddress)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a wallet with err: %s", err)
+	}
+	itay, err := wallet.NewWallet(cryptography.P256, params.GenerateBlockchainAddress)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a wallet with err: %s", err)
+	}
+	bc, err := NewBlockchain(niko.BlockchainAddress(), params)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a blockchain with err: %s", err)
+	}
+	fund(t, bc, itay.BlockchainAddress())
+
+	// counter adds the first input word to slot 0, logs the new value under
+	// the caller and returns it. Deploying runs it once with no input.
+	code, err := vm.Assemble(`
+		PUSH 0 SLOAD
+		PUSH 0 CALLDATALOAD
+		ADD
+		DUP1 PUSH 0 SSTORE
+		DUP1 CALLER SWAP1 LOG1
+		RETURN
+	`)
+	if err != nil {
+		t.Fatalf("Failed to Assemble with err: %s", err)
+	}
+	contract, err := cryptography.GenerateContractAddress(itay.BlockchainAddress(), 1, params)
+	if err != nil {
+		t.Fatalf("Failed to GenerateContractAddress with err: %s", err)
+	}
+	var gas uint64 = 100000
+	fee := float32(gas) * params.GasPrice
+	send := func(kind TxKind, to string, data []byte, gas uint64, fee float32, nonce uint64) error {
+		s, err := wallet.NewContractTransaction(itay.PrivateKey(), itay.PublicKey(), itay.BlockchainAddress(), string(kind), to, data, gas, fee, nonce).GenerateSignature()
+		if err != nil {
+			t.Fatalf("Failed to GenerateSignature with err: %s", err)
+		}
+		return bc.AddContractTransaction(kind, itay.BlockchainAddress(), to, data, gas, fee, nonce, itay.PublicKey(), s)
+	}
+	mine := func() string {
+		if _, mined, err := bc.Mine(); err != nil || !mined {
+			t.Fatalf("Failed to Mine with err: %v", err)
+		}
+		return bc.lastBlock().GetTransactions()[1].ID()
+	}
+	counter := func() uint64 {
+		info, err := bc.Contract(contract)
+		if err != nil {
+			t.Fatalf("Failed to get Contract with err: %s", err)
+		}
+		v, _ := info.Storage[vm.Word{}].Uint64()
+		return v
+	}
+	input := func(v uint64) []byte {
+		w := vm.WordFromUint64(v)
+		return w[:]
+	}
+
+	if err := send(DeployTx, itay.BlockchainAddress(), code, gas, fee, 1); !errors.Is(err, ErrContractAddress) {
+		t.Errorf("Expected ErrContractAddress, got: %v", err)
+	}
+	if err := send(DeployTx, contract, code, params.MaxTxGas+1, fee, 1); !errors.Is(err, ErrGasLimit) {
+		t.Errorf("Expected ErrGasLimit above MaxTxGas, got: %v", err)
+	}
+	if err := send(DeployTx, contract, code, gas, fee/2, 1); !errors.Is(err, ErrGasLimit) {
+		t.Errorf("Expected ErrGasLimit for a fee below the gas, got: %v", err)
+	}
+	if err := send(CallTx, contract, input(1), gas, fee, 1); !errors.Is(err, ErrContractNotFound) {
+		t.Errorf("Expected ErrContractNotFound, got: %v", err)
+	}
+	if err := send(DeployTx, contract, code, gas, fee, 1); err != nil {
+		t.Fatalf("Failed to deploy with err: %s", err)
+	}
+	deploy := mine()
+	info, err := bc.Contract(contract)
+	if err != nil || info.Code != fmt.Sprintf("%x", code) || len(info.Storage) != 0 {
+		t.Fatalf("Unexpected contract %+v, err: %v", info, err)
+	}
+	r, err := bc.Receipt(deploy)
+	if err != nil || !r.Success || r.GasUsed <= vm.GasCodeByte*uint64(len(code)) {
+		t.Errorf("Unexpected deploy receipt %+v, err: %v", r, err)
+	}
+
+	// A call writes the storage and emits its log.
+	if err := send(CallTx, contract, input(5), gas, fee, 2); err != nil {
+		t.Fatalf("Failed to call with err: %s", err)
+	}
+	call := mine()
+	if v := counter(); v != 5 {
+		t.Errorf("Expected the counter at 5, got %d", v)
+	}
+	r, err = bc.Receipt(call)
+	if err != nil {
+		t.Fatalf("Failed to get Receipt with err: %s", err)
+	}
+	want := uint64(vm.GasSLoad + vm.GasSStore + vm.GasLog + vm.GasLogTopic + 8*vm.GasFastest + vm.GasQuick)
+	if v, _ := r.Output.Uint64(); !r.Success || v != 5 || r.GasUsed != want || r.Height != 3 {
+		t.Errorf("Unexpected call receipt %+v", r)
+	}
+	if len(r.Logs) != 1 || r.Logs[0].Contract != contract || r.Logs[0].Topics[0] != vm.AddressWord(itay.BlockchainAddress()) {
+		t.Errorf("Expected a log under the caller, got %+v", r.Logs)
+	}
+
+	// The state root commits to the code and storage of the contract.
+	proof, err := bc.BalanceProof(contract, -1)
+	if err != nil {
+		t.Fatalf("Failed to get BalanceProof with err: %s", err)
+	}
+	b, err := json.Marshal(proof)
+	if err != nil {
+		t.Fatalf("Failed to marshal proof with err: %s", err)
+	}
+	var received BalanceProof
+	if err := json.Unmarshal(b, &received); err != nil || !received.IsContract() || !received.Verify(bc.lastBlock().GetStateRoot()) {
+		t.Errorf("Expected the proof of the contract to verify, err: %v", err)
+	}
+	received.StorageRoot[0]++
+	if received.Verify(bc.lastBlock().GetStateRoot()) {
+		t.Errorf("Expected a forged storage root not to verify")
+	}
+
+	// A read only call leaves the contract as it was.
+	r, err = bc.CallContract(contract, niko.BlockchainAddress(), input(1))
+	if v, _ := r.Output.Uint64(); err != nil || v != 6 || counter() != 5 {
+		t.Errorf("Expected a read only call to return 6, got %d err %v", v, err)
+	}
+
+	// A call running out of gas changes nothing but still pays its fee.
+	before := bc.state.Account(itay.BlockchainAddress()).Balance
+	low := float32(100) * params.GasPrice
+	if err := send(CallTx, contract, input(1), 100, low, 3); err != nil {
+		t.Fatalf("Failed to call with err: %s", err)
+	}
+	failed := mine()
+	if counter() != 5 {
+		t.Errorf("Expected a failed call not to write, got %d", counter())
+	}
+	if balance := bc.state.Account(itay.BlockchainAddress()).Balance; balance != before-low {
+		t.Errorf("Expected the fee to be paid, balance %f of %f", balance, before)
+	}
+	if r, err := bc.Receipt(failed); err != nil || r.Success || r.GasUsed != 100 || !strings.Contains(r.Error, vm.ErrOutOfGas.Error()) {
+		t.Errorf("Unexpected receipt %+v, err: %v", r, err)
+	}
+
+	// Another node reaches the same state roots.
+	other, err := NewBlockchain(itay.BlockchainAddress(), params)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a blockchain with err: %s", err)
+	}
+	if valid, err := other.ValidChain(bc.Chain()); !valid {
+		t.Errorf("Expected the chain with contracts to be valid, err: %v", err)
+	}
+
+	// Disconnecting the blocks restores the storage of the contract.
+	bc.mux.Lock()
+	for i := 0; i < 2; i++ {
+		if _, err := bc.disconnectTip(); err != nil {
+			t.Fatalf("Failed to disconnectTip with err: %s", err)
+		}
+	}
+	root := bc.state.Root()
+	bc.mux.Unlock()
+	if root != bc.lastBlock().GetStateRoot() || counter() != 0 {
+		t.Errorf("Expected the state after the deploy, counter at %d", counter())
+	}
+}
+
+func Test_Assets(t *testing.T) {
+	params := testNetwork()
+	niko, err := wallet.NewWallet(cryptography.P256, params.GenerateBlockchainAddress)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a wallet with err: %s", err)
+	}
+	itay, err := wallet.NewWallet(cryptography.P256, params.GenerateBlockchainAddress)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a wallet with err: %s", err)
+	}
+	bc, err := NewBlockchain(niko.BlockchainAddress(), params)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a blockchain with err: %s", err)
+	}
+	fund(t, bc, itay.BlockchainAddress())
+
+	issue := func(symbol string, decimals uint8, supply uint64, authority string, nonce uint64) (string, error) {
+		s, err := wallet.NewIssueTransaction(itay.PrivateKey(), itay.PublicKey(), itay.BlockchainAddress(), symbol, decimals, supply, authority, 0, nonce).GenerateSignature()
+		if err != nil {
+			t.Fatalf("Failed to GenerateSignature with err: %s", err)
+		}
+		return bc.AddIssueTransaction(itay.BlockchainAddress(), symbol, decimals, supply, authority, 0, nonce, itay.PublicKey(), s)
+	}
+	send := func(w *wallet.Wallet, kind TxKind, to, asset string, amount, nonce uint64) error {
+		s, err := wallet.NewAssetTransaction(w.PrivateKey(), w.PublicKey(), w.BlockchainAddress(), to, string(kind), asset, amount, 0, nonce).GenerateSignature()
+		if err != nil {
+			t.Fatalf("Failed to GenerateSignature with err: %s", err)
+		}
+		return bc.AddAssetTransaction(kind, w.BlockchainAddress(), to, asset, amount, 0, nonce, w.PublicKey(), s)
+	}
+	mine := func() {
+		if _, mined, err := bc.Mine(); err != nil || !mined {
+			t.Fatalf("Failed to Mine with err: %v", err)
+		}
+	}
+	holds := func(address, asset string) uint64 {
+		for _, b := range bc.AssetBalances(address) {
+			if b.Asset == asset {
+				return b.Balance
+			}
+		}
+		return 0
+	}
+
+	if _, err := issue("gold", 2, 1000, "", 1); !errors.Is(err, ErrInvalidAsset) {
+		t.Errorf("Expected ErrInvalidAsset for a lower case symbol, got: %v", err)
+	}
+	if _, err := issue("GOLD", MaxAssetDecimals+1, 1000, "", 1); !errors.Is(err, ErrInvalidAsset) {
+		t.Errorf("Expected ErrInvalidAsset for too many decimals, got: %v", err)
+	}
+	if _, err := issue("GOLD", 2, 0, "", 1); !errors.Is(err, ErrInvalidAsset) {
+		t.Errorf("Expected ErrInvalidAsset for an asset that can never have a supply, got: %v", err)
+	}
+	gold, err := issue("GOLD", 2, 1000, itay.BlockchainAddress(), 1)
+	if err != nil {
+		t.Fatalf("Failed to issue with err: %s", err)
+	}
+	if gold != AssetID(itay.BlockchainAddress(), 1) {
+		t.Errorf("Expected the asset ID to follow from the issuer and nonce, got %s", gold)
+	}
+	mine()
+	asset, err := bc.Asset(gold)
+	if err != nil || asset.Symbol != "GOLD" || asset.Supply != 1000 || asset.Issuer != itay.BlockchainAddress() {
+		t.Fatalf("Unexpected asset %+v, err: %v", asset, err)
+	}
+	balances := bc.AssetBalances(itay.BlockchainAddress())
+	if len(balances) != 1 || balances[0] != (AssetBalance{Asset: gold, Symbol: "GOLD", Decimals: 2, Balance: 1000}) {
+		t.Errorf("Unexpected asset balances %+v", balances)
+	}
+	// The nonce the asset ID follows from is used up, so the same issue can
+	// not be replayed.
+	if _, err := issue("GOLD", 2, 1000, "", 1); !errors.Is(err, ErrInvalidNonce) {
+		t.Errorf("Expected ErrInvalidNonce, got: %v", err)
+	}
+
+	// Transfers spend what the sender holds, pending ones included, and only
+	// the mint authority mints.
+	if err := send(itay, TransferTx, niko.BlockchainAddress(), gold, 300, 2); err != nil {
+		t.Fatalf("Failed to transfer with err: %s", err)
+	}
+	if err := send(itay, TransferTx, niko.BlockchainAddress(), gold, 800, 3); !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("Expected ErrInsufficientFunds, got: %v", err)
+	}
+	if err := send(niko, MintTx, niko.BlockchainAddress(), gold, 50, 1); !errors.Is(err, ErrMintAuthority) {
+		t.Errorf("Expected ErrMintAuthority, got: %v", err)
+	}
+	if err := send(itay, MintTx, niko.BlockchainAddress(), "nothing", 50, 3); !errors.Is(err, ErrAssetNotFound) {
+		t.Errorf("Expected ErrAssetNotFound, got: %v", err)
+	}
+	if err := send(itay, MintTx, niko.BlockchainAddress(), gold, 50, 3); err != nil {
+		t.Fatalf("Failed to mint with err: %s", err)
+	}
+	mine()
+	if holds(itay.BlockchainAddress(), gold) != 700 || holds(niko.BlockchainAddress(), gold) != 350 {
+		t.Errorf("Expected 700 and 350 GOLD, got %+v and %+v", bc.AssetBalances(itay.BlockchainAddress()), bc.AssetBalances(niko.BlockchainAddress()))
+	}
+	if asset, _ := bc.Asset(gold); asset.Supply != 1050 {
+		t.Errorf("Expected a supply of 1050, got %d", asset.Supply)
+	}
+
+	// The state root commits to the asset and the balances.
+	for _, address := range []string{gold, niko.BlockchainAddress()} {
+		proof, err := bc.BalanceProof(address, -1)
+		if err != nil {
+			t.Fatalf("Failed to get BalanceProof with err: %s", err)
+		}
+		b, err := json.Marshal(proof)
+		if err != nil {
+			t.Fatalf("Failed to marshal proof with err: %s", err)
+		}
+		var received BalanceProof
+		if err := json.Unmarshal(b, &received); err != nil || !received.Verify(bc.lastBlock().GetStateRoot()) {
+			t.Errorf("Expected the proof of %s to verify, err: %v", address, err)
+		}
+		if received.Asset != nil {
+			received.Asset.Supply++
+		} else {
+			received.Assets[gold]++
+		}
+		if received.Verify(bc.lastBlock().GetStateRoot()) {
+			t.Errorf("Expected a forged proof of %s not to verify", address)
+		}
+	}
+
+	other, err := NewBlockchain(itay.BlockchainAddress(), params)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a blockchain with err: %s", err)
+	}
+	if valid, err := other.ValidChain(bc.Chain()); !valid {
+		t.Errorf("Expected the chain with assets to be valid, err: %v", err)
+	}
+
+	// Disconnecting the block restores the balances and the supply.
+	bc.mux.Lock()
+	if _, err := bc.disconnectTip(); err != nil {
+		t.Fatalf("Failed to disconnectTip with err: %s", err)
+	}
+	root := bc.state.Root()
+	bc.mux.Unlock()
+	if root != bc.lastBlock().GetStateRoot() || holds(itay.BlockchainAddress(), gold) != 1000 || holds(niko.BlockchainAddress(), gold) != 0 {
+		t.Errorf("Expected the state after the issue, got %+v", bc.AssetBalances(itay.BlockchainAddress()))
+	}
+	if asset, _ := bc.Asset(gold); asset.Supply != 1000 {
+		t.Errorf("Expected a supply of 1000, got %d", asset.Supply)
+	}
+
+	// A block whose only transaction moves the asset to a new address is
+	// undone for the recipient too.
+	fresh, err := wallet.NewWallet(cryptography.P256, params.GenerateBlockchainAddress)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a wallet with err: %s", err)
+	}
+	bc.mux.Lock()
+	bc.mempool.Clear()
+	bc.mux.Unlock()
+	if err := send(itay, TransferTx, fresh.BlockchainAddress(), gold, 100, 2); err != nil {
+		t.Fatalf("Failed to transfer with err: %s", err)
+	}
+	mine()
+	if holds(fresh.BlockchainAddress(), gold) != 100 {
+		t.Fatalf("Expected 100 GOLD, got %+v", bc.AssetBalances(fresh.BlockchainAddress()))
+	}
+	bc.mux.Lock()
+	if _, err := bc.disconnectTip(); err != nil {
+		t.Fatalf("Failed to disconnectTip with err: %s", err)
+	}
+	root = bc.state.Root()
+	bc.mux.Unlock()
+	if root != bc.lastBlock().GetStateRoot() || holds(fresh.BlockchainAddress(), gold) != 0 || holds(itay.BlockchainAddress(), gold) != 1000 {
+		t.Errorf("Expected the transfer to be undone, got %+v", bc.AssetBalances(fresh.BlockchainAddress()))
+	}
+}
+
+func Test_NFTs(t *testing.T) {
+	params := testNetwork()
+	niko, err := wallet.NewWallet(cryptography.P256, params.GenerateBlockchainAddress)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a wallet with err: %s", err)
+	}
+	itay, err := wallet.NewWallet(cryptography.P256, params.GenerateBlockchainAddress)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a wallet with err: %s", err)
+	}
+	bc, err := NewBlockchain(niko.BlockchainAddress(), params)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a blockchain with err: %s", err)
+	}
+	fund(t, bc, itay.BlockchainAddress())
+
+	send := func(w *wallet.Wallet, kind TxKind, to, collection, token, metadata string, nonce uint64) error {
+		s, err := wallet.NewNFTTransaction(w.PrivateKey(), w.PublicKey(), w.BlockchainAddress(), to, string(kind), collection, token, metadata, 0, nonce).GenerateSignature()
+		if err != nil {
+			t.Fatalf("Failed to GenerateSignature with err: %s", err)
+		}
+		return bc.AddNFTTransaction(kind, w.BlockchainAddress(), to, collection, token, metadata, 0, nonce, w.PublicKey(), s)
+	}
+	mine := func() {
+		if _, mined, err := bc.Mine(); err != nil || !mined {
+			t.Fatalf("Failed to Mine with err: %v", err)
+		}
+	}
+	owned := func(address string) []string {
+		var ids []string
+		for _, nft := range bc.NFTs(address) {
+			ids = append(ids, nft.Collection+"/"+nft.ID)
+		}
+		return ids
+	}
+	const uri = "ipfs://bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi"
+	hash := fmt.Sprintf("%x", sha256.Sum256([]byte("mona lisa")))
+	itayAddr, nikoAddr := itay.BlockchainAddress(), niko.BlockchainAddress()
+
+	if err := send(itay, NFTMintTx, itayAddr, "art", "1", "not a uri", 1); !errors.Is(err, ErrInvalidNFT) {
+		t.Errorf("Expected ErrInvalidNFT for metadata that is not a URI, got: %v", err)
+	}
+	if err := send(itay, NFTMintTx, itayAddr, "art/1", "1", uri, 1); !errors.Is(err, ErrInvalidNFT) {
+		t.Errorf("Expected ErrInvalidNFT for a collection with a slash, got: %v", err)
+	}
+	if err := send(itay, NFTBurnTx, nikoAddr, "art", "1", "", 1); !errors.Is(err, ErrInvalidNFT) {
+		t.Errorf("Expected ErrInvalidNFT for a burn to another address, got: %v", err)
+	}
+	if err := send(itay, NFTMintTx, itayAddr, "art", "1", uri, 1); err != nil {
+		t.Fatalf("Failed to mint with err: %s", err)
+	}
+	if err := send(itay, NFTMintTx, nikoAddr, "art", "2", hash, 2); err != nil {
+		t.Fatalf("Failed to mint with err: %s", err)
+	}
+	if err := send(itay, NFTMintTx, itayAddr, "art", "1", uri, 3); !errors.Is(err, ErrNFTExists) {
+		t.Errorf("Expected ErrNFTExists for a pending token, got: %v", err)
+	}
+	mine()
+	nft, err := bc.NFT("art", "2")
+	if err != nil || *nft != (NFT{Collection: "art", ID: "2", Owner: nikoAddr, Metadata: hash}) {
+		t.Fatalf("Unexpected nft %+v, err: %v", nft, err)
+	}
+	if err := send(niko, NFTMintTx, nikoAddr, "art", "3", uri, 1); !errors.Is(err, ErrCollectionCreator) {
+		t.Errorf("Expected ErrCollectionCreator, got: %v", err)
+	}
+
+	// Only the owner moves a token, and only once a block.
+	if err := send(niko, NFTTransferTx, itayAddr, "art", "1", "", 1); !errors.Is(err, ErrNFTOwner) {
+		t.Errorf("Expected ErrNFTOwner, got: %v", err)
+	}
+	if err := send(niko, NFTTransferTx, itayAddr, "art", "9", "", 1); !errors.Is(err, ErrNFTNotFound) {
+		t.Errorf("Expected ErrNFTNotFound, got: %v", err)
+	}
+	if err := send(itay, NFTTransferTx, nikoAddr, "art", "1", "", 3); err != nil {
+		t.Fatalf("Failed to transfer with err: %s", err)
+	}
+	if err := send(itay, NFTBurnTx, itayAddr, "art", "1", "", 4); !errors.Is(err, ErrNFTOwner) {
+		t.Errorf("Expected ErrNFTOwner for a token already moved, got: %v", err)
+	}
+	mine()
+	if ids := owned(nikoAddr); len(ids) != 2 || ids[0] != "art/1" || ids[1] != "art/2" {
+		t.Errorf("Expected niko to own art/1 and art/2, got %v", ids)
+	}
+	if ids := owned(itayAddr); len(ids) != 0 {
+		t.Errorf("Expected itay to own nothing, got %v", ids)
+	}
+
+	if err := send(niko, NFTBurnTx, nikoAddr, "art", "2", "", 1); err != nil {
+		t.Fatalf("Failed to burn with err: %s", err)
+	}
+	mine()
+	if nft, err := bc.NFT("art", "2"); err != nil || !nft.Burned || nft.Owner != "" {
+		t.Errorf("Expected art/2 to be burned, got %+v err: %v", nft, err)
+	}
+	if ids := owned(nikoAddr); len(ids) != 1 || ids[0] != "art/1" {
+		t.Errorf("Expected niko to own art/1, got %v", ids)
+	}
+	if err := send(itay, NFTMintTx, itayAddr, "art", "2", uri, 4); !errors.Is(err, ErrNFTExists) {
+		t.Errorf("Expected ErrNFTExists for a burned token, got: %v", err)
+	}
+	if err := send(niko, NFTTransferTx, itayAddr, "art", "2", "", 2); !errors.Is(err, ErrNFTNotFound) {
+		t.Errorf("Expected ErrNFTNotFound for a burned token, got: %v", err)
+	}
+
+	// The state root commits to the tokens and who owns them.
+	for _, address := range []string{nftKey("art", "1"), nikoAddr} {
+		proof, err := bc.BalanceProof(address, -1)
+		if err != nil {
+			t.Fatalf("Failed to get BalanceProof with err: %s", err)
+		}
+		b, err := json.Marshal(proof)
+		if err != nil {
+			t.Fatalf("Failed to marshal proof with err: %s", err)
+		}
+		var received BalanceProof
+		if err := json.Unmarshal(b, &received); err != nil || !received.Verify(bc.lastBlock().GetStateRoot()) {
+			t.Errorf("Expected the proof of %s to verify, err: %v", address, err)
+		}
+		if received.NFT != nil {
+			received.NFT.Owner = itayAddr
+		} else {
+			received.NFTs = append(received.NFTs, nftKey("art", "2"))
+		}
+		if received.Verify(bc.lastBlock().GetStateRoot()) {
+			t.Errorf("Expected a forged proof of %s not to verify", address)
+		}
+	}
+
+	other, err := NewBlockchain(itayAddr, params)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a blockchain with err: %s", err)
+	}
+	if valid, err := other.ValidChain(bc.Chain()); !valid {
+		t.Errorf("Expected the chain with nfts to be valid, err: %v", err)
+	}
+
+	// Disconnecting the burn brings the token back to its owner.
+	bc.mux.Lock()
+	if _, err := bc.disconnectTip(); err != nil {
+		t.Fatalf("Failed to disconnectTip with err: %s", err)
+	}
+	root := bc.state.Root()
+	bc.mux.Unlock()
+	if root != bc.lastBlock().GetStateRoot() {
+		t.Errorf("Expected the state root of the block before the burn")
+	}
+	if nft, err := bc.NFT("art", "2"); err != nil || nft.Burned || nft.Owner != nikoAddr {
+		t.Errorf("Expected niko to own art/2 again, got %+v err: %v", nft, err)
+	}
+	if ids := owned(nikoAddr); len(ids) != 2 {
+		t.Errorf("Expected niko to own two tokens, got %v", ids)
+	}
+}
+
+func Test_Finality(t *testing.T) {
+	params := testNetwork()
+	var validators []*wallet.Wallet
+	for i := 0; i < 4; i++ {
+		w, err := wallet.NewWallet(cryptography.P256, params.GenerateBlockchainAddress)
+		if err != nil {
+			t.Fatalf("Failed to instatiate a wallet with err: %s", err)
+		}
+		validators = append(validators, w)
+		params.FinalityValidators = append(params.FinalityValidators, w.BlockchainAddress())
+	}
+	now := time.Now()
+	var nodes []*Blockchain
+	for _, w := range validators {
+		bc, err := NewBlockchain(w.BlockchainAddress(), params)
+		if err != nil {
+			t.Fatalf("Failed to instatiate a blockchain with err: %s", err)
+		}
+		bc.SetClock(func() time.Time { return now })
+		if err := bc.SetFinalityKey(w.PrivateKey()); err != nil {
+			t.Fatalf("Failed to SetFinalityKey with err: %s", err)
+		}
+		nodes = append(nodes, bc)
+	}
+	// gossip steps the nodes and passes every vote to the others until no
+	// vote is left.
+	gossip := func(nodes []*Blockchain) {
+		for {
+			var votes []*FinalityVote
+			for _, bc := range nodes {
+				v, err := bc.FinalityStep()
+				if err != nil {
+					t.Fatalf("Failed to FinalityStep with err: %s", err)
+				}
+				votes = append(votes, v...)
+			}
+			if len(votes) == 0 {
+				return
+			}
+			for _, v := range votes {
+				for _, bc := range nodes {
+					if err := bc.AddFinalityVote(v); err != nil && !errors.Is(err, ErrKnownVote) {
+						t.Fatalf("Failed to AddFinalityVote with err: %s", err)
+					}
+				}
+			}
+		}
+	}
+
+	fund(t, nodes[0], validators[0].BlockchainAddress())
+	block1 := nodes[0].Chain()[1]
+	hash1 := block1.Header().Hash()
+	// Half the validators can not make a block final.
+	for _, bc := range nodes[1:] {
+		if err := bc.ProcessBlock(block1); err != nil {
+			t.Fatalf("Failed to ProcessBlock with err: %s", err)
+		}
+	}
+	gossip(nodes[:2])
+	if height, _ := nodes[0].Finalized(); height != 0 {
+		t.Errorf("Expected no finality from two of four validators, got height %d", height)
+	}
+	now = now.Add(DefaultRoundTimeout)
+	gossip(nodes)
+	for i, bc := range nodes {
+		if height, hash := bc.Finalized(); height != 1 || hash != hash1 {
+			t.Errorf("Expected block 1 final on node %d, got %d %x", i, height, hash)
+		}
+	}
+	if status, err := nodes[0].FinalityStatus(); err != nil || status.Round != 0 || status.VotingHeight != 2 ||
+		status.Commit == nil || status.Commit.Round != 1 || len(status.Commit.Precommits) < 3 {
+		t.Errorf("Unexpected finality status %+v, err: %v", status, err)
+	}
+	if status, ok := nodes[0].BlockStatus(hash1); !ok || !status.Final || !status.MainChain || status.Height != 1 {
+		t.Errorf("Expected block 1 to be final, got %+v", status)
+	}
+	if b, err := json.Marshal(&BlockStatus{Block: block1, Height: 1, MainChain: true, Final: true}); err != nil || !strings.Contains(string(b), `"final":true`) {
+		t.Errorf("Expected the final status in the block JSON %s, err: %v", b, err)
+	} else {
+		var decoded Block
+		if err := json.Unmarshal(b, &decoded); err != nil || decoded.Header().Hash() != hash1 {
+			t.Errorf("Expected the block JSON to still decode as the block, err: %v", err)
+		}
+	}
+
+	// A branch with more work from the genesis block is not followed.
+	other, err := NewBlockchain(validators[1].BlockchainAddress(), params)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a blockchain with err: %s", err)
+	}
+	for i := 0; i < 3; i++ {
+		fund(t, other, validators[1].BlockchainAddress())
+	}
+	branch := other.Chain()
+	if err := nodes[0].ProcessBlock(branch[1]); !errors.Is(err, ErrFinalized) {
+		t.Errorf("Expected ErrFinalized for a block below the final one, got: %v", err)
+	}
+	if err := nodes[0].SetChain(branch); !errors.Is(err, ErrFinalized) {
+		t.Errorf("Expected ErrFinalized for a reorg of a final block, got: %v", err)
+	}
+	if nodes[0].Chain()[1] != block1 {
+		t.Errorf("Expected the final block to stay on the chain")
+	}
+
+	// A node that missed the votes takes the commit of a peer, once it has
+	// the block.
+	late, err := NewBlockchain(validators[0].BlockchainAddress(), params)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a blockchain with err: %s", err)
+	}
+	status, _ := nodes[0].FinalityStatus()
+	forged := *status.Commit
+	forged.Precommits = forged.Precommits[:2]
+	if err := late.ApplyCommit(&forged); !errors.Is(err, ErrInvalidCommit) {
+		t.Errorf("Expected ErrInvalidCommit for two precommits, got: %v", err)
+	}
+	if err := late.ApplyCommit(status.Commit); !errors.Is(err, ErrBlockNotFound) {
+		t.Errorf("Expected ErrBlockNotFound before the block arrives, got: %v", err)
+	}
+	if err := late.ProcessBlock(block1); err != nil {
+		t.Fatalf("Failed to ProcessBlock with err: %s", err)
+	}
+	if _, err := late.FinalityStep(); err != nil {
+		t.Fatalf("Failed to FinalityStep with err: %s", err)
+	}
+	if height, _ := late.Finalized(); height != 1 {
+		t.Errorf("Expected the commit to make block 1 final, got height %d", height)
+	}
+
+	// Votes are checked against the validator set and never change.
+	v, err := signVote(validators[0].PrivateKey(), params, Prevote, 2, 0, hash1)
+	if err != nil {
+		t.Fatalf("Failed to sign vote with err: %s", err)
+	}
+	if err := nodes[1].AddFinalityVote(v); err != nil {
+		t.Fatalf("Failed to AddFinalityVote with err: %s", err)
+	}
+	conflicting, _ := signVote(validators[0].PrivateKey(), params, Prevote, 2, 0, [32]byte{1})
+	if err := nodes[1].AddFinalityVote(conflicting); !errors.Is(err, ErrConflictingVote) {
+		t.Errorf("Expected ErrConflictingVote, got: %v", err)
+	}
+	stranger, err := wallet.NewWallet(cryptography.P256, params.GenerateBlockchainAddress)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a wallet with err: %s", err)
+	}
+	outsider, _ := signVote(stranger.PrivateKey(), params, Prevote, 2, 0, hash1)
+	if err := nodes[1].AddFinalityVote(outsider); !errors.Is(err, ErrNotFinalityValidator) {
+		t.Errorf("Expected ErrNotFinalityValidator, got: %v", err)
+	}
+}
+
+// testNetwork is regtest with coinbase rewards spendable right away.
+func testNetwork() *network_params.Params {
+	params := *network_params.RegTest
+	params.CoinbaseMaturity = 0
+	return &params
+}
+
+// fund mines a block paying its coinbase to address.
+func fund(t *testing.T, bc *Blockchain, address string) {
+	template, err := bc.BlockTemplateFor(address)
+	if err != nil {
+		t.Fatalf("Failed to get BlockTemplate with err: %s", err)
+	}
+	b, _, err := template.Solve(context.Background(), NewMiningEngine(0))
+	if err != nil {
+		t.Fatalf("Failed to Solve with err: %s", err)
+	}
+	if err := bc.SubmitBlock(b); err != nil {
+		t.Fatalf("Failed to SubmitBlock with err: %s", err)
+	}
+}
@@ -0,0 +1,381 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// DefaultMaxOrphans is how many blocks with an unknown parent are kept.
+const DefaultMaxOrphans = 100
+
+// DefaultMaxSideBlocks is how many blocks off the chain are kept.
+const DefaultMaxSideBlocks = 1000
+
+var (
+	ErrKnownBlock        = errors.New("block is already known")
+	ErrTooManySideBlocks = errors.New("too many side branch blocks")
+)
+
+// OrphanBlockError is returned for a block whose parent is unknown. The block
+// is kept until its parent arrives.
+type OrphanBlockError struct {
+	Parent [32]byte
+}
+
+func (e *OrphanBlockError) Error() string {
+	return fmt.Sprintf("parent block %x is unknown", e.Parent)
+}
+
+// InvalidBlockError tells which block made a branch invalid.
+type InvalidBlockError struct {
+	Hash   [32]byte
+	Height int
+	Err    error
+}
+
+func (e *InvalidBlockError) Error() string {
+	return fmt.Sprintf("block %d: %s", e.Height, e.Err)
+}
+
+func (e *InvalidBlockError) Unwrap() error {
+	return e.Err
+}
+
+// blockNode is a block in the tree of every branch the node knows about. work
+// is the work of the branch up to and including the block.
+type blockNode struct {
+	block  *Block
+	hash   [32]byte
+	parent *blockNode
+	height int
+	work   *big.Int
+}
+
+func newBlockNode(b *Block, hash [32]byte, parent *blockNode, work *big.Int) *blockNode {
+	n := &blockNode{
+		block: b,
+		hash:  hash,
+		work:  work,
+	}
+	if parent != nil {
+		n.parent = parent
+		n.height = parent.height + 1
+		n.work.Add(n.work, parent.work)
+	}
+	return n
+}
+
+// branch returns the blocks from the genesis block to n.
+func (n *blockNode) branch() []*Block {
+	blocks := make([]*Block, n.height+1)
+	for ; n != nil; n = n.parent {
+		blocks[n.height] = n.block
+	}
+	return blocks
+}
+
+// ancestor returns the block of the branch of n at height.
+func (n *blockNode) ancestor(height int) *blockNode {
+	for n != nil && n.height > height {
+		n = n.parent
+	}
+	if n == nil || n.height != height {
+		return nil
+	}
+	return n
+}
+
+// blockWork is the expected number of hashes to find a block, 16 for every
+// leading zero hex digit.
+func blockWork(difficulty int) *big.Int {
+	return new(big.Int).Lsh(big.NewInt(1), uint(4*difficulty))
+}
+
+// orphanPool holds blocks that arrived before their parent, by the hash of the
+// missing parent. The oldest block is dropped when it is full.
+type orphanPool struct {
+	limit    int
+	blocks   map[[32]byte]*Block
+	byParent map[[32]byte][][32]byte
+	order    [][32]byte
+}
+
+func newOrphanPool(limit int) *orphanPool {
+	return &orphanPool{
+		limit:    limit,
+		blocks:   make(map[[32]byte]*Block),
+		byParent: make(map[[32]byte][][32]byte),
+	}
+}
+
+func (p *orphanPool) has(hash [32]byte) bool {
+	_, ok := p.blocks[hash]
+	return ok
+}
+
+func (p *orphanPool) add(hash [32]byte, b *Block) {
+	if p.has(hash) {
+		return
+	}
+	for len(p.blocks) >= p.limit && len(p.order) > 0 {
+		oldest := p.order[0]
+		p.order = p.order[1:]
+		p.remove(oldest)
+	}
+	p.blocks[hash] = b
+	parent := b.GetPreviousHash()
+	p.byParent[parent] = append(p.byParent[parent], hash)
+	p.order = append(p.order, hash)
+}
+
+func (p *orphanPool) remove(hash [32]byte) {
+	b, ok := p.blocks[hash]
+	if !ok {
+		return
+	}
+	delete(p.blocks, hash)
+	parent := b.GetPreviousHash()
+	children := p.byParent[parent]
+	for i, h := range children {
+		if h == hash {
+			children = append(children[:i:i], children[i+1:]...)
+			break
+		}
+	}
+	if len(children) == 0 {
+		delete(p.byParent, parent)
+	} else {
+		p.byParent[parent] = children
+	}
+	for i, h := range p.order {
+		if h == hash {
+			p.order = append(p.order[:i:i], p.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// takeChildren removes and returns the orphans waiting for parent.
+func (p *orphanPool) takeChildren(parent [32]byte) []*Block {
+	var children []*Block
+	for _, hash := range p.byParent[parent] {
+		children = append(children, p.blocks[hash])
+	}
+	for _, b := range children {
+		hash, _ := b.Hash()
+		p.remove(hash)
+	}
+	return children
+}
+
+func (p *orphanPool) len() int {
+	return len(p.blocks)
+}
+
+// ProcessBlock takes a block from a peer. A block extending the tip is
+// connected. A block forking from an earlier block is kept as a side branch,
+// and the chain switches to that branch once it has more work. A block with
+// an unknown parent is kept as an orphan and an *OrphanBlockError tells which
+// parent to ask for. Orphans waiting for the block are processed after it.
+func (bc *Blockchain) ProcessBlock(b *Block) error {
+	bc.mux.Lock()
+	events, err := bc.processBlock(b)
+	listeners := bc.reorgListeners
+	bc.mux.Unlock()
+
+	for _, e := range events {
+		emitReorg(e, listeners)
+	}
+	return err
+}
+
+// Block returns the block with the given hash, on the chain or on a side
+// branch.
+func (bc *Blockchain) Block(hash [32]byte) (*Block, bool) {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	n, ok := bc.tree[hash]
+	if !ok {
+		return nil, false
+	}
+	return n.block, true
+}
+
+// OrphanCount is the number of blocks waiting for their parent.
+func (bc *Blockchain) OrphanCount() int {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	return bc.orphans.len()
+}
+
+func (bc *Blockchain) processBlock(b *Block) ([]*ReorgEvent, error) {
+	var events []*ReorgEvent
+	queue := []*Block{b}
+	var first error
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		hash, e, err := bc.addBlock(next)
+		if next == b {
+			first = err
+		}
+		if e != nil {
+			events = append(events, e)
+		}
+		if err == nil {
+			queue = append(queue, bc.orphans.takeChildren(hash)...)
+		}
+	}
+	return events, first
+}
+
+func (bc *Blockchain) addBlock(b *Block) ([32]byte, *ReorgEvent, error) {
+	hash, err := b.Hash()
+	if err != nil {
+		return hash, nil, err
+	}
+	if _, ok := bc.tree[hash]; ok || bc.orphans.has(hash) {
+		return hash, nil, ErrKnownBlock
+	}
+	parent, ok := bc.tree[b.GetPreviousHash()]
+	if !ok {
+		bc.orphans.add(hash, b)
+		return hash, nil, &OrphanBlockError{Parent: b.GetPreviousHash()}
+	}
+	tip := bc.tipNode()
+	chain := bc.chain
+	if parent != tip {
+		if err := bc.checkSideBlock(parent, hash); err != nil {
+			return hash, nil, err
+		}
+		chain = parent.branch()
+	}
+	headers, err := bc.sealChain(chain, parent == tip)
+	if err != nil {
+		return hash, nil, err
+	}
+	if err := bc.consensus.VerifySeal(headers, b.Header()); err != nil {
+		return hash, nil, err
+	}
+
+	if parent == tip {
+		if err := bc.acceptBlock(b); err != nil {
+			return hash, nil, err
+		}
+		return hash, nil, nil
+	}
+
+	n := newBlockNode(b, hash, parent, bc.consensus.Work(b.Header()))
+	bc.tree[hash] = n
+	if n.work.Cmp(tip.work) <= 0 {
+		return hash, nil, nil
+	}
+
+	e, err := bc.reorg(n.branch())
+	if err != nil {
+		var invalid *InvalidBlockError
+		if errors.As(err, &invalid) {
+			bc.pruneBranch(invalid.Hash)
+		}
+		return hash, nil, err
+	}
+	return hash, e, nil
+}
+
+// checkSideBlock refuses a block on parent, off the tip, that the chain could
+// never switch to, and one more side block than there is room for. Side
+// blocks no reorg can reach any more are dropped to make room.
+func (bc *Blockchain) checkSideBlock(parent *blockNode, hash [32]byte) error {
+	if err := bc.checkCheckpoint(parent.height+1, hash); err != nil {
+		return err
+	}
+	if err := bc.checkFinal(parent); err != nil {
+		return err
+	}
+	if err := bc.checkFork(parent); err != nil {
+		return err
+	}
+	if len(bc.tree)-len(bc.chain) < bc.maxSideBlocks {
+		return nil
+	}
+	for h, n := range bc.tree {
+		if !bc.onChain(n) && bc.checkFork(n) != nil {
+			delete(bc.tree, h)
+		}
+	}
+	if len(bc.tree)-len(bc.chain) >= bc.maxSideBlocks {
+		return fmt.Errorf("%w: %d kept", ErrTooManySideBlocks, bc.maxSideBlocks)
+	}
+	return nil
+}
+
+// checkFork makes sure the branch of n leaves the chain no lower than the
+// final block and at most MaxReorgDepth blocks below the tip.
+func (bc *Blockchain) checkFork(n *blockNode) error {
+	for !bc.onChain(n) {
+		n = n.parent
+	}
+	if final := bc.finalHeight(); n.height < final {
+		return fmt.Errorf("%w: fork at height %d, block %d is final", ErrFinalized, n.height, final)
+	}
+	if depth := len(bc.chain) - 1 - n.height; bc.params.MaxReorgDepth > 0 && depth > bc.params.MaxReorgDepth {
+		return fmt.Errorf("%w: fork %d blocks deep, at most %d", ErrReorgTooDeep, depth, bc.params.MaxReorgDepth)
+	}
+	return nil
+}
+
+// onChain reports whether the block of n is on the chain.
+func (bc *Blockchain) onChain(n *blockNode) bool {
+	if n.height >= len(bc.chain) {
+		return false
+	}
+	hash, _ := bc.chain[n.height].Hash()
+	return hash == n.hash
+}
+
+// sealChain is chain as a seal of a block on top of it is verified with. Proof
+// of stake draws the validator from the state, which a side branch has to be
+// replayed for.
+func (bc *Blockchain) sealChain(chain []*Block, tip bool) (ChainHeaders, error) {
+	if _, ok := bc.consensus.(*ProofOfStake); !ok {
+		return blockHeaders(chain), nil
+	}
+	if tip {
+		return chainState{blockHeaders(chain), bc.state}, nil
+	}
+	state, err := bc.stateAt(chain)
+	if err != nil {
+		return nil, err
+	}
+	return chainState{blockHeaders(chain), state}, nil
+}
+
+func (bc *Blockchain) tipNode() *blockNode {
+	hash, _ := bc.lastBlock().Hash()
+	return bc.tree[hash]
+}
+
+// addNode records a block connected to the chain in the tree.
+func (bc *Blockchain) addNode(b *Block, hash [32]byte) {
+	if _, ok := bc.tree[hash]; ok {
+		return
+	}
+	bc.tree[hash] = newBlockNode(b, hash, bc.tree[b.GetPreviousHash()], bc.consensus.Work(b.Header()))
+}
+
+// pruneBranch drops an invalid block and every block built on it.
+func (bc *Blockchain) pruneBranch(hash [32]byte) {
+	bad, ok := bc.tree[hash]
+	if !ok {
+		return
+	}
+	for h, n := range bc.tree {
+		for a := n; a != nil; a = a.parent {
+			if a == bad {
+				delete(bc.tree, h)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package blockchain
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"sync"
+
+	"blockchain/blockchain-service/network-params"
+)
+
+// Consensus is the engine that decides who may produce the next block and
+// which branch of the chain the nodes follow.
+type Consensus interface {
+	// Prepare fills in the consensus fields of b, the block about to be
+	// sealed on top of chain.
+	Prepare(chain ChainHeaders, b *Block) error
+	// Seal finishes b so that VerifySeal accepts it. It returns once b is
+	// sealed or ctx is done.
+	Seal(ctx context.Context, chain ChainHeaders, b *Block) error
+	// VerifySeal checks the seal of header as the block at height
+	// chain.Len().
+	VerifySeal(chain ChainHeaders, header *BlockHeader) error
+	// Work is the weight header adds to its branch. The branch with the most
+	// work is the one followed.
+	Work(header *BlockHeader) *big.Int
+}
+
+// ChainHeaders is the chain a block is sealed or verified on top of.
+type ChainHeaders interface {
+	Len() int
+	Header(height int) *BlockHeader
+}
+
+// ChainState is a chain together with the account state after it. Engines
+// that need the state, like proof of stake, check what they can without it on
+// bare ChainHeaders.
+type ChainState interface {
+	ChainHeaders
+	State() *StateTree
+}
+
+// Headers is a chain of headers, as followed by a light client.
+type Headers []*BlockHeader
+
+func (h Headers) Len() int {
+	return len(h)
+}
+
+func (h Headers) Header(height int) *BlockHeader {
+	return h[height]
+}
+
+// blockHeaders is a chain of blocks as ChainHeaders.
+type blockHeaders []*Block
+
+func (c blockHeaders) Len() int {
+	return len(c)
+}
+
+func (c blockHeaders) Header(height int) *BlockHeader {
+	return c[height].Header()
+}
+
+// chainState is a chain of blocks with the state after it.
+type chainState struct {
+	blockHeaders
+	state *StateTree
+}
+
+func (c chainState) State() *StateTree {
+	return c.state
+}
+
+// NewConsensus returns the consensus engine of the network.
+func NewConsensus(params *network_params.Params) (Consensus, error) {
+	switch params.Consensus {
+	case "", network_params.ProofOfWork:
+		return NewProofOfWork(params.MinDifficulty), nil
+	case network_params.ProofOfAuthority:
+		return NewProofOfAuthority(params)
+	case network_params.ProofOfStake:
+		return NewProofOfStake(params)
+	}
+	return nil, fmt.Errorf("unknown consensus engine %q", params.Consensus)
+}
+
+// ProofOfWork accepts a block whose hash has Difficulty leading zero hex
+// digits. Every block adds the same work.
+type ProofOfWork struct {
+	difficulty int
+
+	mux      sync.Mutex
+	engine   *MiningEngine
+	hashRate float64
+}
+
+func NewProofOfWork(difficulty int) *ProofOfWork {
+	return &ProofOfWork{
+		difficulty: difficulty,
+		engine:     NewMiningEngine(0),
+	}
+}
+
+// SetWorkers sets the number of goroutines Seal solves blocks with.
+func (p *ProofOfWork) SetWorkers(workers int) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.engine = NewMiningEngine(workers)
+}
+
+// HashRate is the hash rate of the last block sealed.
+func (p *ProofOfWork) HashRate() float64 {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	return p.hashRate
+}
+
+func (p *ProofOfWork) Prepare(chain ChainHeaders, b *Block) error {
+	return nil
+}
+
+func (p *ProofOfWork) Seal(ctx context.Context, chain ChainHeaders, b *Block) error {
+	p.mux.Lock()
+	engine := p.engine
+	p.mux.Unlock()
+
+	result, err := engine.Solve(ctx, *b.Header(), p.difficulty)
+	if err != nil {
+		return err
+	}
+	b.nonce = result.Nonce
+
+	p.mux.Lock()
+	p.hashRate = result.HashRate()
+	p.mux.Unlock()
+	log.Printf("mined nonce %d with %d workers: %d hashes in %s (%.0f H/s)",
+		result.Nonce, engine.Workers(), result.Hashes, result.Duration, result.HashRate())
+	return nil
+}
+
+func (p *ProofOfWork) VerifySeal(chain ChainHeaders, header *BlockHeader) error {
+	if len(header.Extra) > 0 || len(header.Seal) > 0 {
+		return fmt.Errorf("%w: proof of work blocks carry no extra data or seal", ErrInvalidSeal)
+	}
+	if !header.Meets(p.difficulty) {
+		return fmt.Errorf("invalid proof of work for nonce %d", header.Nonce)
+	}
+	return nil
+}
+
+func (p *ProofOfWork) Work(header *BlockHeader) *big.Int {
+	return blockWork(p.difficulty)
+}
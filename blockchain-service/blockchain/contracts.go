@@ -0,0 +1,257 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+
+	"blockchain/blockchain-service/vm"
+	"blockchain/foundation/cryptography"
+)
+
+var (
+	ErrContractNotFound = errors.New("contract not found")
+	ErrContractExists   = errors.New("contract already exists")
+	ErrContractAddress  = errors.New("contract address does not follow from the sender and nonce")
+	ErrGasLimit         = errors.New("transaction gas is out of bounds")
+)
+
+// Receipt is the outcome of a deploy or call transaction. A failed
+// transaction leaves the contract as it was but still pays its whole fee.
+type Receipt struct {
+	TxID     string         `json:"transaction_id"`
+	Kind     TxKind         `json:"kind"`
+	Contract string         `json:"contract"`
+	Height   int            `json:"height"`
+	Success  bool           `json:"success"`
+	GasUsed  uint64         `json:"gas_used"`
+	Output   vm.Word        `json:"output"`
+	Logs     []*ContractLog `json:"logs,omitempty"`
+	Error    string         `json:"error,omitempty"`
+}
+
+// ContractLog is an event emitted by a contract.
+type ContractLog struct {
+	Contract string    `json:"contract"`
+	Topics   []vm.Word `json:"topics,omitempty"`
+	Data     vm.Word   `json:"data"`
+}
+
+// ContractInfo is a contract with its code, in hex, and storage.
+type ContractInfo struct {
+	Address  string              `json:"address"`
+	Balance  float32             `json:"balance"`
+	CodeHash string              `json:"code_hash"`
+	Code     string              `json:"code"`
+	Storage  map[vm.Word]vm.Word `json:"storage"`
+	Height   int                 `json:"height"`
+}
+
+// AddContractTransaction deploys the code in data at contract, or calls the
+// contract with data as input when kind is CallTx. A call must be to a
+// contract in the chain.
+func (bc *Blockchain) AddContractTransaction(kind TxKind, sender, contract string, data []byte, gas uint64, fee float32, nonce uint64, pKey cryptography.PublicKey, s *cryptography.Signature) error {
+	if kind != DeployTx && kind != CallTx {
+		return fmt.Errorf("%w: %q is not a contract transaction", ErrLedger, kind)
+	}
+	bc.mux.RLock()
+	exists := bc.state.Account(contract).IsContract()
+	bc.mux.RUnlock()
+	switch {
+	case kind == DeployTx && exists:
+		return fmt.Errorf("%w: %s", ErrContractExists, contract)
+	case kind == CallTx && !exists:
+		return fmt.Errorf("%w: %s", ErrContractNotFound, contract)
+	}
+	return bc.addTransaction(NewContractTransaction(kind, sender, contract, data, gas, fee, nonce, 0, []cryptography.PublicKey{pKey}, []*cryptography.Signature{s}))
+}
+
+// Contract returns the contract at address as of the last block.
+func (bc *Blockchain) Contract(address string) (*ContractInfo, error) {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+
+	a := bc.state.Account(address)
+	if !a.IsContract() {
+		return nil, fmt.Errorf("%w: %s", ErrContractNotFound, address)
+	}
+	return &ContractInfo{
+		Address:  address,
+		Balance:  a.Balance,
+		CodeHash: fmt.Sprintf("%x", a.CodeHash),
+		Code:     hex.EncodeToString(bc.state.Code(address)),
+		Storage:  bc.state.Storage(address),
+		Height:   len(bc.chain) - 1,
+	}, nil
+}
+
+// CallContract runs the contract at address with input as caller on top of
+// the last block, with MaxTxGas and without keeping its writes. It is how
+// clients read a contract.
+func (bc *Blockchain) CallContract(address, caller string, input []byte) (*Receipt, error) {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+
+	state := bc.state.Copy()
+	if !state.Account(address).IsContract() {
+		return nil, fmt.Errorf("%w: %s", ErrContractNotFound, address)
+	}
+	t := NewContractTransaction(CallTx, caller, address, input, bc.params.MaxTxGas, 0, 0, 0, nil, nil)
+	return state.run(t, len(bc.chain)), nil
+}
+
+// Receipt returns the receipt of the deploy or call transaction id in the
+// chain. Receipts are not kept, the block of the transaction runs again on
+// the state before it.
+func (bc *Blockchain) Receipt(id string) (*Receipt, error) {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+
+	for height, b := range bc.chain {
+		for _, t := range b.GetTransactions() {
+			if t.ID() != id {
+				continue
+			}
+			if t.kind != DeployTx && t.kind != CallTx {
+				return nil, fmt.Errorf("%w: %s is not a contract transaction", ErrTxNotFound, id)
+			}
+			state, err := bc.stateAt(bc.chain[:height])
+			if err != nil {
+				return nil, err
+			}
+			receipts, err := state.execute(b.GetTransactions(), nil)
+			if err != nil {
+				return nil, err
+			}
+			for _, r := range receipts {
+				if r.TxID == id {
+					return r, nil
+				}
+			}
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrTxNotFound, id)
+}
+
+// verifyContract checks that a deploy or call moves no value and pays for its
+// gas, which is at most MaxTxGas, and that a deploy is to the address derived
+// from its sender and nonce. Contracts only run on the account ledger.
+func (bc *Blockchain) verifyContract(t *Transaction) error {
+	if bc.params.UTXO() {
+		return fmt.Errorf("%w: contracts need the account ledger", ErrLedger)
+	}
+	if t.value != 0 || t.evidence != nil {
+		return fmt.Errorf("%w: a %s transaction moves no value", ErrLedger, t.kind)
+	}
+	if t.gas == 0 || t.gas > bc.params.MaxTxGas {
+		return fmt.Errorf("%w: %d gas, expected 1 to %d", ErrGasLimit, t.gas, bc.params.MaxTxGas)
+	}
+	if price := float32(t.gas) * bc.params.GasPrice; t.fee < price {
+		return fmt.Errorf("%w: fee %f does not pay for %d gas at %f", ErrGasLimit, t.fee, t.gas, bc.params.GasPrice)
+	}
+	if t.kind == DeployTx {
+		address, err := cryptography.GenerateContractAddress(t.sender, t.nonce, bc.params)
+		if err != nil {
+			return &InvalidAddressError{Address: t.sender, Err: err}
+		}
+		if address != t.recipient {
+			return fmt.Errorf("%w: deploy to %s, expected %s", ErrContractAddress, t.recipient, address)
+		}
+	}
+	return nil
+}
+
+// run executes the deploy or call t at height. A deploy pays GasCodeByte for
+// every byte of its code and runs it once with no input, the contract is only
+// created when that succeeds. On success the writes of the call become the
+// new storage of the contract.
+func (s *StateTree) run(t *Transaction, height int) *Receipt {
+	r := &Receipt{TxID: t.ID(), Kind: t.kind, Contract: t.recipient, Height: height}
+	contract := s.Account(t.recipient)
+	code, input, gas := s.code[contract.CodeHash], t.data, t.gas
+	switch {
+	case t.kind == DeployTx && contract.IsContract():
+		r.GasUsed, r.Error = t.gas, ErrContractExists.Error()
+		return r
+	case t.kind == CallTx && !contract.IsContract():
+		r.GasUsed, r.Error = t.gas, ErrContractNotFound.Error()
+		return r
+	case t.kind == DeployTx:
+		code, input = t.data, nil
+		cost := vm.GasCodeByte * uint64(len(code))
+		if cost > gas {
+			r.GasUsed, r.Error = t.gas, vm.ErrOutOfGas.Error()
+			return r
+		}
+		gas -= cost
+	}
+
+	storage := s.storages[contract.StorageRoot]
+	ctx := &vm.Context{Caller: t.sender, Contract: t.recipient, Height: height, Input: input}
+	res := vm.Execute(code, ctx, contractStorage(storage), gas)
+	r.GasUsed = t.gas - gas + res.GasUsed
+	r.Output = res.Output
+	if res.Err != nil {
+		r.Error = res.Err.Error()
+		return r
+	}
+	r.Success = true
+	for _, l := range res.Logs {
+		r.Logs = append(r.Logs, &ContractLog{Contract: t.recipient, Topics: l.Topics, Data: l.Data})
+	}
+
+	if t.kind == DeployTx {
+		contract.CodeHash = sha256.Sum256(code)
+		s.code[contract.CodeHash] = code
+	}
+	if len(res.Writes) > 0 {
+		next := make(map[vm.Word]vm.Word, len(storage)+len(res.Writes))
+		for k, v := range storage {
+			next[k] = v
+		}
+		for k, v := range res.Writes {
+			if v.IsZero() {
+				delete(next, k)
+				continue
+			}
+			next[k] = v
+		}
+		contract.StorageRoot = storageRoot(next)
+		if len(next) > 0 {
+			s.storages[contract.StorageRoot] = next
+		}
+	}
+	s.set(t.recipient, contract)
+	return r
+}
+
+type contractStorage map[vm.Word]vm.Word
+
+func (c contractStorage) Get(key vm.Word) vm.Word {
+	return c[key]
+}
+
+// storageRoot commits to a contract storage: zero when it is empty, the
+// sha256 of its slots in key order otherwise.
+func storageRoot(storage map[vm.Word]vm.Word) [32]byte {
+	if len(storage) == 0 {
+		return [32]byte{}
+	}
+	keys := make([]vm.Word, 0, len(storage))
+	for k := range storage {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i][:], keys[j][:]) < 0 })
+	h := sha256.New()
+	for _, k := range keys {
+		v := storage[k]
+		h.Write(k[:])
+		h.Write(v[:])
+	}
+	var root [32]byte
+	copy(root[:], h.Sum(nil))
+	return root
+}
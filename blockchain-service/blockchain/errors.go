@@ -0,0 +1,45 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrInvalidSignature  = errors.New("invalid transaction signature")
+	ErrNegativeFee       = errors.New("transaction fee must not be negative")
+	ErrInsufficientFunds = errors.New("insufficient spendable funds")
+	ErrCoinbase          = errors.New("coinbase transaction is only allowed first in a block")
+	ErrDoubleSpend       = errors.New("output is spent or does not exist")
+	ErrLedger            = errors.New("transaction does not match the ledger of the network")
+	ErrBlockNotFound     = errors.New("block not found")
+	ErrTxNotFound        = errors.New("transaction not found in the chain")
+	ErrTimeTooOld        = errors.New("block timestamp is not after the median time past")
+	ErrTimeTooNew        = errors.New("block timestamp is too far in the future")
+	ErrCheckpoint        = errors.New("block does not match the checkpoint at its height")
+	ErrReorgTooDeep      = errors.New("reorg disconnects more blocks than allowed")
+	ErrInvalidNonce      = errors.New("transaction nonce is not the next nonce of its sender")
+	ErrInvalidCoinbase   = errors.New("coinbase transaction does more than pay its recipient")
+)
+
+type InvalidAddressError struct {
+	Address string
+	Err     error
+}
+
+func (e *InvalidAddressError) Error() string {
+	return fmt.Sprintf("invalid blockchain address %q: %s", e.Address, e.Err)
+}
+
+func (e *InvalidAddressError) Unwrap() error {
+	return e.Err
+}
+
+type AddressMismatchError struct {
+	Sender  string
+	Derived string
+}
+
+func (e *AddressMismatchError) Error() string {
+	return fmt.Sprintf("sender %s does not match the address %s of the signing key", e.Sender, e.Derived)
+}
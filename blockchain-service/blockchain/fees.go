@@ -0,0 +1,133 @@
+package blockchain
+
+import (
+	"sort"
+)
+
+const DefaultFeeEstimateBlocks = 10
+
+// FeeEstimate summarizes the fee rates, in fee per byte, paid by the
+// transactions of the most recent blocks.
+type FeeEstimate struct {
+	Blocks       int     `json:"blocks"`
+	Transactions int     `json:"transactions"`
+	Low          float64 `json:"low"`
+	Median       float64 `json:"median"`
+	High         float64 `json:"high"`
+}
+
+func (bc *Blockchain) EstimateFee(blocks int) *FeeEstimate {
+	if blocks <= 0 {
+		blocks = DefaultFeeEstimateBlocks
+	}
+
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+
+	start := len(bc.chain) - blocks
+	if start < 1 {
+		start = 1
+	}
+	var rates []float64
+	for _, b := range bc.chain[start:] {
+		for _, t := range b.GetTransactions() {
+			if t.coinbase {
+				continue
+			}
+			rates = append(rates, t.FeeRate())
+		}
+	}
+
+	estimate := &FeeEstimate{
+		Blocks:       len(bc.chain) - start,
+		Transactions: len(rates),
+	}
+	if len(rates) == 0 {
+		return estimate
+	}
+	sort.Float64s(rates)
+	estimate.Low = rates[len(rates)/4]
+	estimate.Median = rates[len(rates)/2]
+	estimate.High = rates[len(rates)*3/4]
+	return estimate
+}
+
+// selectTransactions takes transactions from the top of the pool until the
+// block limits are reached and returns them with the fees they pay. A
+// transaction its sender can no longer pay for, unstake or move the asset or
+// nft of, or spending outputs that are gone, is left out, and so are the
+// later nonces of its sender.
+func (bc *Blockchain) selectTransactions() ([]*Transaction, float32) {
+	var trs []*Transaction
+	var fees float32
+	size := 0
+	available := make(map[string]float32)
+	spent := make(map[OutPoint]bool)
+	unstaked := make(map[string]float32)
+	slashed := make(map[string]bool)
+	assets := newAssetUse()
+	nfts := newNFTUse()
+	// take adds t to the block if it fits and passes on top of the
+	// transactions taken before it.
+	take := func(t *Transaction) bool {
+		s := t.Size()
+		if len(trs) >= bc.params.MaxBlockTransactions || size+s > bc.params.MaxBlockSize {
+			return false
+		}
+		if bc.utxos != nil {
+			if bc.checkInputs(t, bc.utxos, len(bc.chain), spent) != nil {
+				return false
+			}
+		} else {
+			if _, ok := available[t.sender]; !ok {
+				available[t.sender] = bc.spendableBalance(bc.chain, bc.state, t.sender)
+			}
+			if t.cost() > available[t.sender] {
+				return false
+			}
+			if bc.checkStake(t, bc.chain, bc.state, unstaked, slashed) != nil {
+				return false
+			}
+			if bc.checkAsset(t, bc.state, assets) != nil {
+				return false
+			}
+			if bc.checkNFT(t, bc.state, nfts) != nil {
+				return false
+			}
+			available[t.sender] -= t.cost()
+		}
+		trs = append(trs, t.copy())
+		fees += t.fee
+		size += s
+		return true
+	}
+
+	// On the account ledger the transactions of a sender go in nonce order,
+	// one paying more than the nonce before it waits for that one.
+	next := make(map[string]uint64)
+	waiting := make(map[string]map[uint64]*Transaction)
+	for _, t := range bc.pendingTransactions() {
+		if len(trs) >= bc.params.MaxBlockTransactions {
+			break
+		}
+		if bc.utxos != nil {
+			take(t)
+			continue
+		}
+		if _, ok := next[t.sender]; !ok {
+			next[t.sender] = bc.state.Account(t.sender).Nonce + 1
+		}
+		if t.nonce > next[t.sender] {
+			if waiting[t.sender] == nil {
+				waiting[t.sender] = make(map[uint64]*Transaction)
+			}
+			waiting[t.sender][t.nonce] = t
+			continue
+		}
+		for t != nil && t.nonce == next[t.sender] && take(t) {
+			next[t.sender]++
+			t = waiting[t.sender][next[t.sender]]
+		}
+	}
+	return trs, fees
+}
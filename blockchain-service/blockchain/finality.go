@@ -0,0 +1,718 @@
+package blockchain
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"blockchain/blockchain-service/network-params"
+	"blockchain/foundation/cryptography"
+)
+
+// DefaultRoundTimeout is how long a finality round waits for a commit before
+// the validators move to the next round.
+const DefaultRoundTimeout = 20 * time.Second
+
+// maxVoteLookahead bounds how many heights and rounds ahead of the node a vote
+// is kept for.
+const maxVoteLookahead = 16
+
+var (
+	ErrFinalized            = errors.New("change conflicts with a finalized block")
+	ErrNoFinality           = errors.New("chain has no finality validators")
+	ErrNotFinalityValidator = errors.New("not a finality validator")
+	ErrInvalidVote          = errors.New("invalid finality vote")
+	ErrKnownVote            = errors.New("vote is already known")
+	ErrConflictingVote      = errors.New("validator already voted for another block")
+	ErrInvalidCommit        = errors.New("invalid finality commit")
+)
+
+// VoteType is the step of a finality round a vote is cast in.
+type VoteType string
+
+const (
+	Prevote   VoteType = "prevote"
+	Precommit VoteType = "precommit"
+)
+
+// FinalityVote is the vote of a finality validator for the block BlockHash at
+// Height in Round. The validator is the address of PublicKey.
+type FinalityVote struct {
+	Type      VoteType
+	Height    int
+	Round     int
+	BlockHash [32]byte
+	PublicKey string
+	Signature string
+}
+
+type finalityVoteJSON struct {
+	Type      VoteType `json:"type"`
+	Height    int      `json:"height"`
+	Round     int      `json:"round"`
+	BlockHash string   `json:"block_hash"`
+	PublicKey string   `json:"public_key"`
+	Signature string   `json:"signature"`
+}
+
+func (v *FinalityVote) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&finalityVoteJSON{
+		Type:      v.Type,
+		Height:    v.Height,
+		Round:     v.Round,
+		BlockHash: fmt.Sprintf("%x", v.BlockHash),
+		PublicKey: v.PublicKey,
+		Signature: v.Signature,
+	})
+}
+
+func (v *FinalityVote) UnmarshalJSON(data []byte) error {
+	var j finalityVoteJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	hash, err := decodeHash(j.BlockHash)
+	if err != nil {
+		return err
+	}
+	*v = FinalityVote{
+		Type:      j.Type,
+		Height:    j.Height,
+		Round:     j.Round,
+		BlockHash: hash,
+		PublicKey: j.PublicKey,
+		Signature: j.Signature,
+	}
+	return nil
+}
+
+// signedHash is what the validator signs. It includes the chain ID so a vote
+// can not be replayed on another chain.
+func (v *FinalityVote) signedHash(params *network_params.Params) [32]byte {
+	b, _ := json.Marshal(&struct {
+		ChainID   string   `json:"chain_id"`
+		Type      VoteType `json:"type"`
+		Height    int      `json:"height"`
+		Round     int      `json:"round"`
+		BlockHash string   `json:"block_hash"`
+	}{params.ChainID, v.Type, v.Height, v.Round, fmt.Sprintf("%x", v.BlockHash)})
+	return sha256.Sum256(b)
+}
+
+// verify checks the signature of v and returns the address of the validator.
+func (v *FinalityVote) verify(params *network_params.Params) (string, error) {
+	if v.Type != Prevote && v.Type != Precommit {
+		return "", fmt.Errorf("%w: unknown type %q", ErrInvalidVote, v.Type)
+	}
+	if v.Height <= 0 || v.Round < 0 {
+		return "", fmt.Errorf("%w: height %d round %d", ErrInvalidVote, v.Height, v.Round)
+	}
+	pk, err := cryptography.PublicKeyFromString(v.PublicKey)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrInvalidVote, err)
+	}
+	sig, err := cryptography.ParseSignature(v.Signature, pk.KeyType())
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrInvalidVote, err)
+	}
+	hash := v.signedHash(params)
+	if !pk.Verify(hash[:], sig) {
+		return "", fmt.Errorf("%w: bad signature", ErrInvalidVote)
+	}
+	return cryptography.GenerateBlockchainAddress(pk, params), nil
+}
+
+func signVote(key cryptography.PrivateKey, params *network_params.Params, t VoteType, height, round int, hash [32]byte) (*FinalityVote, error) {
+	v := &FinalityVote{
+		Type:      t,
+		Height:    height,
+		Round:     round,
+		BlockHash: hash,
+		PublicKey: cryptography.GeneratePublicKeyString(key.PublicKey()),
+	}
+	signed := v.signedHash(params)
+	sig, err := key.Sign(signed[:])
+	if err != nil {
+		return nil, err
+	}
+	v.Signature = sig.String()
+	return v, nil
+}
+
+// Commit proves the block BlockHash at Height final with the precommits of
+// more than two thirds of the finality validators in one round.
+type Commit struct {
+	Height     int
+	Round      int
+	BlockHash  [32]byte
+	Precommits []*FinalityVote
+}
+
+type commitJSON struct {
+	Height     int             `json:"height"`
+	Round      int             `json:"round"`
+	BlockHash  string          `json:"block_hash"`
+	Precommits []*FinalityVote `json:"precommits"`
+}
+
+func (c *Commit) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&commitJSON{
+		Height:     c.Height,
+		Round:      c.Round,
+		BlockHash:  fmt.Sprintf("%x", c.BlockHash),
+		Precommits: c.Precommits,
+	})
+}
+
+func (c *Commit) UnmarshalJSON(data []byte) error {
+	var j commitJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	hash, err := decodeHash(j.BlockHash)
+	if err != nil {
+		return err
+	}
+	*c = Commit{Height: j.Height, Round: j.Round, BlockHash: hash, Precommits: j.Precommits}
+	return nil
+}
+
+type voteKey struct {
+	height int
+	round  int
+	kind   VoteType
+}
+
+// finality is the state of the finality gadget of a node. The validators
+// decide the heights one after the other in rounds as in Tendermint: each
+// prevotes the block it has at the height, precommits a block once more than
+// two thirds prevoted it in the round and locks on it, and the block is final
+// once more than two thirds precommitted it. A locked validator prevotes its
+// locked block in the later rounds of the height, so two blocks of one height
+// can never both be committed.
+type finality struct {
+	validators map[string]bool
+	quorum     int
+	key        cryptography.PrivateKey
+	timeout    time.Duration
+
+	// final is the height of the last final block, commit what made it
+	// final. The genesis block is final without a commit.
+	final     int
+	finalHash [32]byte
+	commit    *Commit
+	// pending is a commit for a block the node does not have yet.
+	pending *Commit
+
+	// height is the height voted on and round its current round.
+	height      int
+	round       int
+	roundStart  time.Time
+	locked      [32]byte
+	lockedRound int
+	votes       map[voteKey]map[string]*FinalityVote
+}
+
+func newFinality(params *network_params.Params, genesis [32]byte) (*finality, error) {
+	f := &finality{
+		validators:  make(map[string]bool),
+		timeout:     DefaultRoundTimeout,
+		finalHash:   genesis,
+		height:      1,
+		lockedRound: -1,
+		votes:       make(map[voteKey]map[string]*FinalityVote),
+	}
+	for _, address := range params.FinalityValidators {
+		if err := cryptography.ValidateBlockchainAddress(address, params); err != nil {
+			return nil, &InvalidAddressError{Address: address, Err: err}
+		}
+		f.validators[address] = true
+	}
+	f.quorum = len(f.validators)*2/3 + 1
+	return f, nil
+}
+
+func (f *finality) add(validator string, v *FinalityVote) error {
+	k := voteKey{v.Height, v.Round, v.Type}
+	votes := f.votes[k]
+	if votes == nil {
+		votes = make(map[string]*FinalityVote)
+		f.votes[k] = votes
+	}
+	if prev, ok := votes[validator]; ok {
+		if prev.BlockHash == v.BlockHash {
+			return ErrKnownVote
+		}
+		return fmt.Errorf("%w: %s in round %d of height %d", ErrConflictingVote, validator, v.Round, v.Height)
+	}
+	votes[validator] = v
+	return nil
+}
+
+// majority returns the block more than two thirds of the validators voted
+// for under k.
+func (f *finality) majority(k voteKey) ([32]byte, bool) {
+	counts := make(map[[32]byte]int)
+	for _, v := range f.votes[k] {
+		counts[v.BlockHash]++
+		if counts[v.BlockHash] >= f.quorum {
+			return v.BlockHash, true
+		}
+	}
+	return [32]byte{}, false
+}
+
+// rounds returns the rounds of the current height that have votes, in order.
+func (f *finality) rounds() []int {
+	seen := make(map[int]bool)
+	for k := range f.votes {
+		if k.height == f.height {
+			seen[k.round] = true
+		}
+	}
+	rounds := make([]int, 0, len(seen))
+	for r := range seen {
+		rounds = append(rounds, r)
+	}
+	sort.Ints(rounds)
+	return rounds
+}
+
+// decided returns the commit of the current height, if a round has one.
+func (f *finality) decided() *Commit {
+	for _, r := range f.rounds() {
+		k := voteKey{f.height, r, Precommit}
+		hash, ok := f.majority(k)
+		if !ok {
+			continue
+		}
+		c := &Commit{Height: f.height, Round: r, BlockHash: hash}
+		for _, v := range f.votes[k] {
+			if v.BlockHash == hash {
+				c.Precommits = append(c.Precommits, v)
+			}
+		}
+		sort.Slice(c.Precommits, func(i, j int) bool {
+			return c.Precommits[i].PublicKey < c.Precommits[j].PublicKey
+		})
+		return c
+	}
+	return nil
+}
+
+// catchUp moves to the latest round in which more than a third of the
+// validators voted, so a node that fell behind does not hold the others
+// back, and moves the lock to the latest block that had more than two thirds
+// of the prevotes of a round.
+func (f *finality) catchUp(now time.Time) {
+	for _, r := range f.rounds() {
+		if r > f.round {
+			voters := make(map[string]bool)
+			for _, t := range []VoteType{Prevote, Precommit} {
+				for validator := range f.votes[voteKey{f.height, r, t}] {
+					voters[validator] = true
+				}
+			}
+			if 3*len(voters) > len(f.validators) {
+				f.round, f.roundStart = r, now
+			}
+		}
+		if r > f.lockedRound && r <= f.round {
+			if hash, ok := f.majority(voteKey{f.height, r, Prevote}); ok {
+				f.locked, f.lockedRound = hash, r
+			}
+		}
+	}
+}
+
+// verifyCommit checks that c has the precommits of more than two thirds of
+// the validators.
+func (f *finality) verifyCommit(c *Commit, params *network_params.Params) error {
+	signers := make(map[string]bool)
+	for _, v := range c.Precommits {
+		if v.Type != Precommit || v.Height != c.Height || v.Round != c.Round || v.BlockHash != c.BlockHash {
+			return fmt.Errorf("%w: vote for another block", ErrInvalidCommit)
+		}
+		validator, err := v.verify(params)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidCommit, err)
+		}
+		if !f.validators[validator] {
+			return fmt.Errorf("%w: %s is not a validator", ErrInvalidCommit, validator)
+		}
+		signers[validator] = true
+	}
+	if len(signers) < f.quorum {
+		return fmt.Errorf("%w: %d precommits, %d needed", ErrInvalidCommit, len(signers), f.quorum)
+	}
+	return nil
+}
+
+// FinalityStatus is the state of the finality gadget of the node.
+type FinalityStatus struct {
+	// Height and Hash are those of the last final block.
+	Height int    `json:"height"`
+	Hash   string `json:"hash"`
+	// VotingHeight and Round are where the validators vote.
+	VotingHeight int      `json:"voting_height"`
+	Round        int      `json:"round"`
+	Validators   []string `json:"validators"`
+	Commit       *Commit  `json:"commit,omitempty"`
+}
+
+// BlockStatus is a block with its place in the tree. Final blocks are never
+// disconnected from the chain.
+type BlockStatus struct {
+	Block     *Block
+	Height    int
+	MainChain bool
+	Final     bool
+}
+
+// MarshalJSON adds the status to the fields of the block, so clients that
+// only know blocks can still read it.
+func (s *BlockStatus) MarshalJSON() ([]byte, error) {
+	b, err := json.Marshal(s.Block)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	fields["height"], _ = json.Marshal(s.Height)
+	fields["main_chain"], _ = json.Marshal(s.MainChain)
+	fields["final"], _ = json.Marshal(s.Final)
+	return json.Marshal(fields)
+}
+
+// SetFinalityKey makes the node vote with key, the key of one of the
+// finality validators.
+func (bc *Blockchain) SetFinalityKey(key cryptography.PrivateKey) error {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	f := bc.finality
+	if f == nil {
+		return ErrNoFinality
+	}
+	if address := cryptography.GenerateBlockchainAddress(key.PublicKey(), bc.params); !f.validators[address] {
+		return fmt.Errorf("%w: %s", ErrNotFinalityValidator, address)
+	}
+	f.key = key
+	return nil
+}
+
+// SetRoundTimeout sets how long a finality round lasts without a commit.
+func (bc *Blockchain) SetRoundTimeout(d time.Duration) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	if bc.finality != nil {
+		bc.finality.timeout = d
+	}
+}
+
+// Finalized returns the height and hash of the last final block. Without
+// finality validators only the genesis block is final.
+func (bc *Blockchain) Finalized() (int, [32]byte) {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	if bc.finality == nil {
+		return 0, bc.chain[0].Header().Hash()
+	}
+	return bc.finality.final, bc.finality.finalHash
+}
+
+func (bc *Blockchain) finalHeight() int {
+	if bc.finality == nil {
+		return 0
+	}
+	return bc.finality.final
+}
+
+// FinalityStatus returns the state of the finality gadget.
+func (bc *Blockchain) FinalityStatus() (*FinalityStatus, error) {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	f := bc.finality
+	if f == nil {
+		return nil, ErrNoFinality
+	}
+	validators := make([]string, 0, len(f.validators))
+	for address := range f.validators {
+		validators = append(validators, address)
+	}
+	sort.Strings(validators)
+	return &FinalityStatus{
+		Height:       f.final,
+		Hash:         fmt.Sprintf("%x", f.finalHash),
+		VotingHeight: f.height,
+		Round:        f.round,
+		Validators:   validators,
+		Commit:       f.commit,
+	}, nil
+}
+
+// BlockStatus returns the block with the given hash with its height and
+// whether it is on the chain and final.
+func (bc *Blockchain) BlockStatus(hash [32]byte) (*BlockStatus, bool) {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	n, ok := bc.tree[hash]
+	if !ok {
+		return nil, false
+	}
+	main := n.height < len(bc.chain) && bc.chain[n.height].Header().Hash() == hash
+	return &BlockStatus{
+		Block:     n.block,
+		Height:    n.height,
+		MainChain: main,
+		Final:     main && n.height <= bc.finalHeight(),
+	}, true
+}
+
+// AddFinalityVote takes the vote of a validator from a peer. ErrKnownVote
+// tells the vote was seen before.
+func (bc *Blockchain) AddFinalityVote(v *FinalityVote) error {
+	bc.mux.Lock()
+	f := bc.finality
+	if f == nil {
+		bc.mux.Unlock()
+		return ErrNoFinality
+	}
+	validator, err := v.verify(bc.params)
+	if err != nil {
+		bc.mux.Unlock()
+		return err
+	}
+	if !f.validators[validator] {
+		bc.mux.Unlock()
+		return fmt.Errorf("%w: %s", ErrNotFinalityValidator, validator)
+	}
+	if v.Height < f.height {
+		bc.mux.Unlock()
+		return ErrKnownVote
+	}
+	if v.Height > f.height+maxVoteLookahead || v.Round > f.round+maxVoteLookahead {
+		bc.mux.Unlock()
+		return fmt.Errorf("%w: height %d round %d is too far ahead", ErrInvalidVote, v.Height, v.Round)
+	}
+	if err := f.add(validator, v); err != nil {
+		bc.mux.Unlock()
+		return err
+	}
+	events := bc.advanceFinality()
+	listeners := bc.reorgListeners
+	bc.mux.Unlock()
+
+	for _, e := range events {
+		emitReorg(e, listeners)
+	}
+	return nil
+}
+
+// FinalityStep moves to the next round when the current one timed out, casts
+// the votes of the node that are due and finalizes the blocks that have a
+// commit. It returns the votes cast, for the peers.
+func (bc *Blockchain) FinalityStep() ([]*FinalityVote, error) {
+	bc.mux.Lock()
+	f := bc.finality
+	if f == nil {
+		bc.mux.Unlock()
+		return nil, ErrNoFinality
+	}
+	now := bc.clock()
+	if f.roundStart.IsZero() {
+		f.roundStart = now
+	}
+	if now.Sub(f.roundStart) >= f.timeout {
+		f.round++
+		f.roundStart = now
+	}
+	events := bc.advanceFinality()
+	votes, err := bc.castVotes()
+	if err == nil {
+		events = append(events, bc.advanceFinality()...)
+	}
+	listeners := bc.reorgListeners
+	bc.mux.Unlock()
+
+	for _, e := range events {
+		emitReorg(e, listeners)
+	}
+	return votes, err
+}
+
+// castVotes signs the prevote and the precommit of the node for the current
+// round once they are due.
+func (bc *Blockchain) castVotes() ([]*FinalityVote, error) {
+	f := bc.finality
+	if f.key == nil {
+		return nil, nil
+	}
+	me := cryptography.GenerateBlockchainAddress(f.key.PublicKey(), bc.params)
+	var votes []*FinalityVote
+	cast := func(t VoteType, hash [32]byte) error {
+		v, err := signVote(f.key, bc.params, t, f.height, f.round, hash)
+		if err != nil {
+			return err
+		}
+		if err := f.add(me, v); err != nil {
+			return err
+		}
+		votes = append(votes, v)
+		return nil
+	}
+
+	prevote := voteKey{f.height, f.round, Prevote}
+	if _, ok := f.votes[prevote][me]; !ok {
+		hash, ok := f.locked, f.lockedRound >= 0
+		if !ok && f.height < len(bc.chain) {
+			hash, ok = bc.chain[f.height].Header().Hash(), true
+		}
+		if ok {
+			if err := cast(Prevote, hash); err != nil {
+				return nil, err
+			}
+		}
+	}
+	precommit := voteKey{f.height, f.round, Precommit}
+	if _, ok := f.votes[precommit][me]; !ok {
+		if hash, ok := f.majority(prevote); ok {
+			f.locked, f.lockedRound = hash, f.round
+			if err := cast(Precommit, hash); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return votes, nil
+}
+
+// ApplyCommit finalizes the block of a commit received from a peer. The
+// commit is kept until the block arrives when the node does not have it, and
+// an error wrapping ErrBlockNotFound tells to fetch it.
+func (bc *Blockchain) ApplyCommit(c *Commit) error {
+	bc.mux.Lock()
+	f := bc.finality
+	if f == nil {
+		bc.mux.Unlock()
+		return ErrNoFinality
+	}
+	if c.Height <= f.final {
+		var err error
+		if c.Height >= len(bc.chain) || bc.chain[c.Height].Header().Hash() != c.BlockHash {
+			err = fmt.Errorf("%w: commit for another block at height %d", ErrFinalized, c.Height)
+		}
+		bc.mux.Unlock()
+		return err
+	}
+	if err := f.verifyCommit(c, bc.params); err != nil {
+		bc.mux.Unlock()
+		return err
+	}
+	if f.pending == nil || c.Height > f.pending.Height {
+		f.pending = c
+	}
+	events := bc.advanceFinality()
+	var err error
+	if f.pending != nil {
+		if _, ok := bc.tree[f.pending.BlockHash]; !ok {
+			err = fmt.Errorf("%w: %x final at height %d", ErrBlockNotFound, f.pending.BlockHash, f.pending.Height)
+		}
+	}
+	listeners := bc.reorgListeners
+	bc.mux.Unlock()
+
+	for _, e := range events {
+		emitReorg(e, listeners)
+	}
+	return err
+}
+
+// advanceFinality finalizes the pending commit and the commits the votes
+// make, then follows the rounds and locks of the other validators.
+func (bc *Blockchain) advanceFinality() []*ReorgEvent {
+	f := bc.finality
+	var events []*ReorgEvent
+	for {
+		if f.pending == nil {
+			f.pending = f.decided()
+		}
+		if f.pending == nil {
+			break
+		}
+		e, err := bc.finalize(f.pending)
+		if err != nil {
+			if !errors.Is(err, ErrBlockNotFound) {
+				log.Printf("failed to finalize block %d with err: %s", f.pending.Height, err)
+			}
+			break
+		}
+		if e != nil {
+			events = append(events, e)
+		}
+	}
+	f.catchUp(bc.clock())
+	return events
+}
+
+// finalize makes the block of c final, switching the chain to the branch of
+// the block with the most work when the chain does not have it.
+func (bc *Blockchain) finalize(c *Commit) (*ReorgEvent, error) {
+	f := bc.finality
+	n, ok := bc.tree[c.BlockHash]
+	if !ok {
+		return nil, ErrBlockNotFound
+	}
+	if n.height != c.Height {
+		f.pending = nil
+		return nil, fmt.Errorf("%w: block %x is at height %d, not %d", ErrInvalidCommit, c.BlockHash, n.height, c.Height)
+	}
+	var e *ReorgEvent
+	if n.height >= len(bc.chain) || bc.chain[n.height].Header().Hash() != c.BlockHash {
+		var err error
+		if e, err = bc.reorg(bc.bestDescendant(n).branch()); err != nil {
+			return nil, err
+		}
+	}
+
+	f.final, f.finalHash, f.commit, f.pending = c.Height, c.BlockHash, c, nil
+	f.height, f.round, f.roundStart = c.Height+1, 0, bc.clock()
+	f.locked, f.lockedRound = [32]byte{}, -1
+	for k := range f.votes {
+		if k.height <= c.Height {
+			delete(f.votes, k)
+		}
+	}
+	return e, nil
+}
+
+// bestDescendant returns the block with the most work on a branch through n.
+func (bc *Blockchain) bestDescendant(n *blockNode) *blockNode {
+	best := n
+	for _, m := range bc.tree {
+		if m.work.Cmp(best.work) > 0 && m.ancestor(n.height) == n {
+			best = m
+		}
+	}
+	return best
+}
+
+// checkFinal refuses a block on top of parent when the branch does not go
+// through the last final block.
+func (bc *Blockchain) checkFinal(parent *blockNode) error {
+	f := bc.finality
+	if f == nil {
+		return nil
+	}
+	if parent.height < f.final {
+		return fmt.Errorf("%w: block %d forks below final block %d", ErrFinalized, parent.height+1, f.final)
+	}
+	if a := parent.ancestor(f.final); a == nil || a.hash != f.finalHash {
+		return fmt.Errorf("%w: branch does not include final block %d", ErrFinalized, f.final)
+	}
+	return nil
+}
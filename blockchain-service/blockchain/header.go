@@ -0,0 +1,118 @@
+package blockchain
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// BlockHeader is what the consensus seal and the block hash cover. The
+// transactions are committed to by MerkleRoot, so the headers alone are
+// enough to follow the chain. Extra and Seal belong to the consensus engine,
+// they are empty under proof of work.
+type BlockHeader struct {
+	Timestamp    int64
+	Nonce        int
+	PreviousHash [32]byte
+	StateRoot    [32]byte
+	MerkleRoot   [32]byte
+	Extra        []byte
+	Seal         []byte
+}
+
+func (h *BlockHeader) Hash() [32]byte {
+	hash := h.SealHash()
+	if len(h.Seal) == 0 {
+		return hash
+	}
+	return sha256.Sum256(append(hash[:], h.Seal...))
+}
+
+// SealHash is the hash of everything but the seal, it is what the seal signs.
+func (h *BlockHeader) SealHash() [32]byte {
+	b := make([]byte, 8+8+32*3, 8+8+32*3+len(h.Extra))
+	binary.BigEndian.PutUint64(b[0:8], uint64(h.Timestamp))
+	binary.BigEndian.PutUint64(b[8:16], uint64(h.Nonce))
+	copy(b[16:48], h.PreviousHash[:])
+	copy(b[48:80], h.StateRoot[:])
+	copy(b[80:], h.MerkleRoot[:])
+	return sha256.Sum256(append(b, h.Extra...))
+}
+
+// Meets reports whether the header hash has difficulty leading zero hex
+// digits.
+func (h *BlockHeader) Meets(difficulty int) bool {
+	hash := h.Hash()
+	return strings.HasPrefix(fmt.Sprintf("%x", hash), strings.Repeat("0", difficulty))
+}
+
+func (h *BlockHeader) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Timestamp    int64  `json:"timestamp"`
+		Nonce        int    `json:"nonce"`
+		PreviousHash string `json:"previous_hash"`
+		StateRoot    string `json:"state_root"`
+		MerkleRoot   string `json:"merkle_root"`
+		Extra        string `json:"extra,omitempty"`
+		Seal         string `json:"seal,omitempty"`
+	}{
+		Timestamp:    h.Timestamp,
+		Nonce:        h.Nonce,
+		PreviousHash: fmt.Sprintf("%x", h.PreviousHash),
+		StateRoot:    fmt.Sprintf("%x", h.StateRoot),
+		MerkleRoot:   fmt.Sprintf("%x", h.MerkleRoot),
+		Extra:        hex.EncodeToString(h.Extra),
+		Seal:         hex.EncodeToString(h.Seal),
+	})
+}
+
+func (h *BlockHeader) UnmarshalJSON(b []byte) error {
+	var previousHash, stateRoot, merkleRoot, extra, seal string
+	s := struct {
+		Timestamp    *int64  `json:"timestamp"`
+		Nonce        *int    `json:"nonce"`
+		PreviousHash *string `json:"previous_hash"`
+		StateRoot    *string `json:"state_root"`
+		MerkleRoot   *string `json:"merkle_root"`
+		Extra        *string `json:"extra"`
+		Seal         *string `json:"seal"`
+	}{
+		Timestamp:    &h.Timestamp,
+		Nonce:        &h.Nonce,
+		PreviousHash: &previousHash,
+		StateRoot:    &stateRoot,
+		MerkleRoot:   &merkleRoot,
+		Extra:        &extra,
+		Seal:         &seal,
+	}
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+
+	var err error
+	if h.PreviousHash, err = decodeHash(previousHash); err != nil {
+		return err
+	}
+	if h.StateRoot, err = decodeHash(stateRoot); err != nil {
+		return err
+	}
+	if h.MerkleRoot, err = decodeHash(merkleRoot); err != nil {
+		return err
+	}
+	if h.Extra, err = decodeBytes(extra); err != nil {
+		return err
+	}
+	h.Seal, err = decodeBytes(seal)
+	return err
+}
+
+// decodeBytes decodes hex, leaving empty bytes nil.
+func decodeBytes(s string) ([]byte, error) {
+	if s == "" {
+		return nil, nil
+	}
+	return hex.DecodeString(s)
+}
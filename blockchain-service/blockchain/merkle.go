@@ -0,0 +1,159 @@
+package blockchain
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+)
+
+// MerkleRoot commits to the transactions of a block. Leaves and inner nodes
+// are hashed with different prefixes and a node without a sibling moves up a
+// level unchanged, so no two transaction lists share a root.
+func MerkleRoot(trs []*Transaction) [32]byte {
+	level := merkleLeaves(trs)
+	if len(level) == 0 {
+		return [32]byte{}
+	}
+	for len(level) > 1 {
+		level = merkleLevel(level)
+	}
+	return level[0]
+}
+
+// MerkleProof shows that the transaction TxID is at Index of the block at
+// Height, which holds Transactions transactions.
+type MerkleProof struct {
+	TxID         string
+	BlockHash    [32]byte
+	Height       int
+	Index        int
+	Transactions int
+	// Siblings are the hashes met on the way from the leaf to the root.
+	Siblings [][32]byte
+}
+
+func proveInclusion(trs []*Transaction, index int) [][32]byte {
+	var siblings [][32]byte
+	level := merkleLeaves(trs)
+	for len(level) > 1 {
+		if sibling := index ^ 1; sibling < len(level) {
+			siblings = append(siblings, level[sibling])
+		}
+		level = merkleLevel(level)
+		index /= 2
+	}
+	return siblings
+}
+
+// Verify reports whether the proof links TxID to merkleRoot.
+func (p *MerkleProof) Verify(merkleRoot [32]byte) bool {
+	if p.Index < 0 || p.Index >= p.Transactions {
+		return false
+	}
+	id, err := decodeHash(p.TxID)
+	if err != nil {
+		return false
+	}
+
+	h := hashMerkleLeaf(id)
+	index, n, next := p.Index, p.Transactions, 0
+	for ; n > 1; n = (n + 1) / 2 {
+		if index^1 < n {
+			if next == len(p.Siblings) {
+				return false
+			}
+			if index%2 == 0 {
+				h = hashNode(h, p.Siblings[next])
+			} else {
+				h = hashNode(p.Siblings[next], h)
+			}
+			next++
+		}
+		index /= 2
+	}
+	return next == len(p.Siblings) && h == merkleRoot
+}
+
+func (p *MerkleProof) MarshalJSON() ([]byte, error) {
+	siblings := make([]string, len(p.Siblings))
+	for i, s := range p.Siblings {
+		siblings[i] = fmt.Sprintf("%x", s)
+	}
+	return json.Marshal(struct {
+		TxID         string   `json:"txid"`
+		BlockHash    string   `json:"block_hash"`
+		Height       int      `json:"height"`
+		Index        int      `json:"index"`
+		Transactions int      `json:"transactions"`
+		Siblings     []string `json:"siblings"`
+	}{
+		TxID:         p.TxID,
+		BlockHash:    fmt.Sprintf("%x", p.BlockHash),
+		Height:       p.Height,
+		Index:        p.Index,
+		Transactions: p.Transactions,
+		Siblings:     siblings,
+	})
+}
+
+func (p *MerkleProof) UnmarshalJSON(b []byte) error {
+	var blockHash string
+	var siblings []string
+	s := struct {
+		TxID         *string   `json:"txid"`
+		BlockHash    *string   `json:"block_hash"`
+		Height       *int      `json:"height"`
+		Index        *int      `json:"index"`
+		Transactions *int      `json:"transactions"`
+		Siblings     *[]string `json:"siblings"`
+	}{
+		TxID:         &p.TxID,
+		BlockHash:    &blockHash,
+		Height:       &p.Height,
+		Index:        &p.Index,
+		Transactions: &p.Transactions,
+		Siblings:     &siblings,
+	}
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+
+	var err error
+	if p.BlockHash, err = decodeHash(blockHash); err != nil {
+		return err
+	}
+	p.Siblings = make([][32]byte, len(siblings))
+	for i, sibling := range siblings {
+		if p.Siblings[i], err = decodeHash(sibling); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func merkleLeaves(trs []*Transaction) [][32]byte {
+	leaves := make([][32]byte, len(trs))
+	for i, t := range trs {
+		id, _ := decodeHash(t.ID())
+		leaves[i] = hashMerkleLeaf(id)
+	}
+	return leaves
+}
+
+func merkleLevel(level [][32]byte) [][32]byte {
+	next := make([][32]byte, 0, (len(level)+1)/2)
+	for i := 0; i < len(level); i += 2 {
+		if i+1 == len(level) {
+			next = append(next, level[i])
+			continue
+		}
+		next = append(next, hashNode(level[i], level[i+1]))
+	}
+	return next
+}
+
+func hashMerkleLeaf(id [32]byte) [32]byte {
+	var b [1 + 32]byte
+	copy(b[1:], id[:])
+	return sha256.Sum256(b[:])
+}
@@ -0,0 +1,90 @@
+package blockchain
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrMiningAborted = errors.New("mining aborted")
+
+type MiningResult struct {
+	Nonce    int
+	Hashes   uint64
+	Duration time.Duration
+}
+
+func (r *MiningResult) HashRate() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Hashes) / r.Duration.Seconds()
+}
+
+// MiningEngine searches the nonce space with several workers. Worker i tries
+// the nonces i, i+n, i+2n... so no two workers hash the same candidate.
+type MiningEngine struct {
+	workers int
+}
+
+func NewMiningEngine(workers int) *MiningEngine {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	return &MiningEngine{
+		workers: workers,
+	}
+}
+
+func (e *MiningEngine) Workers() int {
+	return e.workers
+}
+
+// Solve searches for a nonce with which header meets difficulty. Everything
+// else in header, the timestamp included, is hashed as it is.
+func (e *MiningEngine) Solve(ctx context.Context, header BlockHeader, difficulty int) (*MiningResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	start := time.Now()
+	var hashes uint64
+	var once sync.Once
+	var found *MiningResult
+
+	var wg sync.WaitGroup
+	for w := 0; w < e.workers; w++ {
+		wg.Add(1)
+		go func(nonce int) {
+			defer wg.Done()
+			h := header
+			for ; ; nonce += e.workers {
+				select {
+				case <-ctx.Done():
+					return
+				default:
+				}
+
+				h.Nonce = nonce
+				atomic.AddUint64(&hashes, 1)
+				if h.Meets(difficulty) {
+					once.Do(func() {
+						found = &MiningResult{Nonce: nonce}
+						cancel()
+					})
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	if found == nil {
+		return nil, ErrMiningAborted
+	}
+	found.Hashes = atomic.LoadUint64(&hashes)
+	found.Duration = time.Since(start)
+	return found, nil
+}
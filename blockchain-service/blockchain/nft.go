@@ -0,0 +1,257 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"blockchain/foundation/cryptography"
+)
+
+// MaxNFTMetadata is the longest metadata URI of a token, in bytes.
+const MaxNFTMetadata = 256
+
+var (
+	ErrNFTNotFound       = errors.New("nft not found")
+	ErrNFTExists         = errors.New("nft already exists")
+	ErrInvalidNFT        = errors.New("invalid nft transaction")
+	ErrNFTOwner          = errors.New("sender does not own the nft")
+	ErrCollectionCreator = errors.New("sender is not the creator of the collection")
+)
+
+// NFT is a token of a collection. Metadata is a URI or the hex sha256 of the
+// content the token stands for, it does not change once minted. A burned
+// token has no owner and its ID is not minted again.
+type NFT struct {
+	Collection string `json:"collection"`
+	ID         string `json:"token_id"`
+	Owner      string `json:"owner,omitempty"`
+	Metadata   string `json:"metadata"`
+	Burned     bool   `json:"burned,omitempty"`
+}
+
+// Collection is a set of tokens, only its creator mints in it.
+type Collection struct {
+	ID      string `json:"id"`
+	Creator string `json:"creator"`
+}
+
+// collectionKey is the state key of the collection record and nftKey that of
+// a token. Neither an address nor an asset ID contains a slash.
+func collectionKey(collection string) string {
+	return "nft/" + collection
+}
+
+func nftKey(collection, token string) string {
+	return collectionKey(collection) + "/" + token
+}
+
+// AddNFTTransaction mints the token of collection to recipient with metadata,
+// transfers it from sender to recipient or burns it, depending on kind.
+func (bc *Blockchain) AddNFTTransaction(kind TxKind, sender, recipient, collection, token, metadata string, fee float32, nonce uint64, pKey cryptography.PublicKey, s *cryptography.Signature) error {
+	switch kind {
+	case NFTMintTx, NFTTransferTx, NFTBurnTx:
+	default:
+		return fmt.Errorf("%w: %q is not an nft transaction", ErrInvalidNFT, kind)
+	}
+	return bc.addTransaction(NewNFTTransaction(kind, sender, recipient, collection, token, metadata, fee, nonce, 0, []cryptography.PublicKey{pKey}, []*cryptography.Signature{s}))
+}
+
+// NFT returns the token of collection as of the last block.
+func (bc *Blockchain) NFT(collection, token string) (*NFT, error) {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+
+	nft := bc.state.Account(nftKey(collection, token)).NFT
+	if nft == nil {
+		return nil, fmt.Errorf("%w: %s/%s", ErrNFTNotFound, collection, token)
+	}
+	c := *nft
+	return &c, nil
+}
+
+// NFTs returns the tokens address owns as of the last block.
+func (bc *Blockchain) NFTs(address string) []*NFT {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+
+	return bc.state.NFTs(address)
+}
+
+// NFTs returns the tokens address owns, by collection and ID.
+func (s *StateTree) NFTs(address string) []*NFT {
+	nfts := make([]*NFT, 0)
+	for _, key := range s.Account(address).NFTs {
+		if nft := s.Account(key).NFT; nft != nil {
+			c := *nft
+			nfts = append(nfts, &c)
+		}
+	}
+	return nfts
+}
+
+// verifyNFT checks the shape of an nft transaction, and that no other
+// transaction carries nft fields.
+func (bc *Blockchain) verifyNFT(t *Transaction) error {
+	switch t.kind {
+	case NFTMintTx, NFTTransferTx, NFTBurnTx:
+	default:
+		if t.collection != "" || t.token != "" || t.metadata != "" {
+			return fmt.Errorf("%w: a %s transaction carries no nft", ErrInvalidNFT, t.kind)
+		}
+		return nil
+	}
+	if t.value != 0 || t.evidence != nil {
+		return fmt.Errorf("%w: a %s moves no value", ErrInvalidNFT, t.kind)
+	}
+	if !validNFTName(t.collection) || !validNFTName(t.token) {
+		return fmt.Errorf("%w: collection %q and token %q must be 1 to 64 letters, digits, '-', '_' or '.'", ErrInvalidNFT, t.collection, t.token)
+	}
+	switch t.kind {
+	case NFTMintTx:
+		if !validMetadata(t.metadata) {
+			return fmt.Errorf("%w: metadata %q is neither a URI nor a sha256", ErrInvalidNFT, t.metadata)
+		}
+	case NFTTransferTx:
+		if t.metadata != "" {
+			return fmt.Errorf("%w: only a mint sets the metadata", ErrInvalidNFT)
+		}
+		if t.recipient == t.sender {
+			return fmt.Errorf("%w: transfer of %s/%s to its owner", ErrInvalidNFT, t.collection, t.token)
+		}
+	case NFTBurnTx:
+		if t.metadata != "" || t.recipient != t.sender {
+			return fmt.Errorf("%w: a burn is from and to its sender", ErrInvalidNFT)
+		}
+	}
+	return nil
+}
+
+func validNFTName(name string) bool {
+	if len(name) == 0 || len(name) > 64 {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// validMetadata accepts an absolute URI or 64 hex digits.
+func validMetadata(metadata string) bool {
+	if len(metadata) == 0 || len(metadata) > MaxNFTMetadata {
+		return false
+	}
+	if len(metadata) == 64 && strings.Trim(strings.ToLower(metadata), "0123456789abcdef") == "" {
+		return true
+	}
+	u, err := url.Parse(metadata)
+	return err == nil && u.Scheme != "" && (u.Host != "" || u.Opaque != "" || u.Path != "")
+}
+
+// nftUse is what the transactions before the one checked, in a block or in
+// the pool, already do to the tokens: the tokens they mint, move or burn and
+// the collections they create, with their creator.
+type nftUse struct {
+	used    map[string]bool
+	created map[string]string
+}
+
+func newNFTUse() *nftUse {
+	return &nftUse{
+		used:    make(map[string]bool),
+		created: make(map[string]string),
+	}
+}
+
+// checkNFT makes sure a mint is by the creator of the collection, if there is
+// one, of a token that never existed, and that a transfer or burn is sent by
+// the owner of the token in state. A token is only touched once in a block,
+// so two transfers of it never both pass. t is added to used when it passes.
+func (bc *Blockchain) checkNFT(t *Transaction, state *StateTree, used *nftUse) error {
+	key := nftKey(t.collection, t.token)
+	switch t.kind {
+	case NFTMintTx:
+		if used.used[key] || state.Account(key).NFT != nil {
+			return fmt.Errorf("%w: %s/%s", ErrNFTExists, t.collection, t.token)
+		}
+		creator, ok := used.created[t.collection]
+		if c := state.Account(collectionKey(t.collection)).Collection; c != nil {
+			creator, ok = c.Creator, true
+		}
+		if ok && creator != t.sender {
+			return fmt.Errorf("%w: %s mints in %s", ErrCollectionCreator, t.sender, t.collection)
+		}
+		used.created[t.collection] = t.sender
+	case NFTTransferTx, NFTBurnTx:
+		nft := state.Account(key).NFT
+		if nft == nil || nft.Burned {
+			return fmt.Errorf("%w: %s/%s", ErrNFTNotFound, t.collection, t.token)
+		}
+		if used.used[key] || nft.Owner != t.sender {
+			return fmt.Errorf("%w: %s %s/%s", ErrNFTOwner, t.sender, t.collection, t.token)
+		}
+	default:
+		return nil
+	}
+	used.used[key] = true
+	return nil
+}
+
+// applyNFT mints, transfers or burns the token of t.
+func (s *StateTree) applyNFT(t *Transaction) error {
+	key := nftKey(t.collection, t.token)
+	record := s.Account(key)
+	if t.kind == NFTMintTx {
+		if record.NFT != nil {
+			return fmt.Errorf("%w: %s/%s", ErrNFTExists, t.collection, t.token)
+		}
+		if s.Account(collectionKey(t.collection)).Collection == nil {
+			s.set(collectionKey(t.collection), Account{Collection: &Collection{ID: t.collection, Creator: t.sender}})
+		}
+		record.NFT = &NFT{Collection: t.collection, ID: t.token, Owner: t.recipient, Metadata: t.metadata}
+		s.set(key, record)
+		s.own(t.recipient, key, true)
+		return nil
+	}
+
+	if record.NFT == nil || record.NFT.Owner != t.sender {
+		return fmt.Errorf("%w: %s %s/%s", ErrNFTOwner, t.sender, t.collection, t.token)
+	}
+	nft := *record.NFT
+	s.own(t.sender, key, false)
+	if t.kind == NFTBurnTx {
+		nft.Owner, nft.Burned = "", true
+	} else {
+		nft.Owner = t.recipient
+		s.own(t.recipient, key, true)
+	}
+	record.NFT = &nft
+	s.set(key, record)
+	return nil
+}
+
+// own adds key to the tokens of address or removes it. The list is copied,
+// the account kept to undo a block still holds the old one.
+func (s *StateTree) own(address, key string, owns bool) {
+	a := s.Account(address)
+	nfts := make([]string, 0, len(a.NFTs)+1)
+	for _, k := range a.NFTs {
+		if k != key {
+			nfts = append(nfts, k)
+		}
+	}
+	if owns {
+		nfts = append(nfts, key)
+		sort.Strings(nfts)
+	}
+	if len(nfts) == 0 {
+		nfts = nil
+	}
+	a.NFTs = nfts
+	s.set(address, a)
+}
@@ -0,0 +1,491 @@
+package blockchain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"blockchain/blockchain-service/network-params"
+	"blockchain/foundation/cryptography"
+)
+
+// DefaultOutOfTurnDelay is how long a signer waits before sealing a block
+// that is not its turn, so the signer in turn goes first.
+const DefaultOutOfTurnDelay = 5 * time.Second
+
+// DefaultMaxSnapshots is how many signer snapshots are kept. An evicted one
+// is rebuilt from an older snapshot, or from the genesis signers.
+const DefaultMaxSnapshots = 1024
+
+var (
+	ErrInvalidSeal        = errors.New("invalid block seal")
+	ErrUnauthorizedSigner = errors.New("signer is not authorized")
+	ErrRecentlySigned     = errors.New("signer has sealed one of the recent blocks")
+	ErrNoSigner           = errors.New("node has no signer key")
+	ErrNotAuthority       = errors.New("chain does not run proof of authority")
+)
+
+// Signers returns the signers allowed to seal the next block of a proof of
+// authority chain.
+func (bc *Blockchain) Signers() ([]string, error) {
+	poa, ok := bc.consensus.(*ProofOfAuthority)
+	if !ok {
+		return nil, ErrNotAuthority
+	}
+	bc.mux.RLock()
+	chain := blockHeaders(bc.chain)
+	bc.mux.RUnlock()
+	return poa.Signers(chain)
+}
+
+// ProposeSigner makes the node vote for address to join the signers, or to
+// leave them when authorize is unset, see ProofOfAuthority.Propose.
+func (bc *Blockchain) ProposeSigner(address string, authorize bool) error {
+	poa, ok := bc.consensus.(*ProofOfAuthority)
+	if !ok {
+		return ErrNotAuthority
+	}
+	return poa.Propose(address, authorize)
+}
+
+// Vote proposes to add Address to the signers, or to remove it when Authorize
+// is unset. The change is made once more than half the signers voted for it.
+type Vote struct {
+	Address   string `json:"address"`
+	Authorize bool   `json:"authorize"`
+}
+
+// poaExtra is the extra data of a proof of authority block.
+type poaExtra struct {
+	InTurn bool  `json:"in_turn"`
+	Vote   *Vote `json:"vote,omitempty"`
+}
+
+// signedSeal is the signature of the signer over the seal hash of a block.
+type signedSeal struct {
+	PublicKey string `json:"public_key"`
+	Signature string `json:"signature"`
+}
+
+// signSeal seals b with key.
+func signSeal(key cryptography.PrivateKey, b *Block) error {
+	hash := b.Header().SealHash()
+	sig, err := key.Sign(hash[:])
+	if err != nil {
+		return err
+	}
+	b.seal, err = json.Marshal(&signedSeal{
+		PublicKey: cryptography.GeneratePublicKeyString(key.PublicKey()),
+		Signature: sig.String(),
+	})
+	return err
+}
+
+// sealSigner checks the signed seal of header and returns the key that made
+// it with its address.
+func sealSigner(header *BlockHeader, params *network_params.Params) (string, cryptography.PublicKey, error) {
+	var seal signedSeal
+	if err := json.Unmarshal(header.Seal, &seal); err != nil {
+		return "", nil, fmt.Errorf("%w: %s", ErrInvalidSeal, err)
+	}
+	pk, err := cryptography.PublicKeyFromString(seal.PublicKey)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %s", ErrInvalidSeal, err)
+	}
+	sig, err := cryptography.ParseSignature(seal.Signature, pk.KeyType())
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %s", ErrInvalidSeal, err)
+	}
+	hash := header.SealHash()
+	if !pk.Verify(hash[:], sig) {
+		return "", nil, fmt.Errorf("%w: bad signature", ErrInvalidSeal)
+	}
+	return cryptography.GenerateBlockchainAddress(pk, params), pk, nil
+}
+
+// ProofOfAuthority lets a set of signers take turns sealing blocks. The signer
+// at the block height modulo the number of signers is in turn and adds twice
+// the work of the others, and no signer may seal more than one of any
+// len(signers)/2+1 blocks in a row. Signers change the set by voting in the
+// blocks they seal.
+type ProofOfAuthority struct {
+	params *network_params.Params
+
+	mux            sync.Mutex
+	key            cryptography.PrivateKey
+	outOfTurnDelay time.Duration
+	proposals      map[string]bool
+	// snapshots are the signer sets on top of the last blocks seen, by hash,
+	// and order the hashes from the oldest.
+	snapshots     map[[32]byte]*signerSnapshot
+	order         [][32]byte
+	snapshotLimit int
+}
+
+func NewProofOfAuthority(params *network_params.Params) (*ProofOfAuthority, error) {
+	if len(params.Signers) == 0 {
+		return nil, errors.New("proof of authority needs at least one signer")
+	}
+	for _, address := range params.Signers {
+		if err := cryptography.ValidateBlockchainAddress(address, params); err != nil {
+			return nil, &InvalidAddressError{Address: address, Err: err}
+		}
+	}
+	return &ProofOfAuthority{
+		params:         params,
+		outOfTurnDelay: DefaultOutOfTurnDelay,
+		proposals:      make(map[string]bool),
+		snapshots:      make(map[[32]byte]*signerSnapshot),
+		snapshotLimit:  DefaultMaxSnapshots,
+	}, nil
+}
+
+// SetSigner makes the node seal blocks with key.
+func (p *ProofOfAuthority) SetSigner(key cryptography.PrivateKey) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.key = key
+}
+
+func (p *ProofOfAuthority) SetOutOfTurnDelay(d time.Duration) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.outOfTurnDelay = d
+}
+
+// Propose makes the node vote, in the blocks it seals, for address to be
+// added to the signers or removed when authorize is unset.
+func (p *ProofOfAuthority) Propose(address string, authorize bool) error {
+	if err := cryptography.ValidateBlockchainAddress(address, p.params); err != nil {
+		return &InvalidAddressError{Address: address, Err: err}
+	}
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.proposals[address] = authorize
+	return nil
+}
+
+// Discard drops the proposal about address.
+func (p *ProofOfAuthority) Discard(address string) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	delete(p.proposals, address)
+}
+
+// Signers returns the signers allowed to seal the block on top of chain.
+func (p *ProofOfAuthority) Signers(chain ChainHeaders) ([]string, error) {
+	snap, err := p.snapshot(chain)
+	if err != nil {
+		return nil, err
+	}
+	return append([]string(nil), snap.signers...), nil
+}
+
+func (p *ProofOfAuthority) Prepare(chain ChainHeaders, b *Block) error {
+	signer, err := p.signerAddress()
+	if err != nil {
+		return err
+	}
+	snap, err := p.snapshot(chain)
+	if err != nil {
+		return err
+	}
+	extra, err := json.Marshal(&poaExtra{
+		InTurn: snap.inTurn(chain.Len(), signer),
+		Vote:   p.vote(snap, signer),
+	})
+	if err != nil {
+		return err
+	}
+	b.extra = extra
+	b.seal = nil
+	return nil
+}
+
+// vote picks a proposal that is neither in effect nor already cast by signer.
+func (p *ProofOfAuthority) vote(snap *signerSnapshot, signer string) *Vote {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	addresses := make([]string, 0, len(p.proposals))
+	for address := range p.proposals {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	for _, address := range addresses {
+		authorize := p.proposals[address]
+		if snap.isSigner(address) == authorize {
+			continue
+		}
+		if cast, ok := snap.votes[address][signer]; ok && cast == authorize {
+			continue
+		}
+		return &Vote{Address: address, Authorize: authorize}
+	}
+	return nil
+}
+
+// Seal signs b. A signer out of turn waits the out of turn delay first, the
+// block in turn aborts it by cancelling ctx.
+func (p *ProofOfAuthority) Seal(ctx context.Context, chain ChainHeaders, b *Block) error {
+	p.mux.Lock()
+	key, delay := p.key, p.outOfTurnDelay
+	p.mux.Unlock()
+	if key == nil {
+		return ErrNoSigner
+	}
+	signer := cryptography.GenerateBlockchainAddress(key.PublicKey(), p.params)
+	snap, err := p.snapshot(chain)
+	if err != nil {
+		return err
+	}
+	if err := snap.canSign(chain.Len(), signer); err != nil {
+		return err
+	}
+	extra, err := parseExtra(b.extra)
+	if err != nil {
+		return err
+	}
+
+	if !extra.InTurn {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+
+	return signSeal(key, b)
+}
+
+func (p *ProofOfAuthority) VerifySeal(chain ChainHeaders, header *BlockHeader) error {
+	snap, err := p.snapshot(chain)
+	if err != nil {
+		return err
+	}
+	signer, err := p.signer(header)
+	if err != nil {
+		return err
+	}
+	height := chain.Len()
+	if err := snap.canSign(height, signer); err != nil {
+		return err
+	}
+	extra, err := parseExtra(header.Extra)
+	if err != nil {
+		return err
+	}
+	if extra.InTurn != snap.inTurn(height, signer) {
+		return fmt.Errorf("%w: block %d is wrongly marked in turn %t", ErrInvalidSeal, height, extra.InTurn)
+	}
+	if extra.Vote != nil {
+		if err := cryptography.ValidateBlockchainAddress(extra.Vote.Address, p.params); err != nil {
+			return fmt.Errorf("%w: vote for %q: %s", ErrInvalidSeal, extra.Vote.Address, err)
+		}
+	}
+	return nil
+}
+
+func (p *ProofOfAuthority) Work(header *BlockHeader) *big.Int {
+	if extra, err := parseExtra(header.Extra); err == nil && extra.InTurn {
+		return big.NewInt(2)
+	}
+	return big.NewInt(1)
+}
+
+func (p *ProofOfAuthority) signerAddress() (string, error) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if p.key == nil {
+		return "", ErrNoSigner
+	}
+	return cryptography.GenerateBlockchainAddress(p.key.PublicKey(), p.params), nil
+}
+
+// signer checks the seal of header and returns the address that made it.
+func (p *ProofOfAuthority) signer(header *BlockHeader) (string, error) {
+	address, _, err := sealSigner(header, p.params)
+	return address, err
+}
+
+func parseExtra(b []byte) (*poaExtra, error) {
+	var extra poaExtra
+	if err := json.Unmarshal(b, &extra); err != nil {
+		return nil, fmt.Errorf("%w: extra data: %s", ErrInvalidSeal, err)
+	}
+	return &extra, nil
+}
+
+// snapshot returns the signer set on top of chain. It starts from the latest
+// block with a known snapshot and applies the blocks after it.
+func (p *ProofOfAuthority) snapshot(chain ChainHeaders) (*signerSnapshot, error) {
+	if chain.Len() == 0 {
+		return nil, ErrGenesisMismatch
+	}
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	var snap *signerSnapshot
+	var pending []*BlockHeader
+	height := chain.Len() - 1
+	for ; ; height-- {
+		header := chain.Header(height)
+		hash := header.Hash()
+		if s, ok := p.snapshots[hash]; ok {
+			snap = s
+			break
+		}
+		if height == 0 {
+			snap = newSignerSnapshot(p.params.Signers)
+			p.remember(hash, snap)
+			break
+		}
+		pending = append(pending, header)
+	}
+
+	for i := len(pending) - 1; i >= 0; i-- {
+		height++
+		header := pending[i]
+		signer, err := p.signer(header)
+		if err != nil {
+			return nil, err
+		}
+		extra, err := parseExtra(header.Extra)
+		if err != nil {
+			return nil, err
+		}
+		snap = snap.apply(height, signer, extra.Vote)
+		p.remember(header.Hash(), snap)
+	}
+	return snap, nil
+}
+
+// remember keeps snap for the block hash, evicting the oldest snapshots over
+// the limit.
+func (p *ProofOfAuthority) remember(hash [32]byte, snap *signerSnapshot) {
+	if _, ok := p.snapshots[hash]; ok {
+		return
+	}
+	for len(p.snapshots) >= p.snapshotLimit && len(p.order) > 0 {
+		delete(p.snapshots, p.order[0])
+		p.order = p.order[1:]
+	}
+	p.snapshots[hash] = snap
+	p.order = append(p.order, hash)
+}
+
+// signerSnapshot is the signer set on top of a block.
+type signerSnapshot struct {
+	// signers is sorted.
+	signers []string
+	// recents are the signers of the last blocks by height, the ones that
+	// may not seal yet.
+	recents map[int]string
+	// votes are the standing votes by address voted on and voter.
+	votes map[string]map[string]bool
+}
+
+func newSignerSnapshot(signers []string) *signerSnapshot {
+	s := &signerSnapshot{
+		recents: make(map[int]string),
+		votes:   make(map[string]map[string]bool),
+	}
+	for _, address := range signers {
+		if !s.isSigner(address) {
+			s.add(address)
+		}
+	}
+	return s
+}
+
+func (s *signerSnapshot) isSigner(address string) bool {
+	i := sort.SearchStrings(s.signers, address)
+	return i < len(s.signers) && s.signers[i] == address
+}
+
+func (s *signerSnapshot) add(address string) {
+	s.signers = append(s.signers, address)
+	sort.Strings(s.signers)
+}
+
+func (s *signerSnapshot) remove(address string) {
+	i := sort.SearchStrings(s.signers, address)
+	s.signers = append(s.signers[:i:i], s.signers[i+1:]...)
+}
+
+// limit is the number of blocks in a row a signer may seal only one of.
+func (s *signerSnapshot) limit() int {
+	return len(s.signers)/2 + 1
+}
+
+func (s *signerSnapshot) inTurn(height int, signer string) bool {
+	return s.signers[height%len(s.signers)] == signer
+}
+
+func (s *signerSnapshot) canSign(height int, signer string) error {
+	if !s.isSigner(signer) {
+		return fmt.Errorf("%w: %s", ErrUnauthorizedSigner, signer)
+	}
+	for h, recent := range s.recents {
+		if recent == signer && height-h < s.limit() {
+			return fmt.Errorf("%w: %s sealed block %d", ErrRecentlySigned, signer, h)
+		}
+	}
+	return nil
+}
+
+// apply returns the snapshot after the block at height, sealed by signer and
+// carrying vote.
+func (s *signerSnapshot) apply(height int, signer string, vote *Vote) *signerSnapshot {
+	next := &signerSnapshot{
+		signers: append([]string(nil), s.signers...),
+		recents: make(map[int]string, len(s.recents)+1),
+		votes:   make(map[string]map[string]bool, len(s.votes)),
+	}
+	for h, recent := range s.recents {
+		next.recents[h] = recent
+	}
+	for address, voters := range s.votes {
+		next.votes[address] = make(map[string]bool, len(voters))
+		for voter, authorize := range voters {
+			next.votes[address][voter] = authorize
+		}
+	}
+	next.recents[height] = signer
+
+	// The last signer can not be voted out.
+	if vote != nil && (vote.Authorize || len(next.signers) > 1) {
+		if next.votes[vote.Address] == nil {
+			next.votes[vote.Address] = make(map[string]bool)
+		}
+		next.votes[vote.Address][signer] = vote.Authorize
+		tally := 0
+		for voter, authorize := range next.votes[vote.Address] {
+			if authorize == vote.Authorize && next.isSigner(voter) {
+				tally++
+			}
+		}
+		if tally > len(next.signers)/2 && next.isSigner(vote.Address) != vote.Authorize {
+			if vote.Authorize {
+				next.add(vote.Address)
+			} else {
+				next.remove(vote.Address)
+				for _, voters := range next.votes {
+					delete(voters, vote.Address)
+				}
+			}
+			delete(next.votes, vote.Address)
+		}
+	}
+
+	for h := range next.recents {
+		if height-h >= next.limit() {
+			delete(next.recents, h)
+		}
+	}
+	return next
+}
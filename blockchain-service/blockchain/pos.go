@@ -0,0 +1,494 @@
+package blockchain
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"sync"
+
+	"blockchain/blockchain-service/network-params"
+	"blockchain/foundation/cryptography"
+)
+
+var (
+	ErrNotStaking        = errors.New("chain does not run proof of stake")
+	ErrNotSelected       = errors.New("validator is not the one drawn for the block")
+	ErrNoValidators      = errors.New("no validator has the minimum stake")
+	ErrInsufficientStake = errors.New("unstake exceeds the stake of the sender")
+	ErrInvalidEvidence   = errors.New("invalid double sign evidence")
+	ErrKnownEvidence     = errors.New("double sign is already punished")
+	ErrNoStake           = errors.New("validator has no stake to slash")
+)
+
+// Validator is an address with a stake.
+type Validator struct {
+	Address string  `json:"address"`
+	Stake   float32 `json:"stake"`
+}
+
+// Validators returns the validators of a proof of stake chain with the one
+// drawn for the next block.
+func (bc *Blockchain) Validators() ([]Validator, string, error) {
+	pos, ok := bc.consensus.(*ProofOfStake)
+	if !ok {
+		return nil, "", ErrNotStaking
+	}
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+
+	next, err := pos.Selected(chainState{blockHeaders(bc.chain), bc.state})
+	if err != nil && !errors.Is(err, ErrNoValidators) {
+		return nil, "", err
+	}
+	return bc.state.Validators(bc.params.MinStake), next, nil
+}
+
+// AddStakeTransaction stakes value of the balance of sender, or unstakes it
+// when kind is UnstakeTx.
+func (bc *Blockchain) AddStakeTransaction(kind TxKind, sender string, value, fee float32, nonce uint64, pKey cryptography.PublicKey, s *cryptography.Signature) error {
+	if kind != StakeTx && kind != UnstakeTx {
+		return fmt.Errorf("%w: %q is not a stake transaction", ErrLedger, kind)
+	}
+	return bc.addTransaction(NewStakeTransaction(kind, sender, value, fee, nonce, 0, []cryptography.PublicKey{pKey}, []*cryptography.Signature{s}))
+}
+
+// AddEvidenceTransaction reports the validator that sealed both blocks of
+// evidence, which burns its stake. The sender signs the transaction with the
+// validator as recipient.
+func (bc *Blockchain) AddEvidenceTransaction(sender string, evidence *DoubleSignEvidence, fee float32, nonce uint64, pKey cryptography.PublicKey, s *cryptography.Signature) error {
+	pos, ok := bc.consensus.(*ProofOfStake)
+	if !ok {
+		return ErrNotStaking
+	}
+	offender, _, err := pos.checkEvidence(evidence)
+	if err != nil {
+		return err
+	}
+	return bc.addTransaction(NewEvidenceTransaction(sender, offender, evidence, fee, nonce, 0, []cryptography.PublicKey{pKey}, []*cryptography.Signature{s}))
+}
+
+func (bc *Blockchain) addTransaction(t *Transaction) error {
+	if err := bc.verifyTransaction(t); err != nil {
+		return err
+	}
+
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	if err := bc.checkFunds(t); err != nil {
+		return err
+	}
+	return bc.mempool.Add(t)
+}
+
+// verifyKind checks a stake transaction for its sender and a positive value,
+// evidence for the validator it names, a contract transaction for its gas and
+// an asset or nft transaction for its asset or token. Only contract
+// transactions carry data and gas.
+func (bc *Blockchain) verifyKind(t *Transaction) error {
+	if err := bc.verifyAsset(t); err != nil {
+		return err
+	}
+	if err := bc.verifyNFT(t); err != nil {
+		return err
+	}
+	if t.kind == DeployTx || t.kind == CallTx {
+		return bc.verifyContract(t)
+	}
+	if len(t.data) > 0 || t.gas != 0 {
+		return fmt.Errorf("%w: a %s transaction carries no data or gas", ErrLedger, t.kind)
+	}
+	switch t.kind {
+	case TransferTx, IssueTx, MintTx, NFTMintTx, NFTTransferTx, NFTBurnTx:
+		if t.evidence != nil {
+			return fmt.Errorf("%w: a transfer carries no evidence", ErrInvalidEvidence)
+		}
+		return nil
+	}
+	pos, ok := bc.consensus.(*ProofOfStake)
+	if !ok {
+		return ErrNotStaking
+	}
+	switch t.kind {
+	case StakeTx, UnstakeTx:
+		if t.recipient != t.sender || t.evidence != nil {
+			return fmt.Errorf("%w: a %s transaction is for its sender only", ErrLedger, t.kind)
+		}
+		if t.kind == StakeTx {
+			if err := validatorAddress(t.sender, pos.params); err != nil {
+				return err
+			}
+		}
+		if t.value <= 0 {
+			return fmt.Errorf("%w: %s of %f must be positive", ErrLedger, t.kind, t.value)
+		}
+	case EvidenceTx:
+		if t.value != 0 {
+			return fmt.Errorf("%w: evidence moves no value", ErrInvalidEvidence)
+		}
+		offender, _, err := pos.checkEvidence(t.evidence)
+		if err != nil {
+			return err
+		}
+		if offender != t.recipient {
+			return fmt.Errorf("%w: blocks are sealed by %s, not %s", ErrInvalidEvidence, offender, t.recipient)
+		}
+	default:
+		return fmt.Errorf("%w: unknown transaction kind %q", ErrLedger, t.kind)
+	}
+	return nil
+}
+
+// checkStake makes sure an unstake does not take more than the sender has
+// staked in state, and that evidence slashes a validator with a stake for a
+// double sign not punished in chain yet. unstaked and slashed hold what the
+// transactions before t already used, t is added to them when it passes.
+func (bc *Blockchain) checkStake(t *Transaction, chain []*Block, state *StateTree, unstaked map[string]float32, slashed map[string]bool) error {
+	switch t.kind {
+	case UnstakeTx:
+		staked := state.Account(t.sender).Stake - unstaked[t.sender]
+		if t.value > staked {
+			return fmt.Errorf("%w: %s unstakes %f of %f", ErrInsufficientStake, t.sender, t.value, staked)
+		}
+		unstaked[t.sender] += t.value
+	case EvidenceTx:
+		height, err := t.evidence.height()
+		if err != nil {
+			return err
+		}
+		key := fmt.Sprintf("%s/%d", t.recipient, height)
+		if slashed[key] || punished(chain, t.recipient, height) {
+			return fmt.Errorf("%w: %s at height %d", ErrKnownEvidence, t.recipient, height)
+		}
+		if state.Account(t.recipient).Stake <= 0 {
+			return fmt.Errorf("%w: %s", ErrNoStake, t.recipient)
+		}
+		slashed[key] = true
+	}
+	return nil
+}
+
+// punished reports whether chain holds evidence of offender sealing two
+// blocks at height.
+func punished(chain []*Block, offender string, height int) bool {
+	for _, b := range chain {
+		for _, t := range b.GetTransactions() {
+			if t.kind != EvidenceTx || t.recipient != offender {
+				continue
+			}
+			if h, err := t.evidence.height(); err == nil && h == height {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// DoubleSignEvidence is two different blocks sealed by the same validator at
+// the same height.
+type DoubleSignEvidence struct {
+	First  *BlockHeader `json:"first"`
+	Second *BlockHeader `json:"second"`
+}
+
+// ID is the hex encoded sha256 of the seal hashes of both blocks, in order, so
+// swapping them makes the same evidence.
+func (e *DoubleSignEvidence) ID() string {
+	if e.First == nil || e.Second == nil {
+		return ""
+	}
+	first, second := e.First.SealHash(), e.Second.SealHash()
+	if string(second[:]) < string(first[:]) {
+		first, second = second, first
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(append(first[:], second[:]...)))
+}
+
+func (e *DoubleSignEvidence) height() (int, error) {
+	if e == nil || e.First == nil {
+		return 0, ErrInvalidEvidence
+	}
+	extra, err := parseStakeExtra(e.First.Extra)
+	if err != nil {
+		return 0, err
+	}
+	return extra.Height, nil
+}
+
+// posExtra is the extra data of a proof of stake block. Reveal is the VRF
+// proof of the validator over the seed it was drawn with, in hex.
+type posExtra struct {
+	Height int    `json:"height"`
+	Reveal string `json:"reveal"`
+}
+
+func parseStakeExtra(b []byte) (*posExtra, error) {
+	var extra posExtra
+	if err := json.Unmarshal(b, &extra); err != nil {
+		return nil, fmt.Errorf("%w: extra data: %s", ErrInvalidSeal, err)
+	}
+	return &extra, nil
+}
+
+// ProofOfStake draws the validator of every block from the accounts with at
+// least MinStake staked, each with a chance in proportion to its stake. The
+// seed of the draw starts as the hash of the genesis block and every block
+// mixes in the VRF output of its validator over the seed before it. A key has
+// a single valid proof for a seed, so a validator can not grind the seed by
+// proving again. Validators need P-256 keys. Every block adds the same work.
+//
+// Only the validator drawn may seal a block, so a block is only verified
+// together with the account state it is drawn from.
+type ProofOfStake struct {
+	params *network_params.Params
+
+	mux sync.Mutex
+	key cryptography.PrivateKey
+	// seeds are the seeds after the blocks seen, by hash.
+	seeds map[[32]byte][32]byte
+}
+
+func NewProofOfStake(params *network_params.Params) (*ProofOfStake, error) {
+	if params.UTXO() {
+		return nil, errors.New("proof of stake keeps the stakes in accounts and needs the account ledger")
+	}
+	if len(params.Stakes) == 0 {
+		return nil, errors.New("proof of stake needs at least one staked validator")
+	}
+	for _, a := range params.Stakes {
+		if err := validatorAddress(a.Address, params); err != nil {
+			return nil, err
+		}
+	}
+	return &ProofOfStake{
+		params: params,
+		seeds:  make(map[[32]byte][32]byte),
+	}, nil
+}
+
+// SetValidator makes the node seal the blocks it is drawn for with key.
+func (p *ProofOfStake) SetValidator(key cryptography.PrivateKey) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.key = key
+}
+
+// Selected returns the validator drawn for the block on top of chain.
+func (p *ProofOfStake) Selected(chain ChainState) (string, error) {
+	seed, err := p.seed(chain)
+	if err != nil {
+		return "", err
+	}
+	return draw(seed, chain.State().Validators(p.params.MinStake))
+}
+
+func (p *ProofOfStake) Prepare(chain ChainHeaders, b *Block) error {
+	p.mux.Lock()
+	key := p.key
+	p.mux.Unlock()
+	if key == nil {
+		return ErrNoSigner
+	}
+	seed, err := p.seed(chain)
+	if err != nil {
+		return err
+	}
+	proof, err := cryptography.VRFProve(key, seed[:])
+	if err != nil {
+		return err
+	}
+	extra, err := json.Marshal(&posExtra{
+		Height: chain.Len(),
+		Reveal: hex.EncodeToString(proof),
+	})
+	if err != nil {
+		return err
+	}
+	b.extra = extra
+	b.seal = nil
+	return nil
+}
+
+// Seal signs b if the node is the validator drawn for it.
+func (p *ProofOfStake) Seal(ctx context.Context, chain ChainHeaders, b *Block) error {
+	p.mux.Lock()
+	key := p.key
+	p.mux.Unlock()
+	if key == nil {
+		return ErrNoSigner
+	}
+	validator := cryptography.GenerateBlockchainAddress(key.PublicKey(), p.params)
+	if err := p.checkSelected(chain, validator); err != nil {
+		return err
+	}
+	return signSeal(key, b)
+}
+
+func (p *ProofOfStake) VerifySeal(chain ChainHeaders, header *BlockHeader) error {
+	validator, pk, err := sealSigner(header, p.params)
+	if err != nil {
+		return err
+	}
+	extra, err := parseStakeExtra(header.Extra)
+	if err != nil {
+		return err
+	}
+	if extra.Height != chain.Len() {
+		return fmt.Errorf("%w: block %d claims height %d", ErrInvalidSeal, chain.Len(), extra.Height)
+	}
+	seed, err := p.seed(chain)
+	if err != nil {
+		return err
+	}
+	proof, err := hex.DecodeString(extra.Reveal)
+	if err != nil || hex.EncodeToString(proof) != extra.Reveal {
+		return fmt.Errorf("%w: reveal is not lower case hex", ErrInvalidSeal)
+	}
+	if _, err := cryptography.VRFVerify(pk, seed[:], proof); err != nil {
+		return fmt.Errorf("%w: reveal: %s", ErrInvalidSeal, err)
+	}
+	return p.checkSelected(chain, validator)
+}
+
+func (p *ProofOfStake) Work(header *BlockHeader) *big.Int {
+	return big.NewInt(1)
+}
+
+// checkSelected makes sure validator is the one drawn for the block on top of
+// chain. The draw needs the state after chain, bare headers are refused.
+func (p *ProofOfStake) checkSelected(chain ChainHeaders, validator string) error {
+	state, ok := chain.(ChainState)
+	if !ok {
+		return fmt.Errorf("%w: block %d can not be checked without the account state", ErrNotSelected, chain.Len())
+	}
+	selected, err := p.Selected(state)
+	if err != nil {
+		return err
+	}
+	if selected != validator {
+		return fmt.Errorf("%w: block %d is for %s, not %s", ErrNotSelected, chain.Len(), selected, validator)
+	}
+	return nil
+}
+
+// checkEvidence returns the validator that sealed both blocks of e and the
+// height they are at.
+func (p *ProofOfStake) checkEvidence(e *DoubleSignEvidence) (string, int, error) {
+	if e == nil || e.First == nil || e.Second == nil {
+		return "", 0, fmt.Errorf("%w: two blocks are needed", ErrInvalidEvidence)
+	}
+	// The seal hash leaves out the seal, a signature encoded another way is
+	// the same block.
+	if e.First.SealHash() == e.Second.SealHash() {
+		return "", 0, fmt.Errorf("%w: both blocks are the same", ErrInvalidEvidence)
+	}
+	first, _, err := sealSigner(e.First, p.params)
+	if err != nil {
+		return "", 0, fmt.Errorf("%w: %s", ErrInvalidEvidence, err)
+	}
+	second, _, err := sealSigner(e.Second, p.params)
+	if err != nil {
+		return "", 0, fmt.Errorf("%w: %s", ErrInvalidEvidence, err)
+	}
+	if first != second {
+		return "", 0, fmt.Errorf("%w: blocks are sealed by %s and %s", ErrInvalidEvidence, first, second)
+	}
+	firstExtra, err := parseStakeExtra(e.First.Extra)
+	if err != nil {
+		return "", 0, fmt.Errorf("%w: %s", ErrInvalidEvidence, err)
+	}
+	secondExtra, err := parseStakeExtra(e.Second.Extra)
+	if err != nil {
+		return "", 0, fmt.Errorf("%w: %s", ErrInvalidEvidence, err)
+	}
+	if firstExtra.Height != secondExtra.Height {
+		return "", 0, fmt.Errorf("%w: blocks are at heights %d and %d", ErrInvalidEvidence, firstExtra.Height, secondExtra.Height)
+	}
+	return first, firstExtra.Height, nil
+}
+
+// seed returns the seed the validator of the block on top of chain is drawn
+// with. It starts from the latest block with a known seed and mixes in the VRF
+// outputs of the blocks after it.
+func (p *ProofOfStake) seed(chain ChainHeaders) ([32]byte, error) {
+	if chain.Len() == 0 {
+		return [32]byte{}, ErrGenesisMismatch
+	}
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	var seed [32]byte
+	var pending []*BlockHeader
+	for height := chain.Len() - 1; ; height-- {
+		header := chain.Header(height)
+		hash := header.Hash()
+		if s, ok := p.seeds[hash]; ok {
+			seed = s
+			break
+		}
+		if height == 0 {
+			seed = sha256.Sum256(hash[:])
+			p.seeds[hash] = seed
+			break
+		}
+		pending = append(pending, header)
+	}
+
+	for i := len(pending) - 1; i >= 0; i-- {
+		header := pending[i]
+		extra, err := parseStakeExtra(header.Extra)
+		if err != nil {
+			return [32]byte{}, err
+		}
+		proof, err := hex.DecodeString(extra.Reveal)
+		if err != nil {
+			return [32]byte{}, fmt.Errorf("%w: reveal: %s", ErrInvalidSeal, err)
+		}
+		beta, err := cryptography.VRFHash(proof)
+		if err != nil {
+			return [32]byte{}, fmt.Errorf("%w: reveal: %s", ErrInvalidSeal, err)
+		}
+		seed = sha256.Sum256(append(seed[:], beta...))
+		p.seeds[header.Hash()] = seed
+	}
+	return seed, nil
+}
+
+// validatorAddress makes sure address is that of a single P-256 key, the only
+// keys the VRF of the draw works with.
+func validatorAddress(address string, params *network_params.Params) error {
+	version, kt, _, err := cryptography.DecodeBlockchainAddress(address, params)
+	if err == nil && (version != params.AddressVersion() || kt != cryptography.P256) {
+		err = fmt.Errorf("validators need a single %s key", cryptography.P256)
+	}
+	if err != nil {
+		return &InvalidAddressError{Address: address, Err: err}
+	}
+	return nil
+}
+
+// draw picks one of the validators with a chance in proportion to its stake.
+// The first 8 bytes of seed are the point drawn on the stakes laid end to end
+// in the order of the validators.
+func draw(seed [32]byte, validators []Validator) (string, error) {
+	if len(validators) == 0 {
+		return "", ErrNoValidators
+	}
+	var total float64
+	for _, v := range validators {
+		total += float64(v.Stake)
+	}
+	point := float64(binary.BigEndian.Uint64(seed[:8])) / math.Exp2(64) * total
+	for _, v := range validators {
+		point -= float64(v.Stake)
+		if point < 0 {
+			return v.Address, nil
+		}
+	}
+	return validators[len(validators)-1].Address, nil
+}
@@ -0,0 +1,252 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"log"
+)
+
+var ErrGenesisMismatch = errors.New("chain does not start at the genesis block")
+
+// ReorgEvent describes a switch of the chain to another branch. Fork is the
+// height of the last block both branches share.
+type ReorgEvent struct {
+	Fork         int
+	Disconnected []*Block
+	Connected    []*Block
+	// Orphaned are the transactions of the disconnected blocks that the new
+	// branch does not include. They went back to the mempool.
+	Orphaned []*Transaction
+}
+
+// OnReorg registers f to be called after every reorg that disconnected at
+// least one block. f runs without the chain lock held.
+func (bc *Blockchain) OnReorg(f func(e *ReorgEvent)) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	bc.reorgListeners = append(bc.reorgListeners, f)
+}
+
+// Reorg switches the chain to c. The blocks after the fork point are
+// disconnected tip first with their undo data, then the blocks of c are
+// validated and connected one by one. If one of them is invalid the chain is
+// rolled back to where it was and the error is returned.
+func (bc *Blockchain) Reorg(c []*Block) (*ReorgEvent, error) {
+	bc.mux.Lock()
+	e, err := bc.reorg(c)
+	listeners := bc.reorgListeners
+	bc.mux.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	emitReorg(e, listeners)
+	return e, nil
+}
+
+func emitReorg(e *ReorgEvent, listeners []func(e *ReorgEvent)) {
+	if len(e.Disconnected) == 0 {
+		return
+	}
+	for _, f := range listeners {
+		f(e)
+	}
+}
+
+// SetChain replaces the chain with c through Reorg.
+func (bc *Blockchain) SetChain(c []*Block) error {
+	_, err := bc.Reorg(c)
+	return err
+}
+
+func (bc *Blockchain) reorg(c []*Block) (*ReorgEvent, error) {
+	if len(c) == 0 {
+		return nil, ErrGenesisMismatch
+	}
+	genesis, err := bc.chain[0].Hash()
+	if err != nil {
+		return nil, err
+	}
+	if hash, err := c[0].Hash(); err != nil || hash != genesis {
+		return nil, ErrGenesisMismatch
+	}
+
+	fork := 1
+	for fork < len(bc.chain) && fork < len(c) {
+		oldHash, err := bc.chain[fork].Hash()
+		if err != nil {
+			return nil, err
+		}
+		newHash, err := c[fork].Hash()
+		if err != nil {
+			return nil, err
+		}
+		if oldHash != newHash {
+			break
+		}
+		fork++
+	}
+	if final := bc.finalHeight(); fork <= final && fork < len(bc.chain) {
+		return nil, fmt.Errorf("%w: fork at height %d, block %d is final", ErrFinalized, fork-1, final)
+	}
+	if depth := len(bc.chain) - fork; bc.params.MaxReorgDepth > 0 && depth > bc.params.MaxReorgDepth {
+		return nil, fmt.Errorf("%w: %d blocks, at most %d", ErrReorgTooDeep, depth, bc.params.MaxReorgDepth)
+	}
+
+	e := &ReorgEvent{Fork: fork - 1}
+	for len(bc.chain) > fork {
+		b, err := bc.disconnectTip()
+		if err != nil {
+			bc.restore(e.Disconnected)
+			return nil, err
+		}
+		e.Disconnected = append([]*Block{b}, e.Disconnected...)
+	}
+	assumed := bc.assumeValidHeight(c)
+	for i, b := range c[fork:] {
+		if err := bc.connectBlock(b, fork+i <= assumed); err != nil {
+			invalid := &InvalidBlockError{Height: len(bc.chain), Err: err}
+			invalid.Hash, _ = b.Hash()
+			bc.rollback(fork, e.Disconnected)
+			return nil, invalid
+		}
+		e.Connected = append(e.Connected, b)
+	}
+
+	included := make(map[string]bool)
+	for _, b := range e.Connected {
+		for _, t := range b.GetTransactions() {
+			included[t.ID()] = true
+		}
+	}
+	for _, b := range e.Disconnected {
+		for _, t := range b.GetTransactions() {
+			if !t.coinbase && !included[t.ID()] {
+				e.Orphaned = append(e.Orphaned, t)
+			}
+		}
+	}
+	bc.mempool.Reinsert(poolTxs(e.Orphaned))
+	for _, b := range e.Connected {
+		bc.removeFromPool(b.GetTransactions())
+	}
+	if len(e.Disconnected) > 0 || len(e.Connected) > 0 {
+		bc.abortMining()
+	}
+	return e, nil
+}
+
+// rollback disconnects the blocks connected after fork and connects the
+// blocks that were disconnected from there again.
+func (bc *Blockchain) rollback(fork int, disconnected []*Block) {
+	for len(bc.chain) > fork {
+		if _, err := bc.disconnectTip(); err != nil {
+			log.Printf("failed to roll back block %d with err: %s", len(bc.chain)-1, err)
+			return
+		}
+	}
+	bc.restore(disconnected)
+}
+
+// restore connects blocks that were disconnected. They were valid on the
+// chain before, so their signatures are not checked again.
+func (bc *Blockchain) restore(disconnected []*Block) {
+	for _, b := range disconnected {
+		if err := bc.connectBlock(b, true); err != nil {
+			log.Printf("failed to reconnect block %d with err: %s", len(bc.chain), err)
+			return
+		}
+	}
+}
+
+// connectBlock validates b on top of the tip and appends it, keeping what is
+// needed to disconnect it again. The signatures of an assumed valid block are
+// not checked.
+func (bc *Blockchain) connectBlock(b *Block, assumed bool) error {
+	hash, err := b.Hash()
+	if err != nil {
+		return err
+	}
+	if b.GetPreviousHash() != bc.lastBlock().Header().Hash() {
+		return ErrStaleBlock
+	}
+
+	state, err := bc.validateBlock(b, bc.chain, bc.utxos, bc.state, assumed)
+	if err != nil {
+		return err
+	}
+	if err := bc.connectUTXOs(b, len(bc.chain)); err != nil {
+		return err
+	}
+
+	undo := make(map[string]Account)
+	for _, address := range touchedAddresses(b.GetTransactions()) {
+		undo[address] = bc.state.Account(address)
+	}
+	bc.undo[hash] = undo
+	bc.state = state
+	bc.chain = append(bc.chain, b)
+	bc.addNode(b, hash)
+	return nil
+}
+
+// disconnectTip reverts connectBlock for the last block.
+func (bc *Blockchain) disconnectTip() (*Block, error) {
+	tip := len(bc.chain) - 1
+	if tip == 0 {
+		return nil, errors.New("the genesis block can not be disconnected")
+	}
+	b := bc.chain[tip]
+	hash, err := b.Hash()
+	if err != nil {
+		return nil, err
+	}
+	undo, ok := bc.undo[hash]
+	if !ok {
+		return nil, fmt.Errorf("no undo data for block %d", tip)
+	}
+
+	if bc.utxos != nil {
+		if err := bc.utxos.Disconnect(b); err != nil {
+			return nil, err
+		}
+	}
+	for address, a := range undo {
+		bc.state.set(address, a)
+	}
+	delete(bc.undo, hash)
+	// Capping the slice makes the next append copy it, so the blocks that
+	// callers of Chain still hold are not overwritten.
+	bc.chain = bc.chain[:tip:tip]
+	return b, nil
+}
+
+// touchedAddresses lists the accounts the transactions change.
+func touchedAddresses(trs []*Transaction) []string {
+	var addresses []string
+	seen := make(map[string]bool)
+	add := func(address string) {
+		if !seen[address] {
+			seen[address] = true
+			addresses = append(addresses, address)
+		}
+	}
+	for _, t := range trs {
+		if !t.coinbase {
+			add(t.sender)
+		}
+		if t.kind != TransferTx || t.asset != "" {
+			add(t.recipient)
+		}
+		for _, out := range t.Outputs() {
+			add(out.Address)
+		}
+		if asset := t.Asset(); asset != "" {
+			add(asset)
+		}
+		if t.collection != "" {
+			add(collectionKey(t.collection))
+			add(nftKey(t.collection, t.token))
+		}
+	}
+	return addresses
+}
@@ -0,0 +1,507 @@
+package blockchain
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+
+	"blockchain/blockchain-service/vm"
+)
+
+const stateTreeDepth = 256
+
+// emptyHashes[d] is the root of an empty subtree whose top is at depth d.
+var emptyHashes = func() [stateTreeDepth + 1][32]byte {
+	var h [stateTreeDepth + 1][32]byte
+	for d := stateTreeDepth - 1; d >= 0; d-- {
+		h[d] = hashNode(h[d+1], h[d+1])
+	}
+	return h
+}()
+
+// Account is the state of an address. Nonce counts the transactions it has
+// sent, Stake is the part of its coins locked for proof of stake. A contract
+// account has the hash of its code and of its storage. Assets are the asset
+// balances by asset ID, and the account keyed by an asset ID holds the Asset.
+// NFTs are the keys of the tokens the address owns, the accounts keyed by
+// those hold the NFT and by a collection key the Collection.
+type Account struct {
+	Balance     float32           `json:"balance"`
+	Nonce       uint64            `json:"nonce"`
+	Stake       float32           `json:"stake,omitempty"`
+	CodeHash    [32]byte          `json:"-"`
+	StorageRoot [32]byte          `json:"-"`
+	Assets      map[string]uint64 `json:"assets,omitempty"`
+	Asset       *Asset            `json:"asset,omitempty"`
+	NFTs        []string          `json:"nfts,omitempty"`
+	NFT         *NFT              `json:"nft,omitempty"`
+	Collection  *Collection       `json:"collection,omitempty"`
+}
+
+func (a Account) empty() bool {
+	return a.Balance == 0 && a.Nonce == 0 && a.Stake == 0 && !a.IsContract() && len(a.Assets) == 0 && a.Asset == nil &&
+		len(a.NFTs) == 0 && a.NFT == nil && a.Collection == nil
+}
+
+func (a Account) IsContract() bool {
+	return a.CodeHash != [32]byte{}
+}
+
+// StateTree is a sparse Merkle tree of the accounts, keyed by the sha256 of
+// their address. An account that is not in the tree proves as a zero one.
+type StateTree struct {
+	accounts map[[32]byte]Account
+	// stakers are the addresses with a stake, the keys alone do not tell
+	// who the validators are.
+	stakers map[string]bool
+	// code holds the code of the contracts by hash and storages their
+	// storage by root. Neither changes once added, so the accounts kept to
+	// disconnect a block still find theirs.
+	code     map[[32]byte][]byte
+	storages map[[32]byte]map[vm.Word]vm.Word
+}
+
+func NewStateTree() *StateTree {
+	return &StateTree{
+		accounts: make(map[[32]byte]Account),
+		stakers:  make(map[string]bool),
+		code:     make(map[[32]byte][]byte),
+		storages: make(map[[32]byte]map[vm.Word]vm.Word),
+	}
+}
+
+func (s *StateTree) Copy() *StateTree {
+	c := NewStateTree()
+	for k, a := range s.accounts {
+		c.accounts[k] = a
+	}
+	for address := range s.stakers {
+		c.stakers[address] = true
+	}
+	for hash, code := range s.code {
+		c.code[hash] = code
+	}
+	for root, storage := range s.storages {
+		c.storages[root] = storage
+	}
+	return c
+}
+
+func (s *StateTree) Account(address string) Account {
+	return s.accounts[stateKey(address)]
+}
+
+// Code returns the code of the contract at address, nil for an account
+// that is not a contract.
+func (s *StateTree) Code(address string) []byte {
+	return s.code[s.Account(address).CodeHash]
+}
+
+// Storage returns the storage of the contract at address. It must not be
+// changed.
+func (s *StateTree) Storage(address string) map[vm.Word]vm.Word {
+	return s.storages[s.Account(address).StorageRoot]
+}
+
+// Validators returns the accounts with at least minStake staked, ordered by
+// address.
+func (s *StateTree) Validators(minStake float32) []Validator {
+	var validators []Validator
+	for address := range s.stakers {
+		if stake := s.Account(address).Stake; stake > 0 && stake >= minStake {
+			validators = append(validators, Validator{Address: address, Stake: stake})
+		}
+	}
+	sort.Slice(validators, func(i, j int) bool {
+		return validators[i].Address < validators[j].Address
+	})
+	return validators
+}
+
+func (s *StateTree) Root() [32]byte {
+	return s.subtree(s.sortedKeys(), 0)
+}
+
+// Prove returns the account of address with the siblings linking it to the
+// root.
+func (s *StateTree) Prove(address string) *BalanceProof {
+	key := stateKey(address)
+	p := &BalanceProof{
+		Address:   address,
+		Account:   s.accounts[key],
+		StateRoot: s.Root(),
+	}
+
+	keys := s.sortedKeys()
+	for d := 0; d < stateTreeDepth; d++ {
+		split := splitKeys(keys, d)
+		var sibling [32]byte
+		if bit(key, d) == 0 {
+			sibling = s.subtree(keys[split:], d+1)
+			keys = keys[:split]
+		} else {
+			sibling = s.subtree(keys[:split], d+1)
+			keys = keys[split:]
+		}
+		if sibling != emptyHashes[d+1] {
+			p.Bitmap[d/8] |= 1 << (7 - d%8)
+			p.Siblings = append(p.Siblings, sibling)
+		}
+	}
+	return p
+}
+
+// apply moves the value of trs between the accounts and their stakes. On a
+// UTXO ledger utxos holds the outputs the inputs of trs refer to.
+func (s *StateTree) apply(trs []*Transaction, utxos *UTXOSet) error {
+	_, err := s.execute(trs, utxos)
+	return err
+}
+
+// execute is apply returning the receipts of the contract transactions.
+func (s *StateTree) execute(trs []*Transaction, utxos *UTXOSet) ([]*Receipt, error) {
+	var receipts []*Receipt
+	height := 0
+	if len(trs) > 0 && trs[0].coinbase {
+		height = trs[0].height
+	}
+	for _, t := range trs {
+		switch {
+		case t.coinbase:
+		case t.IsUTXO():
+			if utxos == nil {
+				return nil, ErrLedger
+			}
+			sender := s.Account(t.sender)
+			for _, op := range t.inputs {
+				u, ok := utxos.Get(op)
+				if !ok {
+					return nil, fmt.Errorf("%w: %s:%d", ErrDoubleSpend, op.TxID, op.Index)
+				}
+				sender.Balance -= u.Value
+			}
+			sender.Nonce++
+			s.set(t.sender, sender)
+		default:
+			sender := s.Account(t.sender)
+			sender.Balance -= t.cost()
+			sender.Nonce++
+			s.set(t.sender, sender)
+		}
+
+		switch t.kind {
+		case StakeTx, UnstakeTx, EvidenceTx:
+			validator := s.Account(t.recipient)
+			switch t.kind {
+			case StakeTx:
+				validator.Stake += t.value
+			case UnstakeTx:
+				validator.Stake -= t.value
+			case EvidenceTx:
+				validator.Stake = 0
+			}
+			s.set(t.recipient, validator)
+		case DeployTx, CallTx:
+			receipts = append(receipts, s.run(t, height))
+		}
+		if t.kind == IssueTx || t.kind == MintTx || t.asset != "" {
+			if err := s.applyAsset(t); err != nil {
+				return nil, err
+			}
+		}
+		if t.kind == NFTMintTx || t.kind == NFTTransferTx || t.kind == NFTBurnTx {
+			if err := s.applyNFT(t); err != nil {
+				return nil, err
+			}
+		}
+
+		for _, out := range t.Outputs() {
+			recipient := s.Account(out.Address)
+			recipient.Balance += out.Value
+			s.set(out.Address, recipient)
+		}
+	}
+	return receipts, nil
+}
+
+func (s *StateTree) set(address string, a Account) {
+	if a.Stake != 0 {
+		s.stakers[address] = true
+	} else {
+		delete(s.stakers, address)
+	}
+	key := stateKey(address)
+	if a.empty() {
+		delete(s.accounts, key)
+		return
+	}
+	s.accounts[key] = a
+}
+
+func (s *StateTree) sortedKeys() [][32]byte {
+	keys := make([][32]byte, 0, len(s.accounts))
+	for k := range s.accounts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		for b := 0; b < 32; b++ {
+			if keys[i][b] != keys[j][b] {
+				return keys[i][b] < keys[j][b]
+			}
+		}
+		return false
+	})
+	return keys
+}
+
+// subtree hashes the subtree at depth holding the sorted keys.
+func (s *StateTree) subtree(keys [][32]byte, depth int) [32]byte {
+	if len(keys) == 0 {
+		return emptyHashes[depth]
+	}
+	if depth == stateTreeDepth {
+		return hashLeaf(keys[0], s.accounts[keys[0]])
+	}
+	split := splitKeys(keys, depth)
+	return hashNode(s.subtree(keys[:split], depth+1), s.subtree(keys[split:], depth+1))
+}
+
+// BalanceProof shows that Address holds Account in the state committed to by
+// StateRoot, the state after the block at Height.
+type BalanceProof struct {
+	Address string
+	Account
+	Height    int
+	StateRoot [32]byte
+	// Bitmap has bit d set when the sibling at depth d is not an empty
+	// subtree. Only those siblings are listed, from the top down.
+	Bitmap   [32]byte
+	Siblings [][32]byte
+}
+
+// Verify reports whether the proof links the account to root.
+func (p *BalanceProof) Verify(root [32]byte) bool {
+	key := stateKey(p.Address)
+	h := hashLeaf(key, p.Account)
+	next := len(p.Siblings) - 1
+	for d := stateTreeDepth - 1; d >= 0; d-- {
+		sibling := emptyHashes[d+1]
+		if p.Bitmap[d/8]&(1<<(7-d%8)) != 0 {
+			if next < 0 {
+				return false
+			}
+			sibling = p.Siblings[next]
+			next--
+		}
+		if bit(key, d) == 0 {
+			h = hashNode(h, sibling)
+		} else {
+			h = hashNode(sibling, h)
+		}
+	}
+	return next == -1 && h == root
+}
+
+func (p *BalanceProof) MarshalJSON() ([]byte, error) {
+	siblings := make([]string, len(p.Siblings))
+	for i, s := range p.Siblings {
+		siblings[i] = fmt.Sprintf("%x", s)
+	}
+	return json.Marshal(struct {
+		Address     string            `json:"address"`
+		Balance     float32           `json:"balance"`
+		Nonce       uint64            `json:"nonce"`
+		Stake       float32           `json:"stake,omitempty"`
+		CodeHash    string            `json:"code_hash,omitempty"`
+		StorageRoot string            `json:"storage_root,omitempty"`
+		Assets      map[string]uint64 `json:"assets,omitempty"`
+		Asset       *Asset            `json:"asset,omitempty"`
+		NFTs        []string          `json:"nfts,omitempty"`
+		NFT         *NFT              `json:"nft,omitempty"`
+		Collection  *Collection       `json:"collection,omitempty"`
+		Height      int               `json:"height"`
+		StateRoot   string            `json:"state_root"`
+		Bitmap      string            `json:"bitmap"`
+		Siblings    []string          `json:"siblings"`
+	}{
+		Address:     p.Address,
+		Balance:     p.Balance,
+		Nonce:       p.Nonce,
+		Stake:       p.Stake,
+		CodeHash:    optionalHash(p.CodeHash),
+		StorageRoot: optionalHash(p.StorageRoot),
+		Assets:      p.Assets,
+		Asset:       p.Asset,
+		NFTs:        p.NFTs,
+		NFT:         p.NFT,
+		Collection:  p.Collection,
+		Height:      p.Height,
+		StateRoot:   fmt.Sprintf("%x", p.StateRoot),
+		Bitmap:      fmt.Sprintf("%x", p.Bitmap),
+		Siblings:    siblings,
+	})
+}
+
+func (p *BalanceProof) UnmarshalJSON(b []byte) error {
+	var stateRoot, bitmap, codeHash, storageRoot string
+	var siblings []string
+	s := struct {
+		Address     *string            `json:"address"`
+		Balance     *float32           `json:"balance"`
+		Nonce       *uint64            `json:"nonce"`
+		Stake       *float32           `json:"stake,omitempty"`
+		CodeHash    *string            `json:"code_hash,omitempty"`
+		StorageRoot *string            `json:"storage_root,omitempty"`
+		Assets      *map[string]uint64 `json:"assets,omitempty"`
+		Asset       **Asset            `json:"asset,omitempty"`
+		NFTs        *[]string          `json:"nfts,omitempty"`
+		NFT         **NFT              `json:"nft,omitempty"`
+		Collection  **Collection       `json:"collection,omitempty"`
+		Height      *int               `json:"height"`
+		StateRoot   *string            `json:"state_root"`
+		Bitmap      *string            `json:"bitmap"`
+		Siblings    *[]string          `json:"siblings"`
+	}{
+		Address:     &p.Address,
+		Balance:     &p.Balance,
+		Nonce:       &p.Nonce,
+		Stake:       &p.Stake,
+		CodeHash:    &codeHash,
+		StorageRoot: &storageRoot,
+		Assets:      &p.Assets,
+		Asset:       &p.Asset,
+		NFTs:        &p.NFTs,
+		NFT:         &p.NFT,
+		Collection:  &p.Collection,
+		Height:      &p.Height,
+		StateRoot:   &stateRoot,
+		Bitmap:      &bitmap,
+		Siblings:    &siblings,
+	}
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+
+	var err error
+	if p.StateRoot, err = decodeHash(stateRoot); err != nil {
+		return err
+	}
+	if codeHash != "" {
+		if p.CodeHash, err = decodeHash(codeHash); err != nil {
+			return err
+		}
+	}
+	if storageRoot != "" {
+		if p.StorageRoot, err = decodeHash(storageRoot); err != nil {
+			return err
+		}
+	}
+	if p.Bitmap, err = decodeHash(bitmap); err != nil {
+		return err
+	}
+	p.Siblings = make([][32]byte, len(siblings))
+	for i, sibling := range siblings {
+		if p.Siblings[i], err = decodeHash(sibling); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func stateKey(address string) [32]byte {
+	return sha256.Sum256([]byte(address))
+}
+
+// hashLeaf is the empty leaf for an empty account, so a proof of a zero
+// account is also a proof of absence. The stake is only hashed when there is
+// one, the code and storage only for a contract and the assets and nfts only
+// when there are any, each after a tag byte, leaving the leaves of the other
+// accounts as they were.
+func hashLeaf(key [32]byte, a Account) [32]byte {
+	if a.empty() {
+		return emptyHashes[stateTreeDepth]
+	}
+	b := make([]byte, 1+32+4+8, 1+32+4+8+4+64)
+	copy(b[1:33], key[:])
+	binary.BigEndian.PutUint32(b[33:37], math.Float32bits(a.Balance))
+	binary.BigEndian.PutUint64(b[37:], a.Nonce)
+	if a.Stake != 0 {
+		b = binary.BigEndian.AppendUint32(b, math.Float32bits(a.Stake))
+	}
+	if a.IsContract() {
+		b = append(b, a.CodeHash[:]...)
+		b = append(b, a.StorageRoot[:]...)
+	}
+	// Maps marshal with sorted keys, so the encodings are canonical.
+	if len(a.Assets) > 0 {
+		assets, _ := json.Marshal(a.Assets)
+		h := sha256.Sum256(assets)
+		b = append(append(b, 'b'), h[:]...)
+	}
+	if a.Asset != nil {
+		asset, _ := json.Marshal(a.Asset)
+		h := sha256.Sum256(asset)
+		b = append(append(b, 'a'), h[:]...)
+	}
+	if len(a.NFTs) > 0 {
+		nfts, _ := json.Marshal(a.NFTs)
+		h := sha256.Sum256(nfts)
+		b = append(append(b, 'o'), h[:]...)
+	}
+	if a.NFT != nil {
+		nft, _ := json.Marshal(a.NFT)
+		h := sha256.Sum256(nft)
+		b = append(append(b, 'n'), h[:]...)
+	}
+	if a.Collection != nil {
+		collection, _ := json.Marshal(a.Collection)
+		h := sha256.Sum256(collection)
+		b = append(append(b, 'c'), h[:]...)
+	}
+	return sha256.Sum256(b)
+}
+
+func hashNode(left, right [32]byte) [32]byte {
+	var b [1 + 64]byte
+	b[0] = 1
+	copy(b[1:33], left[:])
+	copy(b[33:], right[:])
+	return sha256.Sum256(b[:])
+}
+
+func bit(key [32]byte, depth int) byte {
+	return key[depth/8] >> (7 - depth%8) & 1
+}
+
+// splitKeys returns the index of the first of the sorted keys that goes right
+// at depth.
+func splitKeys(keys [][32]byte, depth int) int {
+	return sort.Search(len(keys), func(i int) bool {
+		return bit(keys[i], depth) == 1
+	})
+}
+
+// optionalHash is h in hex, or nothing when it is zero.
+func optionalHash(h [32]byte) string {
+	if h == [32]byte{} {
+		return ""
+	}
+	return fmt.Sprintf("%x", h)
+}
+
+func decodeHash(s string) ([32]byte, error) {
+	var h [32]byte
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return h, err
+	}
+	if len(b) != 32 {
+		return h, fmt.Errorf("invalid hash length %d", len(b))
+	}
+	copy(h[:], b)
+	return h, nil
+}
@@ -0,0 +1,46 @@
+package blockchain
+
+// Supply reports the coins issued by the coinbase transactions of the chain.
+// Fees are transfers and do not count.
+type Supply struct {
+	Height      int     `json:"height"`
+	Circulating float64 `json:"circulating"`
+	Immature    float64 `json:"immature"`
+	MaxSupply   float64 `json:"max_supply"`
+	NextSubsidy float32 `json:"next_subsidy"`
+}
+
+func (bc *Blockchain) Supply() *Supply {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+
+	next := len(bc.chain)
+	s := &Supply{
+		Height:      next - 1,
+		MaxSupply:   bc.params.MaxSupply,
+		NextSubsidy: bc.params.Subsidy(next),
+	}
+	for _, b := range bc.chain {
+		var coinbase float32
+		var fees float32
+		for _, t := range b.GetTransactions() {
+			if t.coinbase {
+				coinbase += t.value
+				continue
+			}
+			fees += t.fee
+		}
+		issued := float64(coinbase - fees)
+		if issued <= 0 {
+			continue
+		}
+
+		trs := b.GetTransactions()
+		if bc.immature(trs[0].height, next) {
+			s.Immature += issued
+		} else {
+			s.Circulating += issued
+		}
+	}
+	return s
+}
@@ -0,0 +1,198 @@
+package blockchain
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"blockchain/foundation/cryptography"
+)
+
+var ErrStaleBlock = errors.New("block does not extend the current chain tip")
+
+// BlockTemplate is everything a miner needs to solve the next block outside
+// of the node. The coinbase transaction is the first one in Transactions.
+type BlockTemplate struct {
+	Height       int
+	PreviousHash [32]byte
+	StateRoot    [32]byte
+	Difficulty   int
+	MinTimestamp int64 // one past the median time past of the chain
+	// Timestamp is the time of the block. It is part of the work, so every
+	// share and the block itself are hashed with it.
+	Timestamp       int64
+	Transactions    []*Transaction
+	CoinbaseAddress string
+	CoinbaseValue   float32
+}
+
+func (bt *BlockTemplate) Target() string {
+	return strings.Repeat("0", bt.Difficulty) + strings.Repeat("f", 64-bt.Difficulty)
+}
+
+// Empty reports whether the template only pays the coinbase.
+func (bt *BlockTemplate) Empty() bool {
+	return len(bt.Transactions) <= 1
+}
+
+func (bt *BlockTemplate) Block(nonce int) *Block {
+	b := NewBlock(nonce, bt.PreviousHash, bt.Transactions)
+	b.stateRoot = bt.StateRoot
+	b.timestamp = bt.Timestamp
+	if b.timestamp < bt.MinTimestamp {
+		b.timestamp = bt.MinTimestamp
+	}
+	return b
+}
+
+// Meets reports whether nonce solves the template at the given difficulty. A
+// pool checks shares with a difficulty below the template's own.
+func (bt *BlockTemplate) Meets(nonce int, difficulty int) (bool, error) {
+	return bt.Block(nonce).Header().Meets(difficulty), nil
+}
+
+func (bt *BlockTemplate) Solve(ctx context.Context, engine *MiningEngine) (*Block, *MiningResult, error) {
+	result, err := engine.Solve(ctx, *bt.Block(0).Header(), bt.Difficulty)
+	if err != nil {
+		return nil, nil, err
+	}
+	return bt.Block(result.Nonce), result, nil
+}
+
+func (bt *BlockTemplate) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Height          int            `json:"height"`
+		PreviousHash    string         `json:"previous_hash"`
+		StateRoot       string         `json:"state_root"`
+		Difficulty      int            `json:"difficulty"`
+		MinTimestamp    int64          `json:"min_timestamp"`
+		Timestamp       int64          `json:"timestamp"`
+		Target          string         `json:"target"`
+		Transactions    []*Transaction `json:"transactions"`
+		CoinbaseAddress string         `json:"coinbase_address"`
+		CoinbaseValue   float32        `json:"coinbase_value"`
+	}{
+		Height:          bt.Height,
+		PreviousHash:    fmt.Sprintf("%x", bt.PreviousHash),
+		StateRoot:       fmt.Sprintf("%x", bt.StateRoot),
+		Difficulty:      bt.Difficulty,
+		MinTimestamp:    bt.MinTimestamp,
+		Timestamp:       bt.Timestamp,
+		Target:          bt.Target(),
+		Transactions:    bt.Transactions,
+		CoinbaseAddress: bt.CoinbaseAddress,
+		CoinbaseValue:   bt.CoinbaseValue,
+	})
+}
+
+func (bt *BlockTemplate) UnmarshalJSON(b []byte) error {
+	var previousHash, stateRoot string
+	s := struct {
+		Height          *int            `json:"height"`
+		PreviousHash    *string         `json:"previous_hash"`
+		StateRoot       *string         `json:"state_root"`
+		Difficulty      *int            `json:"difficulty"`
+		MinTimestamp    *int64          `json:"min_timestamp"`
+		Timestamp       *int64          `json:"timestamp"`
+		Transactions    *[]*Transaction `json:"transactions"`
+		CoinbaseAddress *string         `json:"coinbase_address"`
+		CoinbaseValue   *float32        `json:"coinbase_value"`
+	}{
+		Height:          &bt.Height,
+		PreviousHash:    &previousHash,
+		StateRoot:       &stateRoot,
+		Difficulty:      &bt.Difficulty,
+		MinTimestamp:    &bt.MinTimestamp,
+		Timestamp:       &bt.Timestamp,
+		Transactions:    &bt.Transactions,
+		CoinbaseAddress: &bt.CoinbaseAddress,
+		CoinbaseValue:   &bt.CoinbaseValue,
+	}
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+
+	ph, err := hex.DecodeString(previousHash)
+	if err != nil {
+		return err
+	}
+	if len(ph) != 32 {
+		return fmt.Errorf("invalid previous hash length %d", len(ph))
+	}
+	copy(bt.PreviousHash[:], ph)
+
+	sr, err := decodeHash(stateRoot)
+	if err != nil {
+		return err
+	}
+	bt.StateRoot = sr
+	return nil
+}
+
+func (bc *Blockchain) BlockTemplate() (*BlockTemplate, error) {
+	return bc.BlockTemplateFor(bc.blockchainAddress)
+}
+
+// BlockTemplateFor returns a template whose coinbase pays address instead of
+// the node's blockchain address.
+func (bc *Blockchain) BlockTemplateFor(address string) (*BlockTemplate, error) {
+	if err := cryptography.ValidateBlockchainAddress(address, bc.params); err != nil {
+		return nil, &InvalidAddressError{Address: address, Err: err}
+	}
+
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	return bc.blockTemplate(address)
+}
+
+// SubmitBlock appends a block solved elsewhere after checking that it extends
+// the tip and passes validateBlock.
+func (bc *Blockchain) SubmitBlock(b *Block) error {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	return bc.acceptBlock(b)
+}
+
+func (bc *Blockchain) acceptBlock(b *Block) error {
+	if err := bc.connectBlock(b, false); err != nil {
+		return err
+	}
+	bc.removeFromPool(b.GetTransactions())
+	bc.abortMining()
+	return nil
+}
+
+func (bc *Blockchain) blockTemplate(address string) (*BlockTemplate, error) {
+	prevHash, err := bc.lastBlock().Hash()
+	if err != nil {
+		return nil, err
+	}
+
+	height := len(bc.chain)
+	trs, fees := bc.selectTransactions()
+	coinbaseValue := bc.params.Subsidy(height) + fees
+	trs = append([]*Transaction{NewCoinbaseTransaction(height, address, coinbaseValue)}, trs...)
+	state := bc.state.Copy()
+	if err := state.apply(trs, bc.utxos); err != nil {
+		return nil, err
+	}
+	minTimestamp := medianTimePast(bc.chain) + 1
+	timestamp := bc.clock().UnixNano()
+	if timestamp < minTimestamp {
+		timestamp = minTimestamp
+	}
+	return &BlockTemplate{
+		Height:          height,
+		PreviousHash:    prevHash,
+		StateRoot:       state.Root(),
+		Difficulty:      bc.params.MinDifficulty,
+		MinTimestamp:    minTimestamp,
+		Timestamp:       timestamp,
+		Transactions:    trs,
+		CoinbaseAddress: address,
+		CoinbaseValue:   coinbaseValue,
+	}, nil
+}
@@ -1,15 +1,91 @@
 package blockchain
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"strings"
+
+	"blockchain/foundation/cryptography"
+)
+
+// TxKind is what a transaction on an account ledger does besides paying its
+// fee.
+type TxKind string
+
+const (
+	// TransferTx moves value from the sender to the recipient.
+	TransferTx TxKind = ""
+	// StakeTx locks value of the sender balance as its stake.
+	StakeTx TxKind = "stake"
+	// UnstakeTx moves value of the sender stake back to its balance.
+	UnstakeTx TxKind = "unstake"
+	// EvidenceTx proves that the recipient sealed two blocks at the same
+	// height, its stake is burnt.
+	EvidenceTx TxKind = "evidence"
+	// DeployTx creates the contract at the recipient with the code in its
+	// data. The recipient is derived from the sender and the nonce.
+	DeployTx TxKind = "deploy"
+	// CallTx runs the contract at the recipient with its data as input.
+	CallTx TxKind = "call"
+	// IssueTx creates an asset with the sender as issuer and pays its supply
+	// to the sender. The asset ID follows from the sender and the nonce.
+	IssueTx TxKind = "issue"
+	// MintTx adds to the supply of an asset and pays it to the recipient. Only
+	// the mint authority of the asset may send it.
+	MintTx TxKind = "mint"
+	// NFTMintTx creates a token in a collection owned by the recipient. The
+	// first mint in a collection makes the sender its creator, the only one
+	// who may mint in it after that.
+	NFTMintTx TxKind = "nft_mint"
+	// NFTTransferTx passes a token from the sender, its owner, to the
+	// recipient.
+	NFTTransferTx TxKind = "nft_transfer"
+	// NFTBurnTx destroys a token of the sender. Its ID is not used again.
+	NFTBurnTx TxKind = "nft_burn"
 )
 
+func TxKindFromString(s string) (TxKind, error) {
+	switch k := TxKind(s); k {
+	case TransferTx, StakeTx, UnstakeTx, EvidenceTx, DeployTx, CallTx, IssueTx, MintTx, NFTMintTx, NFTTransferTx, NFTBurnTx:
+		return k, nil
+	}
+	return "", fmt.Errorf("unknown transaction kind %q", s)
+}
+
 type Transaction struct {
-	sender    string
-	recipient string
-	value     float32
+	kind       TxKind
+	sender     string
+	recipient  string
+	value      float32
+	fee        float32
+	nonce      uint64
+	coinbase   bool
+	height     int
+	inputs     []OutPoint
+	outputs    []TxOutput
+	threshold  int
+	publicKeys []cryptography.PublicKey
+	signatures []*cryptography.Signature
+	evidence   *DoubleSignEvidence
+	// data is the code of a deploy and the input of a call, gas the most
+	// either may use.
+	data []byte
+	gas  uint64
+	// asset is the asset a transfer or mint moves amount of, in its base
+	// units. An issue has the symbol, decimals and mint authority of the new
+	// asset and amount as its supply.
+	asset         string
+	amount        uint64
+	symbol        string
+	decimals      uint8
+	mintAuthority string
+	// collection and token name the token of an NFT transaction, metadata is
+	// the URI or content hash a mint gives it.
+	collection string
+	token      string
+	metadata   string
 }
 
 func NewTransaction(sender, recipient string, value float32) *Transaction {
@@ -20,60 +96,805 @@ func NewTransaction(sender, recipient string, value float32) *Transaction {
 	}
 }
 
+// NewCoinbaseTransaction pays the block subsidy and fees to the miner. It is
+// the first transaction of every block but the genesis one, and records the
+// block height so no two coinbases are alike.
+func NewCoinbaseTransaction(height int, recipient string, value float32) *Transaction {
+	t := NewTransaction(BENEFACTOR_ADDRESS, recipient, value)
+	t.coinbase = true
+	t.height = height
+	return t
+}
+
+func NewSignedTransaction(sender, recipient string, value, fee float32, nonce uint64, threshold int, pKeys []cryptography.PublicKey, sigs []*cryptography.Signature) *Transaction {
+	t := NewTransaction(sender, recipient, value)
+	t.fee = fee
+	t.nonce = nonce
+	t.threshold = threshold
+	t.publicKeys = pKeys
+	t.signatures = sigs
+	return t
+}
+
+// NewUTXOTransaction spends outputs of sender and creates new ones. Whatever
+// the inputs hold beyond the outputs and the fee is lost, wallets send it back
+// to the sender as change.
+func NewUTXOTransaction(sender string, inputs []OutPoint, outputs []TxOutput, fee float32, threshold int, pKeys []cryptography.PublicKey, sigs []*cryptography.Signature) *Transaction {
+	t := NewSignedTransaction(sender, "", 0, fee, 0, threshold, pKeys, sigs)
+	t.inputs = inputs
+	t.outputs = outputs
+	return t
+}
+
+// NewStakeTransaction stakes value of the sender balance, or unstakes it when
+// kind is UnstakeTx. The sender is its own recipient.
+func NewStakeTransaction(kind TxKind, sender string, value, fee float32, nonce uint64, threshold int, pKeys []cryptography.PublicKey, sigs []*cryptography.Signature) *Transaction {
+	t := NewSignedTransaction(sender, sender, value, fee, nonce, threshold, pKeys, sigs)
+	t.kind = kind
+	return t
+}
+
+// NewEvidenceTransaction reports that offender sealed the two blocks of
+// evidence, the sender only pays the fee.
+func NewEvidenceTransaction(sender, offender string, evidence *DoubleSignEvidence, fee float32, nonce uint64, threshold int, pKeys []cryptography.PublicKey, sigs []*cryptography.Signature) *Transaction {
+	t := NewSignedTransaction(sender, offender, 0, fee, nonce, threshold, pKeys, sigs)
+	t.kind = EvidenceTx
+	t.evidence = evidence
+	return t
+}
+
+// NewContractTransaction deploys a contract at contract or calls it,
+// depending on kind.
+func NewContractTransaction(kind TxKind, sender, contract string, data []byte, gas uint64, fee float32, nonce uint64, threshold int, pKeys []cryptography.PublicKey, sigs []*cryptography.Signature) *Transaction {
+	t := NewSignedTransaction(sender, contract, 0, fee, nonce, threshold, pKeys, sigs)
+	t.kind = kind
+	t.data = data
+	t.gas = gas
+	return t
+}
+
+// NewIssueTransaction issues the asset symbol with supply base units, each
+// 10^-decimals of a token. An empty mintAuthority fixes the supply.
+func NewIssueTransaction(sender, symbol string, decimals uint8, supply uint64, mintAuthority string, fee float32, nonce uint64, threshold int, pKeys []cryptography.PublicKey, sigs []*cryptography.Signature) *Transaction {
+	t := NewSignedTransaction(sender, sender, 0, fee, nonce, threshold, pKeys, sigs)
+	t.kind = IssueTx
+	t.amount = supply
+	t.symbol = symbol
+	t.decimals = decimals
+	t.mintAuthority = mintAuthority
+	return t
+}
+
+// NewAssetTransaction transfers amount of asset to recipient, or mints it
+// there when kind is MintTx.
+func NewAssetTransaction(kind TxKind, sender, recipient, asset string, amount uint64, fee float32, nonce uint64, threshold int, pKeys []cryptography.PublicKey, sigs []*cryptography.Signature) *Transaction {
+	t := NewSignedTransaction(sender, recipient, 0, fee, nonce, threshold, pKeys, sigs)
+	t.kind = kind
+	t.asset = asset
+	t.amount = amount
+	return t
+}
+
+// NewNFTTransaction mints, transfers or burns the token of collection,
+// depending on kind. Only a mint has metadata, a burn is to the sender.
+func NewNFTTransaction(kind TxKind, sender, recipient, collection, token, metadata string, fee float32, nonce uint64, threshold int, pKeys []cryptography.PublicKey, sigs []*cryptography.Signature) *Transaction {
+	t := NewSignedTransaction(sender, recipient, 0, fee, nonce, threshold, pKeys, sigs)
+	t.kind = kind
+	t.collection = collection
+	t.token = token
+	t.metadata = metadata
+	return t
+}
+
+func (t *Transaction) Kind() TxKind {
+	return t.kind
+}
+
+func (t *Transaction) Evidence() *DoubleSignEvidence {
+	return t.evidence
+}
+
+func (t *Transaction) Data() []byte {
+	return t.data
+}
+
+func (t *Transaction) Gas() uint64 {
+	return t.gas
+}
+
+// Asset is the ID of the asset t moves, for an issue the one it creates.
+func (t *Transaction) Asset() string {
+	if t.kind == IssueTx {
+		return AssetID(t.sender, t.nonce)
+	}
+	return t.asset
+}
+
+func (t *Transaction) Amount() uint64 {
+	return t.amount
+}
+
+func (t *Transaction) Collection() string {
+	return t.collection
+}
+
+func (t *Transaction) Token() string {
+	return t.token
+}
+
+func (t *Transaction) Metadata() string {
+	return t.metadata
+}
+
+func (t *Transaction) Sender() string {
+	return t.sender
+}
+
+func (t *Transaction) Recipient() string {
+	return t.recipient
+}
+
+func (t *Transaction) Value() float32 {
+	return t.value
+}
+
+// ID is the hex encoded sha256 of the transaction, signatures included.
+func (t *Transaction) ID() string {
+	b, err := json.Marshal(t)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(b))
+}
+
+// Nonce is an optional per sender sequence number. A pending transaction can
+// be replaced by one with the same nonce that pays a higher fee.
+func (t *Transaction) Nonce() uint64 {
+	return t.nonce
+}
+
+func (t *Transaction) Fee() float32 {
+	return t.fee
+}
+
+// Size is the number of bytes the transaction takes in a block.
+func (t *Transaction) Size() int {
+	b, err := json.Marshal(t)
+	if err != nil {
+		return 0
+	}
+	return len(b)
+}
+
+// FeeRate is the fee paid per byte of the transaction.
+func (t *Transaction) FeeRate() float64 {
+	size := t.Size()
+	if size == 0 {
+		return 0
+	}
+	return float64(t.fee) / float64(size)
+}
+
+func (t *Transaction) Threshold() int {
+	return t.threshold
+}
+
+func (t *Transaction) PublicKeys() []cryptography.PublicKey {
+	return t.publicKeys
+}
+
+func (t *Transaction) Signatures() []*cryptography.Signature {
+	return t.signatures
+}
+
+func (t *Transaction) IsCoinbase() bool {
+	return t.coinbase
+}
+
+// Height is the height of the block a coinbase transaction belongs to.
+func (t *Transaction) Height() int {
+	return t.height
+}
+
+// IsUTXO reports whether t spends outputs rather than an account balance.
+func (t *Transaction) IsUTXO() bool {
+	return len(t.inputs) > 0
+}
+
+func (t *Transaction) Inputs() []OutPoint {
+	return t.inputs
+}
+
+// Outputs are the outputs t creates. A transaction without explicit outputs
+// pays a single one to its recipient, unless it stakes its value, carries
+// evidence, is for a contract or moves an asset or an NFT.
+func (t *Transaction) Outputs() []TxOutput {
+	if t.IsUTXO() {
+		return t.outputs
+	}
+	switch t.kind {
+	case StakeTx, EvidenceTx, DeployTx, CallTx, IssueTx, MintTx, NFTMintTx, NFTTransferTx, NFTBurnTx:
+		return nil
+	}
+	if t.asset != "" {
+		return nil
+	}
+	return []TxOutput{{Address: t.recipient, Value: t.value}}
+}
+
+// cost is what t takes from the balance of an account sender. Unstaking and
+// evidence only pay the fee.
+func (t *Transaction) cost() float32 {
+	switch t.kind {
+	case UnstakeTx, EvidenceTx:
+		return t.fee
+	}
+	return t.value + t.fee
+}
+
+func (t *Transaction) IsMultisig() bool {
+	return t.threshold > 0
+}
+
+// SignedPayload returns the bytes covered by the sender signatures. It must
+// match wallet.Transaction.MarshalJSON. Evidence is signed by its ID, data in
+// hex.
+func (t *Transaction) SignedPayload() ([]byte, error) {
+	var evidence string
+	if t.evidence != nil {
+		evidence = t.evidence.ID()
+	}
+	return json.Marshal(struct {
+		Sender     string     `json:"sender_blockchain_address"`
+		Recipient  string     `json:"recipient_blockchain_address"`
+		Value      float32    `json:"value"`
+		Fee        float32    `json:"fee,omitempty"`
+		Nonce      uint64     `json:"nonce,omitempty"`
+		Inputs     []OutPoint `json:"inputs,omitempty"`
+		Outputs    []TxOutput `json:"outputs,omitempty"`
+		Kind       TxKind     `json:"kind,omitempty"`
+		Evidence   string     `json:"evidence,omitempty"`
+		Data       string     `json:"data,omitempty"`
+		Gas        uint64     `json:"gas,omitempty"`
+		Asset      string     `json:"asset,omitempty"`
+		Amount     uint64     `json:"amount,omitempty"`
+		Symbol     string     `json:"symbol,omitempty"`
+		Decimals   uint8      `json:"decimals,omitempty"`
+		Authority  string     `json:"mint_authority,omitempty"`
+		Collection string     `json:"collection,omitempty"`
+		Token      string     `json:"token_id,omitempty"`
+		Metadata   string     `json:"metadata,omitempty"`
+	}{
+		Sender:     t.sender,
+		Recipient:  t.recipient,
+		Value:      t.value,
+		Fee:        t.fee,
+		Nonce:      t.nonce,
+		Inputs:     t.inputs,
+		Outputs:    t.outputs,
+		Kind:       t.kind,
+		Evidence:   evidence,
+		Data:       hex.EncodeToString(t.data),
+		Gas:        t.gas,
+		Asset:      t.asset,
+		Amount:     t.amount,
+		Symbol:     t.symbol,
+		Decimals:   t.decimals,
+		Authority:  t.mintAuthority,
+		Collection: t.collection,
+		Token:      t.token,
+		Metadata:   t.metadata,
+	})
+}
+
 func (t *Transaction) MarshalJSON() ([]byte, error) {
+	publicKeys := make([]string, len(t.publicKeys))
+	for i, pKey := range t.publicKeys {
+		publicKeys[i] = cryptography.GeneratePublicKeyString(pKey)
+	}
+	signatures := make([]string, len(t.signatures))
+	for i, s := range t.signatures {
+		signatures[i] = s.String()
+	}
+
 	return json.Marshal(struct {
-		Sender    string  `json:"sender_blockchain_address"`
-		Recipient string  `json:"recipient_blockchain_address"`
-		Value     float32 `json:"value"`
+		Kind       TxKind              `json:"kind,omitempty"`
+		Sender     string              `json:"sender_blockchain_address"`
+		Recipient  string              `json:"recipient_blockchain_address"`
+		Value      float32             `json:"value"`
+		Fee        float32             `json:"fee,omitempty"`
+		Nonce      uint64              `json:"nonce,omitempty"`
+		Coinbase   bool                `json:"coinbase,omitempty"`
+		Height     int                 `json:"height,omitempty"`
+		Inputs     []OutPoint          `json:"inputs,omitempty"`
+		Outputs    []TxOutput          `json:"outputs,omitempty"`
+		Evidence   *DoubleSignEvidence `json:"evidence,omitempty"`
+		Data       string              `json:"data,omitempty"`
+		Gas        uint64              `json:"gas,omitempty"`
+		Asset      string              `json:"asset,omitempty"`
+		Amount     uint64              `json:"amount,omitempty"`
+		Symbol     string              `json:"symbol,omitempty"`
+		Decimals   uint8               `json:"decimals,omitempty"`
+		Authority  string              `json:"mint_authority,omitempty"`
+		Collection string              `json:"collection,omitempty"`
+		Token      string              `json:"token_id,omitempty"`
+		Metadata   string              `json:"metadata,omitempty"`
+		Threshold  int                 `json:"threshold,omitempty"`
+		PublicKeys []string            `json:"sender_public_keys,omitempty"`
+		Signatures []string            `json:"signatures,omitempty"`
 	}{
-		Sender:    t.sender,
-		Recipient: t.recipient,
-		Value:     t.value,
+		Kind:       t.kind,
+		Sender:     t.sender,
+		Recipient:  t.recipient,
+		Value:      t.value,
+		Fee:        t.fee,
+		Nonce:      t.nonce,
+		Coinbase:   t.coinbase,
+		Height:     t.height,
+		Inputs:     t.inputs,
+		Outputs:    t.outputs,
+		Evidence:   t.evidence,
+		Data:       hex.EncodeToString(t.data),
+		Gas:        t.gas,
+		Asset:      t.asset,
+		Amount:     t.amount,
+		Symbol:     t.symbol,
+		Decimals:   t.decimals,
+		Authority:  t.mintAuthority,
+		Collection: t.collection,
+		Token:      t.token,
+		Metadata:   t.metadata,
+		Threshold:  t.threshold,
+		PublicKeys: publicKeys,
+		Signatures: signatures,
 	})
 }
 
 func (t *Transaction) UnmarshalJSON(b []byte) error {
+	var publicKeys, signatures []string
+	var data string
 	s := struct {
-		Sender    *string  `json:"sender_blockchain_address"`
-		Recipient *string  `json:"recipient_blockchain_address"`
-		Value     *float32 `json:"value"`
+		Kind       *TxKind              `json:"kind,omitempty"`
+		Sender     *string              `json:"sender_blockchain_address"`
+		Recipient  *string              `json:"recipient_blockchain_address"`
+		Value      *float32             `json:"value"`
+		Fee        *float32             `json:"fee,omitempty"`
+		Nonce      *uint64              `json:"nonce,omitempty"`
+		Coinbase   *bool                `json:"coinbase,omitempty"`
+		Height     *int                 `json:"height,omitempty"`
+		Inputs     *[]OutPoint          `json:"inputs,omitempty"`
+		Outputs    *[]TxOutput          `json:"outputs,omitempty"`
+		Evidence   **DoubleSignEvidence `json:"evidence,omitempty"`
+		Data       *string              `json:"data,omitempty"`
+		Gas        *uint64              `json:"gas,omitempty"`
+		Asset      *string              `json:"asset,omitempty"`
+		Amount     *uint64              `json:"amount,omitempty"`
+		Symbol     *string              `json:"symbol,omitempty"`
+		Decimals   *uint8               `json:"decimals,omitempty"`
+		Authority  *string              `json:"mint_authority,omitempty"`
+		Collection *string              `json:"collection,omitempty"`
+		Token      *string              `json:"token_id,omitempty"`
+		Metadata   *string              `json:"metadata,omitempty"`
+		Threshold  *int                 `json:"threshold,omitempty"`
+		PublicKeys *[]string            `json:"sender_public_keys,omitempty"`
+		Signatures *[]string            `json:"signatures,omitempty"`
 	}{
-		Sender:    &t.sender,
-		Recipient: &t.recipient,
-		Value:     &t.value,
+		Kind:       &t.kind,
+		Sender:     &t.sender,
+		Recipient:  &t.recipient,
+		Value:      &t.value,
+		Fee:        &t.fee,
+		Nonce:      &t.nonce,
+		Coinbase:   &t.coinbase,
+		Height:     &t.height,
+		Inputs:     &t.inputs,
+		Outputs:    &t.outputs,
+		Evidence:   &t.evidence,
+		Data:       &data,
+		Gas:        &t.gas,
+		Asset:      &t.asset,
+		Amount:     &t.amount,
+		Symbol:     &t.symbol,
+		Decimals:   &t.decimals,
+		Authority:  &t.mintAuthority,
+		Collection: &t.collection,
+		Token:      &t.token,
+		Metadata:   &t.metadata,
+		Threshold:  &t.threshold,
+		PublicKeys: &publicKeys,
+		Signatures: &signatures,
+	}
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
 	}
-	return json.Unmarshal(b, &s)
+	t.data = nil
+	if data != "" {
+		var err error
+		if t.data, err = hex.DecodeString(data); err != nil {
+			return fmt.Errorf("invalid data: %w", err)
+		}
+	}
+
+	t.publicKeys = nil
+	for _, k := range publicKeys {
+		pKey, err := cryptography.PublicKeyFromString(k)
+		if err != nil {
+			return err
+		}
+		t.publicKeys = append(t.publicKeys, pKey)
+	}
+	t.signatures = nil
+	for _, sign := range signatures {
+		if len(t.publicKeys) == 0 {
+			return fmt.Errorf("signature without a public key")
+		}
+		sig, err := cryptography.ParseSignature(sign, t.publicKeys[0].KeyType())
+		if err != nil {
+			return err
+		}
+		t.signatures = append(t.signatures, sig)
+	}
+	return nil
 }
 
 func (t *Transaction) Print() {
 	fmt.Printf("%s\n", strings.Repeat("-", 40))
+	if t.kind != TransferTx {
+		fmt.Printf(" kind                           %s\n", t.kind)
+	}
 	fmt.Printf(" sender_blockchain_address      %s\n", t.sender)
 	fmt.Printf(" recipient_blockchain_address   %s\n", t.recipient)
 	fmt.Printf(" value                          %.1f\n", t.value)
+	if t.coinbase {
+		fmt.Printf(" coinbase                       height %d\n", t.height)
+	}
+	for _, in := range t.inputs {
+		fmt.Printf(" input                          %s:%d\n", in.TxID, in.Index)
+	}
+	for _, out := range t.outputs {
+		fmt.Printf(" output                         %s %.1f\n", out.Address, out.Value)
+	}
+	if len(t.data) > 0 {
+		fmt.Printf(" data                           %d bytes, gas %d\n", len(t.data), t.gas)
+	}
+	if t.kind == IssueTx {
+		fmt.Printf(" asset                          %s %s, %d decimals\n", t.Asset(), t.symbol, t.decimals)
+	} else if t.asset != "" {
+		fmt.Printf(" asset                          %s\n", t.asset)
+	}
+	if t.amount > 0 {
+		fmt.Printf(" amount                         %d\n", t.amount)
+	}
+	if t.collection != "" {
+		fmt.Printf(" nft                            %s/%s %s\n", t.collection, t.token, t.metadata)
+	}
+	if t.fee > 0 {
+		fmt.Printf(" fee                            %f\n", t.fee)
+	}
+	if t.IsMultisig() {
+		fmt.Printf(" multisig                       %d of %d\n", t.threshold, len(t.publicKeys))
+	}
+}
+
+func (t *Transaction) copy() *Transaction {
+	c := NewSignedTransaction(t.sender, t.recipient, t.value, t.fee, t.nonce, t.threshold, t.publicKeys, t.signatures)
+	c.coinbase = t.coinbase
+	c.height = t.height
+	c.inputs = t.inputs
+	c.outputs = t.outputs
+	c.kind = t.kind
+	c.evidence = t.evidence
+	c.data = t.data
+	c.gas = t.gas
+	c.asset = t.asset
+	c.amount = t.amount
+	c.symbol = t.symbol
+	c.decimals = t.decimals
+	c.mintAuthority = t.mintAuthority
+	c.collection = t.collection
+	c.token = t.token
+	c.metadata = t.metadata
+	return c
 }
 
 type TransactionRequest struct {
-	SenderBlockchainAddress    *string  `json:"sender_blockchain_address"`
-	RecipientBlockchainAddress *string  `json:"recipient_blockchain_address"`
-	SenderPublicKey            *string  `json:"sender_public_key"`
-	Value                      *float32 `json:"value"`
-	Signature                  *string  `json:"signature"`
+	SenderBlockchainAddress    *string     `json:"sender_blockchain_address"`
+	RecipientBlockchainAddress *string     `json:"recipient_blockchain_address"`
+	SenderPublicKey            *string     `json:"sender_public_key,omitempty"`
+	Value                      *float32    `json:"value"`
+	Fee                        *float32    `json:"fee,omitempty"`
+	Nonce                      *uint64     `json:"nonce,omitempty"`
+	Inputs                     *[]OutPoint `json:"inputs,omitempty"`
+	Outputs                    *[]TxOutput `json:"outputs,omitempty"`
+	Signature                  *string     `json:"signature,omitempty"`
+	Threshold                  *int        `json:"threshold,omitempty"`
+	SenderPublicKeys           *[]string   `json:"sender_public_keys,omitempty"`
+	Signatures                 *[]string   `json:"signatures,omitempty"`
+	Asset                      *string     `json:"asset,omitempty"`
+	Amount                     *uint64     `json:"amount,omitempty"`
 }
 
 func (t *TransactionRequest) Print() {
 	fmt.Printf("%s\n", strings.Repeat("-", 40))
 	fmt.Printf(" sender_blockchain_address      %s\n", *t.SenderBlockchainAddress)
-	fmt.Printf(" recipient_blockchain_address   %s\n", *t.RecipientBlockchainAddress)
+	if t.IsUTXO() {
+		fmt.Printf(" inputs                         %d\n", len(*t.Inputs))
+		fmt.Printf(" outputs                        %d\n", len(*t.Outputs))
+	} else if t.IsAsset() {
+		fmt.Printf(" recipient_blockchain_address   %s\n", *t.RecipientBlockchainAddress)
+		fmt.Printf(" asset                          %s\n", *t.Asset)
+		fmt.Printf(" amount                         %d\n", *t.Amount)
+	} else {
+		fmt.Printf(" recipient_blockchain_address   %s\n", *t.RecipientBlockchainAddress)
+		fmt.Printf(" value                          %.1f\n", *t.Value)
+	}
+	if t.IsMultisig() {
+		fmt.Printf(" threshold                      %d\n", *t.Threshold)
+		fmt.Printf(" sender_public_keys             %s\n", strings.Join(*t.SenderPublicKeys, ","))
+		fmt.Printf(" signatures                     %s\n", strings.Join(*t.Signatures, ","))
+		return
+	}
 	fmt.Printf(" sender_public_key              %s\n", *t.SenderPublicKey)
-	fmt.Printf(" value                          %.1f\n", *t.Value)
 	fmt.Printf(" signature                      %s\n", *t.Signature)
 }
 
+// GetFee returns the fee of the request, transactions without one pay none.
+func (tr *TransactionRequest) GetFee() float32 {
+	if tr.Fee == nil {
+		return 0
+	}
+	return *tr.Fee
+}
+
+func (tr *TransactionRequest) GetNonce() uint64 {
+	if tr.Nonce == nil {
+		return 0
+	}
+	return *tr.Nonce
+}
+
+// IsUTXO reports whether the request spends outputs, it then has no
+// recipient or value of its own.
+func (tr *TransactionRequest) IsUTXO() bool {
+	return tr.Inputs != nil
+}
+
+// Signers returns the public keys and signatures of the request with its
+// threshold, which is zero for a single key.
+func (tr *TransactionRequest) Signers() ([]string, []string, int) {
+	if tr.IsMultisig() {
+		return *tr.SenderPublicKeys, *tr.Signatures, *tr.Threshold
+	}
+	return []string{*tr.SenderPublicKey}, []string{*tr.Signature}, 0
+}
+
+// IsAsset reports whether the request transfers Amount of Asset instead of
+// a value of the base coin.
+func (tr *TransactionRequest) IsAsset() bool {
+	return tr.Asset != nil
+}
+
+func (tr *TransactionRequest) IsMultisig() bool {
+	return tr.Threshold != nil
+}
+
 func (tr *TransactionRequest) Validate() bool {
-	return tr.RecipientBlockchainAddress != nil &&
-		tr.SenderBlockchainAddress != nil &&
-		tr.Value != nil && tr.Signature != nil &&
-		tr.SenderPublicKey != nil
+	if tr.SenderBlockchainAddress == nil {
+		return false
+	}
+	if tr.IsUTXO() {
+		if len(*tr.Inputs) == 0 || tr.Outputs == nil || len(*tr.Outputs) == 0 {
+			return false
+		}
+	} else if tr.IsAsset() {
+		if tr.RecipientBlockchainAddress == nil || tr.Amount == nil || tr.IsMultisig() {
+			return false
+		}
+	} else if tr.RecipientBlockchainAddress == nil || tr.Value == nil {
+		return false
+	}
+	if tr.GetFee() < 0 {
+		return false
+	}
+	if tr.IsMultisig() {
+		return tr.SenderPublicKeys != nil && tr.Signatures != nil &&
+			*tr.Threshold > 0 && len(*tr.SenderPublicKeys) >= *tr.Threshold
+	}
+	return tr.Signature != nil && tr.SenderPublicKey != nil
+}
+
+// StakingRequest stakes or unstakes Value of the sender, or reports the double
+// sign in Evidence, as Kind says.
+type StakingRequest struct {
+	Kind                    *string             `json:"kind"`
+	SenderBlockchainAddress *string             `json:"sender_blockchain_address"`
+	SenderPublicKey         *string             `json:"sender_public_key"`
+	Value                   *float32            `json:"value,omitempty"`
+	Fee                     *float32            `json:"fee,omitempty"`
+	Nonce                   *uint64             `json:"nonce,omitempty"`
+	Evidence                *DoubleSignEvidence `json:"evidence,omitempty"`
+	Signature               *string             `json:"signature"`
+}
+
+func (sr *StakingRequest) GetValue() float32 {
+	if sr.Value == nil {
+		return 0
+	}
+	return *sr.Value
+}
+
+func (sr *StakingRequest) GetFee() float32 {
+	if sr.Fee == nil {
+		return 0
+	}
+	return *sr.Fee
+}
+
+func (sr *StakingRequest) GetNonce() uint64 {
+	if sr.Nonce == nil {
+		return 0
+	}
+	return *sr.Nonce
+}
+
+func (sr *StakingRequest) Validate() bool {
+	if sr.Kind == nil || sr.SenderBlockchainAddress == nil || sr.SenderPublicKey == nil || sr.Signature == nil {
+		return false
+	}
+	if sr.GetFee() < 0 {
+		return false
+	}
+	if TxKind(*sr.Kind) == EvidenceTx {
+		return sr.Evidence != nil
+	}
+	return sr.Value != nil
+}
+
+// ContractRequest deploys a contract, or calls the one at Contract. The
+// address of a deployed contract follows from the sender and the nonce.
+type ContractRequest struct {
+	SenderBlockchainAddress *string  `json:"sender_blockchain_address"`
+	SenderPublicKey         *string  `json:"sender_public_key"`
+	Contract                *string  `json:"contract,omitempty"`
+	Data                    *string  `json:"data"`
+	Gas                     *uint64  `json:"gas"`
+	Fee                     *float32 `json:"fee,omitempty"`
+	Nonce                   *uint64  `json:"nonce,omitempty"`
+	Signature               *string  `json:"signature"`
+}
+
+func (cr *ContractRequest) GetFee() float32 {
+	if cr.Fee == nil {
+		return 0
+	}
+	return *cr.Fee
+}
+
+func (cr *ContractRequest) GetNonce() uint64 {
+	if cr.Nonce == nil {
+		return 0
+	}
+	return *cr.Nonce
+}
+
+func (cr *ContractRequest) Validate() bool {
+	if cr.SenderBlockchainAddress == nil || cr.SenderPublicKey == nil || cr.Data == nil || cr.Gas == nil || cr.Signature == nil {
+		return false
+	}
+	return cr.GetFee() >= 0
+}
+
+// AssetRequest issues an asset with Symbol, Decimals, Supply and an optional
+// MintAuthority, or mints Amount of the asset to Recipient.
+type AssetRequest struct {
+	SenderBlockchainAddress *string  `json:"sender_blockchain_address"`
+	SenderPublicKey         *string  `json:"sender_public_key"`
+	Symbol                  *string  `json:"symbol,omitempty"`
+	Decimals                *uint8   `json:"decimals,omitempty"`
+	Supply                  *uint64  `json:"supply,omitempty"`
+	MintAuthority           *string  `json:"mint_authority,omitempty"`
+	Recipient               *string  `json:"recipient_blockchain_address,omitempty"`
+	Amount                  *uint64  `json:"amount,omitempty"`
+	Fee                     *float32 `json:"fee,omitempty"`
+	Nonce                   *uint64  `json:"nonce,omitempty"`
+	Signature               *string  `json:"signature"`
+}
+
+func (ar *AssetRequest) GetFee() float32 {
+	if ar.Fee == nil {
+		return 0
+	}
+	return *ar.Fee
+}
+
+func (ar *AssetRequest) GetNonce() uint64 {
+	if ar.Nonce == nil {
+		return 0
+	}
+	return *ar.Nonce
+}
+
+func (ar *AssetRequest) GetDecimals() uint8 {
+	if ar.Decimals == nil {
+		return 0
+	}
+	return *ar.Decimals
+}
+
+func (ar *AssetRequest) GetSupply() uint64 {
+	if ar.Supply == nil {
+		return 0
+	}
+	return *ar.Supply
+}
+
+func (ar *AssetRequest) GetMintAuthority() string {
+	if ar.MintAuthority == nil {
+		return ""
+	}
+	return *ar.MintAuthority
+}
+
+// Validate checks the fields of an issue, or of a mint when mint is set.
+func (ar *AssetRequest) Validate(mint bool) bool {
+	if ar.SenderBlockchainAddress == nil || ar.SenderPublicKey == nil || ar.Signature == nil || ar.GetFee() < 0 {
+		return false
+	}
+	if mint {
+		return ar.Recipient != nil && ar.Amount != nil
+	}
+	return ar.Symbol != nil
+}
+
+// NFTRequest mints, transfers or burns the token TokenID of Collection, as
+// Kind says. Metadata is for a mint only, a burn has no recipient.
+type NFTRequest struct {
+	Kind                       *string  `json:"kind"`
+	SenderBlockchainAddress    *string  `json:"sender_blockchain_address"`
+	SenderPublicKey            *string  `json:"sender_public_key"`
+	RecipientBlockchainAddress *string  `json:"recipient_blockchain_address,omitempty"`
+	Collection                 *string  `json:"collection"`
+	TokenID                    *string  `json:"token_id"`
+	Metadata                   *string  `json:"metadata,omitempty"`
+	Fee                        *float32 `json:"fee,omitempty"`
+	Nonce                      *uint64  `json:"nonce,omitempty"`
+	Signature                  *string  `json:"signature"`
+}
+
+// GetRecipient is the recipient of the request, the sender for a burn.
+func (nr *NFTRequest) GetRecipient() string {
+	if nr.RecipientBlockchainAddress == nil {
+		return *nr.SenderBlockchainAddress
+	}
+	return *nr.RecipientBlockchainAddress
+}
+
+func (nr *NFTRequest) GetMetadata() string {
+	if nr.Metadata == nil {
+		return ""
+	}
+	return *nr.Metadata
+}
+
+func (nr *NFTRequest) GetFee() float32 {
+	if nr.Fee == nil {
+		return 0
+	}
+	return *nr.Fee
+}
+
+func (nr *NFTRequest) GetNonce() uint64 {
+	if nr.Nonce == nil {
+		return 0
+	}
+	return *nr.Nonce
+}
+
+func (nr *NFTRequest) Validate() bool {
+	if nr.Kind == nil || nr.SenderBlockchainAddress == nil || nr.SenderPublicKey == nil || nr.Signature == nil {
+		return false
+	}
+	return nr.Collection != nil && nr.TokenID != nil && nr.GetFee() >= 0
 }
 
 type TransactionResponse struct {
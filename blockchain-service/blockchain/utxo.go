@@ -0,0 +1,162 @@
+package blockchain
+
+import (
+	"fmt"
+	"sort"
+)
+
+// OutPoint references output Index of the transaction TxID.
+type OutPoint struct {
+	TxID  string `json:"txid"`
+	Index int    `json:"index"`
+}
+
+// TxOutput locks Value to Address. Only a transaction signed for Address can
+// spend it.
+type TxOutput struct {
+	Address string  `json:"address"`
+	Value   float32 `json:"value"`
+}
+
+// UTXO is an unspent transaction output together with where it was created.
+type UTXO struct {
+	OutPoint
+	TxOutput
+	Height   int  `json:"height"`
+	Coinbase bool `json:"coinbase,omitempty"`
+}
+
+// UTXOSet indexes the unspent outputs of a chain by outpoint and by address.
+// Connecting a block records the outputs it spends so the block can be
+// disconnected again on a reorg.
+type UTXOSet struct {
+	utxos     map[OutPoint]*UTXO
+	byAddress map[string]map[OutPoint]*UTXO
+	undo      map[[32]byte][]*UTXO
+}
+
+func NewUTXOSet() *UTXOSet {
+	return &UTXOSet{
+		utxos:     make(map[OutPoint]*UTXO),
+		byAddress: make(map[string]map[OutPoint]*UTXO),
+		undo:      make(map[[32]byte][]*UTXO),
+	}
+}
+
+func (s *UTXOSet) Get(op OutPoint) (*UTXO, bool) {
+	u, ok := s.utxos[op]
+	return u, ok
+}
+
+func (s *UTXOSet) Len() int {
+	return len(s.utxos)
+}
+
+// ByAddress returns the outputs locked to address, oldest first.
+func (s *UTXOSet) ByAddress(address string) []*UTXO {
+	utxos := make([]*UTXO, 0, len(s.byAddress[address]))
+	for _, u := range s.byAddress[address] {
+		utxos = append(utxos, u)
+	}
+	sort.Slice(utxos, func(i, j int) bool {
+		if utxos[i].Height != utxos[j].Height {
+			return utxos[i].Height < utxos[j].Height
+		}
+		if utxos[i].TxID != utxos[j].TxID {
+			return utxos[i].TxID < utxos[j].TxID
+		}
+		return utxos[i].Index < utxos[j].Index
+	})
+	return utxos
+}
+
+func (s *UTXOSet) Balance(address string) float32 {
+	var balance float32
+	for _, u := range s.byAddress[address] {
+		balance += u.Value
+	}
+	return balance
+}
+
+// Connect spends the inputs of the transactions of b and adds their outputs.
+// The block must have been validated against the set.
+func (s *UTXOSet) Connect(b *Block, height int) error {
+	hash, err := b.Hash()
+	if err != nil {
+		return err
+	}
+
+	// Check every input before touching the set so a bad block leaves it
+	// as it was.
+	var spent []*UTXO
+	seen := make(map[OutPoint]bool)
+	for _, t := range b.GetTransactions() {
+		for _, in := range t.inputs {
+			u, ok := s.utxos[in]
+			if !ok || seen[in] {
+				return fmt.Errorf("%w: %s:%d", ErrDoubleSpend, in.TxID, in.Index)
+			}
+			seen[in] = true
+			spent = append(spent, u)
+		}
+	}
+
+	for _, u := range spent {
+		s.remove(u)
+	}
+	for _, t := range b.GetTransactions() {
+		id := t.ID()
+		for i, out := range t.Outputs() {
+			s.add(&UTXO{
+				OutPoint: OutPoint{TxID: id, Index: i},
+				TxOutput: out,
+				Height:   height,
+				Coinbase: t.coinbase,
+			})
+		}
+	}
+	s.undo[hash] = spent
+	return nil
+}
+
+// Disconnect reverts Connect for the tip block b.
+func (s *UTXOSet) Disconnect(b *Block) error {
+	hash, err := b.Hash()
+	if err != nil {
+		return err
+	}
+	spent, ok := s.undo[hash]
+	if !ok {
+		return fmt.Errorf("block %x is not connected", hash)
+	}
+
+	for _, t := range b.GetTransactions() {
+		id := t.ID()
+		for i := range t.Outputs() {
+			if u, ok := s.utxos[OutPoint{TxID: id, Index: i}]; ok {
+				s.remove(u)
+			}
+		}
+	}
+	for _, u := range spent {
+		s.add(u)
+	}
+	delete(s.undo, hash)
+	return nil
+}
+
+func (s *UTXOSet) add(u *UTXO) {
+	s.utxos[u.OutPoint] = u
+	if s.byAddress[u.Address] == nil {
+		s.byAddress[u.Address] = make(map[OutPoint]*UTXO)
+	}
+	s.byAddress[u.Address][u.OutPoint] = u
+}
+
+func (s *UTXOSet) remove(u *UTXO) {
+	delete(s.utxos, u.OutPoint)
+	delete(s.byAddress[u.Address], u.OutPoint)
+	if len(s.byAddress[u.Address]) == 0 {
+		delete(s.byAddress, u.Address)
+	}
+}
@@ -0,0 +1,303 @@
+package blockchain
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// medianTimeSpan is the number of blocks the median time past is taken over.
+const medianTimeSpan = 11
+
+// validateBlock checks b as the block at height len(chain) on top of chain:
+// its checkpoint and timestamp, the coinbase, the transactions against the
+// funds, nonces, stakes, assets and nfts of their senders, the block limits,
+// the state root and the seal. On a UTXO ledger utxos holds the outputs chain
+// leaves unspent. state is the account state after chain, the state after b
+// is returned. The signatures of an assumed valid block are not checked.
+func (bc *Blockchain) validateBlock(b *Block, chain []*Block, utxos *UTXOSet, state *StateTree, assumed bool) (*StateTree, error) {
+	height := len(chain)
+	if err := bc.checkCheckpoint(height, b.Header().Hash()); err != nil {
+		return nil, err
+	}
+	if err := bc.checkTimestamp(b, chain); err != nil {
+		return nil, err
+	}
+	trs := b.GetTransactions()
+	if len(trs) == 0 || !trs[0].coinbase {
+		return nil, fmt.Errorf("block %d does not start with a coinbase transaction", height)
+	}
+	coinbase := trs[0]
+	if coinbase.height != height {
+		return nil, fmt.Errorf("coinbase of block %d claims height %d", height, coinbase.height)
+	}
+	if err := checkCoinbase(coinbase); err != nil {
+		return nil, err
+	}
+
+	var fees float32
+	size := 0
+	spent := make(map[string]float32)
+	spentOutputs := make(map[OutPoint]bool)
+	unstaked := make(map[string]float32)
+	slashed := make(map[string]bool)
+	nonces := make(map[string]uint64)
+	assets := newAssetUse()
+	nfts := newNFTUse()
+	for _, t := range trs[1:] {
+		if err := bc.checkTransaction(t, !assumed); err != nil {
+			return nil, err
+		}
+		if utxos != nil {
+			if err := bc.checkInputs(t, utxos, height, spentOutputs); err != nil {
+				return nil, err
+			}
+		} else {
+			if err := checkNonce(t, state, nonces); err != nil {
+				return nil, err
+			}
+			if err := bc.checkStake(t, chain, state, unstaked, slashed); err != nil {
+				return nil, err
+			}
+			if err := bc.checkAsset(t, state, assets); err != nil {
+				return nil, err
+			}
+			if err := bc.checkNFT(t, state, nfts); err != nil {
+				return nil, err
+			}
+			spent[t.sender] += t.cost()
+		}
+		fees += t.fee
+		size += t.Size()
+	}
+	if len(trs)-1 > bc.params.MaxBlockTransactions || size > bc.params.MaxBlockSize {
+		return nil, fmt.Errorf("block with %d transactions of %d bytes exceeds the block limits", len(trs)-1, size)
+	}
+
+	if limit := bc.params.Subsidy(height) + fees; coinbase.value > limit {
+		return nil, fmt.Errorf("coinbase pays %f, expected at most %f", coinbase.value, limit)
+	}
+
+	for sender, amount := range spent {
+		if available := bc.spendableBalance(chain, state, sender); amount > available {
+			return nil, fmt.Errorf("%w: %s spends %f of %f", ErrInsufficientFunds, sender, amount, available)
+		}
+	}
+
+	next := state.Copy()
+	if err := next.apply(trs, utxos); err != nil {
+		return nil, err
+	}
+	if root := next.Root(); root != b.GetStateRoot() {
+		return nil, fmt.Errorf("block %d commits to state root %x, expected %x", height, b.GetStateRoot(), root)
+	}
+
+	if err := bc.consensus.VerifySeal(chainState{blockHeaders(chain), state}, b.Header()); err != nil {
+		return nil, err
+	}
+	return next, nil
+}
+
+// checkCheckpoint makes sure the block at height has the hash of the
+// checkpoint there, if there is one.
+func (bc *Blockchain) checkCheckpoint(height int, hash [32]byte) error {
+	if want, ok := bc.params.Checkpoints[height]; ok && want != hash {
+		return fmt.Errorf("%w: block %d is %x, expected %x", ErrCheckpoint, height, hash, want)
+	}
+	return nil
+}
+
+// assumeValidHeight is the height of the AssumeValid block in chain, or -1
+// when chain does not include it. The blocks up to it are assumed valid.
+func (bc *Blockchain) assumeValidHeight(chain []*Block) int {
+	if bc.params.AssumeValid == ([32]byte{}) {
+		return -1
+	}
+	for height := len(chain) - 1; height >= 0; height-- {
+		if chain[height].Header().Hash() == bc.params.AssumeValid {
+			return height
+		}
+	}
+	return -1
+}
+
+// checkTimestamp makes sure b is later than the median time past of chain and
+// at most MaxTimeDrift ahead of the clock.
+func (bc *Blockchain) checkTimestamp(b *Block, chain []*Block) error {
+	if mtp := medianTimePast(chain); b.GetTimestamp() <= mtp {
+		return fmt.Errorf("%w: %d <= %d", ErrTimeTooOld, b.GetTimestamp(), mtp)
+	}
+	if limit := bc.clock().Add(bc.params.MaxTimeDrift).UnixNano(); b.GetTimestamp() > limit {
+		return fmt.Errorf("%w: %s", ErrTimeTooNew, time.Unix(0, b.GetTimestamp()).UTC())
+	}
+	return nil
+}
+
+// medianTimePast is the median timestamp of the last medianTimeSpan blocks of
+// chain.
+func medianTimePast(chain []*Block) int64 {
+	start := len(chain) - medianTimeSpan
+	if start < 0 {
+		start = 0
+	}
+	ts := make([]int64, 0, medianTimeSpan)
+	for _, b := range chain[start:] {
+		ts = append(ts, b.GetTimestamp())
+	}
+	if len(ts) == 0 {
+		return 0
+	}
+	sort.Slice(ts, func(i, j int) bool { return ts[i] < ts[j] })
+	return ts[len(ts)/2]
+}
+
+// checkFunds makes sure t takes the next nonce of its sender and that the
+// sender can pay for it, unstake it and move its asset or nft on top of its
+// pending transactions, leaving out the one t replaces.
+func (bc *Blockchain) checkFunds(t *Transaction) error {
+	if bc.utxos != nil {
+		spent := make(map[OutPoint]bool)
+		for _, pending := range bc.pendingTransactions() {
+			for _, op := range pending.inputs {
+				spent[op] = true
+			}
+		}
+		return bc.checkInputs(t, bc.utxos, len(bc.chain), spent)
+	}
+
+	amount := t.cost()
+	unstaked := make(map[string]float32)
+	assets := newAssetUse()
+	nfts := newNFTUse()
+	replaces := false
+	for _, tx := range bc.mempool.BySender(t.sender) {
+		if t.nonce != 0 && tx.Nonce() == t.nonce {
+			replaces = true
+			continue
+		}
+		pending := tx.(*Transaction)
+		amount += pending.cost()
+		if pending.kind == UnstakeTx {
+			unstaked[pending.sender] += pending.value
+		}
+		// A pending transaction that no longer passes is left to the block
+		// template, it does not count against t.
+		bc.checkAsset(pending, bc.state, assets)
+		bc.checkNFT(pending, bc.state, nfts)
+	}
+
+	next := bc.nextNonce(t.sender)
+	if t.nonce <= bc.state.Account(t.sender).Nonce || !replaces && t.nonce != next {
+		return fmt.Errorf("%w: %s sends nonce %d, expected %d", ErrInvalidNonce, t.sender, t.nonce, next)
+	}
+	if err := bc.checkStake(t, bc.chain, bc.state, unstaked, make(map[string]bool)); err != nil {
+		return err
+	}
+	if err := bc.checkAsset(t, bc.state, assets); err != nil {
+		return err
+	}
+	if err := bc.checkNFT(t, bc.state, nfts); err != nil {
+		return err
+	}
+	if available := bc.spendableBalance(bc.chain, bc.state, t.sender); amount > available {
+		return fmt.Errorf("%w: %s needs %f of %f", ErrInsufficientFunds, t.sender, amount, available)
+	}
+	return nil
+}
+
+// checkCoinbase makes sure t only pays its value to its recipient. It is a
+// plain transfer, spends no inputs, names no outputs and carries none of the
+// fields of an asset, nft, contract or evidence transaction. Only the genesis
+// block, which is compared by hash instead, locks stakes with its coinbases.
+func checkCoinbase(t *Transaction) error {
+	switch {
+	case t.kind != TransferTx:
+		return fmt.Errorf("%w: kind %s", ErrInvalidCoinbase, t.kind)
+	case t.value < 0:
+		return fmt.Errorf("%w: negative value %f", ErrInvalidCoinbase, t.value)
+	case len(t.inputs) > 0 || len(t.outputs) > 0:
+		return fmt.Errorf("%w: inputs or outputs", ErrInvalidCoinbase)
+	case t.asset != "" || t.amount != 0 || t.symbol != "" || t.decimals != 0 || t.mintAuthority != "":
+		return fmt.Errorf("%w: asset fields", ErrInvalidCoinbase)
+	case t.collection != "" || t.token != "" || t.metadata != "":
+		return fmt.Errorf("%w: nft fields", ErrInvalidCoinbase)
+	case len(t.data) > 0 || t.gas != 0:
+		return fmt.Errorf("%w: contract fields", ErrInvalidCoinbase)
+	case t.evidence != nil:
+		return fmt.Errorf("%w: evidence", ErrInvalidCoinbase)
+	}
+	return nil
+}
+
+// checkNonce makes sure t takes the nonce after that of its sender in state
+// and of the transactions of the sender before it, counted in next.
+func checkNonce(t *Transaction, state *StateTree, next map[string]uint64) error {
+	want, ok := next[t.sender]
+	if !ok {
+		want = state.Account(t.sender).Nonce + 1
+	}
+	if t.nonce != want {
+		return fmt.Errorf("%w: %s sends nonce %d, expected %d", ErrInvalidNonce, t.sender, t.nonce, want)
+	}
+	next[t.sender] = want + 1
+	return nil
+}
+
+// spendableBalance is the balance of address in state, the state after
+// chain, leaving out coinbase rewards that are less than CoinbaseMaturity
+// blocks deep. Only the coinbases of those last blocks are looked at.
+func (bc *Blockchain) spendableBalance(chain []*Block, state *StateTree, address string) float32 {
+	balance := state.Account(address).Balance
+	height := len(chain)
+	from := height - bc.params.CoinbaseMaturity
+	if from < 1 {
+		from = 1
+	}
+	for h := from; h < height; h++ {
+		coinbase := chain[h].GetTransactions()[0]
+		if coinbase.recipient == address && bc.immature(coinbase.height, height) {
+			balance -= coinbase.value
+		}
+	}
+	return balance
+}
+
+// checkInputs makes sure the inputs of t are outputs of its sender that are
+// unspent in utxos, not in spent and mature at height, and that they cover the
+// outputs and the fee. On success the inputs are added to spent.
+func (bc *Blockchain) checkInputs(t *Transaction, utxos *UTXOSet, height int, spent map[OutPoint]bool) error {
+	var in float32
+	for _, op := range t.inputs {
+		u, ok := utxos.Get(op)
+		if !ok || spent[op] {
+			return fmt.Errorf("%w: %s:%d", ErrDoubleSpend, op.TxID, op.Index)
+		}
+		if u.Address != t.sender {
+			return fmt.Errorf("%w: output %s:%d is locked to %s", ErrInvalidSignature, op.TxID, op.Index, u.Address)
+		}
+		if u.Coinbase && bc.immature(u.Height, height) {
+			return fmt.Errorf("%w: coinbase output %s:%d is immature", ErrInsufficientFunds, op.TxID, op.Index)
+		}
+		in += u.Value
+	}
+
+	var out float32
+	for _, o := range t.outputs {
+		out += o.Value
+	}
+	if out+t.fee > in {
+		return fmt.Errorf("%w: outputs and fee of %f exceed the inputs of %f", ErrInsufficientFunds, out+t.fee, in)
+	}
+
+	for _, op := range t.inputs {
+		spent[op] = true
+	}
+	return nil
+}
+
+// immature reports whether a coinbase of the block at coinbaseHeight can not be
+// spent yet at height. The allocations of the genesis block are spendable
+// right away.
+func (bc *Blockchain) immature(coinbaseHeight, height int) bool {
+	return coinbaseHeight > 0 && height-coinbaseHeight < bc.params.CoinbaseMaturity
+}
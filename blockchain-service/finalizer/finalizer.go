@@ -0,0 +1,49 @@
+package finalizer
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// finalizingNode casts the finality votes of the node and sends them to its
+// neighbors.
+type finalizingNode interface {
+	Finalize() (int, error)
+}
+
+// finalizer makes a finality validator vote on a timer. Votes from the peers
+// also make it vote, the timer moves the rounds that time out along.
+type finalizer struct {
+	tickerTime time.Duration
+	finalizingNode
+	final int
+}
+
+func New(d time.Duration, n finalizingNode) finalizer {
+	return finalizer{
+		tickerTime:     d,
+		finalizingNode: n,
+	}
+}
+
+func (f *finalizer) Start(ctx context.Context) {
+	t := time.NewTicker(f.tickerTime)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			final, err := f.Finalize()
+			if err != nil {
+				log.Printf("failed to vote for finality with err: %s", err)
+				continue
+			}
+			if final > f.final {
+				log.Printf("finalized block %d", final)
+				f.final = final
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,331 @@
+package lightclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"blockchain/blockchain-service/blockchain"
+	"blockchain/blockchain-service/network-params"
+)
+
+var (
+	ErrNoPeers    = errors.New("no peer could be reached")
+	ErrUnverified = errors.New("no peer returned a valid proof")
+)
+
+// Client is an SPV light client. It keeps only the block headers, checking
+// their links and consensus seals, and takes balances and transactions from
+// peers only with a proof against those headers, so no single peer has to be
+// trusted.
+type Client struct {
+	params    *network_params.Params
+	consensus blockchain.Consensus
+	peers     []string
+	client    *http.Client
+
+	// genesis is the hash of the header every chain must start with.
+	genesis [32]byte
+
+	mux     sync.RWMutex
+	headers []*blockchain.BlockHeader
+}
+
+func New(params *network_params.Params, peers []string) (*Client, error) {
+	consensus, err := blockchain.NewConsensus(params)
+	if err != nil {
+		return nil, err
+	}
+	// The validator of a proof of stake block is drawn from the account
+	// state, headers alone can not tell whether it was the one drawn.
+	if _, ok := consensus.(*blockchain.ProofOfStake); ok {
+		return nil, errors.New("light clients can not follow proof of stake")
+	}
+	genesis, err := blockchain.GenesisHeader(params)
+	if err != nil {
+		return nil, err
+	}
+	ps := make([]string, len(peers))
+	for i, p := range peers {
+		ps[i] = strings.TrimSuffix(p, "/")
+	}
+	return &Client{
+		params:    params,
+		consensus: consensus,
+		peers:     ps,
+		client:    &http.Client{Timeout: 10 * time.Second},
+		genesis:   genesis.Hash(),
+		headers:   []*blockchain.BlockHeader{genesis},
+	}, nil
+}
+
+// Height is the height of the last synced header.
+func (c *Client) Height() int {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	return len(c.headers) - 1
+}
+
+func (c *Client) Header(height int) (*blockchain.BlockHeader, bool) {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	if height < 0 || height >= len(c.headers) {
+		return nil, false
+	}
+	return c.headers[height], true
+}
+
+// Start syncs the headers every interval until ctx is done.
+func (c *Client) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := c.Sync(); err != nil {
+			log.Printf("Failed to sync headers with err: %s", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync asks every peer for the headers past the local tip and adopts the
+// longest valid chain. A peer on another branch is asked for its whole chain.
+func (c *Client) Sync() error {
+	var lastErr error
+	reached := false
+	for _, peer := range c.peers {
+		if err := c.syncPeer(peer); err != nil {
+			log.Printf("Failed to sync headers from %s with err: %s", peer, err)
+			lastErr = err
+			continue
+		}
+		reached = true
+	}
+	if !reached && lastErr != nil {
+		return fmt.Errorf("%w: %s", ErrNoPeers, lastErr)
+	}
+	return nil
+}
+
+func (c *Client) syncPeer(peer string) error {
+	c.mux.RLock()
+	local := c.headers
+	c.mux.RUnlock()
+
+	tip := len(local) - 1
+	headers, err := c.fetchHeaders(peer, tip)
+	if err != nil {
+		return err
+	}
+	if len(headers) == 0 {
+		// The peer is behind.
+		return nil
+	}
+
+	var candidate []*blockchain.BlockHeader
+	if headers[0].Hash() == local[tip].Hash() {
+		candidate = append(append(candidate, local[:tip]...), headers...)
+	} else {
+		if headers, err = c.fetchHeaders(peer, 0); err != nil {
+			return err
+		}
+		candidate = headers
+	}
+	if err := c.validHeaders(candidate); err != nil {
+		return fmt.Errorf("invalid headers from %s: %w", peer, err)
+	}
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if len(candidate) > len(c.headers) {
+		c.headers = candidate
+	}
+	return nil
+}
+
+// validHeaders checks that headers start at the genesis of the network, link
+// to each other and carry a valid consensus seal.
+func (c *Client) validHeaders(headers []*blockchain.BlockHeader) error {
+	if len(headers) == 0 || headers[0].Hash() != c.genesis {
+		return errors.New("chain does not start at the genesis block")
+	}
+	for i := 1; i < len(headers); i++ {
+		if headers[i].PreviousHash != headers[i-1].Hash() {
+			return fmt.Errorf("header %d does not link to the header before it", i)
+		}
+		if err := c.consensus.VerifySeal(blockchain.Headers(headers[:i]), headers[i]); err != nil {
+			return fmt.Errorf("header %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// VerifyTransaction returns a proof, checked against the synced headers, that
+// the transaction id is in a block.
+func (c *Client) VerifyTransaction(id string) (*blockchain.MerkleProof, error) {
+	for _, peer := range c.peers {
+		var proof blockchain.MerkleProof
+		if err := c.get(peer, "/transactions/"+url.PathEscape(id)+"/proof", nil, &proof); err != nil {
+			log.Printf("Failed to get transaction proof from %s with err: %s", peer, err)
+			continue
+		}
+		header, ok := c.Header(proof.Height)
+		if !ok || proof.TxID != id || header.Hash() != proof.BlockHash || !proof.Verify(header.MerkleRoot) {
+			log.Printf("Peer %s returned an invalid proof for transaction %s", peer, id)
+			continue
+		}
+		return &proof, nil
+	}
+	return nil, ErrUnverified
+}
+
+// BalanceProof returns the account of address with a proof against the state
+// root of the synced tip.
+func (c *Client) BalanceProof(address string) (*blockchain.BalanceProof, error) {
+	c.mux.RLock()
+	height := len(c.headers) - 1
+	tip := c.headers[height]
+	c.mux.RUnlock()
+
+	q := url.Values{}
+	q.Set("bc_address", address)
+	q.Set("height", fmt.Sprint(height))
+	for _, peer := range c.peers {
+		var proof blockchain.BalanceProof
+		if err := c.get(peer, "/balance/proof", q, &proof); err != nil {
+			log.Printf("Failed to get balance proof from %s with err: %s", peer, err)
+			continue
+		}
+		if proof.Address != address || proof.Height != height || !proof.Verify(tip.StateRoot) {
+			log.Printf("Peer %s returned an invalid balance proof for %s", peer, address)
+			continue
+		}
+		return &proof, nil
+	}
+	return nil, ErrUnverified
+}
+
+func (c *Client) Balance(address string) (float32, error) {
+	p, err := c.BalanceProof(address)
+	if err != nil {
+		return 0, err
+	}
+	return p.Balance, nil
+}
+
+// NextNonce returns the nonce after the mined transactions of address, as
+// proven against the synced tip. Pending transactions are not counted, so the
+// next transaction replaces a pending one.
+func (c *Client) NextNonce(address string) (uint64, error) {
+	p, err := c.BalanceProof(address)
+	if err != nil {
+		return 0, err
+	}
+	return p.Nonce + 1, nil
+}
+
+// Assets returns the assets address holds, each checked against a proof of
+// the account of the asset too.
+func (c *Client) Assets(address string) ([]blockchain.AssetBalance, error) {
+	p, err := c.BalanceProof(address)
+	if err != nil {
+		return nil, err
+	}
+	var balances []blockchain.AssetBalance
+	for id, balance := range p.Assets {
+		record, err := c.BalanceProof(id)
+		if err != nil {
+			return nil, err
+		}
+		if record.Asset == nil {
+			return nil, fmt.Errorf("%w: %s", blockchain.ErrAssetNotFound, id)
+		}
+		balances = append(balances, blockchain.AssetBalance{
+			Asset:    id,
+			Symbol:   record.Asset.Symbol,
+			Decimals: record.Asset.Decimals,
+			Balance:  balance,
+		})
+	}
+	sort.Slice(balances, func(i, j int) bool { return balances[i].Symbol < balances[j].Symbol })
+	return balances, nil
+}
+
+// SendTransaction broadcasts tr to every peer. It fails only when no peer
+// accepted it.
+func (c *Client) SendTransaction(tr *blockchain.TransactionRequest) error {
+	body, err := json.Marshal(tr)
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	accepted := false
+	for _, peer := range c.peers {
+		resp, err := c.client.Post(peer+"/transactions", "application/json", bytes.NewBuffer(body))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			lastErr = responseError(resp)
+		} else {
+			accepted = true
+		}
+		resp.Body.Close()
+	}
+	if !accepted {
+		if lastErr == nil {
+			lastErr = ErrNoPeers
+		}
+		return lastErr
+	}
+	return nil
+}
+
+func (c *Client) fetchHeaders(peer string, from int) ([]*blockchain.BlockHeader, error) {
+	q := url.Values{}
+	q.Set("from", fmt.Sprint(from))
+	var res struct {
+		Headers []*blockchain.BlockHeader `json:"headers"`
+	}
+	if err := c.get(peer, "/headers", q, &res); err != nil {
+		return nil, err
+	}
+	return res.Headers, nil
+}
+
+func (c *Client) get(peer, path string, q url.Values, v interface{}) error {
+	u := peer + path
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	resp, err := c.client.Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func responseError(resp *http.Response) error {
+	b, _ := io.ReadAll(resp.Body)
+	return fmt.Errorf("request failed - status: %s, body: %s", resp.Status, strings.TrimSpace(string(b)))
+}
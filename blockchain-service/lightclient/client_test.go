@@ -0,0 +1,185 @@
+package lightclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"blockchain/blockchain-service/blockchain"
+	"blockchain/blockchain-service/network-params"
+	"blockchain/blockchain-service/wallet"
+	"blockchain/foundation/cryptography"
+)
+
+// peer serves the endpoints a light client uses from bc. lie, if set, may
+// change a balance proof before it is sent.
+func peer(t *testing.T, bc *blockchain.Blockchain, lie func(p *blockchain.BalanceProof)) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/headers", func(w http.ResponseWriter, r *http.Request) {
+		from, _ := strconv.Atoi(r.URL.Query().Get("from"))
+		json.NewEncoder(w).Encode(struct {
+			Headers []*blockchain.BlockHeader `json:"headers"`
+		}{
+			Headers: bc.Headers(from),
+		})
+	})
+	mux.HandleFunc("/transactions/", func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/transactions/"), "/proof")
+		proof, err := bc.TransactionProof(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(proof)
+	})
+	mux.HandleFunc("/balance/proof", func(w http.ResponseWriter, r *http.Request) {
+		height, _ := strconv.Atoi(r.URL.Query().Get("height"))
+		proof, err := bc.BalanceProof(r.URL.Query().Get("bc_address"), height)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if lie != nil {
+			lie(proof)
+		}
+		json.NewEncoder(w).Encode(proof)
+	})
+	s := httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func mine(t *testing.T, bc *blockchain.Blockchain, address string) {
+	template, err := bc.BlockTemplateFor(address)
+	if err != nil {
+		t.Fatalf("Failed to get BlockTemplate with err: %s", err)
+	}
+	b, _, err := template.Solve(context.Background(), blockchain.NewMiningEngine(0))
+	if err != nil {
+		t.Fatalf("Failed to Solve with err: %s", err)
+	}
+	if err := bc.SubmitBlock(b); err != nil {
+		t.Fatalf("Failed to SubmitBlock with err: %s", err)
+	}
+}
+
+func newChain(t *testing.T, params *network_params.Params) (*blockchain.Blockchain, *wallet.Wallet) {
+	w, err := wallet.NewWallet(cryptography.P256, params.GenerateBlockchainAddress)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a wallet with err: %s", err)
+	}
+	bc, err := blockchain.NewBlockchain(w.BlockchainAddress(), params)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a blockchain with err: %s", err)
+	}
+	return bc, w
+}
+
+func Test_Client(t *testing.T) {
+	params := network_params.RegTest
+	bc, niko := newChain(t, params)
+	mine(t, bc, niko.BlockchainAddress())
+	mine(t, bc, niko.BlockchainAddress())
+
+	liar := peer(t, bc, func(p *blockchain.BalanceProof) { p.Balance *= 2 })
+	honest := peer(t, bc, nil)
+	c, err := New(params, []string{liar.URL, honest.URL})
+	if err != nil {
+		t.Fatalf("Failed to instantiate a light client with err: %s", err)
+	}
+	if err := c.Sync(); err != nil {
+		t.Fatalf("Failed to Sync with err: %s", err)
+	}
+	if c.Height() != 2 {
+		t.Fatalf("Expected height 2, got %d", c.Height())
+	}
+
+	balance, err := c.Balance(niko.BlockchainAddress())
+	if err != nil {
+		t.Fatalf("Failed to get Balance with err: %s", err)
+	}
+	if want := bc.CalculateBalance(niko.BlockchainAddress()); balance != want {
+		t.Errorf("Expected balance %f, got %f", want, balance)
+	}
+	if nonce, err := c.NextNonce(niko.BlockchainAddress()); err != nil || nonce != bc.NextNonce(niko.BlockchainAddress()) {
+		t.Errorf("Expected next nonce %d, got %d with err: %v", bc.NextNonce(niko.BlockchainAddress()), nonce, err)
+	}
+	lied, err := New(params, []string{liar.URL})
+	if err != nil {
+		t.Fatalf("Failed to instantiate a light client with err: %s", err)
+	}
+	if err := lied.Sync(); err != nil {
+		t.Fatalf("Failed to Sync with err: %s", err)
+	}
+	if _, err := lied.Balance(niko.BlockchainAddress()); !errors.Is(err, ErrUnverified) {
+		t.Errorf("Expected a lying peer to be caught, got: %v", err)
+	}
+
+	id := bc.Chain()[2].GetTransactions()[0].ID()
+	proof, err := c.VerifyTransaction(id)
+	if err != nil {
+		t.Fatalf("Failed to VerifyTransaction with err: %s", err)
+	}
+	if proof.Height != 2 {
+		t.Errorf("Expected the transaction at height 2, got %d", proof.Height)
+	}
+	if _, err := c.VerifyTransaction("missing"); !errors.Is(err, ErrUnverified) {
+		t.Errorf("Expected ErrUnverified, got: %v", err)
+	}
+}
+
+func Test_ClientFollowsLongestChain(t *testing.T) {
+	params := network_params.RegTest
+	short, niko := newChain(t, params)
+	mine(t, short, niko.BlockchainAddress())
+	long, itay := newChain(t, params)
+	for i := 0; i < 3; i++ {
+		mine(t, long, itay.BlockchainAddress())
+	}
+
+	c, err := New(params, []string{peer(t, short, nil).URL})
+	if err != nil {
+		t.Fatalf("Failed to instantiate a light client with err: %s", err)
+	}
+	if err := c.Sync(); err != nil || c.Height() != 1 {
+		t.Fatalf("Expected height 1, got %d with err: %v", c.Height(), err)
+	}
+	c.peers = append(c.peers, peer(t, long, nil).URL)
+	if err := c.Sync(); err != nil || c.Height() != 3 {
+		t.Fatalf("Expected the longer branch at height 3, got %d with err: %v", c.Height(), err)
+	}
+	tip, _ := c.Header(3)
+	if tip.Hash() != long.Headers(3)[0].Hash() {
+		t.Errorf("Expected the tip of the longer branch")
+	}
+
+	// Headers without proof of work are not followed however many there are.
+	forged := append([]*blockchain.BlockHeader{}, c.headers...)
+	header := &blockchain.BlockHeader{PreviousHash: tip.Hash()}
+	for header.Meets(params.MinDifficulty) {
+		header.Nonce++
+	}
+	forged = append(forged, header)
+	if err := c.validHeaders(forged); err == nil {
+		t.Errorf("Expected headers without proof of work to be rejected")
+	}
+	other, err := New(network_params.TestNet, nil)
+	if err != nil {
+		t.Fatalf("Failed to instantiate a light client with err: %s", err)
+	}
+	if err := other.validHeaders(c.headers); err == nil {
+		t.Errorf("Expected headers of another network to be rejected")
+	}
+
+	staking := *params
+	staking.Consensus = network_params.ProofOfStake
+	staking.Stakes = []network_params.Allocation{{Address: niko.BlockchainAddress(), Value: 10}}
+	if _, err := New(&staking, nil); err == nil {
+		t.Errorf("Expected a light client of a proof of stake network to be refused")
+	}
+}
@@ -0,0 +1,338 @@
+package mempool
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrDuplicate              = errors.New("transaction is already in the mempool")
+	ErrReplacementUnderpriced = errors.New("replacement transaction does not pay enough fee")
+	ErrMempoolFull            = errors.New("mempool is full and the transaction pays too little fee")
+	ErrTransactionTooLarge    = errors.New("transaction is larger than the mempool")
+)
+
+// Tx is what the mempool needs to know about a transaction.
+type Tx interface {
+	ID() string
+	Sender() string
+	// Nonce orders the transactions of a sender. Zero means the transaction
+	// has no nonce and can't be replaced.
+	Nonce() uint64
+	Fee() float32
+	FeeRate() float64
+	Size() int
+}
+
+type Config struct {
+	// MaxSize is the total size in bytes of the transactions kept.
+	MaxSize int
+	// Expiry is how long a transaction waits to be mined before it is dropped.
+	Expiry time.Duration
+	// ReplaceBump is how much higher, as a fraction, the fee of a replacement
+	// must be.
+	ReplaceBump float64
+}
+
+func DefaultConfig() Config {
+	return Config{
+		MaxSize:     32 << 20,
+		Expiry:      time.Hour * 24 * 14,
+		ReplaceBump: 0.1,
+	}
+}
+
+type entry struct {
+	tx    Tx
+	added time.Time
+	seq   uint64
+}
+
+type slot struct {
+	sender string
+	nonce  uint64
+}
+
+// Mempool holds the transactions waiting to be mined, indexed by ID and by
+// sender.
+type Mempool struct {
+	config Config
+	now    func() time.Time
+
+	mux      sync.RWMutex
+	byID     map[string]*entry
+	bySender map[string]map[string]*entry
+	byNonce  map[slot]*entry
+	size     int
+	seq      uint64
+}
+
+func New(config Config) *Mempool {
+	return &Mempool{
+		config:   config,
+		now:      time.Now,
+		byID:     make(map[string]*entry),
+		bySender: make(map[string]map[string]*entry),
+		byNonce:  make(map[slot]*entry),
+	}
+}
+
+// Add inserts tx. A transaction with the nonce of one already in the mempool
+// replaces it if it pays ReplaceBump more fee. When the mempool is full the
+// transactions with the lowest fee rate are evicted to make room.
+func (m *Mempool) Add(tx Tx) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return m.add(tx, m.now())
+}
+
+// Reinsert adds back the transactions of disconnected blocks. Transactions
+// that no longer fit are dropped.
+func (m *Mempool) Reinsert(txs []Tx) int {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	n := 0
+	now := m.now()
+	for _, tx := range txs {
+		if err := m.add(tx, now); err == nil {
+			n++
+		}
+	}
+	return n
+}
+
+// RemoveMined drops the given transactions, and any transaction spending the
+// same sender nonce, once they are included in a block.
+func (m *Mempool) RemoveMined(txs []Tx) int {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	n := 0
+	for _, tx := range txs {
+		if e, ok := m.byID[tx.ID()]; ok {
+			m.remove(e)
+			n++
+			continue
+		}
+		if tx.Nonce() == 0 {
+			continue
+		}
+		if e, ok := m.byNonce[slot{sender: tx.Sender(), nonce: tx.Nonce()}]; ok {
+			m.remove(e)
+			n++
+		}
+	}
+	return n
+}
+
+// Expire drops the transactions older than Expiry.
+func (m *Mempool) Expire() int {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return m.expire(m.now())
+}
+
+func (m *Mempool) Clear() int {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	n := len(m.byID)
+	m.byID = make(map[string]*entry)
+	m.bySender = make(map[string]map[string]*entry)
+	m.byNonce = make(map[slot]*entry)
+	m.size = 0
+	return n
+}
+
+func (m *Mempool) Get(id string) (Tx, bool) {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+
+	e, ok := m.byID[id]
+	if !ok {
+		return nil, false
+	}
+	return e.tx, true
+}
+
+// BySender returns the transactions of sender ordered by nonce.
+func (m *Mempool) BySender(sender string) []Tx {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+
+	entries := make([]*entry, 0, len(m.bySender[sender]))
+	for _, e := range m.bySender[sender] {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].tx.Nonce() != entries[j].tx.Nonce() {
+			return entries[i].tx.Nonce() < entries[j].tx.Nonce()
+		}
+		return entries[i].seq < entries[j].seq
+	})
+	return txs(entries)
+}
+
+// Sorted returns the transactions by fee rate, highest first. Transactions
+// paying the same rate are kept in arrival order.
+func (m *Mempool) Sorted() []Tx {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+
+	entries := make([]*entry, 0, len(m.byID))
+	for _, e := range m.byID {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		ri, rj := entries[i].tx.FeeRate(), entries[j].tx.FeeRate()
+		if ri != rj {
+			return ri > rj
+		}
+		return entries[i].seq < entries[j].seq
+	})
+	return txs(entries)
+}
+
+func (m *Mempool) Len() int {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	return len(m.byID)
+}
+
+// Size is the total size in bytes of the transactions in the mempool.
+func (m *Mempool) Size() int {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	return m.size
+}
+
+func (m *Mempool) add(tx Tx, now time.Time) error {
+	m.expire(now)
+
+	id := tx.ID()
+	if _, ok := m.byID[id]; ok {
+		return ErrDuplicate
+	}
+	size := tx.Size()
+	if m.config.MaxSize > 0 && size > m.config.MaxSize {
+		return ErrTransactionTooLarge
+	}
+
+	var replaced *entry
+	if tx.Nonce() != 0 {
+		if old, ok := m.byNonce[slot{sender: tx.Sender(), nonce: tx.Nonce()}]; ok {
+			if tx.Fee() <= old.tx.Fee() || float64(tx.Fee()) < float64(old.tx.Fee())*(1+m.config.ReplaceBump) {
+				return ErrReplacementUnderpriced
+			}
+			replaced = old
+		}
+	}
+
+	// The replaced transaction leaves before room is made, so its size is
+	// not counted against tx. It comes back if tx does not fit.
+	if replaced != nil {
+		m.remove(replaced)
+	}
+	if m.config.MaxSize > 0 {
+		if err := m.makeRoom(size, tx.FeeRate()); err != nil {
+			if replaced != nil {
+				m.insert(replaced)
+			}
+			return err
+		}
+	}
+
+	m.seq++
+	m.insert(&entry{tx: tx, added: now, seq: m.seq})
+	return nil
+}
+
+func (m *Mempool) insert(e *entry) {
+	id := e.tx.ID()
+	sender := e.tx.Sender()
+	m.byID[id] = e
+	if m.bySender[sender] == nil {
+		m.bySender[sender] = make(map[string]*entry)
+	}
+	m.bySender[sender][id] = e
+	if e.tx.Nonce() != 0 {
+		m.byNonce[slot{sender: sender, nonce: e.tx.Nonce()}] = e
+	}
+	m.size += e.tx.Size()
+}
+
+// makeRoom evicts the cheapest transactions until size more bytes fit. It
+// fails, evicting nothing, when that would mean evicting transactions paying
+// a fee rate of at least rate.
+func (m *Mempool) makeRoom(size int, rate float64) error {
+	if m.size+size <= m.config.MaxSize {
+		return nil
+	}
+
+	entries := make([]*entry, 0, len(m.byID))
+	for _, e := range m.byID {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		ri, rj := entries[i].tx.FeeRate(), entries[j].tx.FeeRate()
+		if ri != rj {
+			return ri < rj
+		}
+		return entries[i].seq > entries[j].seq
+	})
+
+	freed, n := 0, 0
+	for ; m.size-freed+size > m.config.MaxSize; n++ {
+		if n == len(entries) || entries[n].tx.FeeRate() >= rate {
+			return ErrMempoolFull
+		}
+		freed += entries[n].tx.Size()
+	}
+	for _, e := range entries[:n] {
+		m.remove(e)
+	}
+	return nil
+}
+
+func (m *Mempool) expire(now time.Time) int {
+	if m.config.Expiry <= 0 {
+		return 0
+	}
+
+	n := 0
+	for _, e := range m.byID {
+		if now.Sub(e.added) > m.config.Expiry {
+			m.remove(e)
+			n++
+		}
+	}
+	return n
+}
+
+func (m *Mempool) remove(e *entry) {
+	id := e.tx.ID()
+	sender := e.tx.Sender()
+	delete(m.byID, id)
+	delete(m.bySender[sender], id)
+	if len(m.bySender[sender]) == 0 {
+		delete(m.bySender, sender)
+	}
+	if e.tx.Nonce() != 0 {
+		s := slot{sender: sender, nonce: e.tx.Nonce()}
+		if m.byNonce[s] == e {
+			delete(m.byNonce, s)
+		}
+	}
+	m.size -= e.tx.Size()
+}
+
+func txs(entries []*entry) []Tx {
+	txs := make([]Tx, len(entries))
+	for i, e := range entries {
+		txs[i] = e.tx
+	}
+	return txs
+}
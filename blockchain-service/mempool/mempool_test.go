@@ -0,0 +1,138 @@
+package mempool
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type testTx struct {
+	id     string
+	sender string
+	nonce  uint64
+	fee    float32
+	size   int
+}
+
+func (t *testTx) ID() string       { return t.id }
+func (t *testTx) Sender() string   { return t.sender }
+func (t *testTx) Nonce() uint64    { return t.nonce }
+func (t *testTx) Fee() float32     { return t.fee }
+func (t *testTx) Size() int        { return t.size }
+func (t *testTx) FeeRate() float64 { return float64(t.fee) / float64(t.size) }
+
+func Test_Mempool(t *testing.T) {
+	m := New(Config{MaxSize: 300, ReplaceBump: 0.1})
+
+	a := &testTx{id: "a", sender: "niko", nonce: 1, fee: 1, size: 100}
+	b := &testTx{id: "b", sender: "itay", fee: 3, size: 100}
+	if err := m.Add(a); err != nil {
+		t.Errorf("Failed to Add with err: %s", err)
+	}
+	if err := m.Add(b); err != nil {
+		t.Errorf("Failed to Add with err: %s", err)
+	}
+	if err := m.Add(a); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("Expected ErrDuplicate, got: %v", err)
+	}
+
+	// Replace by fee needs the same sender nonce and a big enough bump.
+	if err := m.Add(&testTx{id: "a2", sender: "niko", nonce: 1, fee: 1.05, size: 100}); !errors.Is(err, ErrReplacementUnderpriced) {
+		t.Errorf("Expected ErrReplacementUnderpriced, got: %v", err)
+	}
+	a3 := &testTx{id: "a3", sender: "niko", nonce: 1, fee: 2, size: 100}
+	if err := m.Add(a3); err != nil {
+		t.Errorf("Failed to replace by fee with err: %s", err)
+	}
+	if _, ok := m.Get("a"); ok || m.Len() != 2 || m.Size() != 200 {
+		t.Errorf("Expected a to be replaced, have %d transactions of %d bytes", m.Len(), m.Size())
+	}
+
+	// The cheapest transaction is evicted when the mempool is full, a
+	// transaction cheaper than everything in it is turned away.
+	c := &testTx{id: "c", sender: "niko", nonce: 2, fee: 4, size: 100}
+	if err := m.Add(c); err != nil {
+		t.Errorf("Failed to Add with err: %s", err)
+	}
+	if err := m.Add(&testTx{id: "d", sender: "itay", fee: 5, size: 100}); err != nil {
+		t.Errorf("Failed to Add with err: %s", err)
+	}
+	if _, ok := m.Get("a3"); ok {
+		t.Errorf("Expected a3 to be evicted")
+	}
+	if err := m.Add(&testTx{id: "e", sender: "itay", fee: 1, size: 100}); !errors.Is(err, ErrMempoolFull) {
+		t.Errorf("Expected ErrMempoolFull, got: %v", err)
+	}
+
+	sorted := m.Sorted()
+	if len(sorted) != 3 || sorted[0].ID() != "d" || sorted[1].ID() != "c" || sorted[2].ID() != "b" {
+		t.Errorf("Expected the mempool to be sorted by fee rate")
+	}
+	if bySender := m.BySender("itay"); len(bySender) != 2 {
+		t.Errorf("Expected 2 transactions from itay, got %d", len(bySender))
+	}
+
+	// A mined transaction also clears a pending one spending the same nonce.
+	if n := m.RemoveMined([]Tx{&testTx{id: "c2", sender: "niko", nonce: 2}}); n != 1 || m.Len() != 2 {
+		t.Errorf("Expected c to be removed, removed %d", n)
+	}
+	if n := m.Reinsert([]Tx{c, a3}); n != 1 {
+		t.Errorf("Expected 1 reinserted transaction, got %d", n)
+	}
+}
+
+// A replacement takes the room of the transaction it replaces, a full
+// mempool evicts nothing else for it.
+func Test_MempoolReplaceWhenFull(t *testing.T) {
+	m := New(Config{MaxSize: 200, ReplaceBump: 0.1})
+
+	if err := m.Add(&testTx{id: "a", sender: "niko", nonce: 1, fee: 1, size: 100}); err != nil {
+		t.Errorf("Failed to Add with err: %s", err)
+	}
+	if err := m.Add(&testTx{id: "b", sender: "itay", fee: 0.5, size: 100}); err != nil {
+		t.Errorf("Failed to Add with err: %s", err)
+	}
+	if err := m.Add(&testTx{id: "a2", sender: "niko", nonce: 1, fee: 1.5, size: 100}); err != nil {
+		t.Errorf("Failed to replace by fee with err: %s", err)
+	}
+	if _, ok := m.Get("b"); !ok || m.Len() != 2 || m.Size() != 200 {
+		t.Errorf("Expected only a to be replaced, have %d transactions of %d bytes", m.Len(), m.Size())
+	}
+
+	// A replacement that does not fit leaves the transaction it replaces.
+	m = New(Config{MaxSize: 200, ReplaceBump: 0.1})
+	if err := m.Add(&testTx{id: "a", sender: "niko", nonce: 1, fee: 1, size: 100}); err != nil {
+		t.Errorf("Failed to Add with err: %s", err)
+	}
+	if err := m.Add(&testTx{id: "b", sender: "itay", fee: 3, size: 100}); err != nil {
+		t.Errorf("Failed to Add with err: %s", err)
+	}
+	if err := m.Add(&testTx{id: "a2", sender: "niko", nonce: 1, fee: 1.5, size: 150}); !errors.Is(err, ErrMempoolFull) {
+		t.Errorf("Expected ErrMempoolFull, got: %v", err)
+	}
+	if _, ok := m.Get("a"); !ok || m.Len() != 2 || m.Size() != 200 {
+		t.Errorf("Expected a to be kept, have %d transactions of %d bytes", m.Len(), m.Size())
+	}
+}
+
+func Test_MempoolExpiry(t *testing.T) {
+	now := time.Now()
+	m := New(Config{Expiry: time.Hour})
+	m.now = func() time.Time { return now }
+
+	if err := m.Add(&testTx{id: "a", sender: "niko", fee: 1, size: 100}); err != nil {
+		t.Errorf("Failed to Add with err: %s", err)
+	}
+	now = now.Add(30 * time.Minute)
+	if err := m.Add(&testTx{id: "b", sender: "niko", fee: 1, size: 100}); err != nil {
+		t.Errorf("Failed to Add with err: %s", err)
+	}
+
+	now = now.Add(45 * time.Minute)
+	if n := m.Expire(); n != 1 || m.Len() != 1 {
+		t.Errorf("Expected 1 expired transaction, got %d", n)
+	}
+	if _, ok := m.Get("b"); !ok {
+		t.Errorf("Expected b to still be pending")
+	}
+}
@@ -0,0 +1,223 @@
+package network_params
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"blockchain/foundation/cryptography"
+)
+
+// GenesisSpec is the file a chain is started from. It fixes the genesis block
+// and the consensus parameters that every node of the chain must share.
+type GenesisSpec struct {
+	ChainID    string    `json:"chain_id"`
+	Timestamp  time.Time `json:"timestamp"`
+	Difficulty int       `json:"difficulty"`
+	// MaxTimeDrift is in seconds, it defaults to the one of the network.
+	MaxTimeDrift int `json:"max_time_drift,omitempty"`
+	// Checkpoints are block hashes in hex by height, see Params.Checkpoints.
+	Checkpoints   map[int]string `json:"checkpoints,omitempty"`
+	AssumeValid   string         `json:"assume_valid,omitempty"`
+	MaxReorgDepth int            `json:"max_reorg_depth,omitempty"`
+	// FinalityValidators are the known validator set of the finality
+	// gadget, the chain relies on the longest chain alone without them.
+	FinalityValidators []string `json:"finality_validators,omitempty"`
+	// Ledger defaults to the one of the network the spec is applied to.
+	Ledger Ledger `json:"ledger,omitempty"`
+	// Consensus defaults to proof of work. Signers are the first
+	// authorities of a proof of authority chain, Stakes the first validators
+	// of a proof of stake one.
+	Consensus ConsensusEngine    `json:"consensus,omitempty"`
+	Signers   []string           `json:"signers,omitempty"`
+	Stakes    map[string]float32 `json:"stakes,omitempty"`
+	MinStake  float32            `json:"min_stake,omitempty"`
+	// GasPrice and MaxTxGas default to those of the network.
+	GasPrice    float32            `json:"gas_price,omitempty"`
+	MaxTxGas    uint64             `json:"max_tx_gas,omitempty"`
+	Reward      RewardSchedule     `json:"reward"`
+	Allocations map[string]float32 `json:"alloc,omitempty"`
+}
+
+// RewardSchedule is the subsidy of the coinbase transactions, see
+// Params.Subsidy.
+type RewardSchedule struct {
+	Initial          float32 `json:"initial"`
+	HalvingInterval  int     `json:"halving_interval"`
+	MaxSupply        float64 `json:"max_supply"`
+	CoinbaseMaturity int     `json:"coinbase_maturity"`
+}
+
+func LoadGenesisSpec(path string) (*GenesisSpec, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var g GenesisSpec
+	if err := json.Unmarshal(b, &g); err != nil {
+		return nil, fmt.Errorf("failed to parse genesis spec %s with err: %w", path, err)
+	}
+	if err := g.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid genesis spec %s: %w", path, err)
+	}
+	return &g, nil
+}
+
+func (g *GenesisSpec) Validate() error {
+	switch {
+	case g.ChainID == "":
+		return errors.New("chain_id is required")
+	case g.Timestamp.IsZero():
+		return errors.New("timestamp is required")
+	case g.Difficulty < 0 || g.Difficulty > 64:
+		return fmt.Errorf("difficulty %d is not in [0, 64]", g.Difficulty)
+	case g.MaxTimeDrift < 0:
+		return errors.New("max_time_drift must not be negative")
+	case g.MaxReorgDepth < 0:
+		return errors.New("max_reorg_depth must not be negative")
+	case g.GasPrice < 0:
+		return errors.New("gas_price must not be negative")
+	case g.Reward.Initial < 0 || g.Reward.MaxSupply < 0 || g.Reward.HalvingInterval < 0 || g.Reward.CoinbaseMaturity < 0:
+		return errors.New("reward schedule must not be negative")
+	}
+	if g.Ledger != "" {
+		if _, err := LedgerFromString(string(g.Ledger)); err != nil {
+			return err
+		}
+	}
+	if g.Consensus != "" {
+		if _, err := ConsensusEngineFromString(string(g.Consensus)); err != nil {
+			return err
+		}
+	}
+	if g.Consensus == ProofOfAuthority && len(g.Signers) == 0 {
+		return errors.New("a proof of authority chain needs signers")
+	}
+	if g.Consensus == ProofOfStake && len(g.Stakes) == 0 {
+		return errors.New("a proof of stake chain needs stakes")
+	}
+	if g.MinStake < 0 {
+		return errors.New("min_stake must not be negative")
+	}
+	for address, value := range g.Stakes {
+		if value <= 0 {
+			return fmt.Errorf("stake of %s must be positive", address)
+		}
+	}
+	for height, hash := range g.Checkpoints {
+		if height <= 0 {
+			return fmt.Errorf("checkpoint height %d must be positive", height)
+		}
+		if _, err := ParseHash(hash); err != nil {
+			return fmt.Errorf("checkpoint %d: %w", height, err)
+		}
+	}
+	if g.AssumeValid != "" {
+		if _, err := ParseHash(g.AssumeValid); err != nil {
+			return fmt.Errorf("assume_valid: %w", err)
+		}
+	}
+	for address, value := range g.Allocations {
+		if value <= 0 {
+			return fmt.Errorf("allocation to %s must be positive", address)
+		}
+	}
+	return nil
+}
+
+// Apply returns a copy of base running the chain of the spec. The ports and
+// address versions stay those of base.
+func (g *GenesisSpec) Apply(base *Params) (*Params, error) {
+	var err error
+	p := *base
+	p.ChainID = g.ChainID
+	p.GenesisTimestamp = g.Timestamp.UnixNano()
+	p.MinDifficulty = g.Difficulty
+	if g.MaxTimeDrift > 0 {
+		p.MaxTimeDrift = time.Duration(g.MaxTimeDrift) * time.Second
+	}
+	if g.Ledger != "" {
+		p.Ledger = g.Ledger
+	}
+	p.Checkpoints = make(map[int][32]byte, len(g.Checkpoints))
+	for height, hash := range g.Checkpoints {
+		h, err := ParseHash(hash)
+		if err != nil {
+			return nil, fmt.Errorf("checkpoint %d: %w", height, err)
+		}
+		p.Checkpoints[height] = h
+	}
+	p.AssumeValid = [32]byte{}
+	if g.AssumeValid != "" {
+		h, err := ParseHash(g.AssumeValid)
+		if err != nil {
+			return nil, fmt.Errorf("assume_valid: %w", err)
+		}
+		p.AssumeValid = h
+	}
+	p.MaxReorgDepth = g.MaxReorgDepth
+	p.Consensus = ProofOfWork
+	if g.Consensus != "" {
+		p.Consensus = g.Consensus
+	}
+	p.Signers = nil
+	for _, address := range g.Signers {
+		if err := cryptography.ValidateBlockchainAddress(address, &p); err != nil {
+			return nil, fmt.Errorf("invalid signer address %q: %w", address, err)
+		}
+		p.Signers = append(p.Signers, address)
+	}
+	p.FinalityValidators = nil
+	seen := make(map[string]bool)
+	for _, address := range g.FinalityValidators {
+		if err := cryptography.ValidateBlockchainAddress(address, &p); err != nil {
+			return nil, fmt.Errorf("invalid finality validator address %q: %w", address, err)
+		}
+		if seen[address] {
+			return nil, fmt.Errorf("finality validator %s is listed twice", address)
+		}
+		seen[address] = true
+		p.FinalityValidators = append(p.FinalityValidators, address)
+	}
+	sort.Strings(p.FinalityValidators)
+	p.Stakes, err = allocations(g.Stakes, &p)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stake: %w", err)
+	}
+	p.MinStake = g.MinStake
+	if g.GasPrice > 0 {
+		p.GasPrice = g.GasPrice
+	}
+	if g.MaxTxGas > 0 {
+		p.MaxTxGas = g.MaxTxGas
+	}
+	p.MiningReward = g.Reward.Initial
+	p.HalvingInterval = g.Reward.HalvingInterval
+	p.MaxSupply = g.Reward.MaxSupply
+	p.CoinbaseMaturity = g.Reward.CoinbaseMaturity
+
+	p.Allocations, err = allocations(g.Allocations, &p)
+	if err != nil {
+		return nil, fmt.Errorf("invalid allocation: %w", err)
+	}
+	return &p, nil
+}
+
+// allocations orders the values by address, checking that they are
+// addresses of p.
+func allocations(values map[string]float32, p *Params) ([]Allocation, error) {
+	allocs := make([]Allocation, 0, len(values))
+	for address, value := range values {
+		if err := cryptography.ValidateBlockchainAddress(address, p); err != nil {
+			return nil, fmt.Errorf("address %q: %w", address, err)
+		}
+		allocs = append(allocs, Allocation{Address: address, Value: value})
+	}
+	sort.Slice(allocs, func(i, j int) bool {
+		return allocs[i].Address < allocs[j].Address
+	})
+	return allocs, nil
+}
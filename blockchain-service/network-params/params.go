@@ -0,0 +1,314 @@
+package network_params
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"blockchain/foundation/cryptography"
+)
+
+// Ledger is how a network keeps track of who owns which coins.
+type Ledger string
+
+const (
+	// AccountLedger keeps a balance per address, transactions move value
+	// from the sender balance to the recipient.
+	AccountLedger Ledger = "account"
+	// UTXOLedger keeps the unspent transaction outputs, transactions spend
+	// whole outputs and create new ones.
+	UTXOLedger Ledger = "utxo"
+)
+
+func LedgerFromString(s string) (Ledger, error) {
+	switch l := Ledger(s); l {
+	case AccountLedger, UTXOLedger:
+		return l, nil
+	}
+	return "", fmt.Errorf("unknown ledger %q", s)
+}
+
+// ConsensusEngine is how a network agrees on who produces the next block.
+type ConsensusEngine string
+
+const (
+	// ProofOfWork lets anyone produce a block by solving its hash.
+	ProofOfWork ConsensusEngine = "pow"
+	// ProofOfAuthority lets the Signers of the network take turns signing
+	// blocks.
+	ProofOfAuthority ConsensusEngine = "poa"
+	// ProofOfStake draws the validator of every block at random, weighted
+	// by the stake it has locked.
+	ProofOfStake ConsensusEngine = "pos"
+)
+
+func ConsensusEngineFromString(s string) (ConsensusEngine, error) {
+	switch c := ConsensusEngine(s); c {
+	case ProofOfWork, ProofOfAuthority, ProofOfStake:
+		return c, nil
+	}
+	return "", fmt.Errorf("unknown consensus engine %q", s)
+}
+
+// Allocation is a balance the genesis block pays out.
+type Allocation struct {
+	Address string
+	Value   float32
+}
+
+type Params struct {
+	Name string
+	// ChainID is part of the genesis block, so nodes of different chains
+	// never follow each other. So are the consensus parameters, see
+	// GenesisCommitment.
+	ChainID string
+
+	Ledger Ledger
+
+	Consensus ConsensusEngine
+	// Signers are the addresses allowed to seal the first blocks of a proof
+	// of authority network. They change by vote after that.
+	Signers []string
+	// Stakes are locked by the genesis block of a proof of stake network,
+	// ordered by address. Only validators with MinStake take part in the
+	// draw.
+	Stakes   []Allocation
+	MinStake float32
+
+	PubKeyAddressVersion   byte
+	MultisigAddressVersion byte
+
+	GenesisTimestamp int64
+	// Allocations are paid out by the genesis block, ordered by address.
+	Allocations []Allocation
+
+	DefaultBlockchainPort    uint16
+	DefaultWalletPort        uint16
+	BlockchainPortRangeStart uint16
+	BlockchainPortRangeEnd   uint16
+
+	// MiningReward is the subsidy of the first blocks, it halves every
+	// HalvingInterval blocks until MaxSupply has been issued.
+	MiningReward    float32
+	HalvingInterval int
+	MaxSupply       float64
+	// CoinbaseMaturity is the number of blocks a coinbase reward waits
+	// before it can be spent.
+	CoinbaseMaturity int
+	MinDifficulty    int
+	// MaxTimeDrift is how far into the future of the node clock a block
+	// timestamp may be.
+	MaxTimeDrift time.Duration
+
+	// Checkpoints are the hashes of the blocks a chain must have at their
+	// heights. No chain forking below one of them is followed.
+	Checkpoints map[int][32]byte
+	// AssumeValid is a block whose ancestors are known to be valid, their
+	// signatures are not checked when they are synced.
+	AssumeValid [32]byte
+	// MaxReorgDepth is the most blocks a reorg may disconnect, 0 for no
+	// limit.
+	MaxReorgDepth int
+	// FinalityValidators are the addresses that vote blocks final, see
+	// blockchain.Finality. The chain has no finality when it is empty.
+	FinalityValidators []string
+
+	// GasPrice is the fee a contract transaction pays at least per unit of
+	// its gas limit, which is at most MaxTxGas.
+	GasPrice float32
+	MaxTxGas uint64
+
+	// Block assembly limits, not counting the coinbase transaction.
+	MaxBlockSize         int
+	MaxBlockTransactions int
+}
+
+var MainNet = &Params{
+	Name:                     "mainnet",
+	ChainID:                  "mainnet",
+	Ledger:                   AccountLedger,
+	Consensus:                ProofOfWork,
+	PubKeyAddressVersion:     0x00,
+	MultisigAddressVersion:   0x05,
+	GenesisTimestamp:         1669852800000000000,
+	DefaultBlockchainPort:    5000,
+	DefaultWalletPort:        4999,
+	BlockchainPortRangeStart: 5000,
+	BlockchainPortRangeEnd:   5003,
+	MiningReward:             0.0001,
+	HalvingInterval:          210000,
+	MaxSupply:                21,
+	CoinbaseMaturity:         100,
+	MinDifficulty:            2,
+	MaxTimeDrift:             2 * time.Hour,
+	MaxReorgDepth:            100,
+	GasPrice:                 0.000001,
+	MaxTxGas:                 1000000,
+	MaxBlockSize:             1 << 20,
+	MaxBlockTransactions:     2000,
+}
+
+var TestNet = &Params{
+	Name:                     "testnet",
+	ChainID:                  "testnet",
+	Ledger:                   AccountLedger,
+	Consensus:                ProofOfWork,
+	PubKeyAddressVersion:     0x6f,
+	MultisigAddressVersion:   0xc4,
+	GenesisTimestamp:         1669939200000000000,
+	DefaultBlockchainPort:    6000,
+	DefaultWalletPort:        5999,
+	BlockchainPortRangeStart: 6000,
+	BlockchainPortRangeEnd:   6003,
+	MiningReward:             0.0001,
+	HalvingInterval:          210000,
+	MaxSupply:                21,
+	CoinbaseMaturity:         100,
+	MinDifficulty:            2,
+	MaxTimeDrift:             2 * time.Hour,
+	MaxReorgDepth:            100,
+	GasPrice:                 0.000001,
+	MaxTxGas:                 1000000,
+	MaxBlockSize:             1 << 20,
+	MaxBlockTransactions:     2000,
+}
+
+var RegTest = &Params{
+	Name:                     "regtest",
+	ChainID:                  "regtest",
+	Ledger:                   AccountLedger,
+	Consensus:                ProofOfWork,
+	PubKeyAddressVersion:     0x7a,
+	MultisigAddressVersion:   0x7d,
+	GenesisTimestamp:         1670025600000000000,
+	DefaultBlockchainPort:    7000,
+	DefaultWalletPort:        6999,
+	BlockchainPortRangeStart: 7000,
+	BlockchainPortRangeEnd:   7003,
+	MiningReward:             50,
+	HalvingInterval:          150,
+	MaxSupply:                21000000,
+	CoinbaseMaturity:         100,
+	MinDifficulty:            1,
+	MaxTimeDrift:             2 * time.Hour,
+	GasPrice:                 0.000001,
+	MaxTxGas:                 1000000,
+	MaxBlockSize:             1 << 20,
+	MaxBlockTransactions:     2000,
+}
+
+// ParseHash parses a block hash in hex.
+func ParseHash(s string) ([32]byte, error) {
+	var hash [32]byte
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return hash, fmt.Errorf("invalid hash %q: %w", s, err)
+	}
+	if len(b) != len(hash) {
+		return hash, fmt.Errorf("invalid hash %q: expected %d bytes, got %d", s, len(hash), len(b))
+	}
+	copy(hash[:], b)
+	return hash, nil
+}
+
+func ByName(name string) (*Params, error) {
+	for _, p := range []*Params{MainNet, TestNet, RegTest} {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown network %q", name)
+}
+
+// Subsidy is the number of new coins the coinbase of the block at height may
+// claim, fees aside. The genesis block has no coinbase.
+func (p *Params) Subsidy(height int) float32 {
+	if height <= 0 {
+		return 0
+	}
+	return float32(p.Supply(height) - p.Supply(height-1))
+}
+
+// Supply is the number of coins issued by the blocks up to and including
+// height.
+func (p *Params) Supply(height int) float64 {
+	if height <= 0 {
+		return 0
+	}
+
+	var supply float64
+	reward := float64(p.MiningReward)
+	if p.HalvingInterval <= 0 {
+		supply = reward * float64(height)
+	} else {
+		for era := 0; era < 64 && era*p.HalvingInterval <= height; era++ {
+			first := era * p.HalvingInterval
+			if first < 1 {
+				first = 1
+			}
+			last := (era+1)*p.HalvingInterval - 1
+			if last > height {
+				last = height
+			}
+			supply += reward * float64(last-first+1)
+			reward /= 2
+		}
+	}
+
+	if p.MaxSupply > 0 && supply > p.MaxSupply {
+		return p.MaxSupply
+	}
+	return supply
+}
+
+// GenesisCommitment is the previous hash of the genesis block. It commits to
+// the chain ID and to every parameter that decides whether a block is valid,
+// so nodes that disagree on one of them do not share a genesis block and never
+// sync with each other. The allocations and stakes are transactions of the
+// genesis block already.
+func (p *Params) GenesisCommitment() [32]byte {
+	b, _ := json.Marshal(&struct {
+		ChainID            string          `json:"chain_id"`
+		Ledger             Ledger          `json:"ledger"`
+		Consensus          ConsensusEngine `json:"consensus"`
+		Signers            []string        `json:"signers"`
+		MinStake           float32         `json:"min_stake"`
+		MiningReward       float32         `json:"mining_reward"`
+		HalvingInterval    int             `json:"halving_interval"`
+		MaxSupply          float64         `json:"max_supply"`
+		CoinbaseMaturity   int             `json:"coinbase_maturity"`
+		MinDifficulty      int             `json:"min_difficulty"`
+		FinalityValidators []string        `json:"finality_validators"`
+		GasPrice           float32         `json:"gas_price"`
+		MaxTxGas           uint64          `json:"max_tx_gas"`
+		MaxBlockSize       int             `json:"max_block_size"`
+		MaxBlockTxs        int             `json:"max_block_transactions"`
+		AddressVersion     byte            `json:"address_version"`
+		MultisigVersion    byte            `json:"multisig_version"`
+	}{
+		p.ChainID, p.Ledger, p.Consensus, p.Signers, p.MinStake,
+		p.MiningReward, p.HalvingInterval, p.MaxSupply, p.CoinbaseMaturity,
+		p.MinDifficulty, p.FinalityValidators, p.GasPrice, p.MaxTxGas,
+		p.MaxBlockSize, p.MaxBlockTransactions,
+		p.PubKeyAddressVersion, p.MultisigAddressVersion,
+	})
+	return sha256.Sum256(b)
+}
+
+func (p *Params) UTXO() bool {
+	return p.Ledger == UTXOLedger
+}
+
+func (p *Params) AddressVersion() byte {
+	return p.PubKeyAddressVersion
+}
+
+func (p *Params) MultisigVersion() byte {
+	return p.MultisigAddressVersion
+}
+
+func (p *Params) GenerateBlockchainAddress(pKey cryptography.PublicKey) string {
+	return cryptography.GenerateBlockchainAddress(pKey, p)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"sync"
+
+	"blockchain/blockchain-service/pool"
+)
+
+func init() {
+	log.SetPrefix("Pool worker: ")
+}
+
+func main() {
+	poolAddress := flag.String("pool", "127.0.0.1:3333", "Address of the mining pool")
+	address := flag.String("address", "", "Blockchain address shares are credited to")
+	workers := flag.Int("workers", 1, "Number of pool connections to mine with")
+	flag.Parse()
+
+	if *address == "" {
+		log.Fatalf("missing -address")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < *workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := pool.NewWorker(*poolAddress, *address)
+			if err := w.Run(context.Background()); err != nil {
+				log.Printf("worker stopped with err: %s", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,108 @@
+package pool
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"blockchain/blockchain-service/wallet"
+	"blockchain/foundation/cryptography"
+)
+
+type Scheme int
+
+const (
+	// PPLNS pays the last Window shares, whatever round they were found in.
+	PPLNS Scheme = iota
+	// Proportional pays the shares of the round that found the block.
+	Proportional
+)
+
+func SchemeFromString(s string) (Scheme, error) {
+	switch s {
+	case "", "pplns":
+		return PPLNS, nil
+	case "proportional":
+		return Proportional, nil
+	default:
+		return 0, fmt.Errorf("unsupported payout scheme %q", s)
+	}
+}
+
+type Payer interface {
+	Pay(recipient string, value float32) error
+}
+
+type transactionAdder interface {
+	NextNonce(address string) uint64
+	AddTransaction(sender, recipient string, value, fee float32, nonce uint64, pKey cryptography.PublicKey, s *cryptography.Signature) error
+}
+
+// KeyPayer pays out of the node's blockchain address, which must be the
+// address of the given key.
+type KeyPayer struct {
+	privateKey cryptography.PrivateKey
+	address    string
+	bc         transactionAdder
+
+	mux   sync.Mutex
+	nonce uint64
+}
+
+func NewKeyPayer(privateKey cryptography.PrivateKey, address string, bc transactionAdder) *KeyPayer {
+	return &KeyPayer{
+		privateKey: privateKey,
+		address:    address,
+		bc:         bc,
+	}
+}
+
+// Pay numbers the payouts so that two equal ones are still distinct
+// transactions in the mempool. The numbering carries on from the nonce of the
+// address on the chain, so it survives a restart.
+func (p *KeyPayer) Pay(recipient string, value float32) error {
+	p.mux.Lock()
+	p.nonce++
+	if next := p.bc.NextNonce(p.address); next > p.nonce {
+		p.nonce = next
+	}
+	nonce := p.nonce
+	p.mux.Unlock()
+
+	publicKey := p.privateKey.PublicKey()
+	s, err := wallet.NewTransactionWithNonce(p.privateKey, publicKey, p.address, recipient, value, 0, nonce).GenerateSignature()
+	if err != nil {
+		return err
+	}
+	return p.bc.AddTransaction(p.address, recipient, value, 0, nonce, publicKey, s)
+}
+
+type payout struct {
+	address string
+	value   float32
+}
+
+// splitReward divides reward between the workers in proportion to the number
+// of shares each of them has in shares.
+func splitReward(shares []string, reward float32) []payout {
+	if len(shares) == 0 {
+		return nil
+	}
+
+	counts := make(map[string]int)
+	for _, address := range shares {
+		counts[address]++
+	}
+
+	payouts := make([]payout, 0, len(counts))
+	for address, n := range counts {
+		payouts = append(payouts, payout{
+			address: address,
+			value:   reward * float32(n) / float32(len(shares)),
+		})
+	}
+	sort.Slice(payouts, func(i, j int) bool {
+		return payouts[i].address < payouts[j].address
+	})
+	return payouts
+}
@@ -0,0 +1,445 @@
+package pool
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"blockchain/blockchain-service/blockchain"
+	"blockchain/blockchain-service/network-params"
+	"blockchain/foundation/cryptography"
+)
+
+var (
+	ErrUnauthorized = errors.New("worker is not authorized")
+	ErrStaleJob     = errors.New("job is stale")
+	ErrDuplicate    = errors.New("duplicate share")
+	ErrLowShare     = errors.New("share does not meet the share difficulty")
+	ErrNonceRange   = errors.New("nonce is outside the range of the worker")
+)
+
+// nonceRange is the number of nonces each connection gets, from its
+// NonceStart.
+const nonceRange = 1 << 32
+
+type blockchainer interface {
+	BlockTemplate() (*blockchain.BlockTemplate, error)
+	SubmitBlock(b *blockchain.Block) error
+	Block(hash string) (*blockchain.BlockStatus, error)
+}
+
+type Config struct {
+	ShareDifficulty int
+	Scheme          Scheme
+	// Window is the number of shares paid by PPLNS.
+	Window int
+	// Fee is the fraction of each block reward the pool keeps.
+	Fee             float32
+	RefreshInterval time.Duration
+}
+
+type WorkerStats struct {
+	Address  string `json:"address"`
+	Accepted int    `json:"accepted"`
+	Rejected int    `json:"rejected"`
+	Blocks   int    `json:"blocks"`
+}
+
+type job struct {
+	id              string
+	template        *blockchain.BlockTemplate
+	shareDifficulty int
+	submitted       map[int]bool
+}
+
+// Pool hands out block templates to remote workers, credits their shares and
+// pays the block reward out to them once one of the shares solves a block.
+type Pool struct {
+	bc     blockchainer
+	payer  Payer
+	params *network_params.Params
+	config Config
+
+	mux     sync.Mutex
+	job     *job
+	jobs    map[string]*job
+	nextJob uint64
+	nextID  int
+	conns   map[*conn]bool
+	shares  []string
+	stats   map[string]*WorkerStats
+	// matures holds the payouts of found blocks until their coinbase can
+	// be spent.
+	matures []maturingPayouts
+}
+
+type maturingPayouts struct {
+	height  int
+	hash    string
+	payouts []payout
+}
+
+func New(bc blockchainer, payer Payer, params *network_params.Params, config Config) (*Pool, error) {
+	if config.ShareDifficulty < 0 || config.ShareDifficulty >= params.MinDifficulty {
+		return nil, fmt.Errorf("share difficulty must be below the network difficulty %d", params.MinDifficulty)
+	}
+	if config.Fee < 0 || config.Fee >= 1 {
+		return nil, fmt.Errorf("pool fee must be in [0, 1)")
+	}
+	if config.Window <= 0 {
+		config.Window = 1000
+	}
+	if config.RefreshInterval <= 0 {
+		config.RefreshInterval = time.Second * 5
+	}
+
+	return &Pool{
+		bc:     bc,
+		payer:  payer,
+		params: params,
+		config: config,
+		jobs:   make(map[string]*job),
+		conns:  make(map[*conn]bool),
+		stats:  make(map[string]*WorkerStats),
+	}, nil
+}
+
+// Start refreshes the work from the node until ctx is done.
+func (p *Pool) Start(ctx context.Context) {
+	t := time.NewTicker(p.config.RefreshInterval)
+	defer t.Stop()
+	p.refresh()
+	for {
+		select {
+		case <-t.C:
+			p.refresh()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (p *Pool) ListenAndServe(ctx context.Context, address string) error {
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	return p.Serve(ctx, ln)
+}
+
+func (p *Pool) Serve(ctx context.Context, ln net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go p.handle(newConn(c))
+	}
+}
+
+func (p *Pool) Stats() []WorkerStats {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	stats := make([]WorkerStats, 0, len(p.stats))
+	for _, s := range p.stats {
+		stats = append(stats, *s)
+	}
+	return stats
+}
+
+// refresh fetches a new template and sends it to every worker when the tip
+// or the selected transactions changed.
+func (p *Pool) refresh() {
+	template, err := p.bc.BlockTemplate()
+	if err != nil {
+		log.Printf("failed to get block template with err: %s", err)
+		return
+	}
+
+	p.payMatured(template.Height)
+
+	p.mux.Lock()
+	if template.Empty() {
+		p.job = nil
+		p.mux.Unlock()
+		return
+	}
+	clean := p.job == nil || p.job.template.PreviousHash != template.PreviousHash
+	if !clean && len(p.job.template.Transactions) == len(template.Transactions) {
+		p.mux.Unlock()
+		return
+	}
+	if clean {
+		p.jobs = make(map[string]*job)
+	}
+
+	shareDifficulty := p.config.ShareDifficulty
+	if shareDifficulty >= template.Difficulty {
+		shareDifficulty = template.Difficulty - 1
+	}
+	p.nextJob++
+	j := &job{
+		id:              fmt.Sprintf("%x", p.nextJob),
+		template:        template,
+		shareDifficulty: shareDifficulty,
+		submitted:       make(map[int]bool),
+	}
+	p.job = j
+	p.jobs[j.id] = j
+	conns := make([]*conn, 0, len(p.conns))
+	for c := range p.conns {
+		conns = append(conns, c)
+	}
+	p.mux.Unlock()
+
+	for _, c := range conns {
+		p.notify(c, j, clean)
+	}
+}
+
+func (p *Pool) handle(c *conn) {
+	defer c.Close()
+
+	p.mux.Lock()
+	c.nonceStart = p.nextID * nonceRange
+	p.nextID++
+	p.mux.Unlock()
+
+	scanner := bufio.NewScanner(c)
+	for scanner.Scan() {
+		var req message
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			log.Printf("pool: malformed message from %s: %s", c.RemoteAddr(), err)
+			return
+		}
+
+		var result interface{}
+		var err error
+		switch req.Method {
+		case MethodAuthorize:
+			result, err = p.authorize(c, req.Params)
+		case MethodSubmit:
+			result, err = p.submit(c, req.Params)
+		default:
+			err = fmt.Errorf("unknown method %q", req.Method)
+		}
+		if err := c.respond(req.ID, result, err); err != nil {
+			return
+		}
+	}
+
+	p.mux.Lock()
+	delete(p.conns, c)
+	p.mux.Unlock()
+}
+
+func (p *Pool) authorize(c *conn, params json.RawMessage) (bool, error) {
+	var ap AuthorizeParams
+	if err := json.Unmarshal(params, &ap); err != nil {
+		return false, err
+	}
+	if err := cryptography.ValidateBlockchainAddress(ap.Worker, p.params); err != nil {
+		return false, &blockchain.InvalidAddressError{Address: ap.Worker, Err: err}
+	}
+
+	p.mux.Lock()
+	c.worker = ap.Worker
+	p.conns[c] = true
+	if _, ok := p.stats[ap.Worker]; !ok {
+		p.stats[ap.Worker] = &WorkerStats{Address: ap.Worker}
+	}
+	j := p.job
+	p.mux.Unlock()
+
+	if j != nil {
+		go p.notify(c, j, true)
+	}
+	return true, nil
+}
+
+func (p *Pool) submit(c *conn, params json.RawMessage) (*SubmitResult, error) {
+	var sp SubmitParams
+	if err := json.Unmarshal(params, &sp); err != nil {
+		return nil, err
+	}
+
+	p.mux.Lock()
+	if c.worker == "" {
+		p.mux.Unlock()
+		return nil, ErrUnauthorized
+	}
+	stats := p.stats[c.worker]
+	j, err := p.checkShare(c, sp)
+	if err != nil {
+		stats.Rejected++
+		p.mux.Unlock()
+		return nil, err
+	}
+	j.submitted[sp.Nonce] = true
+	stats.Accepted++
+	p.shares = append(p.shares, c.worker)
+	if p.config.Scheme == PPLNS && len(p.shares) > p.config.Window {
+		p.shares = p.shares[len(p.shares)-p.config.Window:]
+	}
+	p.mux.Unlock()
+
+	isBlock, err := j.template.Meets(sp.Nonce, j.template.Difficulty)
+	if err != nil || !isBlock {
+		return &SubmitResult{Accepted: true}, err
+	}
+
+	b := j.template.Block(sp.Nonce)
+	if err := p.bc.SubmitBlock(b); err != nil {
+		log.Printf("pool: block from %s was rejected with err: %s", c.worker, err)
+		return &SubmitResult{Accepted: true}, nil
+	}
+	hash, _ := b.Hash()
+	log.Printf("pool: %s found block %d with nonce %d", c.worker, j.template.Height, sp.Nonce)
+
+	p.mux.Lock()
+	stats.Blocks++
+	shares := p.shares
+	if p.config.Scheme == Proportional {
+		p.shares = nil
+	}
+	p.matures = append(p.matures, maturingPayouts{
+		height:  j.template.Height,
+		hash:    fmt.Sprintf("%x", hash),
+		payouts: splitReward(shares, j.template.CoinbaseValue*(1-p.config.Fee)),
+	})
+	p.mux.Unlock()
+
+	go p.refresh()
+	return &SubmitResult{Accepted: true, Block: true}, nil
+}
+
+// payMatured pays the blocks whose coinbase is spendable at height. A block a
+// reorg took off the chain has no coinbase to pay from, its payouts are
+// dropped.
+func (p *Pool) payMatured(height int) {
+	p.mux.Lock()
+	var matured []maturingPayouts
+	pending := p.matures[:0]
+	for _, m := range p.matures {
+		if height-m.height >= p.params.CoinbaseMaturity {
+			matured = append(matured, m)
+			continue
+		}
+		pending = append(pending, m)
+	}
+	p.matures = pending
+	p.mux.Unlock()
+
+	var due []payout
+	for _, m := range matured {
+		status, err := p.bc.Block(m.hash)
+		if err != nil || !status.MainChain || status.Height != m.height {
+			log.Printf("pool: block %d %s is no longer on the chain, dropping its payouts", m.height, m.hash)
+			continue
+		}
+		due = append(due, m.payouts...)
+	}
+	for _, po := range due {
+		if err := p.payer.Pay(po.address, po.value); err != nil {
+			log.Printf("pool: failed to pay %f to %s with err: %s", po.value, po.address, err)
+		}
+	}
+}
+
+// checkShare must be called with p.mux held.
+func (p *Pool) checkShare(c *conn, sp SubmitParams) (*job, error) {
+	j, ok := p.jobs[sp.JobID]
+	if !ok {
+		return nil, ErrStaleJob
+	}
+	if sp.Nonce < c.nonceStart || sp.Nonce >= c.nonceStart+nonceRange {
+		return nil, ErrNonceRange
+	}
+	if j.submitted[sp.Nonce] {
+		return nil, ErrDuplicate
+	}
+	valid, err := j.template.Meets(sp.Nonce, j.shareDifficulty)
+	if err != nil {
+		return nil, err
+	}
+	if !valid {
+		return nil, ErrLowShare
+	}
+	return j, nil
+}
+
+func (p *Pool) notify(c *conn, j *job, clean bool) {
+	err := c.send(MethodNotify, &Job{
+		JobID:           j.id,
+		Template:        j.template,
+		ShareDifficulty: j.shareDifficulty,
+		NonceStart:      c.nonceStart,
+		CleanJobs:       clean,
+	})
+	if err != nil {
+		log.Printf("pool: failed to notify %s with err: %s", c.RemoteAddr(), err)
+	}
+}
+
+type conn struct {
+	net.Conn
+	worker     string
+	nonceStart int
+
+	muxWrite sync.Mutex
+}
+
+func newConn(c net.Conn) *conn {
+	return &conn{
+		Conn: c,
+	}
+}
+
+func (c *conn) respond(id *int64, result interface{}, err error) error {
+	m := message{ID: id}
+	if err != nil {
+		m.Error = err.Error()
+	} else {
+		b, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		m.Result = b
+	}
+	return c.write(&m)
+}
+
+func (c *conn) send(method string, params interface{}) error {
+	b, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return c.write(&message{Method: method, Params: b})
+}
+
+func (c *conn) write(m *message) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	c.muxWrite.Lock()
+	defer c.muxWrite.Unlock()
+	_, err = c.Write(append(b, '\n'))
+	return err
+}
@@ -0,0 +1,175 @@
+package pool
+
+import (
+	"context"
+	"encoding/hex"
+	"net"
+	"testing"
+	"time"
+
+	"blockchain/blockchain-service/blockchain"
+	"blockchain/blockchain-service/network-params"
+	"blockchain/blockchain-service/wallet"
+	"blockchain/foundation/cryptography"
+)
+
+type recordingPayer struct {
+	Payer
+	payouts chan payout
+}
+
+func (p *recordingPayer) Pay(recipient string, value float32) error {
+	p.payouts <- payout{address: recipient, value: value}
+	return p.Payer.Pay(recipient, value)
+}
+
+// node looks blocks up by hex hash, as the blockchain server does.
+type node struct {
+	*blockchain.Blockchain
+}
+
+func (n node) Block(hash string) (*blockchain.BlockStatus, error) {
+	var key [32]byte
+	if _, err := hex.Decode(key[:], []byte(hash)); err != nil {
+		return nil, err
+	}
+	status, ok := n.BlockStatus(key)
+	if !ok {
+		return nil, blockchain.ErrBlockNotFound
+	}
+	return status, nil
+}
+
+func Test_SplitReward(t *testing.T) {
+	payouts := splitReward([]string{"niko", "itay", "niko", "niko"}, 8)
+	if len(payouts) != 2 {
+		t.Fatalf("Expected 2 payouts, got %d", len(payouts))
+	}
+	if payouts[0].address != "itay" || payouts[0].value != 2 {
+		t.Errorf("Wrong payout for itay: %+v", payouts[0])
+	}
+	if payouts[1].address != "niko" || payouts[1].value != 6 {
+		t.Errorf("Wrong payout for niko: %+v", payouts[1])
+	}
+}
+
+func Test_Pool(t *testing.T) {
+	regtest := *network_params.RegTest
+	regtest.CoinbaseMaturity = 0
+	params := &regtest
+	operator, err := wallet.NewWallet(cryptography.P256, params.GenerateBlockchainAddress)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a wallet with err: %s", err)
+	}
+	niko, err := wallet.NewWallet(cryptography.P256, params.GenerateBlockchainAddress)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a wallet with err: %s", err)
+	}
+
+	bc, err := blockchain.NewBlockchain(operator.BlockchainAddress(), params)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a blockchain with err: %s", err)
+	}
+	// Niko needs coins to pay the operator with.
+	template, err := bc.BlockTemplateFor(niko.BlockchainAddress())
+	if err != nil {
+		t.Fatalf("Failed to get BlockTemplate with err: %s", err)
+	}
+	b, _, err := template.Solve(context.Background(), blockchain.NewMiningEngine(0))
+	if err != nil {
+		t.Fatalf("Failed to Solve with err: %s", err)
+	}
+	if err := bc.SubmitBlock(b); err != nil {
+		t.Fatalf("Failed to SubmitBlock with err: %s", err)
+	}
+
+	s, err := wallet.NewTransactionWithNonce(niko.PrivateKey(), niko.PublicKey(), niko.BlockchainAddress(), operator.BlockchainAddress(), 1.0, 0, 1).GenerateSignature()
+	if err != nil {
+		t.Fatalf("Failed to GenerateSignature with err: %s", err)
+	}
+	if err := bc.AddTransaction(niko.BlockchainAddress(), operator.BlockchainAddress(), 1.0, 0, 1, niko.PublicKey(), s); err != nil {
+		t.Fatalf("Failed to AddTransaction with err: %s", err)
+	}
+
+	if _, err := New(node{bc}, nil, params, Config{ShareDifficulty: params.MinDifficulty}); err == nil {
+		t.Errorf("Expected a share difficulty at the network difficulty to be rejected")
+	}
+	payer := &recordingPayer{
+		Payer:   NewKeyPayer(operator.PrivateKey(), operator.BlockchainAddress(), bc),
+		payouts: make(chan payout, 16),
+	}
+	p, err := New(node{bc}, payer, params, Config{
+		ShareDifficulty: 0,
+		Fee:             0.1,
+	})
+	if err != nil {
+		t.Fatalf("Failed to instatiate a pool with err: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen with err: %s", err)
+	}
+	go p.Serve(ctx, ln)
+	p.refresh()
+	go NewWorker(ln.Addr().String(), niko.BlockchainAddress()).Run(ctx)
+
+	var po payout
+	select {
+	case po = <-payer.payouts:
+	case <-ctx.Done():
+		t.Fatalf("Pool did not find and pay a block")
+	}
+	cancel()
+	if po.address != niko.BlockchainAddress() || po.value != params.Subsidy(2)*0.9 {
+		t.Errorf("Unexpected payout %+v", po)
+	}
+	if len(bc.Chain()) < 3 {
+		t.Errorf("Expected the pool block to be appended")
+	}
+
+	stats := p.Stats()
+	if len(stats) != 1 || stats[0].Accepted == 0 || stats[0].Blocks == 0 {
+		t.Errorf("Unexpected worker stats: %+v", stats)
+	}
+}
+
+func Test_PayMaturedDropsOrphans(t *testing.T) {
+	regtest := *network_params.RegTest
+	regtest.CoinbaseMaturity = 0
+	params := &regtest
+	operator, err := wallet.NewWallet(cryptography.P256, params.GenerateBlockchainAddress)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a wallet with err: %s", err)
+	}
+	bc, err := blockchain.NewBlockchain(operator.BlockchainAddress(), params)
+	if err != nil {
+		t.Fatalf("Failed to instatiate a blockchain with err: %s", err)
+	}
+	payer := &recordingPayer{
+		Payer:   NewKeyPayer(operator.PrivateKey(), operator.BlockchainAddress(), bc),
+		payouts: make(chan payout, 16),
+	}
+	p, err := New(node{bc}, payer, params, Config{})
+	if err != nil {
+		t.Fatalf("Failed to instatiate a pool with err: %s", err)
+	}
+	genesis := bc.Genesis().Header().Hash()
+	p.matures = []maturingPayouts{
+		{height: 0, hash: hex.EncodeToString(make([]byte, 32)), payouts: []payout{{address: "orphan", value: 1}}},
+		{height: 0, hash: hex.EncodeToString(genesis[:]), payouts: []payout{{address: operator.BlockchainAddress(), value: 1}}},
+	}
+	p.payMatured(1)
+
+	if len(p.matures) != 0 {
+		t.Errorf("Expected the matured blocks to be taken, %d left", len(p.matures))
+	}
+	if len(payer.payouts) != 1 {
+		t.Fatalf("Expected only the block on the chain to be paid, got %d payouts", len(payer.payouts))
+	}
+	if po := <-payer.payouts; po.address != operator.BlockchainAddress() {
+		t.Errorf("Unexpected payout %+v", po)
+	}
+}
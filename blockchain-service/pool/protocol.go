@@ -0,0 +1,49 @@
+package pool
+
+import (
+	"encoding/json"
+
+	"blockchain/blockchain-service/blockchain"
+)
+
+// The pool speaks line-delimited JSON over TCP, loosely following stratum.
+// Requests carry an id and get a response with the same id, notifications
+// from the pool have no id.
+const (
+	MethodAuthorize = "mining.authorize"
+	MethodSubmit    = "mining.submit"
+	MethodNotify    = "mining.notify"
+)
+
+type message struct {
+	ID     *int64          `json:"id,omitempty"`
+	Method string          `json:"method,omitempty"`
+	Params json.RawMessage `json:"params,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+type AuthorizeParams struct {
+	// Worker is the blockchain address shares are credited to.
+	Worker string `json:"worker"`
+}
+
+type SubmitParams struct {
+	JobID string `json:"job_id"`
+	Nonce int    `json:"nonce"`
+}
+
+type SubmitResult struct {
+	Accepted bool `json:"accepted"`
+	Block    bool `json:"block"`
+}
+
+// Job is a unit of work. Each connection gets its own NonceStart so workers
+// never hash the same candidates.
+type Job struct {
+	JobID           string                    `json:"job_id"`
+	Template        *blockchain.BlockTemplate `json:"template"`
+	ShareDifficulty int                       `json:"share_difficulty"`
+	NonceStart      int                       `json:"nonce_start"`
+	CleanJobs       bool                      `json:"clean_jobs"`
+}
@@ -0,0 +1,124 @@
+package pool
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+)
+
+const maxMessageSize = 16 << 20
+
+// Worker connects to a pool, searches the nonces of each job it is sent and
+// submits every share it finds.
+type Worker struct {
+	poolAddress string
+	address     string
+
+	mux       sync.Mutex
+	cancelJob context.CancelFunc
+	nextID    int64
+}
+
+func NewWorker(poolAddress, address string) *Worker {
+	return &Worker{
+		poolAddress: poolAddress,
+		address:     address,
+	}
+}
+
+func (w *Worker) Run(ctx context.Context) error {
+	var d net.Dialer
+	nc, err := d.DialContext(ctx, "tcp", w.poolAddress)
+	if err != nil {
+		return err
+	}
+	c := newConn(nc)
+	defer c.Close()
+	go func() {
+		<-ctx.Done()
+		c.Close()
+	}()
+	defer w.stopJob()
+
+	if err := w.request(c, MethodAuthorize, &AuthorizeParams{Worker: w.address}); err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(c)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxMessageSize)
+	for scanner.Scan() {
+		var m message
+		if err := json.Unmarshal(scanner.Bytes(), &m); err != nil {
+			return err
+		}
+
+		switch {
+		case m.Method == MethodNotify:
+			var j Job
+			if err := json.Unmarshal(m.Params, &j); err != nil {
+				return err
+			}
+			w.startJob(ctx, c, &j)
+		case m.Error != "":
+			log.Printf("pool worker: request %d failed with err: %s", *m.ID, m.Error)
+		}
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("pool closed the connection")
+}
+
+func (w *Worker) startJob(ctx context.Context, c *conn, j *Job) {
+	w.stopJob()
+
+	ctx, cancel := context.WithCancel(ctx)
+	w.mux.Lock()
+	w.cancelJob = cancel
+	w.mux.Unlock()
+
+	go func() {
+		for nonce := j.NonceStart; nonce < j.NonceStart+nonceRange && ctx.Err() == nil; nonce++ {
+			valid, err := j.Template.Meets(nonce, j.ShareDifficulty)
+			if err != nil {
+				log.Printf("pool worker: failed to hash nonce %d with err: %s", nonce, err)
+				return
+			}
+			if !valid {
+				continue
+			}
+			if err := w.request(c, MethodSubmit, &SubmitParams{JobID: j.JobID, Nonce: nonce}); err != nil {
+				return
+			}
+		}
+	}()
+}
+
+func (w *Worker) stopJob() {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if w.cancelJob != nil {
+		w.cancelJob()
+		w.cancelJob = nil
+	}
+}
+
+func (w *Worker) request(c *conn, method string, params interface{}) error {
+	b, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	w.mux.Lock()
+	w.nextID++
+	id := w.nextID
+	w.mux.Unlock()
+	return c.write(&message{ID: &id, Method: method, Params: b})
+}
@@ -0,0 +1,87 @@
+package vm
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Assemble turns whitespace separated instructions into bytecode. "PUSH x"
+// pushes x, in decimal or 0x hex, with the shortest PUSHn. "name:" is a
+// JUMPDEST and "PUSH @name" pushes its offset. ";" starts a comment.
+func Assemble(src string) ([]byte, error) {
+	var tokens []string
+	for _, line := range strings.Split(src, "\n") {
+		if i := strings.Index(line, ";"); i >= 0 {
+			line = line[:i]
+		}
+		tokens = append(tokens, strings.Fields(line)...)
+	}
+
+	// Labels are pushed with PUSH2, so the offsets are known in one pass
+	// and patched in the second.
+	var code []byte
+	labels := make(map[string]int)
+	patches := make(map[int]string)
+	for i := 0; i < len(tokens); i++ {
+		tok := strings.ToUpper(tokens[i])
+		if strings.HasSuffix(tok, ":") {
+			name := strings.TrimSuffix(tokens[i], ":")
+			if _, ok := labels[name]; ok {
+				return nil, fmt.Errorf("label %s defined twice", name)
+			}
+			labels[name] = len(code)
+			code = append(code, byte(JUMPDEST))
+			continue
+		}
+		if tok == "PUSH" {
+			if i+1 == len(tokens) {
+				return nil, fmt.Errorf("PUSH without a value")
+			}
+			i++
+			arg := tokens[i]
+			if strings.HasPrefix(arg, "@") {
+				patches[len(code)+1] = arg[1:]
+				code = append(code, byte(PUSH1+1), 0, 0)
+				continue
+			}
+			v, ok := new(big.Int).SetString(arg, 0)
+			if !ok || v.Sign() < 0 || v.BitLen() > 256 {
+				return nil, fmt.Errorf("invalid PUSH value %q", arg)
+			}
+			b := v.Bytes()
+			if len(b) == 0 {
+				b = []byte{0}
+			}
+			code = append(code, byte(PUSH1+Op(len(b)-1)))
+			code = append(code, b...)
+			continue
+		}
+		op, ok := opByName(tok)
+		if !ok || op.isPush() {
+			return nil, fmt.Errorf("unknown instruction %q", tokens[i])
+		}
+		code = append(code, byte(op))
+	}
+
+	for at, name := range patches {
+		offset, ok := labels[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown label %s", name)
+		}
+		if offset > 0xffff {
+			return nil, fmt.Errorf("label %s at %d is out of PUSH2 range", name, offset)
+		}
+		code[at], code[at+1] = byte(offset>>8), byte(offset)
+	}
+	return code, nil
+}
+
+func opByName(name string) (Op, bool) {
+	for op, n := range names {
+		if n == name {
+			return op, true
+		}
+	}
+	return 0, false
+}
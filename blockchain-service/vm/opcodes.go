@@ -0,0 +1,136 @@
+package vm
+
+import "fmt"
+
+// Op is an instruction of the machine. The opcodes are those of the EVM for
+// the instructions both have, contracts have no memory and no calls.
+type Op byte
+
+const (
+	STOP Op = 0x00
+	ADD  Op = 0x01
+	MUL  Op = 0x02
+	SUB  Op = 0x03
+	DIV  Op = 0x04
+	MOD  Op = 0x06
+
+	LT     Op = 0x10
+	GT     Op = 0x11
+	EQ     Op = 0x14
+	ISZERO Op = 0x15
+	AND    Op = 0x16
+	OR     Op = 0x17
+	XOR    Op = 0x18
+	NOT    Op = 0x19
+
+	// SHA256 hashes the two words on top of the stack, contracts use it to
+	// derive storage keys.
+	SHA256 Op = 0x20
+
+	ADDRESS      Op = 0x30
+	CALLER       Op = 0x33
+	CALLDATALOAD Op = 0x35
+	CALLDATASIZE Op = 0x36
+	HEIGHT       Op = 0x43
+
+	POP      Op = 0x50
+	SLOAD    Op = 0x54
+	SSTORE   Op = 0x55
+	JUMP     Op = 0x56
+	JUMPI    Op = 0x57
+	GAS      Op = 0x5a
+	JUMPDEST Op = 0x5b
+
+	PUSH1  Op = 0x60
+	PUSH32 Op = 0x7f
+	DUP1   Op = 0x80
+	DUP16  Op = 0x8f
+	SWAP1  Op = 0x90
+	SWAP16 Op = 0x9f
+	LOG0   Op = 0xa0
+	LOG4   Op = 0xa4
+
+	RETURN Op = 0xf3
+	REVERT Op = 0xfd
+)
+
+// Gas costs of the instructions.
+const (
+	GasQuick    = 2
+	GasFastest  = 3
+	GasFast     = 5
+	GasJump     = 8
+	GasJumpI    = 10
+	GasJumpDest = 1
+	GasSHA256   = 30
+	GasSLoad    = 200
+	GasSStore   = 5000
+	GasLog      = 375
+	GasLogTopic = 375
+	// GasCodeByte is paid for every byte of deployed code.
+	GasCodeByte = 200
+)
+
+var names = map[Op]string{
+	STOP: "STOP", ADD: "ADD", MUL: "MUL", SUB: "SUB", DIV: "DIV", MOD: "MOD",
+	LT: "LT", GT: "GT", EQ: "EQ", ISZERO: "ISZERO", AND: "AND", OR: "OR", XOR: "XOR", NOT: "NOT",
+	SHA256: "SHA256", ADDRESS: "ADDRESS", CALLER: "CALLER", CALLDATALOAD: "CALLDATALOAD",
+	CALLDATASIZE: "CALLDATASIZE", HEIGHT: "HEIGHT", POP: "POP", SLOAD: "SLOAD", SSTORE: "SSTORE",
+	JUMP: "JUMP", JUMPI: "JUMPI", GAS: "GAS", JUMPDEST: "JUMPDEST", RETURN: "RETURN", REVERT: "REVERT",
+}
+
+func init() {
+	for n := 1; n <= 32; n++ {
+		names[PUSH1+Op(n-1)] = fmt.Sprintf("PUSH%d", n)
+	}
+	for n := 1; n <= 16; n++ {
+		names[DUP1+Op(n-1)] = fmt.Sprintf("DUP%d", n)
+		names[SWAP1+Op(n-1)] = fmt.Sprintf("SWAP%d", n)
+	}
+	for n := 0; n <= 4; n++ {
+		names[LOG0+Op(n)] = fmt.Sprintf("LOG%d", n)
+	}
+}
+
+func (op Op) String() string {
+	if name, ok := names[op]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%02x", byte(op))
+}
+
+func (op Op) valid() bool {
+	_, ok := names[op]
+	return ok
+}
+
+func (op Op) isPush() bool {
+	return op >= PUSH1 && op <= PUSH32
+}
+
+// gas is the cost of op, the topics of a log included.
+func (op Op) gas() uint64 {
+	switch {
+	case op == STOP || op == RETURN || op == REVERT:
+		return 0
+	case op == JUMPDEST:
+		return GasJumpDest
+	case op == ADDRESS || op == CALLER || op == CALLDATASIZE || op == HEIGHT || op == POP || op == GAS:
+		return GasQuick
+	case op == MUL || op == DIV || op == MOD:
+		return GasFast
+	case op == JUMP:
+		return GasJump
+	case op == JUMPI:
+		return GasJumpI
+	case op == SHA256:
+		return GasSHA256
+	case op == SLOAD:
+		return GasSLoad
+	case op == SSTORE:
+		return GasSStore
+	case op >= LOG0 && op <= LOG4:
+		return GasLog + GasLogTopic*uint64(op-LOG0)
+	}
+	return GasFastest
+}
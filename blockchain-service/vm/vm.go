@@ -0,0 +1,404 @@
+// Package vm runs contract bytecode. The machine is a stack of 256 bit words
+// with a key-value storage per contract. Every instruction costs gas and a
+// call stops when its gas runs out, so contracts always terminate and every
+// node gets the same result.
+package vm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// StackLimit is the most words the stack holds.
+const StackLimit = 1024
+
+var (
+	ErrOutOfGas       = errors.New("out of gas")
+	ErrStackUnderflow = errors.New("stack underflow")
+	ErrStackOverflow  = errors.New("stack overflow")
+	ErrInvalidOpcode  = errors.New("invalid opcode")
+	ErrInvalidJump    = errors.New("invalid jump destination")
+	ErrReverted       = errors.New("execution reverted")
+)
+
+// Word is a 256 bit unsigned integer, big endian.
+type Word [32]byte
+
+var modulus = new(big.Int).Lsh(big.NewInt(1), 256)
+
+func WordFromUint64(v uint64) Word {
+	return WordFromBig(new(big.Int).SetUint64(v))
+}
+
+// WordFromBig wraps v modulo 2^256.
+func WordFromBig(v *big.Int) Word {
+	var w Word
+	new(big.Int).Mod(v, modulus).FillBytes(w[:])
+	return w
+}
+
+// AddressWord is how contracts see a blockchain address.
+func AddressWord(address string) Word {
+	return sha256.Sum256([]byte(address))
+}
+
+func (w Word) Big() *big.Int {
+	return new(big.Int).SetBytes(w[:])
+}
+
+// Uint64 returns w when it fits in 64 bits.
+func (w Word) Uint64() (uint64, bool) {
+	b := w.Big()
+	return b.Uint64(), b.IsUint64()
+}
+
+func (w Word) IsZero() bool {
+	return w == Word{}
+}
+
+func (w Word) String() string {
+	return hex.EncodeToString(w[:])
+}
+
+// MarshalText encodes w in hex, in JSON and as a map key.
+func (w Word) MarshalText() ([]byte, error) {
+	return []byte(w.String()), nil
+}
+
+func (w *Word) UnmarshalText(text []byte) error {
+	b, err := hex.DecodeString(string(text))
+	if err != nil {
+		return err
+	}
+	if len(b) > len(w) {
+		return fmt.Errorf("word of %d bytes", len(b))
+	}
+	*w = Word{}
+	copy(w[len(w)-len(b):], b)
+	return nil
+}
+
+// Context is what a contract knows about the call it runs in.
+type Context struct {
+	Caller   string
+	Contract string
+	Height   int
+	Input    []byte
+}
+
+// Storage is the storage of the contract before the call.
+type Storage interface {
+	Get(key Word) Word
+}
+
+// Log is an event emitted by a contract. Topics are what clients filter
+// logs on.
+type Log struct {
+	Topics []Word
+	Data   Word
+}
+
+// Result is the outcome of a call. Writes and Logs are only set when the
+// call succeeded, the storage is left as it was otherwise. A call that
+// failed uses all its gas, one that reverted only the gas up to REVERT.
+type Result struct {
+	Output  Word
+	GasUsed uint64
+	Writes  map[Word]Word
+	Logs    []Log
+	Err     error
+}
+
+// Execute runs code in ctx with at most gas.
+func Execute(code []byte, ctx *Context, storage Storage, gas uint64) *Result {
+	in := &interpreter{
+		code:      code,
+		ctx:       ctx,
+		storage:   storage,
+		gas:       gas,
+		jumpdests: jumpDests(code),
+		writes:    make(map[Word]Word),
+	}
+	output, err := in.run()
+	r := &Result{Output: output, GasUsed: gas - in.gas, Err: err}
+	switch {
+	case err == nil:
+		r.Writes, r.Logs = in.writes, in.logs
+	case !errors.Is(err, ErrReverted):
+		r.GasUsed = gas
+	}
+	return r
+}
+
+// jumpDests marks the JUMPDEST instructions of code, leaving out the bytes
+// pushed by PUSH instructions.
+func jumpDests(code []byte) map[int]bool {
+	dests := make(map[int]bool)
+	for pc := 0; pc < len(code); pc++ {
+		op := Op(code[pc])
+		if op == JUMPDEST {
+			dests[pc] = true
+		}
+		if op.isPush() {
+			pc += int(op-PUSH1) + 1
+		}
+	}
+	return dests
+}
+
+type interpreter struct {
+	code      []byte
+	ctx       *Context
+	storage   Storage
+	gas       uint64
+	jumpdests map[int]bool
+	stack     []Word
+	writes    map[Word]Word
+	logs      []Log
+}
+
+func (in *interpreter) push(w Word) error {
+	if len(in.stack) >= StackLimit {
+		return ErrStackOverflow
+	}
+	in.stack = append(in.stack, w)
+	return nil
+}
+
+func (in *interpreter) pop() (Word, error) {
+	if len(in.stack) == 0 {
+		return Word{}, ErrStackUnderflow
+	}
+	w := in.stack[len(in.stack)-1]
+	in.stack = in.stack[:len(in.stack)-1]
+	return w, nil
+}
+
+func (in *interpreter) load(key Word) Word {
+	if v, ok := in.writes[key]; ok {
+		return v
+	}
+	return in.storage.Get(key)
+}
+
+func boolWord(b bool) Word {
+	if b {
+		return WordFromUint64(1)
+	}
+	return Word{}
+}
+
+// binary applies f to the top of the stack and the word under it.
+func (in *interpreter) binary(f func(a, b *big.Int) *big.Int) error {
+	a, err := in.pop()
+	if err != nil {
+		return err
+	}
+	b, err := in.pop()
+	if err != nil {
+		return err
+	}
+	return in.push(WordFromBig(f(a.Big(), b.Big())))
+}
+
+func (in *interpreter) run() (Word, error) {
+	for pc := 0; pc < len(in.code); pc++ {
+		op := Op(in.code[pc])
+		if !op.valid() {
+			return Word{}, fmt.Errorf("%w %s at %d", ErrInvalidOpcode, op, pc)
+		}
+		cost := op.gas()
+		if cost > in.gas {
+			in.gas = 0
+			return Word{}, ErrOutOfGas
+		}
+		in.gas -= cost
+
+		var err error
+		switch {
+		case op.isPush():
+			n := int(op-PUSH1) + 1
+			var w Word
+			// Code ending in the middle of a push is padded with zeros.
+			end := pc + 1 + n
+			if end > len(in.code) {
+				end = len(in.code)
+			}
+			copy(w[32-n:], in.code[pc+1:end])
+			err = in.push(w)
+			pc += n
+		case op >= DUP1 && op <= DUP16:
+			n := int(op-DUP1) + 1
+			if len(in.stack) < n {
+				return Word{}, ErrStackUnderflow
+			}
+			err = in.push(in.stack[len(in.stack)-n])
+		case op >= SWAP1 && op <= SWAP16:
+			n := int(op-SWAP1) + 1
+			if len(in.stack) <= n {
+				return Word{}, ErrStackUnderflow
+			}
+			top := len(in.stack) - 1
+			in.stack[top], in.stack[top-n] = in.stack[top-n], in.stack[top]
+		case op >= LOG0 && op <= LOG4:
+			var l Log
+			if l.Data, err = in.pop(); err != nil {
+				return Word{}, err
+			}
+			for i := 0; i < int(op-LOG0); i++ {
+				topic, err := in.pop()
+				if err != nil {
+					return Word{}, err
+				}
+				l.Topics = append(l.Topics, topic)
+			}
+			in.logs = append(in.logs, l)
+		default:
+			var next int
+			var stop bool
+			var output Word
+			next, stop, output, err = in.step(op, pc)
+			if stop || err != nil {
+				return output, err
+			}
+			pc = next
+		}
+		if err != nil {
+			return Word{}, err
+		}
+	}
+	return Word{}, nil
+}
+
+// step runs the instructions that are not a family. It returns the pc of the
+// instruction before the next one and whether the call ends.
+func (in *interpreter) step(op Op, pc int) (int, bool, Word, error) {
+	var err error
+	switch op {
+	case STOP:
+		return pc, true, Word{}, nil
+	case ADD:
+		err = in.binary(func(a, b *big.Int) *big.Int { return a.Add(a, b) })
+	case MUL:
+		err = in.binary(func(a, b *big.Int) *big.Int { return a.Mul(a, b) })
+	case SUB:
+		err = in.binary(func(a, b *big.Int) *big.Int { return a.Sub(a, b) })
+	case DIV:
+		err = in.binary(func(a, b *big.Int) *big.Int {
+			if b.Sign() == 0 {
+				return b
+			}
+			return a.Div(a, b)
+		})
+	case MOD:
+		err = in.binary(func(a, b *big.Int) *big.Int {
+			if b.Sign() == 0 {
+				return b
+			}
+			return a.Mod(a, b)
+		})
+	case LT, GT, EQ:
+		err = in.binary(func(a, b *big.Int) *big.Int {
+			c := a.Cmp(b)
+			return boolWord(op == LT && c < 0 || op == GT && c > 0 || op == EQ && c == 0).Big()
+		})
+	case AND:
+		err = in.binary(func(a, b *big.Int) *big.Int { return a.And(a, b) })
+	case OR:
+		err = in.binary(func(a, b *big.Int) *big.Int { return a.Or(a, b) })
+	case XOR:
+		err = in.binary(func(a, b *big.Int) *big.Int { return a.Xor(a, b) })
+	case ISZERO, NOT:
+		var a Word
+		if a, err = in.pop(); err != nil {
+			break
+		}
+		if op == ISZERO {
+			err = in.push(boolWord(a.IsZero()))
+			break
+		}
+		for i := range a {
+			a[i] = ^a[i]
+		}
+		err = in.push(a)
+	case SHA256:
+		var a, b Word
+		if a, err = in.pop(); err != nil {
+			break
+		}
+		if b, err = in.pop(); err != nil {
+			break
+		}
+		err = in.push(sha256.Sum256(append(a[:], b[:]...)))
+	case ADDRESS:
+		err = in.push(AddressWord(in.ctx.Contract))
+	case CALLER:
+		err = in.push(AddressWord(in.ctx.Caller))
+	case CALLDATALOAD:
+		var offset Word
+		if offset, err = in.pop(); err != nil {
+			break
+		}
+		var w Word
+		if o, ok := offset.Uint64(); ok && o < uint64(len(in.ctx.Input)) {
+			copy(w[:], in.ctx.Input[o:])
+		}
+		err = in.push(w)
+	case CALLDATASIZE:
+		err = in.push(WordFromUint64(uint64(len(in.ctx.Input))))
+	case HEIGHT:
+		err = in.push(WordFromUint64(uint64(in.ctx.Height)))
+	case POP:
+		_, err = in.pop()
+	case SLOAD:
+		var key Word
+		if key, err = in.pop(); err != nil {
+			break
+		}
+		err = in.push(in.load(key))
+	case SSTORE:
+		var key, value Word
+		if key, err = in.pop(); err != nil {
+			break
+		}
+		if value, err = in.pop(); err != nil {
+			break
+		}
+		in.writes[key] = value
+	case JUMP, JUMPI:
+		var dest, cond Word
+		if dest, err = in.pop(); err != nil {
+			break
+		}
+		if op == JUMPI {
+			if cond, err = in.pop(); err != nil {
+				break
+			}
+			if cond.IsZero() {
+				break
+			}
+		}
+		d, ok := dest.Uint64()
+		if !ok || !in.jumpdests[int(d)] {
+			return pc, true, Word{}, fmt.Errorf("%w %s", ErrInvalidJump, dest.Big())
+		}
+		// The loop moves past the JUMPDEST, which costs nothing then.
+		return int(d), false, Word{}, nil
+	case GAS:
+		err = in.push(WordFromUint64(in.gas))
+	case JUMPDEST:
+	case RETURN, REVERT:
+		var output Word
+		if output, err = in.pop(); err != nil {
+			break
+		}
+		if op == REVERT {
+			return pc, true, output, ErrReverted
+		}
+		return pc, true, output, nil
+	}
+	return pc, false, Word{}, err
+}
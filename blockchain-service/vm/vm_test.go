@@ -0,0 +1,125 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+type mapStorage map[Word]Word
+
+func (s mapStorage) Get(key Word) Word { return s[key] }
+
+// counter adds the first input word to slot 0, logs the new value under the
+// caller and returns it.
+const counter = `
+	PUSH 0 SLOAD
+	PUSH 0 CALLDATALOAD
+	ADD
+	DUP1 PUSH 0 SSTORE
+	DUP1 CALLER SWAP1 LOG1
+	RETURN
+`
+
+func input(v uint64) []byte {
+	w := WordFromUint64(v)
+	return w[:]
+}
+
+func Test_Execute(t *testing.T) {
+	code, err := Assemble(counter)
+	if err != nil {
+		t.Fatalf("Failed to Assemble with err: %s", err)
+	}
+	storage := mapStorage{}
+	storage[Word{}] = WordFromUint64(40)
+	ctx := &Context{Caller: "niko", Contract: "counter", Height: 1, Input: input(2)}
+
+	r := Execute(code, ctx, storage, 100000)
+	if r.Err != nil {
+		t.Fatalf("Failed to Execute with err: %s", r.Err)
+	}
+	if v, _ := r.Output.Uint64(); v != 42 {
+		t.Errorf("Expected 42, got %d", v)
+	}
+	if v, _ := r.Writes[Word{}].Uint64(); v != 42 || len(r.Writes) != 1 {
+		t.Errorf("Expected slot 0 to be written with 42, got %v", r.Writes)
+	}
+	if len(r.Logs) != 1 || r.Logs[0].Topics[0] != AddressWord("niko") {
+		t.Errorf("Expected a log under the caller, got %+v", r.Logs)
+	}
+	if v, _ := storage[Word{}].Uint64(); v != 40 {
+		t.Errorf("Expected the storage to be left to the caller, got %d", v)
+	}
+	used := r.GasUsed
+	if want := uint64(GasSLoad + GasSStore + GasLog + GasLogTopic + 8*GasFastest + GasQuick); used != want {
+		t.Errorf("Expected %d gas used, got %d", want, used)
+	}
+
+	// Running out of gas uses it all and leaves nothing behind.
+	r = Execute(code, ctx, storage, used-1)
+	if !errors.Is(r.Err, ErrOutOfGas) || r.GasUsed != used-1 || r.Writes != nil || r.Logs != nil {
+		t.Errorf("Expected ErrOutOfGas without writes, got %+v", r)
+	}
+
+	// Arithmetic wraps at 2^256.
+	r = Execute(mustAssemble(t, "PUSH 1 PUSH 0 SUB PUSH 1 ADD RETURN"), ctx, storage, 1000)
+	if r.Err != nil || !r.Output.IsZero() {
+		t.Errorf("Expected 0 - 1 + 1 to wrap to 0, got %s err %v", r.Output, r.Err)
+	}
+}
+
+func Test_Control(t *testing.T) {
+	owner := AddressWord("niko")
+	code := mustAssemble(t, fmt.Sprintf(`
+		CALLER PUSH 0x%s EQ
+		PUSH @ok JUMPI
+		PUSH 1 REVERT
+	ok:
+		PUSH 7 RETURN
+	`, owner))
+	storage := mapStorage{}
+
+	r := Execute(code, &Context{Caller: "niko"}, storage, 1000)
+	if v, _ := r.Output.Uint64(); r.Err != nil || v != 7 {
+		t.Errorf("Expected the owner to get 7, got %d err %v", v, r.Err)
+	}
+	r = Execute(code, &Context{Caller: "itay"}, storage, 1000)
+	if !errors.Is(r.Err, ErrReverted) || r.GasUsed == 1000 {
+		t.Errorf("Expected a revert paying only the gas used, got %+v", r)
+	}
+
+	// Jumping into push data is refused.
+	r = Execute(mustAssemble(t, "PUSH 0x5b5b PUSH 1 JUMP"), &Context{}, storage, 1000)
+	if !errors.Is(r.Err, ErrInvalidJump) {
+		t.Errorf("Expected ErrInvalidJump, got: %v", r.Err)
+	}
+	r = Execute([]byte{0xef}, &Context{}, storage, 1000)
+	if !errors.Is(r.Err, ErrInvalidOpcode) {
+		t.Errorf("Expected ErrInvalidOpcode, got: %v", r.Err)
+	}
+	r = Execute(mustAssemble(t, "ADD"), &Context{}, storage, 1000)
+	if !errors.Is(r.Err, ErrStackUnderflow) {
+		t.Errorf("Expected ErrStackUnderflow, got: %v", r.Err)
+	}
+	// An endless loop ends with its gas.
+	r = Execute(mustAssemble(t, "loop: PUSH @loop JUMP"), &Context{}, storage, 1000)
+	if !errors.Is(r.Err, ErrOutOfGas) {
+		t.Errorf("Expected ErrOutOfGas, got: %v", r.Err)
+	}
+
+	if _, err := Assemble("PUSH @nowhere"); err == nil {
+		t.Errorf("Expected an unknown label to be refused")
+	}
+	if _, err := Assemble("PUSH1 1"); err == nil {
+		t.Errorf("Expected PUSHn to be left to PUSH")
+	}
+}
+
+func mustAssemble(t *testing.T, src string) []byte {
+	code, err := Assemble(src)
+	if err != nil {
+		t.Fatalf("Failed to Assemble with err: %s", err)
+	}
+	return code
+}
@@ -1,11 +1,17 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
+	"blockchain/blockchain-service/lightclient"
+	"blockchain/blockchain-service/network-params"
 	wallet_server "blockchain/blockchain-service/wallet-server"
 )
 
@@ -14,17 +20,53 @@ func init() {
 }
 
 func main() {
-	p := flag.Uint("port", 4999, "TCP Port Number for wallet server")
-	gateway := flag.String("gateway", "http://127.0.0.1:5000", "Blockchain Gateway")
+	p := flag.Uint("port", 0, "TCP Port Number for wallet server, defaults to the network wallet port")
+	gateway := flag.String("gateway", "", "Blockchain Gateway, defaults to the local node of the network")
+	networkName := flag.String("network", "mainnet", "Network to use: mainnet, testnet or regtest")
+	genesis := flag.String("genesis", "", "Genesis spec file of the chain, needed by the light client to check the headers")
+	peers := flag.String("peers", "", "Comma separated blockchain nodes to follow with a light client instead of trusting the gateway")
 	flag.Parse()
 
-	walletSrv := wallet_server.New(uint16(*p), *gateway)
+	params, err := network_params.ByName(*networkName)
+	if err != nil {
+		log.Fatalf("Failed to select network with err: %s", err)
+	}
+	if *genesis != "" {
+		spec, err := network_params.LoadGenesisSpec(*genesis)
+		if err != nil {
+			log.Fatalf("Failed to load genesis spec with err: %s", err)
+		}
+		if params, err = spec.Apply(params); err != nil {
+			log.Fatalf("Failed to apply genesis spec with err: %s", err)
+		}
+	}
+	if *p == 0 {
+		*p = uint(params.DefaultWalletPort)
+	}
+	if *gateway == "" {
+		*gateway = fmt.Sprintf("http://127.0.0.1:%d", params.DefaultBlockchainPort)
+	}
+
+	var node wallet_server.Node = wallet_server.NewGateway(*gateway)
+	if *peers != "" {
+		lc, err := lightclient.New(params, strings.Split(*peers, ","))
+		if err != nil {
+			log.Fatalf("Failed to instantiate the light client with err: %s", err)
+		}
+		go lc.Start(context.Background(), 10*time.Second)
+		node = lc
+	}
+
+	walletSrv := wallet_server.New(uint16(*p), node, params)
 	transport := wallet_server.NewTransport(walletSrv)
 
 	http.HandleFunc("/", transport.HandleIndex)
 	http.HandleFunc("/wallet", transport.HandleWallet)
 	http.HandleFunc("/wallet/balance", transport.HandleBalance)
 	http.HandleFunc("/transactions", transport.HandleTransaction)
+	http.HandleFunc("/multisig/address", transport.HandleMultisigAddress)
+	http.HandleFunc("/multisig/transactions", transport.HandleMultisigTransaction)
+	http.HandleFunc("/multisig/signatures", transport.HandleMultisigSignature)
 
 	if err := http.ListenAndServe("0.0.0.0:"+strconv.Itoa(int(*p)), nil); err != nil {
 		log.Fatalf("Failed ListenAndServe with err: %s", err)
@@ -0,0 +1,214 @@
+package wallet_server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"blockchain/blockchain-service/blockchain"
+	"blockchain/blockchain-service/wallet"
+	"blockchain/foundation/cryptography"
+)
+
+// multisigProposal is a multisig transaction collecting signatures. Hash is
+// what every signer signs.
+type multisigProposal struct {
+	ID                         string            `json:"id"`
+	SenderBlockchainAddress    string            `json:"sender_blockchain_address"`
+	RecipientBlockchainAddress string            `json:"recipient_blockchain_address"`
+	Value                      float32           `json:"value"`
+	Fee                        float32           `json:"fee,omitempty"`
+	Nonce                      uint64            `json:"nonce,omitempty"`
+	Threshold                  int               `json:"threshold"`
+	PublicKeys                 []string          `json:"sender_public_keys"`
+	Hash                       string            `json:"hash"`
+	Signatures                 map[string]string `json:"signatures"`
+	Submitted                  bool              `json:"submitted"`
+
+	// submitting is set while the transaction is sent to the node, so it is
+	// sent once.
+	submitting bool
+}
+
+// request copies the proposal into a transaction request, which stays valid
+// once the lock on the proposals is released.
+func (p multisigProposal) request() blockchain.TransactionRequest {
+	var signatures []string
+	for _, k := range p.PublicKeys {
+		if sig, ok := p.Signatures[k]; ok {
+			signatures = append(signatures, sig)
+		}
+	}
+	p.PublicKeys = append([]string(nil), p.PublicKeys...)
+
+	return blockchain.TransactionRequest{
+		SenderBlockchainAddress:    &p.SenderBlockchainAddress,
+		RecipientBlockchainAddress: &p.RecipientBlockchainAddress,
+		Value:                      &p.Value,
+		Fee:                        &p.Fee,
+		Nonce:                      &p.Nonce,
+		Threshold:                  &p.Threshold,
+		SenderPublicKeys:           &p.PublicKeys,
+		Signatures:                 &signatures,
+	}
+}
+
+func (s *Server) MultisigAddress(publicKeys []string, threshold int) ([]byte, error) {
+	pKeys, err := parsePublicKeys(publicKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	address, err := cryptography.GenerateMultisigAddress(threshold, pKeys, s.params)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(struct {
+		BlockchainAddress string `json:"blockchain_address"`
+	}{
+		BlockchainAddress: address,
+	})
+}
+
+func (s *Server) CreateMultisigTransaction(publicKeys []string, threshold int, recipientBlockchainAddress, v string, f, n *string) ([]byte, error) {
+	pKeys, err := parsePublicKeys(publicKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	address, err := cryptography.GenerateMultisigAddress(threshold, pKeys, s.params)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.validateAddresses(recipientBlockchainAddress); err != nil {
+		return nil, err
+	}
+
+	value, err := strconv.ParseFloat(v, 32)
+	if err != nil {
+		return nil, err
+	}
+	fee, err := parseFee(f)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := s.nonce(n, address)
+	if err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	hash, err := wallet.NewTransactionWithNonce(nil, pKeys[0], address, recipientBlockchainAddress, float32(value), fee, nonce).Hash()
+	if err != nil {
+		return nil, err
+	}
+
+	p := &multisigProposal{
+		ID:                         hex.EncodeToString(id),
+		SenderBlockchainAddress:    address,
+		RecipientBlockchainAddress: recipientBlockchainAddress,
+		Value:                      float32(value),
+		Fee:                        fee,
+		Nonce:                      nonce,
+		Threshold:                  threshold,
+		PublicKeys:                 publicKeys,
+		Hash:                       hex.EncodeToString(hash[:]),
+		Signatures:                 map[string]string{},
+	}
+
+	s.muxProposals.Lock()
+	s.proposals[p.ID] = p
+	s.muxProposals.Unlock()
+
+	return json.Marshal(p)
+}
+
+func (s *Server) MultisigTransaction(id string) ([]byte, error) {
+	s.muxProposals.Lock()
+	defer s.muxProposals.Unlock()
+
+	p, ok := s.proposals[id]
+	if !ok {
+		return nil, fmt.Errorf("multisig transaction %s not found", id)
+	}
+	return json.Marshal(p)
+}
+
+// SignMultisigTransaction adds the signature of a signer over the hash of the
+// proposal, once it verifies. The transaction is sent to the node when the
+// threshold is reached, without holding the lock on the proposals.
+func (s *Server) SignMultisigTransaction(id, signerPublicKey, signature string) ([]byte, error) {
+	s.muxProposals.Lock()
+	defer s.muxProposals.Unlock()
+
+	p, ok := s.proposals[id]
+	if !ok {
+		return nil, fmt.Errorf("multisig transaction %s not found", id)
+	}
+	if p.Submitted || p.submitting {
+		return nil, fmt.Errorf("multisig transaction %s already submitted", id)
+	}
+
+	member := false
+	for _, k := range p.PublicKeys {
+		if k == signerPublicKey {
+			member = true
+			break
+		}
+	}
+	if !member {
+		return nil, fmt.Errorf("public key is not part of the multisig set")
+	}
+
+	publicKey, err := cryptography.PublicKeyFromString(signerPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	sign, err := cryptography.ParseSignature(signature, publicKey.KeyType())
+	if err != nil {
+		return nil, err
+	}
+	hash, err := hex.DecodeString(p.Hash)
+	if err != nil {
+		return nil, err
+	}
+	if !publicKey.Verify(hash, sign) {
+		return nil, fmt.Errorf("signature does not verify for the multisig transaction %s", id)
+	}
+	p.Signatures[signerPublicKey] = sign.String()
+
+	if len(p.Signatures) >= p.Threshold {
+		tr := p.request()
+		p.submitting = true
+		s.muxProposals.Unlock()
+		err := s.node.SendTransaction(&tr)
+		s.muxProposals.Lock()
+		p.submitting = false
+		if err != nil {
+			return nil, err
+		}
+		p.Submitted = true
+	}
+
+	return json.Marshal(p)
+}
+
+func parsePublicKeys(publicKeys []string) ([]cryptography.PublicKey, error) {
+	pKeys := make([]cryptography.PublicKey, len(publicKeys))
+	for i, k := range publicKeys {
+		pKey, err := cryptography.PublicKeyFromString(k)
+		if err != nil {
+			return nil, err
+		}
+		pKeys[i] = pKey
+	}
+	return pKeys, nil
+}
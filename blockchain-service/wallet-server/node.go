@@ -0,0 +1,108 @@
+package wallet_server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"blockchain/blockchain-service/blockchain"
+)
+
+// Node is what the wallet server reads balances from and sends transactions
+// to. A Gateway trusts a single blockchain node, a light client checks what
+// its peers answer against the headers it synced.
+type Node interface {
+	Balance(address string) (float32, error)
+	Assets(address string) ([]blockchain.AssetBalance, error)
+	NextNonce(address string) (uint64, error)
+	SendTransaction(tr *blockchain.TransactionRequest) error
+}
+
+// Gateway is a Node backed by the HTTP API of one blockchain node.
+type Gateway struct {
+	url    string
+	client *http.Client
+}
+
+func NewGateway(url string) *Gateway {
+	return &Gateway{
+		url:    strings.TrimSuffix(url, "/"),
+		client: &http.Client{},
+	}
+}
+
+func (g *Gateway) Balance(address string) (float32, error) {
+	res, err := g.balance(address)
+	if err != nil {
+		return 0, err
+	}
+	return res.Balance, nil
+}
+
+func (g *Gateway) Assets(address string) ([]blockchain.AssetBalance, error) {
+	res, err := g.balance(address)
+	if err != nil {
+		return nil, err
+	}
+	return res.Assets, nil
+}
+
+// NextNonce returns the nonce after the mined and pending transactions of
+// address.
+func (g *Gateway) NextNonce(address string) (uint64, error) {
+	res, err := g.balance(address)
+	if err != nil {
+		return 0, err
+	}
+	return res.NextNonce, nil
+}
+
+type balanceResponse struct {
+	Balance   float32                   `json:"balance"`
+	Assets    []blockchain.AssetBalance `json:"assets"`
+	NextNonce uint64                    `json:"next_nonce"`
+}
+
+func (g *Gateway) balance(address string) (*balanceResponse, error) {
+	url := g.url + "/balance"
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	q := req.URL.Query()
+	q.Add("bc_address", address)
+	req.URL.RawQuery = q.Encode()
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, fmt.Errorf("failed to GET url - %v, status: %s", url, resp.Status)
+	}
+
+	var res balanceResponse
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, fmt.Errorf("failed to parse balance response with err: %s", err)
+	}
+	return &res, nil
+}
+
+func (g *Gateway) SendTransaction(tr *blockchain.TransactionRequest) error {
+	b, err := json.Marshal(tr)
+	if err != nil {
+		return err
+	}
+	url := g.url + "/transactions"
+	resp, err := g.client.Post(url, "application/json", bytes.NewBuffer(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("failed to POST url - %v, status: %s", url, resp.Status)
+	}
+	return nil
+}
@@ -2,15 +2,16 @@ package wallet_server
 
 import (
 	"blockchain/blockchain-service/blockchain"
+	"blockchain/blockchain-service/network-params"
 	"blockchain/blockchain-service/wallet"
 	"blockchain/foundation/cryptography"
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"html/template"
-	"net/http"
 	"path"
 	"strconv"
+	"strings"
+	"sync"
 )
 
 const (
@@ -23,14 +24,20 @@ type Walleter interface {
 
 type Server struct {
 	port          uint16
-	gateway       string
+	node          Node
+	params        *network_params.Params
 	walletService Walleter
+
+	proposals    map[string]*multisigProposal
+	muxProposals sync.Mutex
 }
 
-func New(port uint16, gateway string) *Server {
+func New(port uint16, node Node, params *network_params.Params) *Server {
 	return &Server{
-		port:    port,
-		gateway: gateway,
+		port:      port,
+		node:      node,
+		params:    params,
+		proposals: map[string]*multisigProposal{},
 	}
 }
 
@@ -38,8 +45,8 @@ func (s *Server) Port() uint16 {
 	return s.port
 }
 
-func (s *Server) Gateway() string {
-	return s.gateway
+func (s *Server) Node() Node {
+	return s.node
 }
 
 func (s *Server) Index() (*template.Template, error) {
@@ -47,39 +54,36 @@ func (s *Server) Index() (*template.Template, error) {
 }
 
 func (s *Server) Balance(bcAddress string) ([]byte, error) {
-	url := s.gateway + "/balance"
-	client := http.Client{}
-	req, err := http.NewRequest(http.MethodGet, url, nil)
-	q := req.URL.Query()
-	q.Add("bc_address", bcAddress)
-	req.URL.RawQuery = q.Encode()
-	resp, err := client.Do(req)
-
+	balance, err := s.node.Balance(bcAddress)
 	if err != nil {
 		return nil, err
 	}
-	if err != nil || resp.StatusCode > 400 {
-		return nil, fmt.Errorf("failed to POST url - %v, err: %s", url, err)
-	}
-	decoder := json.NewDecoder(resp.Body)
-	var balanceResponse struct {
-		Balance float32 `json:"balance"`
-	}
-
-	if err = decoder.Decode(&balanceResponse); err != nil {
-		return nil, fmt.Errorf("failed to parse response - %v, to struct: %v", resp.Body, balanceResponse)
+	assets, err := s.node.Assets(bcAddress)
+	if err != nil {
+		return nil, err
 	}
 
-	b, err := json.Marshal(balanceResponse)
+	b, err := json.Marshal(struct {
+		Balance float32                   `json:"balance"`
+		Assets  []blockchain.AssetBalance `json:"assets"`
+	}{
+		Balance: balance,
+		Assets:  assets,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal balance - %v, with err: %s", balanceResponse, err)
+		return nil, fmt.Errorf("failed to marshal balance - %v, with err: %s", balance, err)
 	}
 
 	return b, nil
 }
 
-func (s *Server) Wallet() ([]byte, error) {
-	w, err := wallet.NewWallet(cryptography.GenerateBlockchainAddress)
+func (s *Server) Wallet(keyType string) ([]byte, error) {
+	kt, err := cryptography.KeyTypeFromString(keyType)
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := wallet.NewWallet(kt, s.params.GenerateBlockchainAddress)
 	if err != nil {
 		return nil, err
 	}
@@ -90,7 +94,9 @@ func (s *Server) Wallet() ([]byte, error) {
 	return b, nil
 }
 
-func (s *Server) CreateTransaction(senderPublicKey, senderPrivateKey, senderBlockchainAddress, recipientBlockchainAddress, v *string) ([]byte, error) {
+// CreateTransaction sends v of the base coin, or v tokens of asset when it
+// is set.
+func (s *Server) CreateTransaction(senderPublicKey, senderPrivateKey, senderBlockchainAddress, recipientBlockchainAddress, v, f, n, asset *string) ([]byte, error) {
 	publicKey, err := cryptography.PublicKeyFromString(*senderPublicKey)
 	if err != nil {
 		return nil, err
@@ -101,13 +107,32 @@ func (s *Server) CreateTransaction(senderPublicKey, senderPrivateKey, senderBloc
 		return nil, err
 	}
 
+	if err := s.validateAddresses(*senderBlockchainAddress, *recipientBlockchainAddress); err != nil {
+		return nil, err
+	}
+	if derived := s.params.GenerateBlockchainAddress(publicKey); derived != *senderBlockchainAddress {
+		return nil, &blockchain.AddressMismatchError{Sender: *senderBlockchainAddress, Derived: derived}
+	}
+
+	fee, err := parseFee(f)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := s.nonce(n, *senderBlockchainAddress)
+	if err != nil {
+		return nil, err
+	}
+	if asset != nil && *asset != "" {
+		return nil, s.sendAsset(publicKey, privateKey, *senderBlockchainAddress, *recipientBlockchainAddress, *asset, *v, fee, nonce)
+	}
+
 	value, err := strconv.ParseFloat(*v, 32)
 	if err != nil {
 		return nil, err
 	}
 	value32 := float32(value)
 
-	walletTransaction := wallet.NewTransaction(privateKey, publicKey, *senderBlockchainAddress, *recipientBlockchainAddress, float32(value))
+	walletTransaction := wallet.NewTransactionWithNonce(privateKey, publicKey, *senderBlockchainAddress, *recipientBlockchainAddress, value32, fee, nonce)
 	sign, err := walletTransaction.GenerateSignature()
 	if err != nil {
 		return nil, err
@@ -119,22 +144,102 @@ func (s *Server) CreateTransaction(senderPublicKey, senderPrivateKey, senderBloc
 		RecipientBlockchainAddress: recipientBlockchainAddress,
 		SenderPublicKey:            senderPublicKey,
 		Value:                      &value32,
+		Fee:                        &fee,
+		Nonce:                      &nonce,
 		Signature:                  &sString,
 	}
 
-	b, err := json.Marshal(btr)
-	if err != nil {
+	if err := s.node.SendTransaction(&btr); err != nil {
 		return nil, err
 	}
-	buf := bytes.NewBuffer(b)
-	url := s.gateway + "/transactions"
-	resp, err := http.Post(url, "application/json", buf)
+
+	return nil, nil
+}
+
+// sendAsset sends v tokens of asset, which the sender must hold, in the base
+// units of its decimals.
+func (s *Server) sendAsset(publicKey cryptography.PublicKey, privateKey cryptography.PrivateKey, sender, recipient, asset, v string, fee float32, nonce uint64) error {
+	balances, err := s.node.Assets(sender)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	if err != nil || resp.StatusCode > 400 {
-		return nil, fmt.Errorf("failed to POST url - %v, err: %v", url, err)
+	var held *blockchain.AssetBalance
+	for i := range balances {
+		if balances[i].Asset == asset {
+			held = &balances[i]
+		}
+	}
+	if held == nil {
+		return fmt.Errorf("%w: %s holds no %s", blockchain.ErrInsufficientFunds, sender, asset)
+	}
+	amount, err := parseAmount(v, held.Decimals)
+	if err != nil {
+		return err
 	}
 
-	return nil, nil
+	sign, err := wallet.NewAssetTransaction(privateKey, publicKey, sender, recipient, "", asset, amount, fee, nonce).GenerateSignature()
+	if err != nil {
+		return err
+	}
+	pKey, sString := cryptography.GeneratePublicKeyString(publicKey), sign.String()
+	return s.node.SendTransaction(&blockchain.TransactionRequest{
+		SenderBlockchainAddress:    &sender,
+		RecipientBlockchainAddress: &recipient,
+		SenderPublicKey:            &pKey,
+		Fee:                        &fee,
+		Nonce:                      &nonce,
+		Signature:                  &sString,
+		Asset:                      &asset,
+		Amount:                     &amount,
+	})
+}
+
+// parseAmount reads a decimal number of tokens as base units of an asset with
+// decimals, "1.5" with 2 decimals is 150.
+func parseAmount(v string, decimals uint8) (uint64, error) {
+	whole, fraction, _ := strings.Cut(v, ".")
+	if len(fraction) > int(decimals) {
+		return 0, fmt.Errorf("amount %s has more than %d decimals", v, decimals)
+	}
+	amount, err := strconv.ParseUint(whole+fraction+strings.Repeat("0", int(decimals)-len(fraction)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %s: %w", v, err)
+	}
+	if amount == 0 {
+		return 0, fmt.Errorf("amount %s must be positive", v)
+	}
+	return amount, nil
+}
+
+// parseFee reads an optional fee, a missing or empty fee is zero.
+func parseFee(f *string) (float32, error) {
+	if f == nil || *f == "" {
+		return 0, nil
+	}
+	fee, err := strconv.ParseFloat(*f, 32)
+	if err != nil {
+		return 0, err
+	}
+	if fee < 0 {
+		return 0, blockchain.ErrNegativeFee
+	}
+	return float32(fee), nil
+}
+
+// nonce reads an optional nonce, a missing or empty nonce is the next nonce
+// of sender on the node.
+func (s *Server) nonce(n *string, sender string) (uint64, error) {
+	if n == nil || *n == "" {
+		return s.node.NextNonce(sender)
+	}
+	return strconv.ParseUint(*n, 10, 64)
+}
+
+func (s *Server) validateAddresses(addresses ...string) error {
+	for _, a := range addresses {
+		if err := cryptography.ValidateBlockchainAddress(a, s.params); err != nil {
+			return &blockchain.InvalidAddressError{Address: a, Err: err}
+		}
+	}
+	return nil
 }
@@ -14,6 +14,10 @@ type TransactionRequest struct {
 	SenderBlockchainAddress    *string `json:"sender_blockchain_address"`
 	RecipientBlockchainAddress *string `json:"recipient_blockchain_address"`
 	Value                      *string `json:"value"`
+	Fee                        *string `json:"fee,omitempty"`
+	Nonce                      *string `json:"nonce,omitempty"`
+	// Asset is the ID of the asset to send, the base coin when empty.
+	Asset *string `json:"asset,omitempty"`
 }
 
 func (tr *TransactionRequest) Validate() bool {
@@ -23,11 +27,50 @@ func (tr *TransactionRequest) Validate() bool {
 		tr.SenderPublicKey != nil
 }
 
+type MultisigAddressRequest struct {
+	PublicKeys *[]string `json:"public_keys"`
+	Threshold  *int      `json:"threshold"`
+}
+
+func (mr *MultisigAddressRequest) Validate() bool {
+	return mr.PublicKeys != nil && mr.Threshold != nil
+}
+
+type MultisigTransactionRequest struct {
+	PublicKeys                 *[]string `json:"public_keys"`
+	Threshold                  *int      `json:"threshold"`
+	RecipientBlockchainAddress *string   `json:"recipient_blockchain_address"`
+	Value                      *string   `json:"value"`
+	Fee                        *string   `json:"fee,omitempty"`
+	Nonce                      *string   `json:"nonce,omitempty"`
+}
+
+func (mr *MultisigTransactionRequest) Validate() bool {
+	return mr.PublicKeys != nil && mr.Threshold != nil &&
+		mr.RecipientBlockchainAddress != nil && mr.Value != nil
+}
+
+// MultisigSignatureRequest carries the signature of one signer over the hash
+// of the multisig transaction, made where the signer keeps the key.
+type MultisigSignatureRequest struct {
+	ID              *string `json:"id"`
+	SignerPublicKey *string `json:"signer_public_key"`
+	Signature       *string `json:"signature"`
+}
+
+func (mr *MultisigSignatureRequest) Validate() bool {
+	return mr.ID != nil && mr.SignerPublicKey != nil && mr.Signature != nil
+}
+
 type Serverer interface {
 	Index() (*template.Template, error)
-	Wallet() ([]byte, error)
-	CreateTransaction(senderPublicKey, senderPrivateKey, senderBlockchainAddress, recipientBlockchainAddress, v *string) ([]byte, error)
+	Wallet(keyType string) ([]byte, error)
+	CreateTransaction(senderPublicKey, senderPrivateKey, senderBlockchainAddress, recipientBlockchainAddress, v, fee, nonce, asset *string) ([]byte, error)
 	Balance(bcAddress string) ([]byte, error)
+	MultisigAddress(publicKeys []string, threshold int) ([]byte, error)
+	CreateMultisigTransaction(publicKeys []string, threshold int, recipientBlockchainAddress, v string, fee, nonce *string) ([]byte, error)
+	MultisigTransaction(id string) ([]byte, error)
+	SignMultisigTransaction(id, signerPublicKey, signature string) ([]byte, error)
 }
 
 type Transporter struct {
@@ -60,7 +103,7 @@ func (t *Transporter) HandleIndex(w http.ResponseWriter, r *http.Request) {
 func (t *Transporter) HandleWallet(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodPost:
-		b, err := t.server.Wallet()
+		b, err := t.server.Wallet(r.URL.Query().Get("key_type"))
 		if err != nil {
 			http.Error(w, "server error - page not found", http.StatusInternalServerError)
 			return
@@ -120,11 +163,96 @@ func (t *Transporter) createTransaction(w http.ResponseWriter, r *http.Request)
 	}
 
 	w.Header().Add("Content-Type", "application/json")
-	_, err = t.server.CreateTransaction(tr.SenderPublicKey, tr.SenderPrivateKey, tr.SenderBlockchainAddress, tr.RecipientBlockchainAddress, tr.Value)
+	_, err = t.server.CreateTransaction(tr.SenderPublicKey, tr.SenderPrivateKey, tr.SenderBlockchainAddress, tr.RecipientBlockchainAddress, tr.Value, tr.Fee, tr.Nonce, tr.Asset)
 	if err != nil {
 		io.WriteString(w, string(http2.JsonStatus("fail")))
-		http.Error(w, "failed to read request body", http.StatusBadRequest)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 	io.WriteString(w, string(http2.JsonStatus("success")))
 }
+
+func (t *Transporter) HandleMultisigAddress(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		var mr MultisigAddressRequest
+		if err := json.NewDecoder(r.Body).Decode(&mr); err != nil || !mr.Validate() {
+			io.WriteString(w, string(http2.JsonStatus("fail")))
+			http.Error(w, "bad request body", http.StatusBadRequest)
+			return
+		}
+
+		b, err := t.server.MultisigAddress(*mr.PublicKeys, *mr.Threshold)
+		if err != nil {
+			io.WriteString(w, string(http2.JsonStatus("fail")))
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(b[:]))
+	default:
+		http.Error(w, "page not found", http.StatusBadRequest)
+	}
+}
+
+func (t *Transporter) HandleMultisigTransaction(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			io.WriteString(w, string(http2.JsonStatus("fail")))
+			http.Error(w, "missing multisig transaction id", http.StatusBadRequest)
+			return
+		}
+
+		b, err := t.server.MultisigTransaction(id)
+		if err != nil {
+			io.WriteString(w, string(http2.JsonStatus("fail")))
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(b[:]))
+	case http.MethodPost:
+		var mr MultisigTransactionRequest
+		if err := json.NewDecoder(r.Body).Decode(&mr); err != nil || !mr.Validate() {
+			io.WriteString(w, string(http2.JsonStatus("fail")))
+			http.Error(w, "bad request body", http.StatusBadRequest)
+			return
+		}
+
+		b, err := t.server.CreateMultisigTransaction(*mr.PublicKeys, *mr.Threshold, *mr.RecipientBlockchainAddress, *mr.Value, mr.Fee, mr.Nonce)
+		if err != nil {
+			io.WriteString(w, string(http2.JsonStatus("fail")))
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(b[:]))
+	default:
+		http.Error(w, "page not found", http.StatusBadRequest)
+	}
+}
+
+func (t *Transporter) HandleMultisigSignature(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		var mr MultisigSignatureRequest
+		if err := json.NewDecoder(r.Body).Decode(&mr); err != nil || !mr.Validate() {
+			io.WriteString(w, string(http2.JsonStatus("fail")))
+			http.Error(w, "bad request body", http.StatusBadRequest)
+			return
+		}
+
+		b, err := t.server.SignMultisigTransaction(*mr.ID, *mr.SignerPublicKey, *mr.Signature)
+		if err != nil {
+			io.WriteString(w, string(http2.JsonStatus("fail")))
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(b[:]))
+	default:
+		http.Error(w, "page not found", http.StatusBadRequest)
+	}
+}
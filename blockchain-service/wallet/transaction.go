@@ -1,23 +1,38 @@
 package wallet
 
 import (
-	"crypto/ecdsa"
-	"crypto/rand"
 	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 
 	"blockchain/foundation/cryptography"
 )
 
 type Transaction struct {
-	senderPrivateKey           *ecdsa.PrivateKey
-	senderPublicKey            *ecdsa.PublicKey
+	senderPrivateKey           cryptography.PrivateKey
+	senderPublicKey            cryptography.PublicKey
 	senderBlockchainAddress    string
 	recipientBlockchainAddress string
 	value                      float32
+	fee                        float32
+	nonce                      uint64
+	inputs                     []OutPoint
+	outputs                    []Output
+	kind                       string
+	evidence                   string
+	data                       []byte
+	gas                        uint64
+	asset                      string
+	amount                     uint64
+	symbol                     string
+	decimals                   uint8
+	mintAuthority              string
+	collection                 string
+	token                      string
+	metadata                   string
 }
 
-func NewTransaction(privateKey *ecdsa.PrivateKey, publicKey *ecdsa.PublicKey, sender, recipient string, value float32) *Transaction {
+func NewTransaction(privateKey cryptography.PrivateKey, publicKey cryptography.PublicKey, sender, recipient string, value float32) *Transaction {
 	return &Transaction{
 		senderPrivateKey:           privateKey,
 		senderPublicKey:            publicKey,
@@ -27,27 +42,149 @@ func NewTransaction(privateKey *ecdsa.PrivateKey, publicKey *ecdsa.PublicKey, se
 	}
 }
 
-func (t *Transaction) GenerateSignature() (*cryptography.Signature, error) {
+func NewTransactionWithFee(privateKey cryptography.PrivateKey, publicKey cryptography.PublicKey, sender, recipient string, value, fee float32) *Transaction {
+	return NewTransactionWithNonce(privateKey, publicKey, sender, recipient, value, fee, 0)
+}
+
+func NewTransactionWithNonce(privateKey cryptography.PrivateKey, publicKey cryptography.PublicKey, sender, recipient string, value, fee float32, nonce uint64) *Transaction {
+	t := NewTransaction(privateKey, publicKey, sender, recipient, value)
+	t.fee = fee
+	t.nonce = nonce
+	return t
+}
+
+// NewStakeTransaction stakes value of the sender balance, or unstakes it when
+// kind is "unstake".
+func NewStakeTransaction(privateKey cryptography.PrivateKey, publicKey cryptography.PublicKey, sender, kind string, value, fee float32, nonce uint64) *Transaction {
+	t := NewTransactionWithNonce(privateKey, publicKey, sender, sender, value, fee, nonce)
+	t.kind = kind
+	return t
+}
+
+// NewEvidenceTransaction reports that offender sealed two blocks at the same
+// height. evidenceID is the ID of the double sign evidence holding both.
+func NewEvidenceTransaction(privateKey cryptography.PrivateKey, publicKey cryptography.PublicKey, sender, offender, evidenceID string, fee float32, nonce uint64) *Transaction {
+	t := NewTransactionWithNonce(privateKey, publicKey, sender, offender, 0, fee, nonce)
+	t.kind = "evidence"
+	t.evidence = evidenceID
+	return t
+}
+
+// NewContractTransaction deploys the code in data at contract, or calls the
+// contract with data as input when kind is "call". The address of a deployed
+// contract is cryptography.GenerateContractAddress of the sender and nonce.
+func NewContractTransaction(privateKey cryptography.PrivateKey, publicKey cryptography.PublicKey, sender, kind, contract string, data []byte, gas uint64, fee float32, nonce uint64) *Transaction {
+	t := NewTransactionWithNonce(privateKey, publicKey, sender, contract, 0, fee, nonce)
+	t.kind = kind
+	t.data = data
+	t.gas = gas
+	return t
+}
+
+// NewIssueTransaction issues the asset symbol with supply base units, each
+// 10^-decimals of a token. An empty mintAuthority fixes the supply.
+func NewIssueTransaction(privateKey cryptography.PrivateKey, publicKey cryptography.PublicKey, sender, symbol string, decimals uint8, supply uint64, mintAuthority string, fee float32, nonce uint64) *Transaction {
+	t := NewTransactionWithNonce(privateKey, publicKey, sender, sender, 0, fee, nonce)
+	t.kind = "issue"
+	t.amount = supply
+	t.symbol = symbol
+	t.decimals = decimals
+	t.mintAuthority = mintAuthority
+	return t
+}
+
+// NewAssetTransaction transfers amount base units of asset to recipient, or
+// mints them there when kind is "mint". kind is empty for a transfer.
+func NewAssetTransaction(privateKey cryptography.PrivateKey, publicKey cryptography.PublicKey, sender, recipient, kind, asset string, amount uint64, fee float32, nonce uint64) *Transaction {
+	t := NewTransactionWithNonce(privateKey, publicKey, sender, recipient, 0, fee, nonce)
+	t.kind = kind
+	t.asset = asset
+	t.amount = amount
+	return t
+}
+
+// NewNFTTransaction mints the token of collection to recipient with metadata,
+// transfers it there or burns it, as kind says: "nft_mint", "nft_transfer" or
+// "nft_burn". A burn is to the sender.
+func NewNFTTransaction(privateKey cryptography.PrivateKey, publicKey cryptography.PublicKey, sender, recipient, kind, collection, token, metadata string, fee float32, nonce uint64) *Transaction {
+	t := NewTransactionWithNonce(privateKey, publicKey, sender, recipient, 0, fee, nonce)
+	t.kind = kind
+	t.collection = collection
+	t.token = token
+	t.metadata = metadata
+	return t
+}
+
+// Hash is what the sender signs, the sha256 of the transaction JSON. Signers
+// of a multisig transaction sign it without handing out their keys.
+func (t *Transaction) Hash() ([32]byte, error) {
 	b, err := json.Marshal(t)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	return sha256.Sum256(b), nil
+}
+
+func (t *Transaction) GenerateSignature() (*cryptography.Signature, error) {
+	h, err := t.Hash()
 	if err != nil {
 		return nil, err
 	}
-	h := sha256.Sum256(b)
-	r, s, err := ecdsa.Sign(rand.Reader, t.senderPrivateKey, h[:])
-	return &cryptography.Signature{
-		R: r,
-		S: s,
-	}, nil
+	return t.senderPrivateKey.Sign(h[:])
 }
 
 func (t *Transaction) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct {
-		Sender    string  `json:"sender_blockchain_address"`
-		Recipient string  `json:"recipient_blockchain_address"`
-		Value     float32 `json:"value"`
+		Sender     string     `json:"sender_blockchain_address"`
+		Recipient  string     `json:"recipient_blockchain_address"`
+		Value      float32    `json:"value"`
+		Fee        float32    `json:"fee,omitempty"`
+		Nonce      uint64     `json:"nonce,omitempty"`
+		Inputs     []OutPoint `json:"inputs,omitempty"`
+		Outputs    []Output   `json:"outputs,omitempty"`
+		Kind       string     `json:"kind,omitempty"`
+		Evidence   string     `json:"evidence,omitempty"`
+		Data       string     `json:"data,omitempty"`
+		Gas        uint64     `json:"gas,omitempty"`
+		Asset      string     `json:"asset,omitempty"`
+		Amount     uint64     `json:"amount,omitempty"`
+		Symbol     string     `json:"symbol,omitempty"`
+		Decimals   uint8      `json:"decimals,omitempty"`
+		Authority  string     `json:"mint_authority,omitempty"`
+		Collection string     `json:"collection,omitempty"`
+		Token      string     `json:"token_id,omitempty"`
+		Metadata   string     `json:"metadata,omitempty"`
 	}{
-		Sender:    t.senderBlockchainAddress,
-		Recipient: t.recipientBlockchainAddress,
-		Value:     t.value,
+		Sender:     t.senderBlockchainAddress,
+		Recipient:  t.recipientBlockchainAddress,
+		Value:      t.value,
+		Fee:        t.fee,
+		Nonce:      t.nonce,
+		Inputs:     t.inputs,
+		Outputs:    t.outputs,
+		Kind:       t.kind,
+		Evidence:   t.evidence,
+		Data:       hex.EncodeToString(t.data),
+		Gas:        t.gas,
+		Asset:      t.asset,
+		Amount:     t.amount,
+		Symbol:     t.symbol,
+		Decimals:   t.decimals,
+		Authority:  t.mintAuthority,
+		Collection: t.collection,
+		Token:      t.token,
+		Metadata:   t.metadata,
 	})
 }
+
+func (t *Transaction) Inputs() []OutPoint {
+	return t.inputs
+}
+
+func (t *Transaction) Outputs() []Output {
+	return t.outputs
+}
+
+func (t *Transaction) Fee() float32 {
+	return t.fee
+}
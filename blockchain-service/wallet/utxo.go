@@ -0,0 +1,96 @@
+package wallet
+
+import (
+	"errors"
+	"math"
+	"sort"
+
+	"blockchain/foundation/cryptography"
+)
+
+var ErrInsufficientCoins = errors.New("not enough coins to pay the amount")
+
+// OutPoint references output Index of the transaction TxID.
+type OutPoint struct {
+	TxID  string `json:"txid"`
+	Index int    `json:"index"`
+}
+
+type Output struct {
+	Address string  `json:"address"`
+	Value   float32 `json:"value"`
+}
+
+// Coin is an unspent output the wallet can spend, as listed by a node.
+type Coin struct {
+	OutPoint
+	Value float32 `json:"value"`
+}
+
+// SelectCoins picks coins worth at least amount. A single coin matching the
+// amount exactly is preferred, then the smallest coin that covers it, and
+// otherwise the largest coins until they do. The change is what the selected
+// coins hold beyond amount.
+func SelectCoins(coins []Coin, amount float32) ([]Coin, float32, error) {
+	if amount <= 0 {
+		return nil, 0, nil
+	}
+
+	sorted := make([]Coin, len(coins))
+	copy(sorted, coins)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Value < sorted[j].Value
+	})
+
+	for _, c := range sorted {
+		if c.Value >= amount {
+			return []Coin{c}, c.Value - amount, nil
+		}
+	}
+
+	var selected []Coin
+	var total float32
+	for i := len(sorted) - 1; i >= 0 && total < amount; i-- {
+		selected = append(selected, sorted[i])
+		total += sorted[i].Value
+	}
+	if total < amount {
+		return nil, 0, ErrInsufficientCoins
+	}
+	return selected, total - amount, nil
+}
+
+func NewUTXOTransaction(privateKey cryptography.PrivateKey, publicKey cryptography.PublicKey, sender string, inputs []OutPoint, outputs []Output, fee float32) *Transaction {
+	t := NewTransactionWithFee(privateKey, publicKey, sender, "", 0, fee)
+	t.inputs = inputs
+	t.outputs = outputs
+	return t
+}
+
+// NewPayment selects coins of sender to pay value to recipient plus the fee,
+// sending the change back to sender.
+func NewPayment(privateKey cryptography.PrivateKey, publicKey cryptography.PublicKey, sender string, coins []Coin, recipient string, value, fee float32) (*Transaction, error) {
+	selected, _, err := SelectCoins(coins, value+fee)
+	if err != nil {
+		return nil, err
+	}
+
+	inputs := make([]OutPoint, len(selected))
+	var in float32
+	for i, c := range selected {
+		inputs[i] = c.OutPoint
+		in += c.Value
+	}
+
+	outputs := []Output{{Address: recipient, Value: value}}
+	// Rounding must not make the outputs and fee add up to more than the
+	// inputs, nodes sum them in the same order.
+	change := in - value - fee
+	for change > 0 && value+change+fee > in {
+		change = math.Nextafter32(change, 0)
+	}
+	if change > 0 {
+		outputs = append(outputs, Output{Address: sender, Value: change})
+	}
+	return NewUTXOTransaction(privateKey, publicKey, sender, inputs, outputs, fee), nil
+}
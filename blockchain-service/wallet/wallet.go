@@ -2,47 +2,48 @@ package wallet
 
 import (
 	"blockchain/foundation/cryptography"
-	"crypto/ecdsa"
-	"crypto/elliptic"
-	"crypto/rand"
 	"encoding/json"
 )
 
 type Wallet struct {
-	privateKey        *ecdsa.PrivateKey
-	publicKey         *ecdsa.PublicKey
+	privateKey        cryptography.PrivateKey
+	publicKey         cryptography.PublicKey
 	blockchainAddress string
 }
 
-func NewWallet(generateAddress func(pKey *ecdsa.PublicKey) string) (*Wallet, error) {
-	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+func NewWallet(keyType cryptography.KeyType, generateAddress func(pKey cryptography.PublicKey) string) (*Wallet, error) {
+	privateKey, err := cryptography.GenerateKey(keyType)
 	if err != nil {
 		return nil, err
 	}
 
-	address := generateAddress(&privateKey.PublicKey)
+	address := generateAddress(privateKey.PublicKey())
 
 	return &Wallet{
 		privateKey:        privateKey,
-		publicKey:         &privateKey.PublicKey,
+		publicKey:         privateKey.PublicKey(),
 		blockchainAddress: address,
 	}, nil
 }
 
-func (w *Wallet) PrivateKey() *ecdsa.PrivateKey {
+func (w *Wallet) PrivateKey() cryptography.PrivateKey {
 	return w.privateKey
 }
 
 func (w *Wallet) PrivateKeyStr() string {
-	return cryptography.GeneratePrivateKeyString(w.privateKey.D.Bytes())
+	return cryptography.GeneratePrivateKeyString(w.privateKey)
 }
 
-func (w *Wallet) PublicKey() *ecdsa.PublicKey {
+func (w *Wallet) PublicKey() cryptography.PublicKey {
 	return w.publicKey
 }
 
 func (w *Wallet) PublicKeyStr() string {
-	return cryptography.GeneratePublicKeyString(w.privateKey.PublicKey.X.Bytes(), w.privateKey.PublicKey.Y.Bytes())
+	return cryptography.GeneratePublicKeyString(w.publicKey)
+}
+
+func (w *Wallet) KeyType() cryptography.KeyType {
+	return w.publicKey.KeyType()
 }
 
 func (w *Wallet) BlockchainAddress() string {
@@ -51,10 +52,12 @@ func (w *Wallet) BlockchainAddress() string {
 
 func (w *Wallet) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct {
+		KeyType           string `json:"key_type"`
 		PrivateKey        string `json:"private_key"`
 		PublicKey         string `json:"public_key"`
 		BlockchainAddress string `json:"blockchain_address"`
 	}{
+		KeyType:           w.KeyType().String(),
 		PrivateKey:        w.PrivateKeyStr(),
 		PublicKey:         w.PublicKeyStr(),
 		BlockchainAddress: w.BlockchainAddress(),
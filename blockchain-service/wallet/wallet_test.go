@@ -1,14 +1,18 @@
 package wallet
 
 import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"testing"
 
+	"blockchain/blockchain-service/network-params"
 	"blockchain/foundation/cryptography"
 )
 
 func Test_Wallet(t *testing.T) {
-	w, err := NewWallet(cryptography.GenerateBlockchainAddress)
+	w, err := NewWallet(cryptography.P256, network_params.MainNet.GenerateBlockchainAddress)
 	if err != nil {
 		t.Errorf("Failed to instatiate a wallet with err: %s", err)
 	}
@@ -24,3 +28,53 @@ func Test_Wallet(t *testing.T) {
 
 	fmt.Println(s.String())
 }
+
+func Test_WalletKeyTypes(t *testing.T) {
+	for _, kt := range []cryptography.KeyType{cryptography.P256, cryptography.Secp256k1, cryptography.Ed25519} {
+		w, err := NewWallet(kt, network_params.MainNet.GenerateBlockchainAddress)
+		if err != nil {
+			t.Errorf("%s: Failed to instatiate a wallet with err: %s", kt, err)
+			continue
+		}
+
+		tr := NewTransaction(w.PrivateKey(), w.PublicKey(), w.BlockchainAddress(), "Niko", 1.0)
+		s, err := tr.GenerateSignature()
+		if err != nil {
+			t.Errorf("%s: Failed to GenerateSignature with err: %s", kt, err)
+			continue
+		}
+
+		b, err := json.Marshal(tr)
+		if err != nil {
+			t.Errorf("%s: Failed to marshal transaction with err: %s", kt, err)
+		}
+		h := sha256.Sum256(b)
+		if !w.PublicKey().Verify(h[:], s) {
+			t.Errorf("%s: signature not verified", kt)
+		}
+	}
+}
+
+func Test_SelectCoins(t *testing.T) {
+	coins := []Coin{
+		{OutPoint: OutPoint{TxID: "a"}, Value: 1},
+		{OutPoint: OutPoint{TxID: "b"}, Value: 5},
+		{OutPoint: OutPoint{TxID: "c"}, Value: 3},
+	}
+
+	selected, change, err := SelectCoins(coins, 3)
+	if err != nil || len(selected) != 1 || selected[0].TxID != "c" || change != 0 {
+		t.Errorf("Expected the exact coin, got %+v with change %f, err: %v", selected, change, err)
+	}
+	selected, change, err = SelectCoins(coins, 4)
+	if err != nil || len(selected) != 1 || selected[0].TxID != "b" || change != 1 {
+		t.Errorf("Expected the smallest covering coin, got %+v with change %f, err: %v", selected, change, err)
+	}
+	selected, change, err = SelectCoins(coins, 7)
+	if err != nil || len(selected) != 2 || change != 1 {
+		t.Errorf("Expected the largest coins, got %+v with change %f, err: %v", selected, change, err)
+	}
+	if _, _, err := SelectCoins(coins, 10); !errors.Is(err, ErrInsufficientCoins) {
+		t.Errorf("Expected ErrInsufficientCoins, got: %v", err)
+	}
+}
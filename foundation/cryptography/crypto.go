@@ -1,17 +1,34 @@
 package cryptography
 
 import (
-	"crypto/ecdsa"
-	"crypto/elliptic"
+	"bytes"
 	"crypto/sha256"
+	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"math/big"
+	"sort"
 
 	"github.com/btcsuite/btcutil/base58"
 	"golang.org/x/crypto/ripemd160"
 )
 
+// Network supplies the address version bytes of a chain, so addresses of
+// one network are rejected on another.
+type Network interface {
+	AddressVersion() byte
+	MultisigVersion() byte
+}
+
+var (
+	ErrAddressEncoding = errors.New("address is not valid base58")
+	ErrAddressLength   = errors.New("address has an invalid length")
+	ErrAddressChecksum = errors.New("address checksum mismatch")
+	ErrAddressVersion  = errors.New("address version byte does not belong to this network")
+	ErrAddressKeyType  = errors.New("address has an unknown key type")
+)
+
 type Signature struct {
 	R *big.Int
 	S *big.Int
@@ -21,28 +38,115 @@ func (s *Signature) String() string {
 	return fmt.Sprintf("%064x%064x", s.R, s.S)
 }
 
-func GeneratePrivateKeyString(privateKeyDB []byte) string {
-	return fmt.Sprintf("%x", privateKeyDB)
-}
-
-func GeneratePublicKeyString(publicKeyXB, publicKeyYB []byte) string {
-	return fmt.Sprintf("%064x%064x", publicKeyXB, publicKeyYB)
-}
-
-func GenerateBlockchainAddress(pKey *ecdsa.PublicKey) string {
+func GenerateBlockchainAddress(pKey PublicKey, net Network) string {
 	//Perform SHA-256 hashing on the public key (32 bytes).
 	h2 := sha256.New()
-	h2.Write(pKey.X.Bytes())
-	h2.Write(pKey.Y.Bytes())
+	h2.Write(pKey.Bytes())
 	digest2 := h2.Sum(nil)
 	// Perform RIPEMD-160 hashing on the result of SHA-256 (20 bytes).
 	h3 := ripemd160.New()
 	h3.Write(digest2)
 	digest3 := h3.Sum(nil)
-	// Add version byte in front of RIPEMD-160 hash (0x00 for Main Network).
-	vd4 := make([]byte, 21)
-	vd4[0] = 0x00
-	copy(vd4[1:], digest3[:])
+	// Add the network version byte and key type in front of RIPEMD-160 hash.
+	return base58CheckEncode(net.AddressVersion(), append([]byte{byte(pKey.KeyType())}, digest3...))
+}
+
+// MaxMultisigKeys is the most keys a multisig address has. Every key may sign
+// a spend, so it bounds the signatures checked per transaction.
+const MaxMultisigKeys = 20
+
+func GenerateMultisigAddress(threshold int, pKeys []PublicKey, net Network) (string, error) {
+	if len(pKeys) > MaxMultisigKeys {
+		return "", fmt.Errorf("multisig set of %d keys, at most %d", len(pKeys), MaxMultisigKeys)
+	}
+	if threshold < 1 || threshold > len(pKeys) {
+		return "", fmt.Errorf("invalid multisig threshold %d of %d keys", threshold, len(pKeys))
+	}
+
+	// Sort the public keys so every signer derives the same address.
+	keys := make([]string, len(pKeys))
+	for i, pKey := range pKeys {
+		if pKey.KeyType() != pKeys[0].KeyType() {
+			return "", fmt.Errorf("multisig keys must share a key type")
+		}
+		keys[i] = GeneratePublicKeyString(pKey)
+	}
+	sort.Strings(keys)
+	for i := 1; i < len(keys); i++ {
+		if keys[i] == keys[i-1] {
+			return "", fmt.Errorf("duplicate public key in multisig set")
+		}
+	}
+
+	// Perform SHA-256 hashing on the threshold followed by the sorted keys.
+	h := sha256.New()
+	h.Write([]byte{byte(threshold), byte(len(keys))})
+	for _, k := range keys {
+		h.Write([]byte(k))
+	}
+	// Perform RIPEMD-160 hashing on the result of SHA-256 (20 bytes).
+	h2 := ripemd160.New()
+	h2.Write(h.Sum(nil))
+	// Add the network multisig version byte and key type in front of RIPEMD-160 hash.
+	return base58CheckEncode(net.MultisigVersion(), append([]byte{byte(pKeys[0].KeyType())}, h2.Sum(nil)...)), nil
+}
+
+// GenerateContractAddress derives the address of the contract deployed by
+// sender with nonce. It is a script address like a multisig one, no key can
+// sign for it.
+func GenerateContractAddress(sender string, nonce uint64, net Network) (string, error) {
+	_, kt, _, err := DecodeBlockchainAddress(sender, net)
+	if err != nil {
+		return "", err
+	}
+	// Perform SHA-256 hashing on the sender followed by the nonce.
+	h := sha256.New()
+	h.Write([]byte(sender))
+	var n [8]byte
+	binary.BigEndian.PutUint64(n[:], nonce)
+	h.Write(n[:])
+	// Perform RIPEMD-160 hashing on the result of SHA-256 (20 bytes).
+	h2 := ripemd160.New()
+	h2.Write(h.Sum(nil))
+	return base58CheckEncode(net.MultisigVersion(), append([]byte{byte(kt)}, h2.Sum(nil)...)), nil
+}
+
+// DecodeBlockchainAddress checks the base58check encoding of an address and
+// returns its version byte, key type and RIPEMD-160 hash.
+func DecodeBlockchainAddress(address string, net Network) (byte, KeyType, []byte, error) {
+	b := base58.Decode(address)
+	if len(b) == 0 {
+		return 0, 0, nil, ErrAddressEncoding
+	}
+	if len(b) != 26 {
+		return 0, 0, nil, ErrAddressLength
+	}
+
+	h := sha256.Sum256(b[:22])
+	h = sha256.Sum256(h[:])
+	if !bytes.Equal(h[:4], b[22:]) {
+		return 0, 0, nil, ErrAddressChecksum
+	}
+
+	version, kt := b[0], KeyType(b[1])
+	if version != net.AddressVersion() && version != net.MultisigVersion() {
+		return 0, 0, nil, ErrAddressVersion
+	}
+	if !kt.Valid() {
+		return 0, 0, nil, ErrAddressKeyType
+	}
+	return version, kt, b[2:22], nil
+}
+
+func ValidateBlockchainAddress(address string, net Network) error {
+	_, _, _, err := DecodeBlockchainAddress(address, net)
+	return err
+}
+
+func base58CheckEncode(version byte, payload []byte) string {
+	vd4 := make([]byte, len(payload)+1)
+	vd4[0] = version
+	copy(vd4[1:], payload[:])
 	// Perform SHA-256 hash on the extended RIPEMD-160 result.
 	h5 := sha256.New()
 	h5.Write(vd4)
@@ -53,26 +157,22 @@ func GenerateBlockchainAddress(pKey *ecdsa.PublicKey) string {
 	digest6 := h6.Sum(nil)
 	// Take the first 4 bytes of the second SHA-256 hash for checksum.
 	chsum := digest6[:4]
-	// Add the 4 checksum bytes from 7 at the end of extended RIPEMD-160 hash from 4 (25 bytes).
-	dc8 := make([]byte, 25)
-	copy(dc8[:21], vd4[:])
-	copy(dc8[21:], chsum[:])
+	// Add the 4 checksum bytes at the end of the extended RIPEMD-160 hash (26 bytes).
+	dc8 := make([]byte, len(vd4)+4)
+	copy(dc8[:len(vd4)], vd4[:])
+	copy(dc8[len(vd4):], chsum[:])
 	// Convert and return the result from a byte string into base58.
 	return base58.Encode(dc8)
 }
 
 func SignatureFromString(s string) (*Signature, error) {
-	x, y, err := StringToBigIntTupple(s)
-	if err != nil {
-		return nil, err
-	}
-	return &Signature{
-		R: &x,
-		S: &y,
-	}, err
+	return ParseSignature(s, P256)
 }
 
 func StringToBigIntTupple(s string) (bix big.Int, biy big.Int, err error) {
+	if len(s) != 128 {
+		return big.Int{}, big.Int{}, fmt.Errorf("invalid length %d, expected 128 hex characters", len(s))
+	}
 	x, err := hex.DecodeString(s[:64])
 	if err != nil {
 		return big.Int{}, big.Int{}, err
@@ -86,28 +186,3 @@ func StringToBigIntTupple(s string) (bix big.Int, biy big.Int, err error) {
 	biy.SetBytes(y)
 	return
 }
-
-func PublicKeyFromString(s string) (*ecdsa.PublicKey, error) {
-	x, y, err := StringToBigIntTupple(s)
-	if err != nil {
-		return nil, err
-	}
-	return &ecdsa.PublicKey{
-		Curve: elliptic.P256(),
-		X:     &x,
-		Y:     &y,
-	}, nil
-}
-
-func PrivateKeyFromString(s string, pubKey *ecdsa.PublicKey) (*ecdsa.PrivateKey, error) {
-	b, err := hex.DecodeString(s[:])
-	if err != nil {
-		return nil, err
-	}
-	var bi big.Int
-	bi.SetBytes(b)
-	return &ecdsa.PrivateKey{
-		PublicKey: *pubKey,
-		D:         &bi,
-	}, nil
-}
@@ -6,9 +6,15 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"testing"
 )
 
+type testNetwork struct{}
+
+func (testNetwork) AddressVersion() byte  { return 0x00 }
+func (testNetwork) MultisigVersion() byte { return 0x05 }
+
 func Test_Signature(t *testing.T) {
 	type transaction struct {
 		sender    string
@@ -21,7 +27,7 @@ func Test_Signature(t *testing.T) {
 		t.Errorf("failed to generate private key with err: %v", err)
 	}
 
-	senderPublicKeyString := GeneratePublicKeyString(privateKey.PublicKey.X.Bytes(), privateKey.PublicKey.Y.Bytes())
+	senderPublicKeyString := GeneratePublicKeyString(NewECDSAPublicKey(&privateKey.PublicKey))
 
 	publicKeyString, err := PublicKeyFromString(senderPublicKeyString)
 	if err != nil {
@@ -33,8 +39,10 @@ func Test_Signature(t *testing.T) {
 
 	}
 	h := sha256.Sum256(b)
-	r, s, err := ecdsa.Sign(rand.Reader, privateKey, h[:])
-	signature := &Signature{R: r, S: s}
+	signature, err := Sign(privateKey, h[:])
+	if err != nil {
+		t.Errorf("failed to Sign with err: %v", err)
+	}
 	sign, err := SignatureFromString(signature.String())
 
 	sender := "0x00"
@@ -50,9 +58,170 @@ func Test_Signature(t *testing.T) {
 		t.Errorf("failed to marshal transaction with err: %v", err)
 	}
 	hash := sha256.Sum256(bb)
-	v := ecdsa.Verify(publicKeyString, hash[:], sign.R, sign.S)
+	v := publicKeyString.Verify(hash[:], sign)
 	if !v {
 		t.Errorf("signature prossess failed with err: %v", err)
 	}
 	t.Logf("\nSignature verified successfully\n -> %v <-", sign)
 }
+
+func Test_MultisigAddress(t *testing.T) {
+	k1, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Errorf("failed to generate private key with err: %v", err)
+	}
+	k2, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Errorf("failed to generate private key with err: %v", err)
+	}
+
+	a1, err := GenerateMultisigAddress(2, []PublicKey{NewECDSAPublicKey(&k1.PublicKey), NewECDSAPublicKey(&k2.PublicKey)}, testNetwork{})
+	if err != nil {
+		t.Errorf("failed to GenerateMultisigAddress with err: %v", err)
+	}
+	a2, err := GenerateMultisigAddress(2, []PublicKey{NewECDSAPublicKey(&k2.PublicKey), NewECDSAPublicKey(&k1.PublicKey)}, testNetwork{})
+	if err != nil {
+		t.Errorf("failed to GenerateMultisigAddress with err: %v", err)
+	}
+	if a1 != a2 {
+		t.Errorf("multisig address depends on key order: %s != %s", a1, a2)
+	}
+
+	a3, err := GenerateMultisigAddress(1, []PublicKey{NewECDSAPublicKey(&k1.PublicKey), NewECDSAPublicKey(&k2.PublicKey)}, testNetwork{})
+	if err != nil {
+		t.Errorf("failed to GenerateMultisigAddress with err: %v", err)
+	}
+	if a1 == a3 {
+		t.Errorf("multisig address does not depend on threshold")
+	}
+
+	if _, err := GenerateMultisigAddress(3, []PublicKey{NewECDSAPublicKey(&k1.PublicKey), NewECDSAPublicKey(&k2.PublicKey)}, testNetwork{}); err == nil {
+		t.Errorf("expected error for threshold above key count")
+	}
+	if _, err := GenerateMultisigAddress(1, []PublicKey{NewECDSAPublicKey(&k1.PublicKey), NewECDSAPublicKey(&k1.PublicKey)}, testNetwork{}); err == nil {
+		t.Errorf("expected error for duplicate keys")
+	}
+
+	many := make([]PublicKey, MaxMultisigKeys+1)
+	for i := range many {
+		k, err := GenerateKey(P256)
+		if err != nil {
+			t.Fatalf("failed to GenerateKey with err: %v", err)
+		}
+		many[i] = k.PublicKey()
+	}
+	if _, err := GenerateMultisigAddress(1, many, testNetwork{}); err == nil {
+		t.Errorf("expected error for more than %d keys", MaxMultisigKeys)
+	}
+	if _, err := GenerateMultisigAddress(1, many[:MaxMultisigKeys], testNetwork{}); err != nil {
+		t.Errorf("failed to GenerateMultisigAddress of %d keys with err: %v", MaxMultisigKeys, err)
+	}
+}
+
+func Test_ContractAddress(t *testing.T) {
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Errorf("failed to generate private key with err: %v", err)
+	}
+	sender := GenerateBlockchainAddress(NewECDSAPublicKey(&k.PublicKey), testNetwork{})
+	a1, err := GenerateContractAddress(sender, 0, testNetwork{})
+	if err != nil {
+		t.Errorf("failed to GenerateContractAddress with err: %v", err)
+	}
+	a2, err := GenerateContractAddress(sender, 1, testNetwork{})
+	if err != nil {
+		t.Errorf("failed to GenerateContractAddress with err: %v", err)
+	}
+	if a1 == a2 || a1 == sender {
+		t.Errorf("contract address does not depend on the nonce: %s", a1)
+	}
+	if err := ValidateBlockchainAddress(a1, testNetwork{}); err != nil {
+		t.Errorf("contract address %s is not valid with err: %v", a1, err)
+	}
+	if _, err := GenerateContractAddress("nope", 0, testNetwork{}); err == nil {
+		t.Errorf("expected error for an invalid sender")
+	}
+}
+
+func Test_KeyTypes(t *testing.T) {
+	for _, kt := range []KeyType{P256, Secp256k1, Ed25519} {
+		privateKey, err := GenerateKey(kt)
+		if err != nil {
+			t.Errorf("%s: failed to GenerateKey with err: %v", kt, err)
+			continue
+		}
+
+		publicKeyStr := GeneratePublicKeyString(privateKey.PublicKey())
+		publicKey, err := PublicKeyFromString(publicKeyStr)
+		if err != nil {
+			t.Errorf("%s: failed to PublicKeyFromString with err: %v", kt, err)
+			continue
+		}
+		if publicKey.KeyType() != kt {
+			t.Errorf("%s: public key string lost its key type", kt)
+		}
+
+		restored, err := PrivateKeyFromString(GeneratePrivateKeyString(privateKey), publicKey)
+		if err != nil {
+			t.Errorf("%s: failed to PrivateKeyFromString with err: %v", kt, err)
+			continue
+		}
+
+		h := sha256.Sum256([]byte("transaction"))
+		sign, err := restored.Sign(h[:])
+		if err != nil {
+			t.Errorf("%s: failed to Sign with err: %v", kt, err)
+			continue
+		}
+		parsed, err := ParseSignature(sign.String(), kt)
+		if err != nil {
+			t.Errorf("%s: failed to ParseSignature with err: %v", kt, err)
+			continue
+		}
+		if !publicKey.Verify(h[:], parsed) {
+			t.Errorf("%s: signature not verified", kt)
+		}
+		other := sha256.Sum256([]byte("other transaction"))
+		if publicKey.Verify(other[:], parsed) {
+			t.Errorf("%s: signature verified for another message", kt)
+		}
+	}
+
+	p256, _ := GenerateKey(P256)
+	k1, _ := GenerateKey(Secp256k1)
+	if GenerateBlockchainAddress(p256.PublicKey(), testNetwork{}) == GenerateBlockchainAddress(k1.PublicKey(), testNetwork{}) {
+		t.Errorf("addresses of different keys collide")
+	}
+}
+
+func Test_ValidateBlockchainAddress(t *testing.T) {
+	privateKey, err := GenerateKey(P256)
+	if err != nil {
+		t.Errorf("failed to generate private key with err: %v", err)
+	}
+	address := GenerateBlockchainAddress(privateKey.PublicKey(), testNetwork{})
+	if err := ValidateBlockchainAddress(address, testNetwork{}); err != nil {
+		t.Errorf("valid address rejected with err: %v", err)
+	}
+
+	corrupted := []byte(address)
+	if corrupted[5] == 'a' {
+		corrupted[5] = 'b'
+	} else {
+		corrupted[5] = 'a'
+	}
+	if err := ValidateBlockchainAddress(string(corrupted), testNetwork{}); !errors.Is(err, ErrAddressChecksum) {
+		t.Errorf("expected checksum error, got: %v", err)
+	}
+
+	_, _, hash, _ := DecodeBlockchainAddress(address, testNetwork{})
+	if err := ValidateBlockchainAddress(base58CheckEncode(0x42, append([]byte{byte(P256)}, hash...)), testNetwork{}); !errors.Is(err, ErrAddressVersion) {
+		t.Errorf("expected version error, got: %v", err)
+	}
+	if err := ValidateBlockchainAddress("THE BLOCKCHAIN", testNetwork{}); err == nil {
+		t.Errorf("expected error for non base58 address")
+	}
+	if err := ValidateBlockchainAddress("Niko", testNetwork{}); !errors.Is(err, ErrAddressLength) {
+		t.Errorf("expected length error, got: %v", err)
+	}
+}
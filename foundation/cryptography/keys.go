@@ -0,0 +1,325 @@
+package cryptography
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+type KeyType byte
+
+const (
+	P256      KeyType = 0x01
+	Secp256k1 KeyType = 0x02
+	Ed25519   KeyType = 0x03
+)
+
+func (kt KeyType) String() string {
+	switch kt {
+	case P256:
+		return "p256"
+	case Secp256k1:
+		return "secp256k1"
+	case Ed25519:
+		return "ed25519"
+	default:
+		return fmt.Sprintf("unknown(%d)", byte(kt))
+	}
+}
+
+func (kt KeyType) Valid() bool {
+	return kt == P256 || kt == Secp256k1 || kt == Ed25519
+}
+
+func KeyTypeFromString(s string) (KeyType, error) {
+	switch s {
+	case "", "p256":
+		return P256, nil
+	case "secp256k1":
+		return Secp256k1, nil
+	case "ed25519":
+		return Ed25519, nil
+	default:
+		return 0, fmt.Errorf("unsupported key type %q", s)
+	}
+}
+
+// curve is the curve of an ECDSA key type. Only its parameters are used for
+// secp256k1, its keys do their arithmetic in secp256k1.go.
+func (kt KeyType) curve() (elliptic.Curve, error) {
+	switch kt {
+	case P256:
+		return elliptic.P256(), nil
+	case Secp256k1:
+		return secp256k1.S256(), nil
+	default:
+		return nil, fmt.Errorf("key type %s is not an ECDSA curve", kt)
+	}
+}
+
+type PublicKey interface {
+	KeyType() KeyType
+	Bytes() []byte
+	Verify(hash []byte, s *Signature) bool
+}
+
+type PrivateKey interface {
+	KeyType() KeyType
+	Bytes() []byte
+	PublicKey() PublicKey
+	Sign(hash []byte) (*Signature, error)
+}
+
+func GenerateKey(kt KeyType) (PrivateKey, error) {
+	if kt == Ed25519 {
+		_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return ed25519PrivateKey(privateKey), nil
+	}
+	if kt == Secp256k1 {
+		privateKey, err := secp256k1.GeneratePrivateKey()
+		if err != nil {
+			return nil, err
+		}
+		return &secp256k1PrivateKey{privateKey: privateKey}, nil
+	}
+
+	c, err := kt.curve()
+	if err != nil {
+		return nil, err
+	}
+	privateKey, err := ecdsa.GenerateKey(c, rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &ecdsaPrivateKey{privateKey: privateKey, keyType: kt}, nil
+}
+
+// NewECDSAPublicKey wraps a P-256 key of crypto/ecdsa.
+func NewECDSAPublicKey(pKey *ecdsa.PublicKey) PublicKey {
+	return &ecdsaPublicKey{publicKey: pKey, keyType: P256}
+}
+
+// NewECDSAPrivateKey wraps a P-256 key of crypto/ecdsa.
+func NewECDSAPrivateKey(pKey *ecdsa.PrivateKey) PrivateKey {
+	return &ecdsaPrivateKey{privateKey: pKey, keyType: P256}
+}
+
+// Public key strings are the key type tag followed by the raw key, in hex.
+// Untagged 128 character strings are read as P-256 keys.
+func GeneratePublicKeyString(pKey PublicKey) string {
+	return fmt.Sprintf("%02x%x", byte(pKey.KeyType()), pKey.Bytes())
+}
+
+func GeneratePrivateKeyString(pKey PrivateKey) string {
+	return fmt.Sprintf("%x", pKey.Bytes())
+}
+
+func PublicKeyFromString(s string) (PublicKey, error) {
+	kt := P256
+	if len(s) != 128 {
+		if len(s) < 2 {
+			return nil, fmt.Errorf("invalid public key length %d", len(s))
+		}
+		t, err := hex.DecodeString(s[:2])
+		if err != nil {
+			return nil, err
+		}
+		kt, s = KeyType(t[0]), s[2:]
+	}
+
+	if kt == Ed25519 {
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		if len(b) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid ed25519 public key length %d", len(b))
+		}
+		return ed25519PublicKey(b), nil
+	}
+	if kt == Secp256k1 {
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		return parseSecp256k1PublicKey(b)
+	}
+
+	c, err := kt.curve()
+	if err != nil {
+		return nil, err
+	}
+	x, y, err := StringToBigIntTupple(s)
+	if err != nil {
+		return nil, err
+	}
+	if !c.IsOnCurve(&x, &y) {
+		return nil, fmt.Errorf("public key is not on the %s curve", kt)
+	}
+	return &ecdsaPublicKey{
+		publicKey: &ecdsa.PublicKey{Curve: c, X: &x, Y: &y},
+		keyType:   kt,
+	}, nil
+}
+
+func PrivateKeyFromString(s string, pubKey PublicKey) (PrivateKey, error) {
+	b, err := hex.DecodeString(s[:])
+	if err != nil {
+		return nil, err
+	}
+
+	if pubKey.KeyType() == Ed25519 {
+		if len(b) != ed25519.SeedSize {
+			return nil, fmt.Errorf("invalid ed25519 private key length %d", len(b))
+		}
+		return ed25519PrivateKey(ed25519.NewKeyFromSeed(b)), nil
+	}
+	if pubKey.KeyType() == Secp256k1 {
+		if len(b) != 32 {
+			return nil, fmt.Errorf("invalid secp256k1 private key length %d", len(b))
+		}
+		return &secp256k1PrivateKey{privateKey: secp256k1.PrivKeyFromBytes(b)}, nil
+	}
+
+	pKey, ok := pubKey.(*ecdsaPublicKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported public key type %T", pubKey)
+	}
+	var bi big.Int
+	bi.SetBytes(b)
+	return &ecdsaPrivateKey{
+		privateKey: &ecdsa.PrivateKey{
+			PublicKey: *pKey.publicKey,
+			D:         &bi,
+		},
+		keyType: pKey.keyType,
+	}, nil
+}
+
+func ParseSignature(s string, kt KeyType) (*Signature, error) {
+	x, y, err := StringToBigIntTupple(s)
+	if err != nil {
+		return nil, err
+	}
+	sig := &Signature{
+		R: &x,
+		S: &y,
+	}
+
+	if kt == Ed25519 {
+		// S is a little-endian scalar that must be reduced modulo the group
+		// order, R is an encoded point.
+		le := sig.S.FillBytes(make([]byte, 32))
+		for i, j := 0, len(le)-1; i < j; i, j = i+1, j-1 {
+			le[i], le[j] = le[j], le[i]
+		}
+		l, _ := new(big.Int).SetString("1000000000000000000000000000000014def9dea2f79cd65812631a5cf5d3ed", 16)
+		if new(big.Int).SetBytes(le).Cmp(l) >= 0 {
+			return nil, fmt.Errorf("signature values out of range")
+		}
+		return sig, nil
+	}
+
+	c, err := kt.curve()
+	if err != nil {
+		return nil, err
+	}
+	if !sig.inRange(c) {
+		return nil, fmt.Errorf("signature values out of range")
+	}
+	return sig, nil
+}
+
+type ecdsaPublicKey struct {
+	publicKey *ecdsa.PublicKey
+	keyType   KeyType
+}
+
+func (k *ecdsaPublicKey) KeyType() KeyType {
+	return k.keyType
+}
+
+func (k *ecdsaPublicKey) Bytes() []byte {
+	b := make([]byte, 64)
+	k.publicKey.X.FillBytes(b[:32])
+	k.publicKey.Y.FillBytes(b[32:])
+	return b
+}
+
+func (k *ecdsaPublicKey) Verify(hash []byte, s *Signature) bool {
+	return Verify(k.publicKey, hash, s)
+}
+
+type ecdsaPrivateKey struct {
+	privateKey *ecdsa.PrivateKey
+	keyType    KeyType
+}
+
+func (k *ecdsaPrivateKey) KeyType() KeyType {
+	return k.keyType
+}
+
+func (k *ecdsaPrivateKey) Bytes() []byte {
+	return k.privateKey.D.FillBytes(make([]byte, 32))
+}
+
+func (k *ecdsaPrivateKey) PublicKey() PublicKey {
+	return &ecdsaPublicKey{publicKey: &k.privateKey.PublicKey, keyType: k.keyType}
+}
+
+func (k *ecdsaPrivateKey) Sign(hash []byte) (*Signature, error) {
+	return Sign(k.privateKey, hash)
+}
+
+type ed25519PublicKey ed25519.PublicKey
+
+func (k ed25519PublicKey) KeyType() KeyType {
+	return Ed25519
+}
+
+func (k ed25519PublicKey) Bytes() []byte {
+	return []byte(k)
+}
+
+func (k ed25519PublicKey) Verify(hash []byte, s *Signature) bool {
+	if s == nil || s.R == nil || s.S == nil || s.R.BitLen() > 256 || s.S.BitLen() > 256 {
+		return false
+	}
+	sig := make([]byte, ed25519.SignatureSize)
+	s.R.FillBytes(sig[:32])
+	s.S.FillBytes(sig[32:])
+	return ed25519.Verify(ed25519.PublicKey(k), hash, sig)
+}
+
+type ed25519PrivateKey ed25519.PrivateKey
+
+func (k ed25519PrivateKey) KeyType() KeyType {
+	return Ed25519
+}
+
+func (k ed25519PrivateKey) Bytes() []byte {
+	return ed25519.PrivateKey(k).Seed()
+}
+
+func (k ed25519PrivateKey) PublicKey() PublicKey {
+	return ed25519PublicKey(ed25519.PrivateKey(k).Public().(ed25519.PublicKey))
+}
+
+// Ed25519 signatures are deterministic and not malleable; the 64 byte
+// signature is carried in the R and S halves of Signature.
+func (k ed25519PrivateKey) Sign(hash []byte) (*Signature, error) {
+	sig := ed25519.Sign(ed25519.PrivateKey(k), hash)
+	return &Signature{
+		R: new(big.Int).SetBytes(sig[:32]),
+		S: new(big.Int).SetBytes(sig[32:]),
+	}, nil
+}
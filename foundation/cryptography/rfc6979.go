@@ -0,0 +1,174 @@
+package cryptography
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+)
+
+// Sign produces a deterministic ECDSA signature (RFC 6979, HMAC-SHA256) with
+// a canonical low S value, so a transaction always has a single valid
+// signature string per key.
+func Sign(privateKey *ecdsa.PrivateKey, hash []byte) (*Signature, error) {
+	c := privateKey.Curve
+	n := c.Params().N
+	if privateKey.D == nil || privateKey.D.Sign() <= 0 || privateKey.D.Cmp(n) >= 0 {
+		return nil, fmt.Errorf("invalid private key")
+	}
+
+	f, err := newScalarField(n)
+	if err != nil {
+		return nil, err
+	}
+	// The key and the nonce only meet constant time arithmetic, e and r are
+	// public.
+	e := hashToInt(hash, c)
+	e.Mod(e, n)
+	d := f.element(privateKey.D)
+	nonce := newRFC6979Nonce(c, privateKey.D, hash)
+	for {
+		k := nonce.next()
+
+		r, _ := c.ScalarBaseMult(k.FillBytes(make([]byte, 32)))
+		r.Mod(r, n)
+		if r.Sign() == 0 {
+			continue
+		}
+
+		// s = (e + r·d)/k
+		sum := f.add(f.element(e), f.mul(f.element(r), d))
+		s := f.int(f.mul(f.inverse(f.element(k)), sum))
+		if s.Sign() == 0 {
+			continue
+		}
+
+		sig := &Signature{R: r, S: s}
+		sig.normalizeS(c)
+		return sig, nil
+	}
+}
+
+// Verify accepts only canonical (low S) signatures.
+func Verify(publicKey *ecdsa.PublicKey, hash []byte, s *Signature) bool {
+	if publicKey == nil || s == nil || !s.inRange(publicKey.Curve) || !s.IsLowS(publicKey.Curve) {
+		return false
+	}
+
+	c := publicKey.Curve
+	n := c.Params().N
+	if publicKey.X == nil || publicKey.Y == nil || !c.IsOnCurve(publicKey.X, publicKey.Y) {
+		return false
+	}
+
+	// u1 = e/s, u2 = r/s and the signature holds if (u1·G + u2·Q).x = r.
+	e := hashToInt(hash, c)
+	w := new(big.Int).ModInverse(s.S, n)
+	u1 := new(big.Int).Mul(e, w)
+	u1.Mod(u1, n)
+	u2 := new(big.Int).Mul(s.R, w)
+	u2.Mod(u2, n)
+
+	x1, y1 := c.ScalarBaseMult(u1.Bytes())
+	x2, y2 := c.ScalarMult(publicKey.X, publicKey.Y, u2.Bytes())
+	x, y := c.Add(x1, y1, x2, y2)
+	if x.Sign() == 0 && y.Sign() == 0 {
+		return false
+	}
+	x.Mod(x, n)
+	return x.Cmp(s.R) == 0
+}
+
+func (s *Signature) IsLowS(c elliptic.Curve) bool {
+	halfN := new(big.Int).Rsh(c.Params().N, 1)
+	return s.S.Cmp(halfN) <= 0
+}
+
+func (s *Signature) normalizeS(c elliptic.Curve) {
+	if !s.IsLowS(c) {
+		s.S = new(big.Int).Sub(c.Params().N, s.S)
+	}
+}
+
+func (s *Signature) inRange(c elliptic.Curve) bool {
+	n := c.Params().N
+	return s.R != nil && s.S != nil &&
+		s.R.Sign() > 0 && s.R.Cmp(n) < 0 &&
+		s.S.Sign() > 0 && s.S.Cmp(n) < 0
+}
+
+type rfc6979Nonce struct {
+	n    *big.Int
+	k, v []byte
+	used bool
+}
+
+func newRFC6979Nonce(c elliptic.Curve, d *big.Int, hash []byte) *rfc6979Nonce {
+	n := c.Params().N
+	rlen := (n.BitLen() + 7) / 8
+
+	// bits2octets(h1): reduce the hash modulo n.
+	z := hashToInt(hash, c)
+	if z.Cmp(n) >= 0 {
+		z.Sub(z, n)
+	}
+	x := d.FillBytes(make([]byte, rlen))
+	h := z.FillBytes(make([]byte, rlen))
+
+	v := make([]byte, sha256.Size)
+	for i := range v {
+		v[i] = 0x01
+	}
+	k := make([]byte, sha256.Size)
+
+	k = mac(k, v, []byte{0x00}, x, h)
+	v = mac(k, v)
+	k = mac(k, v, []byte{0x01}, x, h)
+	v = mac(k, v)
+
+	return &rfc6979Nonce{n: n, k: k, v: v}
+}
+
+func (g *rfc6979Nonce) next() *big.Int {
+	rlen := (g.n.BitLen() + 7) / 8
+	for {
+		if g.used {
+			g.k = mac(g.k, g.v, []byte{0x00})
+			g.v = mac(g.k, g.v)
+		}
+		g.used = true
+
+		var t []byte
+		for len(t) < rlen {
+			g.v = mac(g.k, g.v)
+			t = append(t, g.v...)
+		}
+
+		k := bitsToInt(t, g.n.BitLen())
+		if k.Sign() > 0 && k.Cmp(g.n) < 0 {
+			return k
+		}
+	}
+}
+
+func mac(key []byte, data ...[]byte) []byte {
+	m := hmac.New(sha256.New, key)
+	for _, d := range data {
+		m.Write(d)
+	}
+	return m.Sum(nil)
+}
+
+func hashToInt(hash []byte, c elliptic.Curve) *big.Int {
+	return bitsToInt(hash, c.Params().N.BitLen())
+}
+
+func bitsToInt(b []byte, qlen int) *big.Int {
+	v := new(big.Int).SetBytes(b)
+	if blen := len(b) * 8; blen > qlen {
+		v.Rsh(v, uint(blen-qlen))
+	}
+	return v
+}
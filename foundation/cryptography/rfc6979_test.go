@@ -0,0 +1,164 @@
+package cryptography
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func hexInt(t *testing.T, s string) *big.Int {
+	i, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		t.Fatalf("invalid hex %s", s)
+	}
+	return i
+}
+
+// Test vectors from RFC 6979 appendix A.2.5 (P-256, SHA-256).
+func Test_RFC6979Vectors(t *testing.T) {
+	c := elliptic.P256()
+	privateKey := &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: c,
+			X:     hexInt(t, "60FED4BA255A9D31C961EB74C6356D68C049B8923B61FA6CE669622E60F29FB6"),
+			Y:     hexInt(t, "7903FE1008B8BC99A41AE9E95628BC64F2F1B20C2D7E9F5177A3C294D4462299"),
+		},
+		D: hexInt(t, "C9AFA9D845BA75166B5C215767B1D6934E50C3DB36E89B127B8A622B120F6721"),
+	}
+
+	vectors := []struct {
+		message string
+		k, r, s string
+	}{
+		{
+			message: "sample",
+			k:       "A6E3C57DD01ABE90086538398355DD4C3B17AA873382B0F24D6129493D8AAD60",
+			r:       "EFD48B2AACB6A8FD1140DD9CD45E81D69D2C877B56AAF991C34D0EA84EAF3716",
+			s:       "F7CB1C942D657C41D436C7A1B6E29F65F3E900DBB9AFF4064DC4AB2F843ACDA8",
+		},
+		{
+			message: "test",
+			k:       "D16B6AE827F17175E040871A1C7EC3500192C4C92677336EC2537ACAEE0008E0",
+			r:       "F1ABB023518351CD71D881567B1EA663ED3EFCF6C5132B354F28D3B0B7D38367",
+			s:       "019F4113742A2B14BD25926B49C649155F267E60D3814B4C0CC84250E46F0083",
+		},
+	}
+
+	for _, v := range vectors {
+		h := sha256.Sum256([]byte(v.message))
+
+		k := newRFC6979Nonce(c, privateKey.D, h[:]).next()
+		if k.Cmp(hexInt(t, v.k)) != 0 {
+			t.Errorf("%s: wrong nonce %x", v.message, k)
+		}
+
+		sig, err := Sign(privateKey, h[:])
+		if err != nil {
+			t.Errorf("%s: failed to Sign with err: %v", v.message, err)
+			continue
+		}
+		if sig.R.Cmp(hexInt(t, v.r)) != 0 {
+			t.Errorf("%s: wrong r %x", v.message, sig.R)
+		}
+		// The RFC value is normalized to the lower of s and n - s.
+		expectedS := hexInt(t, v.s)
+		if !(&Signature{R: sig.R, S: expectedS}).IsLowS(c) {
+			expectedS.Sub(c.Params().N, expectedS)
+		}
+		if sig.S.Cmp(expectedS) != 0 {
+			t.Errorf("%s: wrong s %x", v.message, sig.S)
+		}
+
+		again, err := Sign(privateKey, h[:])
+		if err != nil || again.String() != sig.String() {
+			t.Errorf("%s: signature is not deterministic", v.message)
+		}
+
+		if !Verify(&privateKey.PublicKey, h[:], sig) {
+			t.Errorf("%s: low S signature rejected", v.message)
+		}
+		highS := &Signature{R: sig.R, S: new(big.Int).Sub(c.Params().N, sig.S)}
+		if Verify(&privateKey.PublicKey, h[:], highS) {
+			t.Errorf("%s: high S signature accepted", v.message)
+		}
+	}
+}
+
+// Deterministic secp256k1 signatures with the private key 1, as published for
+// RFC 6979 implementations (SHA-256, low S).
+func Test_RFC6979Secp256k1Vectors(t *testing.T) {
+	publicKey, err := PublicKeyFromString(fmt.Sprintf("%02x%s%s", byte(Secp256k1),
+		"79BE667EF9DCBBAC55A06295CE870B07029BFCDB2DCE28D959F2815B16F81798",
+		"483ADA7726A3C4655DA4FBFC0E1108A8FD17B448A68554199C47D08FFB10D4B8"))
+	if err != nil {
+		t.Fatalf("failed to PublicKeyFromString with err: %v", err)
+	}
+	privateKey, err := PrivateKeyFromString(strings.Repeat("00", 31)+"01", publicKey)
+	if err != nil {
+		t.Fatalf("failed to PrivateKeyFromString with err: %v", err)
+	}
+
+	vectors := []struct {
+		message string
+		r, s    string
+	}{
+		{
+			message: "Satoshi Nakamoto",
+			r:       "934B1EA10A4B3C1757E2B0C017D0B6143CE3C9A7E6A4A49860D7A6AB210EE3D8",
+			s:       "2442CE9D2B916064108014783E923EC36B49743E2FFA1C4496F01A512AAFD9E5",
+		},
+		{
+			message: "All those moments will be lost in time, like tears in rain. Time to die...",
+			r:       "8600DBD41E348FE5C9465AB92D23E3DB8B98B873BEECD930736488696438CB6B",
+			s:       "547FE64427496DB33BF66019DACBF0039C04199ABB0122918601DB38A72CFC21",
+		},
+	}
+
+	n := hexInt(t, "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEBAAEDCE6AF48A03BBFD25E8CD0364141")
+	for _, v := range vectors {
+		h := sha256.Sum256([]byte(v.message))
+		sig, err := privateKey.Sign(h[:])
+		if err != nil {
+			t.Errorf("%s: failed to Sign with err: %v", v.message, err)
+			continue
+		}
+		if sig.R.Cmp(hexInt(t, v.r)) != 0 || sig.S.Cmp(hexInt(t, v.s)) != 0 {
+			t.Errorf("%s: wrong signature %s", v.message, sig)
+		}
+		if !publicKey.Verify(h[:], sig) {
+			t.Errorf("%s: low S signature rejected", v.message)
+		}
+		highS := &Signature{R: sig.R, S: new(big.Int).Sub(n, sig.S)}
+		if publicKey.Verify(h[:], highS) {
+			t.Errorf("%s: high S signature accepted", v.message)
+		}
+	}
+}
+
+func Test_SignatureFromStringValidation(t *testing.T) {
+	n := elliptic.P256().Params().N
+	valid := (&Signature{R: big.NewInt(1), S: big.NewInt(2)}).String()
+	if _, err := SignatureFromString(valid); err != nil {
+		t.Errorf("failed to parse valid signature with err: %v", err)
+	}
+
+	invalid := []string{
+		"",
+		valid[:127],
+		valid + "00",
+		strings.Repeat("zz", 64),
+		(&Signature{R: big.NewInt(0), S: big.NewInt(2)}).String(),
+		(&Signature{R: big.NewInt(1), S: big.NewInt(0)}).String(),
+		(&Signature{R: n, S: big.NewInt(2)}).String(),
+		(&Signature{R: big.NewInt(1), S: n}).String(),
+	}
+	for _, s := range invalid {
+		if _, err := SignatureFromString(s); err == nil {
+			t.Errorf("expected error for signature %q", s)
+		}
+	}
+}
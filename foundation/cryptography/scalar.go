@@ -0,0 +1,147 @@
+package cryptography
+
+import (
+	"fmt"
+	"math/big"
+	"math/bits"
+)
+
+// scalarField does arithmetic modulo the order of a curve of at most 256 bits
+// in constant time, for the nonces and keys that must not leak through timing.
+// Elements are little endian limbs in Montgomery form, always below n.
+type scalarField struct {
+	n   [4]uint64
+	n0  uint64    // -n⁻¹ mod 2⁶⁴
+	rr  [4]uint64 // 2⁵¹² mod n, turns an element into Montgomery form
+	one [4]uint64 // 1 in Montgomery form
+	exp []uint    // bits of n - 2 from the top, the Fermat inverse exponent
+}
+
+func newScalarField(n *big.Int) (*scalarField, error) {
+	if n.BitLen() > 256 || n.Bit(0) == 0 {
+		return nil, fmt.Errorf("unsupported curve order of %d bits", n.BitLen())
+	}
+	f := &scalarField{n: limbs(n)}
+
+	// Newton's iteration doubles the correct low bits of n⁻¹ mod 2⁶⁴.
+	inv := f.n[0]
+	for i := 0; i < 5; i++ {
+		inv *= 2 - f.n[0]*inv
+	}
+	f.n0 = -inv
+
+	rr := new(big.Int).Lsh(big.NewInt(1), 512)
+	f.rr = limbs(rr.Mod(rr, n))
+	f.one = f.toMont([4]uint64{1})
+
+	e := new(big.Int).Sub(n, big.NewInt(2))
+	for i := e.BitLen() - 1; i >= 0; i-- {
+		f.exp = append(f.exp, e.Bit(i))
+	}
+	return f, nil
+}
+
+// limbs reads a value below 2²⁵⁶ through a fixed length encoding.
+func limbs(x *big.Int) [4]uint64 {
+	b := x.FillBytes(make([]byte, 32))
+	var l [4]uint64
+	for i := range l {
+		for _, c := range b[32-8*(i+1) : 32-8*i] {
+			l[i] = l[i]<<8 | uint64(c)
+		}
+	}
+	return l
+}
+
+// element converts x, which must be below n, into Montgomery form.
+func (f *scalarField) element(x *big.Int) [4]uint64 {
+	return f.toMont(limbs(x))
+}
+
+// int converts a back out of Montgomery form.
+func (f *scalarField) int(a [4]uint64) *big.Int {
+	l := f.mul(a, [4]uint64{1})
+	b := make([]byte, 32)
+	for i, v := range l {
+		for j := 0; j < 8; j++ {
+			b[31-8*i-j] = byte(v >> (8 * j))
+		}
+	}
+	return new(big.Int).SetBytes(b)
+}
+
+func (f *scalarField) toMont(a [4]uint64) [4]uint64 {
+	return f.mul(a, f.rr)
+}
+
+// mul returns a·b·2⁻²⁵⁶ mod n by word by word Montgomery multiplication.
+func (f *scalarField) mul(a, b [4]uint64) [4]uint64 {
+	var t [6]uint64
+	for i := 0; i < 4; i++ {
+		var c, cc uint64
+		for j := 0; j < 4; j++ {
+			hi, lo := bits.Mul64(a[j], b[i])
+			lo, cc = bits.Add64(lo, t[j], 0)
+			hi += cc
+			lo, cc = bits.Add64(lo, c, 0)
+			hi += cc
+			t[j], c = lo, hi
+		}
+		t[4], cc = bits.Add64(t[4], c, 0)
+		t[5] = cc
+
+		m := t[0] * f.n0
+		hi, lo := bits.Mul64(m, f.n[0])
+		_, cc = bits.Add64(lo, t[0], 0)
+		c = hi + cc
+		for j := 1; j < 4; j++ {
+			hi, lo = bits.Mul64(m, f.n[j])
+			lo, cc = bits.Add64(lo, t[j], 0)
+			hi += cc
+			lo, cc = bits.Add64(lo, c, 0)
+			hi += cc
+			t[j-1], c = lo, hi
+		}
+		t[3], cc = bits.Add64(t[4], c, 0)
+		t[4] = t[5] + cc
+	}
+	return f.reduce([4]uint64{t[0], t[1], t[2], t[3]}, t[4])
+}
+
+func (f *scalarField) add(a, b [4]uint64) [4]uint64 {
+	var t [4]uint64
+	var c uint64
+	for i := range t {
+		t[i], c = bits.Add64(a[i], b[i], c)
+	}
+	return f.reduce(t, c)
+}
+
+// reduce subtracts n once from the 257 bit value carry·2²⁵⁶ + t, which must
+// be below 2n, without branching on it.
+func (f *scalarField) reduce(t [4]uint64, carry uint64) [4]uint64 {
+	var d [4]uint64
+	var b uint64
+	for i := range d {
+		d[i], b = bits.Sub64(t[i], f.n[i], b)
+	}
+	_, b = bits.Sub64(carry, 0, b)
+	keep := -b
+	for i := range d {
+		d[i] = t[i]&keep | d[i]&^keep
+	}
+	return d
+}
+
+// inverse returns a⁻¹ as a^(n-2). Only the public exponent decides the
+// sequence of operations.
+func (f *scalarField) inverse(a [4]uint64) [4]uint64 {
+	z := f.one
+	for _, bit := range f.exp {
+		z = f.mul(z, z)
+		if bit == 1 {
+			z = f.mul(z, a)
+		}
+	}
+	return z
+}
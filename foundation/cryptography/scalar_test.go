@@ -0,0 +1,52 @@
+package cryptography
+
+import (
+	"crypto/elliptic"
+	"crypto/rand"
+	"math/big"
+	"testing"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+func Test_ScalarField(t *testing.T) {
+	for _, c := range []elliptic.Curve{elliptic.P256(), secp256k1.S256()} {
+		n := c.Params().N
+		f, err := newScalarField(n)
+		if err != nil {
+			t.Fatalf("Failed to instantiate a scalar field with err: %s", err)
+		}
+
+		edges := []*big.Int{big.NewInt(1), big.NewInt(2), new(big.Int).Sub(n, big.NewInt(1))}
+		for i := 0; i < 64; i++ {
+			a, b := edges[i%len(edges)], edges[(i+1)%len(edges)]
+			if i >= len(edges) {
+				a, _ = rand.Int(rand.Reader, n)
+				b, _ = rand.Int(rand.Reader, n)
+			}
+			x, y := f.element(a), f.element(b)
+
+			if got := f.int(x); got.Cmp(a) != 0 {
+				t.Errorf("Expected %x back, got: %x", a, got)
+			}
+			sum := new(big.Int).Add(a, b)
+			if got := f.int(f.add(x, y)); got.Cmp(sum.Mod(sum, n)) != 0 {
+				t.Errorf("Expected %x + %x = %x, got: %x", a, b, sum, got)
+			}
+			product := new(big.Int).Mul(a, b)
+			if got := f.int(f.mul(x, y)); got.Cmp(product.Mod(product, n)) != 0 {
+				t.Errorf("Expected %x · %x = %x, got: %x", a, b, product, got)
+			}
+			if a.Sign() == 0 {
+				continue
+			}
+			if got := f.int(f.inverse(x)); got.Cmp(new(big.Int).ModInverse(a, n)) != 0 {
+				t.Errorf("Expected the inverse of %x, got: %x", a, got)
+			}
+		}
+	}
+
+	if _, err := newScalarField(elliptic.P384().Params().N); err == nil {
+		t.Errorf("Expected an order above 256 bits to be refused")
+	}
+}
@@ -0,0 +1,78 @@
+package cryptography
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+// secp256k1 keys are backed by the dcrd implementation, whose scalar and
+// field arithmetic runs in constant time. Its signatures are deterministic
+// per RFC 6979 with a low S value, the same as Sign produces for P-256.
+
+type secp256k1PublicKey struct {
+	publicKey *secp256k1.PublicKey
+}
+
+// parseSecp256k1PublicKey reads the raw 64 byte X and Y of a key.
+func parseSecp256k1PublicKey(b []byte) (*secp256k1PublicKey, error) {
+	if len(b) != 64 {
+		return nil, fmt.Errorf("invalid secp256k1 public key length %d", len(b))
+	}
+	publicKey, err := secp256k1.ParsePubKey(append([]byte{0x04}, b...))
+	if err != nil {
+		return nil, fmt.Errorf("public key is not on the %s curve: %w", Secp256k1, err)
+	}
+	return &secp256k1PublicKey{publicKey: publicKey}, nil
+}
+
+func (k *secp256k1PublicKey) KeyType() KeyType {
+	return Secp256k1
+}
+
+func (k *secp256k1PublicKey) Bytes() []byte {
+	return k.publicKey.SerializeUncompressed()[1:]
+}
+
+// Verify accepts only canonical (low S) signatures.
+func (k *secp256k1PublicKey) Verify(hash []byte, s *Signature) bool {
+	if s == nil || s.R == nil || s.S == nil || s.R.Sign() <= 0 || s.S.Sign() <= 0 || s.R.BitLen() > 256 || s.S.BitLen() > 256 {
+		return false
+	}
+	var r, sv secp256k1.ModNScalar
+	if r.SetByteSlice(s.R.Bytes()) || sv.SetByteSlice(s.S.Bytes()) || sv.IsOverHalfOrder() {
+		return false
+	}
+	return ecdsa.NewSignature(&r, &sv).Verify(hash, k.publicKey)
+}
+
+type secp256k1PrivateKey struct {
+	privateKey *secp256k1.PrivateKey
+}
+
+func (k *secp256k1PrivateKey) KeyType() KeyType {
+	return Secp256k1
+}
+
+func (k *secp256k1PrivateKey) Bytes() []byte {
+	return k.privateKey.Serialize()
+}
+
+func (k *secp256k1PrivateKey) PublicKey() PublicKey {
+	return &secp256k1PublicKey{publicKey: k.privateKey.PubKey()}
+}
+
+func (k *secp256k1PrivateKey) Sign(hash []byte) (*Signature, error) {
+	if k.privateKey.Key.IsZero() {
+		return nil, fmt.Errorf("invalid private key")
+	}
+	sig := ecdsa.Sign(k.privateKey, hash)
+	r, s := sig.R(), sig.S()
+	rb, sb := r.Bytes(), s.Bytes()
+	return &Signature{
+		R: new(big.Int).SetBytes(rb[:]),
+		S: new(big.Int).SetBytes(sb[:]),
+	}, nil
+}
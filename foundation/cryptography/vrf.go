@@ -0,0 +1,155 @@
+package cryptography
+
+import (
+	"crypto/elliptic"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// The VRF is ECVRF-P256-SHA256-TAI of RFC 9381. A proof shows that its output,
+// beta, was computed from the input with the private key of a public key. For
+// a given key and input there is only one valid proof, so unlike an ECDSA
+// signature a prover can not pick between several outputs.
+
+// VRFProofSize is the length of a proof: the point Gamma, compressed, the
+// challenge c and the scalar s.
+const VRFProofSize = 33 + 16 + 32
+
+const vrfSuite = 0x01
+
+var ErrInvalidVRFProof = errors.New("invalid vrf proof")
+
+// VRFProve returns the proof of the output of privateKey for alpha. Only P-256
+// keys are supported.
+func VRFProve(privateKey PrivateKey, alpha []byte) ([]byte, error) {
+	k, ok := privateKey.(*ecdsaPrivateKey)
+	if !ok || k.keyType != P256 {
+		return nil, fmt.Errorf("vrf needs a %s key, got %s", P256, privateKey.KeyType())
+	}
+	c := k.privateKey.Curve
+	q := c.Params().N
+	x := k.privateKey.D
+	if x == nil || x.Sign() <= 0 || x.Cmp(q) >= 0 {
+		return nil, fmt.Errorf("invalid private key")
+	}
+
+	xb := x.FillBytes(make([]byte, 32))
+	yx, yy := c.ScalarBaseMult(xb)
+	hx, hy := vrfEncodeToCurve(c, yx, yy, alpha)
+	gx, gy := c.ScalarMult(hx, hy, xb)
+
+	hString := elliptic.MarshalCompressed(c, hx, hy)
+	hash := sha256.Sum256(hString)
+	nonce := newRFC6979Nonce(c, x, hash[:]).next()
+	nb := nonce.FillBytes(make([]byte, 32))
+	ux, uy := c.ScalarBaseMult(nb)
+	vx, vy := c.ScalarMult(hx, hy, nb)
+
+	ch := vrfChallenge(c, yx, yy, hx, hy, gx, gy, ux, uy, vx, vy)
+	f, err := newScalarField(q)
+	if err != nil {
+		return nil, err
+	}
+	s := f.int(f.add(f.mul(f.element(ch), f.element(x)), f.element(nonce)))
+
+	proof := make([]byte, 0, VRFProofSize)
+	proof = append(proof, elliptic.MarshalCompressed(c, gx, gy)...)
+	proof = append(proof, ch.FillBytes(make([]byte, 16))...)
+	return append(proof, s.FillBytes(make([]byte, 32))...), nil
+}
+
+// VRFVerify checks proof for publicKey and alpha and returns the output.
+func VRFVerify(publicKey PublicKey, alpha, proof []byte) ([]byte, error) {
+	k, ok := publicKey.(*ecdsaPublicKey)
+	if !ok || k.keyType != P256 {
+		return nil, fmt.Errorf("vrf needs a %s key, got %s", P256, publicKey.KeyType())
+	}
+	c := k.publicKey.Curve
+	q := c.Params().N
+	yx, yy := k.publicKey.X, k.publicKey.Y
+	if yx == nil || yy == nil || !c.IsOnCurve(yx, yy) {
+		return nil, ErrInvalidVRFProof
+	}
+	gx, gy, ch, s, err := vrfDecodeProof(c, proof)
+	if err != nil {
+		return nil, err
+	}
+
+	hx, hy := vrfEncodeToCurve(c, yx, yy, alpha)
+	// U = s*B - c*Y and V = s*H - c*Gamma, the negation taken on the scalar.
+	negC := new(big.Int).Sub(q, ch).Bytes()
+	sbx, sby := c.ScalarBaseMult(s.Bytes())
+	cyx, cyy := c.ScalarMult(yx, yy, negC)
+	ux, uy := c.Add(sbx, sby, cyx, cyy)
+	shx, shy := c.ScalarMult(hx, hy, s.Bytes())
+	cgx, cgy := c.ScalarMult(gx, gy, negC)
+	vx, vy := c.Add(shx, shy, cgx, cgy)
+
+	if vrfChallenge(c, yx, yy, hx, hy, gx, gy, ux, uy, vx, vy).Cmp(ch) != 0 {
+		return nil, ErrInvalidVRFProof
+	}
+	return vrfProofToHash(c, gx, gy), nil
+}
+
+// VRFHash returns the output of proof without checking it.
+func VRFHash(proof []byte) ([]byte, error) {
+	c := elliptic.P256()
+	gx, gy, _, _, err := vrfDecodeProof(c, proof)
+	if err != nil {
+		return nil, err
+	}
+	return vrfProofToHash(c, gx, gy), nil
+}
+
+func vrfDecodeProof(c elliptic.Curve, proof []byte) (gx, gy, ch, s *big.Int, err error) {
+	if len(proof) != VRFProofSize {
+		return nil, nil, nil, nil, fmt.Errorf("%w: length %d", ErrInvalidVRFProof, len(proof))
+	}
+	gx, gy = elliptic.UnmarshalCompressed(c, proof[:33])
+	if gx == nil {
+		return nil, nil, nil, nil, fmt.Errorf("%w: gamma is not on the curve", ErrInvalidVRFProof)
+	}
+	ch = new(big.Int).SetBytes(proof[33:49])
+	s = new(big.Int).SetBytes(proof[49:])
+	if s.Cmp(c.Params().N) >= 0 {
+		return nil, nil, nil, nil, fmt.Errorf("%w: s out of range", ErrInvalidVRFProof)
+	}
+	return gx, gy, ch, s, nil
+}
+
+// vrfEncodeToCurve hashes alpha, salted with the public key, to a point by
+// try and increment: the first counter whose hash is the x of a point wins.
+func vrfEncodeToCurve(c elliptic.Curve, yx, yy *big.Int, alpha []byte) (*big.Int, *big.Int) {
+	pk := elliptic.MarshalCompressed(c, yx, yy)
+	for ctr := 0; ; ctr++ {
+		h := sha256.New()
+		h.Write([]byte{vrfSuite, 0x01})
+		h.Write(pk)
+		h.Write(alpha)
+		h.Write([]byte{byte(ctr), 0x00})
+		if hx, hy := elliptic.UnmarshalCompressed(c, append([]byte{0x02}, h.Sum(nil)...)); hx != nil {
+			return hx, hy
+		}
+	}
+}
+
+// vrfChallenge is the hash of the points of a proof, cut to 16 bytes.
+func vrfChallenge(c elliptic.Curve, points ...*big.Int) *big.Int {
+	h := sha256.New()
+	h.Write([]byte{vrfSuite, 0x02})
+	for i := 0; i < len(points); i += 2 {
+		h.Write(elliptic.MarshalCompressed(c, points[i], points[i+1]))
+	}
+	h.Write([]byte{0x00})
+	return new(big.Int).SetBytes(h.Sum(nil)[:16])
+}
+
+func vrfProofToHash(c elliptic.Curve, gx, gy *big.Int) []byte {
+	h := sha256.New()
+	h.Write([]byte{vrfSuite, 0x03})
+	h.Write(elliptic.MarshalCompressed(c, gx, gy))
+	h.Write([]byte{0x00})
+	return h.Sum(nil)
+}
@@ -0,0 +1,96 @@
+package cryptography
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+// Test vectors from RFC 9381 appendix B.1 (ECVRF-P256-SHA256-TAI).
+func Test_VRFVectors(t *testing.T) {
+	c := elliptic.P256()
+	privateKey := &ecdsa.PrivateKey{D: hexInt(t, "c9afa9d845ba75166b5c215767b1d6934e50c3db36e89b127b8a622b120f6721")}
+	privateKey.Curve = c
+	privateKey.X, privateKey.Y = c.ScalarBaseMult(privateKey.D.Bytes())
+	key := NewECDSAPrivateKey(privateKey)
+
+	vectors := []struct {
+		alpha string
+		pi    string
+		beta  string
+	}{
+		{
+			alpha: "sample",
+			pi:    "035b5c726e8c0e2c488a107c600578ee75cb702343c153cb1eb8dec77f4b5071b4a53f0a46f018bc2c56e58d383f2305e0975972c26feea0eb122fe7893c15af376b33edf7de17c6ea056d4d82de6bc02f",
+			beta:  "a3ad7b0ef73d8fc6655053ea22f9bede8c743f08bbed3d38821f0e16474b505e",
+		},
+		{
+			alpha: "test",
+			pi:    "034dac60aba508ba0c01aa9be80377ebd7562c4a52d74722e0abae7dc3080ddb56c19e067b15a8a8174905b13617804534214f935b94c2287f797e393eb0816969d864f37625b443f30f1a5a33f2b3c854",
+			beta:  "a284f94ceec2ff4b3794629da7cbafa49121972671b466cab4ce170aa365f26d",
+		},
+	}
+	for _, v := range vectors {
+		proof, err := VRFProve(key, []byte(v.alpha))
+		if err != nil {
+			t.Fatalf("Failed to VRFProve with err: %s", err)
+		}
+		if hex.EncodeToString(proof) != v.pi {
+			t.Errorf("%s: expected proof %s, got %x", v.alpha, v.pi, proof)
+		}
+		beta, err := VRFVerify(key.PublicKey(), []byte(v.alpha), proof)
+		if err != nil {
+			t.Fatalf("%s: failed to VRFVerify with err: %s", v.alpha, err)
+		}
+		if hex.EncodeToString(beta) != v.beta {
+			t.Errorf("%s: expected output %s, got %x", v.alpha, v.beta, beta)
+		}
+		if hash, err := VRFHash(proof); err != nil || hex.EncodeToString(hash) != v.beta {
+			t.Errorf("%s: expected VRFHash to give the output, got %x with err: %v", v.alpha, hash, err)
+		}
+	}
+}
+
+func Test_VRFVerify(t *testing.T) {
+	key, err := GenerateKey(P256)
+	if err != nil {
+		t.Fatalf("Failed to GenerateKey with err: %s", err)
+	}
+	other, err := GenerateKey(P256)
+	if err != nil {
+		t.Fatalf("Failed to GenerateKey with err: %s", err)
+	}
+	proof, err := VRFProve(key, []byte("seed"))
+	if err != nil {
+		t.Fatalf("Failed to VRFProve with err: %s", err)
+	}
+
+	if _, err := VRFVerify(key.PublicKey(), []byte("other seed"), proof); !errors.Is(err, ErrInvalidVRFProof) {
+		t.Errorf("Expected a proof for another input to be rejected, got: %v", err)
+	}
+	if _, err := VRFVerify(other.PublicKey(), []byte("seed"), proof); !errors.Is(err, ErrInvalidVRFProof) {
+		t.Errorf("Expected a proof of another key to be rejected, got: %v", err)
+	}
+	for _, i := range []int{0, 40, VRFProofSize - 1} {
+		tampered := append([]byte{}, proof...)
+		tampered[i] ^= 0x01
+		if _, err := VRFVerify(key.PublicKey(), []byte("seed"), tampered); !errors.Is(err, ErrInvalidVRFProof) {
+			t.Errorf("Expected a proof changed at byte %d to be rejected, got: %v", i, err)
+		}
+	}
+	if _, err := VRFVerify(key.PublicKey(), []byte("seed"), proof[1:]); !errors.Is(err, ErrInvalidVRFProof) {
+		t.Errorf("Expected a short proof to be rejected, got: %v", err)
+	}
+
+	for _, kt := range []KeyType{Secp256k1, Ed25519} {
+		k, err := GenerateKey(kt)
+		if err != nil {
+			t.Fatalf("Failed to GenerateKey with err: %s", err)
+		}
+		if _, err := VRFProve(k, []byte("seed")); err == nil {
+			t.Errorf("Expected VRFProve to refuse a %s key", kt)
+		}
+	}
+}